@@ -1,15 +1,21 @@
 package api
 
 import (
+	"database/sql"
 	"fmt"
 	requestandreceivedatafrommongodb "financialscraper/RequestAndReceiveDataFromMongoDB"
+	requestandreceivedatafrompostgres "financialscraper/RequestAndReceiveDataFromPostgres"
+	requestandreceivedatafromsqlite "financialscraper/RequestAndReceiveDataFromSQLite"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-// SetupRoutes configures all the routes for the API
-func SetupRoutes(r *gin.Engine, mongoClient *mongo.Client) {
+// SetupRoutes configures all the routes for the API.
+// With sqliteDB the financial statements come from SQLite, with postgresPool the facts loaded into Postgres are served too,
+// the other routes need mongoClient and are left out without it
+func SetupRoutes(r *gin.Engine, mongoClient *mongo.Client, sqliteDB *sql.DB, postgresPool *pgxpool.Pool) {
 	// Enable CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
@@ -29,6 +35,45 @@ func SetupRoutes(r *gin.Engine, mongoClient *mongo.Client) {
 	{
 		// Financial statements endpoint
 		fmt.Println("Registering route: GET /api/:cik")
-		api.GET("/:cik", requestandreceivedatafrommongodb.HandleGetFinancialStatements(mongoClient))
+		if sqliteDB != nil {
+			api.GET("/:cik", requestandreceivedatafromsqlite.HandleGetFinancialStatements(sqliteDB))
+		} else {
+			api.GET("/:cik", requestandreceivedatafrommongodb.HandleGetFinancialStatements(mongoClient))
+		}
+
+		// Trailing twelve months endpoint, from the same database as the financial statements
+		fmt.Println("Registering route: GET /api/:cik/ttm")
+		if sqliteDB != nil {
+			api.GET("/:cik/ttm", requestandreceivedatafromsqlite.HandleGetTrailingTwelveMonths(sqliteDB))
+		} else {
+			api.GET("/:cik/ttm", requestandreceivedatafrommongodb.HandleGetTrailingTwelveMonths(mongoClient))
+		}
+
+		// Financial facts endpoint, the normalized line item values the scraper loads into Postgres
+		if postgresPool != nil {
+			fmt.Println("Registering route: GET /api/:cik/facts")
+			api.GET("/:cik/facts", requestandreceivedatafrompostgres.HandleGetFinancialFacts(postgresPool))
+		}
+
+		if mongoClient == nil {
+			fmt.Println("No MongoDB configured, skipping the review and scrape job routes")
+			return
+		}
+
+		// Balance sheet review queue endpoints
+		fmt.Println("Registering route: GET /api/reviews")
+		api.GET("/reviews", requestandreceivedatafrommongodb.HandleGetBalanceSheetReviews(mongoClient))
+		fmt.Println("Registering route: GET /api/reviews/:cik/:accessionNumber")
+		api.GET("/reviews/:cik/:accessionNumber", requestandreceivedatafrommongodb.HandleGetBalanceSheetReview(mongoClient))
+		fmt.Println("Registering route: PUT /api/reviews/:cik/:accessionNumber/indices")
+		api.PUT("/reviews/:cik/:accessionNumber/indices", requestandreceivedatafrommongodb.HandleSubmitBalanceSheetIndices(mongoClient))
+
+		// Scrape job endpoints, the scraper's workers run the queued jobs
+		fmt.Println("Registering route: POST /api/jobs")
+		api.POST("/jobs", requestandreceivedatafrommongodb.HandleCreateScrapeJob(mongoClient))
+		fmt.Println("Registering route: GET /api/jobs/:id")
+		api.GET("/jobs/:id", requestandreceivedatafrommongodb.HandleGetScrapeJob(mongoClient))
+		fmt.Println("Registering route: GET /api/jobs/:id/events")
+		api.GET("/jobs/:id/events", requestandreceivedatafrommongodb.HandleStreamScrapeJob(mongoClient))
 	}
 }
@@ -0,0 +1,138 @@
+package requestandreceivedatafrommongodb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Balance sheets the scraper couldn't classify are queued in balanceSheetReviews with their rows,
+// a reviewer submits the section boundaries (row indices of the R file) and the scraper uses them on its next combine.
+// The scraper is the one that checks them, a submission it rejects goes back to pending with the reason
+
+// BalanceSheetIndices are the section boundaries of a balance sheet R file, same fields as the scraper's BalanceSheetIndices.
+// A section starts at its heading or its first line item and ends at its total row, the non current sections are derived
+type BalanceSheetIndices struct {
+	AccessionNumber            string `json:"accessionNumber" bson:"accessionNumber"`
+	AssetsStart                int    `json:"assetsStart" bson:"assetsStart"`
+	AssetsEnd                  int    `json:"assetsEnd" bson:"assetsEnd"`
+	LiabilitiesStart           int    `json:"liabilitiesStart" bson:"liabilitiesStart"`
+	LiabilitiesEnd             int    `json:"liabilitiesEnd" bson:"liabilitiesEnd"`
+	EquityStart                int    `json:"equityStart" bson:"equityStart"`
+	EquityEnd                  int    `json:"equityEnd" bson:"equityEnd"`
+	OtherEquityStart           int    `json:"otherEquityStart" bson:"otherEquityStart"`
+	OtherEquityEnd             int    `json:"otherEquityEnd" bson:"otherEquityEnd"`
+	CurrentAssetsStart         int    `json:"currentAssetsStart" bson:"currentAssetsStart"`
+	CurrentAssetsEnd           int    `json:"currentAssetsEnd" bson:"currentAssetsEnd"`
+	NonCurrentAssetsStart      int    `json:"nonCurrentAssetsStart" bson:"nonCurrentAssetsStart"`
+	NonCurrentAssetsEnd        int    `json:"nonCurrentAssetsEnd" bson:"nonCurrentAssetsEnd"`
+	CurrentLiabilitiesStart    int    `json:"currentLiabilitiesStart" bson:"currentLiabilitiesStart"`
+	CurrentLiabilitiesEnd      int    `json:"currentLiabilitiesEnd" bson:"currentLiabilitiesEnd"`
+	NonCurrentLiabilitiesStart int    `json:"nonCurrentLiabilitiesStart" bson:"nonCurrentLiabilitiesStart"`
+	NonCurrentLiabilitiesEnd   int    `json:"nonCurrentLiabilitiesEnd" bson:"nonCurrentLiabilitiesEnd"`
+}
+
+// SubmitBalanceSheetIndicesRequest is the body of PUT /api/reviews/:cik/:accessionNumber/indices
+type SubmitBalanceSheetIndicesRequest struct {
+	Indices    BalanceSheetIndices `json:"indices"`
+	ResolvedBy string              `json:"resolvedBy"`
+}
+
+func getBalanceSheetReviewCollection(client *mongo.Client) *mongo.Collection {
+	return getPublishedCollection(client, "balanceSheetReviewCollection", "balanceSheetReviews")
+}
+
+// GetBalanceSheetReviews returns the queued reviews oldest first, filtered by CIK and status when they are not empty
+func GetBalanceSheetReviews(client *mongo.Client, CIK string, status string) ([]bson.M, error) {
+	filter := bson.M{}
+	if CIK != "" {
+		filter["cik"] = CIK
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := getBalanceSheetReviewCollection(client).Find(context.Background(), filter, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB Find error: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	results := []bson.M{}
+	if err := cursor.All(context.Background(), &results); err != nil {
+		return nil, fmt.Errorf("cursor error: %v", err)
+	}
+	return results, nil
+}
+
+// HandleGetBalanceSheetReviews is the HTTP handler for listing the review queue, ?status=pending by default, ?status= for all
+func HandleGetBalanceSheetReviews(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := c.DefaultQuery("status", "pending")
+
+		results, err := GetBalanceSheetReviews(client, c.Query("cik"), status)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
+
+// HandleGetBalanceSheetReview is the HTTP handler for getting one review with the rows of its balance sheet
+func HandleGetBalanceSheetReview(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := bson.M{"cik": c.Param("cik"), "accessionNumber": c.Param("accessionNumber")}
+
+		var result bson.M
+		err := getBalanceSheetReviewCollection(client).FindOne(context.Background(), filter).Decode(&result)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No review found for this filing"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, result)
+	}
+}
+
+// HandleSubmitBalanceSheetIndices is the HTTP handler for submitting the section boundaries of a queued balance sheet.
+// The review is marked submitted, the scraper checks the indices against the R file on its next combine and resolves it
+func HandleSubmitBalanceSheetIndices(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cik := c.Param("cik")
+		accessionNumber := c.Param("accessionNumber")
+
+		var request SubmitBalanceSheetIndicesRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		indices := request.Indices
+		indices.AccessionNumber = accessionNumber
+		filter := bson.M{"cik": cik, "accessionNumber": accessionNumber}
+		update := bson.M{"$set": bson.M{"status": "submitted", "indices": indices, "resolvedBy": request.ResolvedBy, "updatedAt": time.Now()}}
+		result, err := getBalanceSheetReviewCollection(client).UpdateOne(context.Background(), filter, update)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if result.MatchedCount == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No review found for this filing"})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{"status": "submitted", "indices": indices})
+	}
+}
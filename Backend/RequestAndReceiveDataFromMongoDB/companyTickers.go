@@ -0,0 +1,73 @@
+package requestandreceivedatafrommongodb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// company_tickers.json maps every ticker SEC knows to its CIK, the scraper's FindCIKGivenTicker reads the same file:
+// {"0":{"cik_str":320193,"ticker":"AAPL","title":"Apple Inc."},"1":{...}}
+var companyTickersURL = "https://www.sec.gov/files/company_tickers.json"
+
+// errCompanyTickersUnavailable is returned when company_tickers.json couldn't be downloaded, the request isn't at fault then
+var errCompanyTickersUnavailable = errors.New("company_tickers.json is unavailable")
+
+var (
+	companyTickersMutex sync.Mutex
+	companyCIKsByTicker map[string]string // downloaded once, a failed download is tried again on the next request
+)
+
+// findCIKGivenTicker returns the 10 digit CIK of the ticker, share classes are written with a dash like SEC does, BRK.B is found as BRK-B
+func findCIKGivenTicker(ticker string) (string, error) {
+	companyTickersMutex.Lock()
+	defer companyTickersMutex.Unlock()
+	if companyCIKsByTicker == nil {
+		downloaded, err := downloadCompanyTickers()
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", errCompanyTickersUnavailable, err)
+		}
+		companyCIKsByTicker = downloaded
+	}
+
+	ticker = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(ticker), ".", "-"))
+	CIK, ok := companyCIKsByTicker[ticker]
+	if !ok {
+		return "", fmt.Errorf("ticker %s is not in company_tickers.json", ticker)
+	}
+	return CIK, nil
+}
+
+// downloadCompanyTickers sends the User-Agent SEC asks for, the same one the scraper sends
+func downloadCompanyTickers() (map[string]string, error) {
+	req, err := http.NewRequest("GET", companyTickersURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", fmt.Sprintf("%s - %s (mailto:%s)", os.Getenv("USER_AGENT"), os.Getenv("COMPANY_NAME"), os.Getenv("EMAIL")))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SEC answered %s", resp.Status)
+	}
+
+	var companies map[string]struct {
+		CIK    int64  `json:"cik_str"`
+		Ticker string `json:"ticker"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&companies); err != nil {
+		return nil, err
+	}
+	CIKs := make(map[string]string, len(companies))
+	for _, company := range companies {
+		CIKs[strings.ToUpper(company.Ticker)] = fmt.Sprintf("%010d", company.CIK)
+	}
+	return CIKs, nil
+}
@@ -0,0 +1,21 @@
+package requestandreceivedatafrommongodb
+
+import (
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// getPublishedCollection returns a collection of the database the scraper publishes to, PUBLISHED_DATABASE_NAME or testDatabase2,
+// the same env variables and defaults as the scraper's GetPublishedMongoDBCollectionByName
+func getPublishedCollection(client *mongo.Client, collectionEnvVariable string, defaultCollectionName string) *mongo.Collection {
+	dbName := os.Getenv("PUBLISHED_DATABASE_NAME")
+	if dbName == "" {
+		dbName = "testDatabase2"
+	}
+	collectionName := os.Getenv(collectionEnvVariable)
+	if collectionName == "" {
+		collectionName = defaultCollectionName
+	}
+	return client.Database(dbName).Collection(collectionName)
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"os"
 
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
@@ -13,16 +12,10 @@ import (
 
 // GetFinancialStatementsByCIK queries MongoDB for financial statements matching the given CIK
 func GetFinancialStatementsByCIK(client *mongo.Client, CIK string) ([]bson.M, error) {
-	dbName := "testDatabase2" // Hardcoding the known database name
-	collectionName := os.Getenv("combinedFinancialStatementsCollection")
-	if collectionName == "" {
-		collectionName = "combinedFinancialStatements" // fallback to default
-	}
-
-	collection := client.Database(dbName).Collection(collectionName)
+	collection := getPublishedCollection(client, "combinedFinancialStatementsCollection", "combinedFinancialStatements")
 
 	// Create a filter for documents with matching CIK
-	filter := bson.D{{"cik", CIK}}
+	filter := bson.D{{Key: "cik", Value: CIK}}
 
 	// Query the collection with the CIK filter
 	cursor, err := collection.Find(context.Background(), filter)
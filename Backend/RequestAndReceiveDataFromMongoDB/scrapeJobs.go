@@ -0,0 +1,297 @@
+package requestandreceivedatafrommongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Scrapes are requested by adding a job to the scrapeJobs collection, the scraper's workers (ScraperEngine jobQueue)
+// claim the queued jobs and save the progress of every stage on the job so it can be polled or streamed from here
+
+// ScrapeJobStages are the pipeline stages a job can run, in the order they run
+var ScrapeJobStages = []string{"fetch", "categorize", "parse", "combine"}
+
+// ScrapeJobMaxAttempts is how many times a job is run before it is marked failed, the scraper's DefaultMaxAttempts
+const ScrapeJobMaxAttempts = 3
+
+// ScrapeJobPollInterval is how often the event stream of a job reads the job from Mongo
+var ScrapeJobPollInterval = time.Second
+
+// ScrapeJobProgress is where a running job is, same fields as the scraper's JobProgress
+type ScrapeJobProgress struct {
+	Stage           string `json:"stage,omitempty" bson:"stage,omitempty"`
+	CompletedStages int    `json:"completedStages" bson:"completedStages"`
+	TotalStages     int    `json:"totalStages" bson:"totalStages"`
+	Message         string `json:"message,omitempty" bson:"message,omitempty"`
+}
+
+// ScrapeJobStageResult is how one stage of the last attempt went, Status is "ok", "failed" or "skipped"
+type ScrapeJobStageResult struct {
+	Stage      string `json:"stage" bson:"stage"`
+	Status     string `json:"status" bson:"status"`
+	DurationMs int64  `json:"durationMs" bson:"durationMs"`
+	Error      string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// ScrapeJob is a job of the scraper's queue, same fields as the scraper's Job minus the lease
+type ScrapeJob struct {
+	ID           primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	CIK          string                 `json:"cik" bson:"cik"`
+	Ticker       string                 `json:"ticker,omitempty" bson:"ticker,omitempty"`
+	Stages       []string               `json:"stages,omitempty" bson:"stages,omitempty"`
+	Status       string                 `json:"status" bson:"status"`
+	Attempts     int                    `json:"attempts" bson:"attempts"`
+	MaxAttempts  int                    `json:"maxAttempts" bson:"maxAttempts"`
+	RunAfter     time.Time              `json:"runAfter" bson:"runAfter"`
+	Progress     ScrapeJobProgress      `json:"progress" bson:"progress"`
+	StageResults []ScrapeJobStageResult `json:"stageResults,omitempty" bson:"stageResults,omitempty"`
+	Error        string                 `json:"error,omitempty" bson:"error,omitempty"`
+	RequestedBy  string                 `json:"requestedBy,omitempty" bson:"requestedBy,omitempty"`
+	OpenCompany  string                 `json:"-" bson:"openCompany,omitempty"`
+	CreatedAt    time.Time              `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time              `json:"updatedAt" bson:"updatedAt"`
+	StartedAt    time.Time              `json:"startedAt,omitempty" bson:"startedAt,omitempty"`
+	FinishedAt   time.Time              `json:"finishedAt,omitempty" bson:"finishedAt,omitempty"`
+}
+
+// Finished is true once the job succeeded or failed for good, a failed attempt with attempts left goes back to queued
+func (job ScrapeJob) Finished() bool {
+	return job.Status == "succeeded" || job.Status == "failed"
+}
+
+// CreateScrapeJobRequest is the body of POST /api/jobs, no stages runs all of them
+type CreateScrapeJobRequest struct {
+	CIK         string   `json:"cik"`
+	Ticker      string   `json:"ticker"`
+	Stages      []string `json:"stages"`
+	RequestedBy string   `json:"requestedBy"`
+}
+
+func getScrapeJobCollection(client *mongo.Client) *mongo.Collection {
+	return getPublishedCollection(client, "scrapeJobCollection", "scrapeJobs")
+}
+
+// openScrapeJobIndex is the scraper's OpenJobIndex, unique on openCompany which only queued and running jobs have.
+// Both create it, the name and options have to stay the same or the second one fails
+var openScrapeJobIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "openCompany", Value: 1}},
+	Options: options.Index().SetName("openCompany_unique").SetUnique(true).
+		SetPartialFilterExpression(bson.M{"openCompany": bson.M{"$exists": true}}),
+}
+
+// GetScrapeJob returns the job with the given id, mongo.ErrNoDocuments when there is none
+func GetScrapeJob(client *mongo.Client, id primitive.ObjectID) (ScrapeJob, error) {
+	var job ScrapeJob
+	err := getScrapeJobCollection(client).FindOne(context.Background(), bson.M{"_id": id}).Decode(&job)
+	return job, err
+}
+
+// CreateScrapeJob queues a job for the company the same way the scraper's Enqueue does,
+// a company that already has a queued or running job gets that job back and the bool is false then
+func CreateScrapeJob(client *mongo.Client, request CreateScrapeJobRequest) (ScrapeJob, bool, error) {
+	collection := getScrapeJobCollection(client)
+	if _, err := collection.Indexes().CreateOne(context.Background(), openScrapeJobIndex); err != nil {
+		return ScrapeJob{}, false, fmt.Errorf("MongoDB CreateIndex error: %v", err)
+	}
+
+	totalStages := len(request.Stages)
+	if totalStages == 0 {
+		totalStages = len(ScrapeJobStages)
+	}
+	now := time.Now()
+	job := ScrapeJob{
+		ID:          primitive.NewObjectID(),
+		CIK:         request.CIK,
+		Ticker:      request.Ticker,
+		Stages:      request.Stages,
+		Status:      "queued",
+		MaxAttempts: ScrapeJobMaxAttempts,
+		RunAfter:    now,
+		Progress:    ScrapeJobProgress{TotalStages: totalStages},
+		RequestedBy: request.RequestedBy,
+		OpenCompany: request.CIK,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	// only inserted when the company has no open job, the unique index keeps two requests at the same time from both inserting
+	filter := bson.M{"openCompany": job.OpenCompany}
+	upsertOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var saved ScrapeJob
+	err := collection.FindOneAndUpdate(context.Background(), filter, bson.M{"$setOnInsert": job}, upsertOptions).Decode(&saved)
+	if mongo.IsDuplicateKeyError(err) {
+		err = collection.FindOne(context.Background(), filter).Decode(&saved)
+	}
+	if err != nil {
+		return ScrapeJob{}, false, fmt.Errorf("MongoDB FindOneAndUpdate error: %v", err)
+	}
+	return saved, saved.ID == job.ID, nil
+}
+
+// checkCreateScrapeJobRequest pads the CIK to 10 digits like the combined statements have it, looks the CIK of a ticker up
+// so a company has one open job whether it was asked for by CIK or ticker, and checks the stages here so a typo fails the request and not the job
+func checkCreateScrapeJobRequest(request *CreateScrapeJobRequest) error {
+	request.CIK = strings.TrimSpace(request.CIK)
+	request.Ticker = strings.ToUpper(strings.TrimSpace(request.Ticker))
+	if request.CIK == "" && request.Ticker == "" {
+		return fmt.Errorf("a job needs a cik or a ticker")
+	}
+	if request.CIK != "" {
+		for _, r := range request.CIK {
+			if r < '0' || r > '9' {
+				return fmt.Errorf("cik %q is not a number", request.CIK)
+			}
+		}
+		if len(request.CIK) > 10 {
+			return fmt.Errorf("cik %q is longer than 10 digits", request.CIK)
+		}
+		request.CIK = fmt.Sprintf("%010s", request.CIK)
+	} else {
+		CIK, err := findCIKGivenTicker(request.Ticker)
+		if err != nil {
+			return err
+		}
+		request.CIK = CIK
+	}
+
+	selected := make(map[string]bool)
+	for _, stage := range request.Stages {
+		found := false
+		for _, name := range ScrapeJobStages {
+			if strings.ToLower(stage) == name {
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown stage %q, expected fetch, categorize, parse or combine", stage)
+		}
+		selected[strings.ToLower(stage)] = true
+	}
+	var stages []string
+	for _, name := range ScrapeJobStages {
+		if selected[name] {
+			stages = append(stages, name)
+		}
+	}
+	request.Stages = stages
+	return nil
+}
+
+// HandleCreateScrapeJob is the HTTP handler for requesting a scrape, it answers 202 with a new job
+// or 200 with the job that is already queued or running for the company
+func HandleCreateScrapeJob(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request CreateScrapeJobRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := checkCreateScrapeJobRequest(&request); errors.Is(err, errCompanyTickersUnavailable) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		} else if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		job, created, err := CreateScrapeJob(client, request)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if created {
+			c.JSON(http.StatusAccepted, job)
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// HandleGetScrapeJob is the HTTP handler for getting the status and progress of a job
+func HandleGetScrapeJob(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job id"})
+			return
+		}
+
+		job, err := GetScrapeJob(client, id)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No job found for this id"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, job)
+	}
+}
+
+// HandleStreamScrapeJob is the HTTP handler for the server-sent events of a job. It sends a "progress" event with the job
+// every time the job changes and a "done" event with the job once it succeeded or failed, then closes the stream
+func HandleStreamScrapeJob(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job id"})
+			return
+		}
+
+		job, err := GetScrapeJob(client, id)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No job found for this id"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.Header("Content-Type", "text/event-stream")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("Connection", "keep-alive")
+		c.Header("X-Accel-Buffering", "no") // otherwise a proxy in front holds the events back
+
+		ticker := time.NewTicker(ScrapeJobPollInterval)
+		defer ticker.Stop()
+		var lastUpdatedAt time.Time
+		c.Stream(func(w io.Writer) bool {
+			if job.Finished() {
+				c.SSEvent("done", job)
+				return false
+			}
+			if !job.UpdatedAt.Equal(lastUpdatedAt) {
+				c.SSEvent("progress", job)
+				c.Writer.Flush() // Stream only flushes after the step, which waits for the next poll
+				lastUpdatedAt = job.UpdatedAt
+			}
+
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-ticker.C:
+			}
+
+			job, err = GetScrapeJob(client, id)
+			if err != nil {
+				c.SSEvent("error", gin.H{"error": err.Error()})
+				return false
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package requestandreceivedatafrommongodb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GetTrailingTwelveMonthsByCIK queries MongoDB for the TTM income statement and cash flow statement of the given CIK
+// each doc has cik, financialStatementType (IS or CF), data in the same layout as the combined statements and gaps,
+// the report periods whose TTM could not be built because quarters are missing
+func GetTrailingTwelveMonthsByCIK(client *mongo.Client, CIK string) ([]bson.M, error) {
+	collection := getPublishedCollection(client, "trailingTwelveMonthsCollection", "trailingTwelveMonths")
+
+	cursor, err := collection.Find(context.Background(), bson.D{{Key: "cik", Value: CIK}})
+	if err != nil {
+		return nil, fmt.Errorf("MongoDB Find error: %v", err)
+	}
+	defer cursor.Close(context.Background())
+
+	var results []bson.M
+	if err := cursor.All(context.Background(), &results); err != nil {
+		return nil, fmt.Errorf("cursor error: %v", err)
+	}
+
+	return results, nil
+}
+
+// HandleGetTrailingTwelveMonths is the HTTP handler for getting the TTM series of a CIK
+func HandleGetTrailingTwelveMonths(client *mongo.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cik := c.Param("cik")
+
+		results, err := GetTrailingTwelveMonthsByCIK(client, cik)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(results) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No trailing twelve months data found for this CIK"})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
@@ -0,0 +1,102 @@
+package requestandreceivedatafrompostgres
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FinancialFact is one row of the financial_facts view the scraper's postgres load fills, one value of one line item in one column
+type FinancialFact struct {
+	CIK                    string  `json:"cik"`
+	FinancialStatementType string  `json:"financialStatementType"`
+	Level                  int     `json:"level"`
+	RowIndex               int     `json:"rowIndex"`
+	Heading                string  `json:"heading"`
+	LineItem               string  `json:"lineItem"`
+	ColumnIndex            int     `json:"columnIndex"`
+	AccessionNumber        string  `json:"accessionNumber"`
+	Form                   string  `json:"form"`
+	ReportDate             *string `json:"reportDate"`
+	ReportPeriod           *string `json:"reportPeriod"`
+	DurationMonths         *int    `json:"durationMonths"`
+	ValueSource            string  `json:"valueSource"`
+	FilingDate             *string `json:"filingDate"`
+	Value                  float64 `json:"value"`
+}
+
+// Open connects to POSTGRES_URL, nil when it isn't set. The schema is the scraper's, run go run . postgres migrate there first
+func Open() (*pgxpool.Pool, error) {
+	URL := os.Getenv("POSTGRES_URL")
+	if URL == "" {
+		return nil, nil
+	}
+	pool, err := pgxpool.New(context.Background(), URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := pool.Ping(context.Background()); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to ping Postgres: %v", err)
+	}
+	return pool, nil
+}
+
+// GetFinancialFactsByCIK queries Postgres for the facts of the given CIK in statement order, only of financialStatementType when it isn't empty
+func GetFinancialFactsByCIK(pool *pgxpool.Pool, CIK string, financialStatementType string) ([]FinancialFact, error) {
+	rows, err := pool.Query(context.Background(), `SELECT cik, financial_statement_type, level, row_index, heading, line_item, column_index,
+			accession_number, form, to_char(report_date, 'YYYY-MM-DD'), to_char(report_period, 'YYYY-MM-DD'), duration_months, value_source,
+			to_char(filing_date, 'YYYY-MM-DD'), value::float8
+		FROM financial_facts
+		WHERE cik = $1 AND ($2 = '' OR financial_statement_type = $2)
+		ORDER BY financial_statement_type, row_index, column_index`, CIK, financialStatementType)
+	if err != nil {
+		return nil, fmt.Errorf("Postgres query error: %v", err)
+	}
+	defer rows.Close()
+
+	results := []FinancialFact{}
+	for rows.Next() {
+		var fact FinancialFact
+		err := rows.Scan(&fact.CIK, &fact.FinancialStatementType, &fact.Level, &fact.RowIndex, &fact.Heading, &fact.LineItem, &fact.ColumnIndex,
+			&fact.AccessionNumber, &fact.Form, &fact.ReportDate, &fact.ReportPeriod, &fact.DurationMonths, &fact.ValueSource,
+			&fact.FilingDate, &fact.Value)
+		if err != nil {
+			return nil, fmt.Errorf("Postgres scan error: %v", err)
+		}
+		results = append(results, fact)
+	}
+	return results, rows.Err()
+}
+
+// HandleGetFinancialFacts is the HTTP handler for getting the financial facts of a CIK, ?statement=BS for one statement
+func HandleGetFinancialFacts(pool *pgxpool.Pool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cik := c.Param("cik")
+		statement := strings.ToUpper(c.Query("statement"))
+		switch statement {
+		case "", "BS", "IS", "CF":
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "statement must be BS, IS or CF"})
+			return
+		}
+
+		results, err := GetFinancialFactsByCIK(pool, cik, statement)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(results) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No financial facts found for this CIK"})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
@@ -0,0 +1,101 @@
+package requestandreceivedatafromsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	_ "modernc.org/sqlite"
+)
+
+// CombinedStatement is a row of combined_financial_statements in the JSON shape of the Mongo doc,
+// so StockPage gets the same response from either backend
+type CombinedStatement struct {
+	CIK                    string          `json:"cik"`
+	FinancialStatementType string          `json:"financialStatementType"`
+	Level                  int             `json:"level"`
+	Columns                json.RawMessage `json:"columns"`
+	Data                   json.RawMessage `json:"data"`
+	Provenance             json.RawMessage `json:"provenance"`
+	GeneratedAt            string          `json:"generatedAt"`
+}
+
+// PathFromEnv is SQLITE_PATH or financialData.db in the working directory, the same file the scraper writes
+func PathFromEnv() string {
+	if path := os.Getenv("SQLITE_PATH"); path != "" {
+		return path
+	}
+	return "financialData.db"
+}
+
+// Open opens the database the scraper writes, the schema is the scraper's so a database without
+// combined_financial_statements fails instead of being created here
+func Open(path string) (*sql.DB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no SQLite database at %s, run the scraper first: %v", path, err)
+	}
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	var tableName string
+	err = db.QueryRow(`SELECT name FROM sqlite_master WHERE type = 'table' AND name = 'combined_financial_statements'`).Scan(&tableName)
+	if errors.Is(err, sql.ErrNoRows) {
+		db.Close()
+		return nil, fmt.Errorf("%s has no combined_financial_statements table, run the scraper first", path)
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error opening %s: %v", path, err)
+	}
+	return db, nil
+}
+
+// GetFinancialStatementsByCIK queries SQLite for the combined statements of the given CIK
+func GetFinancialStatementsByCIK(db *sql.DB, CIK string) ([]CombinedStatement, error) {
+	rows, err := db.Query(`SELECT cik, financial_statement_type, level, columns, data, provenance, generated_at
+		FROM combined_financial_statements WHERE cik = ? ORDER BY financial_statement_type`, CIK)
+	if err != nil {
+		return nil, fmt.Errorf("SQLite query error: %v", err)
+	}
+	defer rows.Close()
+
+	var results []CombinedStatement
+	for rows.Next() {
+		var statement CombinedStatement
+		var columns, data, provenance string
+		err := rows.Scan(&statement.CIK, &statement.FinancialStatementType, &statement.Level, &columns, &data, &provenance, &statement.GeneratedAt)
+		if err != nil {
+			return nil, fmt.Errorf("SQLite scan error: %v", err)
+		}
+		statement.Columns = json.RawMessage(columns)
+		statement.Data = json.RawMessage(data)
+		statement.Provenance = json.RawMessage(provenance)
+		results = append(results, statement)
+	}
+	return results, rows.Err()
+}
+
+// HandleGetFinancialStatements is the HTTP handler for getting financial statements out of SQLite
+func HandleGetFinancialStatements(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cik := c.Param("cik")
+
+		results, err := GetFinancialStatementsByCIK(db, cik)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(results) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No financial statements found for this CIK"})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
@@ -0,0 +1,63 @@
+package requestandreceivedatafromsqlite
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrailingTwelveMonths is a row of trailing_twelve_months in the JSON shape of the Mongo doc
+type TrailingTwelveMonths struct {
+	CIK                    string          `json:"cik"`
+	FinancialStatementType string          `json:"financialStatementType"`
+	Data                   json.RawMessage `json:"data"`
+	Gaps                   json.RawMessage `json:"gaps"`
+	UpdatedAt              string          `json:"updatedAt"`
+}
+
+// GetTrailingTwelveMonthsByCIK queries SQLite for the TTM income statement and cash flow statement of the given CIK
+func GetTrailingTwelveMonthsByCIK(db *sql.DB, CIK string) ([]TrailingTwelveMonths, error) {
+	rows, err := db.Query(`SELECT cik, financial_statement_type, data, gaps, updated_at
+		FROM trailing_twelve_months WHERE cik = ? ORDER BY financial_statement_type`, CIK)
+	if err != nil {
+		return nil, fmt.Errorf("SQLite query error: %v", err)
+	}
+	defer rows.Close()
+
+	var results []TrailingTwelveMonths
+	for rows.Next() {
+		var statement TrailingTwelveMonths
+		var data, gaps string
+		err := rows.Scan(&statement.CIK, &statement.FinancialStatementType, &data, &gaps, &statement.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("SQLite scan error: %v", err)
+		}
+		statement.Data = json.RawMessage(data)
+		statement.Gaps = json.RawMessage(gaps)
+		results = append(results, statement)
+	}
+	return results, rows.Err()
+}
+
+// HandleGetTrailingTwelveMonths is the HTTP handler for getting the TTM series of a CIK out of SQLite
+func HandleGetTrailingTwelveMonths(db *sql.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cik := c.Param("cik")
+
+		results, err := GetTrailingTwelveMonthsByCIK(db, cik)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if len(results) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No trailing twelve months data found for this CIK"})
+			return
+		}
+
+		c.JSON(http.StatusOK, results)
+	}
+}
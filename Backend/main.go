@@ -2,13 +2,17 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"os"
 
 	api "financialscraper/API"
+	requestandreceivedatafrompostgres "financialscraper/RequestAndReceiveDataFromPostgres"
+	requestandreceivedatafromsqlite "financialscraper/RequestAndReceiveDataFromSQLite"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/joho/godotenv"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -17,36 +21,40 @@ import (
 
 var mongoClient *mongo.Client
 
-func initMongoDB() error {
-	// Load .env file
-	err := godotenv.Load()
-	if err != nil {
-		return fmt.Errorf("Error loading .env file: %v", err)
-	}
+var sqliteDB *sql.DB
 
-	// Get MongoDB credentials from env
+var postgresPool *pgxpool.Pool
+
+// mongoURIFromEnv is MONGODB_URI, or the Atlas cluster with mongodb_id and mongodb_password, empty when neither is set
+func mongoURIFromEnv() string {
+	if mongoURI := os.Getenv("MONGODB_URI"); mongoURI != "" {
+		return mongoURI
+	}
 	mongoID := os.Getenv("mongodb_id")
 	mongoPassword := os.Getenv("mongodb_password")
+	if mongoID == "" && mongoPassword == "" {
+		return ""
+	}
+	return fmt.Sprintf("mongodb+srv://%s:%s@financialdatasitecluste.scp0c5v.mongodb.net/?retryWrites=true&w=majority",
+		mongoID,
+		mongoPassword)
+}
 
+func initMongoDB(mongoURI string) error {
 	// Use the SetServerAPIOptions() method to set the Stable API version to 1
 	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
 
-	// Construct the MongoDB URI using the provided credentials
-	mongoURI := fmt.Sprintf("mongodb+srv://%s:%s@financialdatasitecluste.scp0c5v.mongodb.net/?retryWrites=true&w=majority",
-		mongoID,
-		mongoPassword)
-
 	opts := options.Client().ApplyURI(mongoURI).SetServerAPIOptions(serverAPI)
 
 	// Create a new client and connect to the server
-	var err2 error
-	mongoClient, err2 = mongo.Connect(context.TODO(), opts)
-	if err2 != nil {
-		return fmt.Errorf("failed to connect to MongoDB: %v", err2)
+	var err error
+	mongoClient, err = mongo.Connect(context.TODO(), opts)
+	if err != nil {
+		return fmt.Errorf("failed to connect to MongoDB: %v", err)
 	}
 
 	// Send a ping to confirm a successful connection
-	if err := mongoClient.Database("admin").RunCommand(context.TODO(), bson.D{{"ping", 1}}).Err(); err != nil {
+	if err := mongoClient.Database("admin").RunCommand(context.TODO(), bson.D{{Key: "ping", Value: 1}}).Err(); err != nil {
 		return fmt.Errorf("failed to ping MongoDB: %v", err)
 	}
 
@@ -55,21 +63,56 @@ func initMongoDB() error {
 }
 
 func main() {
-	// Initialize MongoDB connection
-	if err := initMongoDB(); err != nil {
-		log.Fatal("Failed to connect to MongoDB:", err)
+	// Load .env file
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Error loading .env file: %v\n", err)
 	}
-	defer func() {
-		if err := mongoClient.Disconnect(context.TODO()); err != nil {
-			log.Printf("Error disconnecting from MongoDB: %v\n", err)
+
+	// DATABASE_BACKEND=sqlite serves the financial statements out of the scraper's SQLite file,
+	// Mongo is then only used for the TTM, review and scrape job routes when it is configured
+	switch os.Getenv("DATABASE_BACKEND") {
+	case "", "mongo":
+		if err := initMongoDB(mongoURIFromEnv()); err != nil {
+			log.Fatal("Failed to connect to MongoDB:", err)
 		}
-	}()
+	case "sqlite":
+		var err error
+		sqliteDB, err = requestandreceivedatafromsqlite.Open(requestandreceivedatafromsqlite.PathFromEnv())
+		if err != nil {
+			log.Fatal("Failed to open SQLite:", err)
+		}
+		defer sqliteDB.Close()
+		if mongoURI := mongoURIFromEnv(); mongoURI != "" {
+			if err := initMongoDB(mongoURI); err != nil {
+				log.Fatal("Failed to connect to MongoDB:", err)
+			}
+		}
+	default:
+		log.Fatalf("Unknown DATABASE_BACKEND %q, use mongo or sqlite", os.Getenv("DATABASE_BACKEND"))
+	}
+	if mongoClient != nil {
+		defer func() {
+			if err := mongoClient.Disconnect(context.TODO()); err != nil {
+				log.Printf("Error disconnecting from MongoDB: %v\n", err)
+			}
+		}()
+	}
+
+	// the facts loaded into Postgres are served when POSTGRES_URL is set, whichever DATABASE_BACKEND is used
+	var err error
+	postgresPool, err = requestandreceivedatafrompostgres.Open()
+	if err != nil {
+		log.Fatal("Failed to connect to Postgres:", err)
+	}
+	if postgresPool != nil {
+		defer postgresPool.Close()
+	}
 
 	// Initialize Gin router
 	r := gin.Default()
 
 	// Setup routes
-	api.SetupRoutes(r, mongoClient)
+	api.SetupRoutes(r, mongoClient, sqliteDB, postgresPool)
 
 	// Run server
 	port := os.Getenv("PORT")
@@ -9,11 +9,39 @@ interface Company {
   title: string
 }
 
+// Scrape job of the backend queue, only the fields the search bar shows
+interface ScrapeJob {
+  id: string
+  status: 'queued' | 'running' | 'succeeded' | 'failed'
+  progress: {
+    stage?: string
+    completedStages: number
+    totalStages: number
+  }
+  error?: string
+}
+
+const stageMessages: Record<string, string> = {
+  fetch: 'Fetching filings…',
+  categorize: 'Finding financial statements…',
+  parse: 'Parsing financial statements…',
+  combine: 'Combining financial statements…'
+}
+
+const scrapeJobMessage = (job: ScrapeJob): string => {
+  if (job.status === 'queued') {
+    return 'Waiting for a scraper…'
+  }
+  const message = (job.progress.stage && stageMessages[job.progress.stage]) || 'Fetching filings…'
+  return `${message} (${job.progress.completedStages}/${job.progress.totalStages})`
+}
+
 export default function SearchBar() {
   const [searchTerm, setSearchTerm] = useState('')
   const [suggestions, setSuggestions] = useState<Company[]>([])
   const [selectedIndex, setSelectedIndex] = useState(-1)
   const [loading, setLoading] = useState(false)
+  const [scrapeJob, setScrapeJob] = useState<ScrapeJob | null>(null)
   const navigate = useNavigate()
   const location = useLocation()
   const isHomePage = location.pathname === '/'
@@ -45,18 +73,76 @@ export default function SearchBar() {
     setSuggestions(filteredCompanies)
   }
 
+  const fetchFinancialStatements = (formattedCIK: string) => {
+    return fetch(`http://localhost:3000/api/${formattedCIK}`, {
+      method: 'GET',
+      headers: {
+        'Accept': 'application/json',
+        'Content-Type': 'application/json'
+      }
+    })
+  }
+
+  // Queues a scrape of a company that isn't in the database yet, the backend returns the running job if there already is one
+  const startScrapeJob = async (company: Company, formattedCIK: string): Promise<ScrapeJob> => {
+    const response = await fetch('http://localhost:3000/api/jobs', {
+      method: 'POST',
+      headers: {
+        'Accept': 'application/json',
+        'Content-Type': 'application/json'
+      },
+      body: JSON.stringify({ cik: formattedCIK, ticker: company.ticker, requestedBy: 'search' })
+    })
+
+    if (!response.ok) {
+      const errorText = await response.text()
+      throw new Error(`Failed to request company data: ${response.status} ${response.statusText}${errorText ? ` - ${errorText}` : ''}`)
+    }
+
+    return response.json()
+  }
+
+  // Follows the progress events of the job until it succeeds or fails
+  const waitForScrapeJob = (job: ScrapeJob): Promise<ScrapeJob> => {
+    return new Promise((resolve, reject) => {
+      const events = new EventSource(`http://localhost:3000/api/jobs/${job.id}/events`)
+
+      events.addEventListener('progress', (event) => {
+        setScrapeJob(JSON.parse((event as MessageEvent).data))
+      })
+      events.addEventListener('done', (event) => {
+        events.close()
+        const finishedJob: ScrapeJob = JSON.parse((event as MessageEvent).data)
+        setScrapeJob(finishedJob)
+        if (finishedJob.status === 'succeeded') {
+          resolve(finishedJob)
+        } else {
+          reject(new Error(`Failed to fetch filings for this company${finishedJob.error ? `: ${finishedJob.error}` : ''}`))
+        }
+      })
+      // EventSource reconnects on its own after a dropped connection, it only gives up when the server refused the stream
+      events.onerror = () => {
+        if (events.readyState === EventSource.CLOSED) {
+          reject(new Error('Lost the connection to the scrape job'))
+        }
+      }
+    })
+  }
+
   const handleNavigate = async (company: Company) => {
     const formattedCIK = formatCIK(company.cik_str)
     
     try {
       setLoading(true)
-      const response = await fetch(`http://localhost:3000/api/${formattedCIK}`, {
-        method: 'GET',
-        headers: {
-          'Accept': 'application/json',
-          'Content-Type': 'application/json'
-        }
-      })
+      let response = await fetchFinancialStatements(formattedCIK)
+
+      // Not scraped yet, scrape it now and show the progress instead of an error
+      if (response.status === 404) {
+        const job = await startScrapeJob(company, formattedCIK)
+        setScrapeJob(job)
+        await waitForScrapeJob(job)
+        response = await fetchFinancialStatements(formattedCIK)
+      }
 
       if (!response.ok) {
         const errorText = await response.text()
@@ -90,6 +176,7 @@ export default function SearchBar() {
       }
     } finally {
       setLoading(false)
+      setScrapeJob(null)
     }
   }
 
@@ -193,6 +280,11 @@ export default function SearchBar() {
         >
           {loading ? 'Searching...' : 'Search'}
         </button>
+        {scrapeJob && (
+          <p className="mt-3 text-sm text-muted-foreground text-center">
+            {scrapeJobMessage(scrapeJob)}
+          </p>
+        )}
       </form>
     </div>
   )
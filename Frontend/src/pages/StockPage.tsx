@@ -91,11 +91,12 @@ export default function StockPage() {
     return reportPeriodRow.slice(1).map(date => formatDate(date)).filter(Boolean)
   }
 
-  // Helper function to get financial data rows
+  // Helper function to get financial data rows, the rows up to the separator row describe the columns
+  // (accessionNumber, reportPeriod, valueSource, derivedFrom...) and are not line items
   const getFinancialRows = (data: [string, ...string[]][]) => {
-    return data.filter(row => 
+    const separatorIndex = data.findIndex(row => row[0] === 'separator')
+    return data.slice(separatorIndex + 1).filter(row => 
       row[0] && 
-      !['accessionNumber', 'form', 'reportDate', 'denomination', 'reportPeriod', 'reportDurationInMonths', 'separator'].includes(row[0]) &&
       row.some((cell, index) => index > 0 && cell)
     )
   }
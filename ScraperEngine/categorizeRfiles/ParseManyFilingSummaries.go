@@ -1,101 +1,64 @@
 package categorizefinancialstatements
 
 import (
-	"context"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
 
-	"go.mongodb.org/mongo-driver/bson"
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func ParseManyFilingSummaryXmlFilesAndSaveToMongoGivenCIK(CIK string, client *mongo.Client) {
-	accessionNumbers_slice, err := RetrieveAccessionNumbersThatHaveFilingSummaries(CIK, client)
+func ParseManyFilingSummaryXmlFilesAndSaveToMongoGivenCIK(CIK string, client *mongo.Client) error {
+	accessionNumbers_slice, err := RetrieveAccessionNumbersThatHaveFilingSummaries(CIK)
 	if err != nil {
 		fmt.Println("Error retrieving accession numbers:", err)
-		return
+		return err
+	}
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		fmt.Println("Error loading classification rules:", err)
+		return err
 	}
 
 	for _, accessionNumber := range accessionNumbers_slice {
-		filePath := filepath.Join("SEC-files", "filingSummaryAndRfiles", CIK, accessionNumber, "FilingSummary.xml")
-		RfileObjects, err := CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(filePath)
+		key := storage.FilingKey(CIK, accessionNumber, "FilingSummary.xml")
+		RfileObjects, err := CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(key, rules)
 		if err != nil {
 			fmt.Println("Error categorizing Rfiles:", err)
-			return
+			return err
+		}
+		if err := SaveRfileObjects(CIK, accessionNumber, RfileObjects, rules.Version); err != nil {
+			return err
 		}
-		SaveRfileObjectsToMongoDB(CIK, accessionNumber, RfileObjects, client)
 	}
+	return nil
 }
 
-func SaveRfileObjectsToMongoDB(CIK, accessionNumber string, rfileObjects []RfileFinancialStatementObject, client *mongo.Client) {
-	databaseName := os.Getenv("DATABASE_NAME")
-	collectionName := os.Getenv("10K10QMetaDataCollection")
-	db := client.Database(databaseName)
-	collection := db.Collection(collectionName)
-	ctx := context.Background()
-	filter := bson.M{
-		"accessionnumber":  accessionNumber,
-		"cik":              CIK,
-		"hasFilingSummary": true,
-	}
-
+// SaveRfileObjects saves the R files the categorizer found as the R files of the filing,
+// a statement it didn't find loses the R file saved for it before
+func SaveRfileObjects(CIK, accessionNumber string, rfileObjects []RfileFinancialStatementObject, rulesVersion string) error {
+	Rfiles := make(map[string]filingrepository.Rfile)
 	for _, obj := range rfileObjects {
-		if obj.FinancialStatementType != "" {
-			financialStatementType := obj.FinancialStatementType
-			prefix := fmt.Sprintf("Rfile_%s_", financialStatementType)
-			update := bson.M{"$set": bson.M{
-				prefix + "fileName":     obj.FileName,
-				prefix + "longName":     obj.LongName,
-				prefix + "shortName":    obj.ShortName,
-				prefix + "menuCategory": obj.MenuCategory,
-			}}
-
-			if _, err := collection.UpdateOne(ctx, filter, update); err != nil {
-				log.Printf("Error updating %s: %v", financialStatementType, err)
-				return
+		if obj.FinancialStatementType != "" && obj.FileName != "" {
+			Rfiles[obj.FinancialStatementType] = filingrepository.Rfile{
+				FileName:     obj.FileName,
+				LongName:     obj.LongName,
+				ShortName:    obj.ShortName,
+				MenuCategory: obj.MenuCategory,
 			}
 		}
 	}
-}
-
-func RetrieveAccessionNumbersThatHaveFilingSummaries(CIK string, client *mongo.Client) ([]string, error) {
-	databaseName := os.Getenv("DATABASE_NAME")
-	collectionName := os.Getenv("10K10QMetaDataCollection")
-	collection := client.Database(databaseName).Collection(collectionName)
-
-	filter := bson.M{"hasFilingSummary": true, "cik": CIK}
-	projection := bson.M{"accessionnumber": 1, "_id": 0} // Project only the accessionNumber
-
-	// Use a context with timeout or a background context as needed
-	ctx := context.Background()
 
-	// Perform the query to find all matching documents
-	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(projection))
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var accessionNumbers []string // Slice to hold the accession numbers
-
-	// Iterate through the cursor and collect accession numbers and cik values
-	for cursor.Next(ctx) {
-		var result struct {
-			AccessionNumber string `bson:"accessionnumber"`
-		}
-		if err := cursor.Decode(&result); err != nil {
-			return nil, err
-		}
-		accessionNumbers = append(accessionNumbers, result.AccessionNumber)
-	}
-
-	// Check if the cursor encountered any errors during iteration
-	if err := cursor.Err(); err != nil {
-		return nil, err
+	// the rules version keeps track of which version of the classification rules produced the R files
+	if err := filingrepository.Filings.SetRfiles(CIK, accessionNumber, Rfiles, rulesVersion); err != nil {
+		log.Printf("Error saving the R files of %s: %v", accessionNumber, err)
+		return err
 	}
+	return nil
+}
 
-	return accessionNumbers, nil
+func RetrieveAccessionNumbersThatHaveFilingSummaries(CIK string) ([]string, error) {
+	return filingrepository.AccessionNumbersThatHaveFilingSummary(filingrepository.Filings, CIK)
 }
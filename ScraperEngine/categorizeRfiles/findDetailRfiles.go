@@ -0,0 +1,122 @@
+package categorizefinancialstatements
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"gopkg.in/xmlpath.v2"
+)
+
+// RfileDetailReportObject is a report of FilingSummary.xml that matched one of the requested patterns
+// these are usually the "Details" reports (segment revenue, debt maturities, leases) that the categorizer leaves out
+type RfileDetailReportObject struct {
+	FileName       string `bson:"fileName"`
+	LongName       string `bson:"longName"`
+	ShortName      string `bson:"shortName"`
+	MenuCategory   string `bson:"menuCategory"`
+	Role           string `bson:"role"`
+	MatchedPattern string `bson:"matchedPattern"`
+}
+
+// A pattern that starts with http:// or https:// is an XBRL role URI and has to match the Role of the report exactly (case insensitive)
+// any other pattern is a case insensitive regular expression matched against the LongName and ShortName of the report
+type detailReportPattern struct {
+	pattern string
+	roleURI string
+	regex   *regexp.Regexp
+}
+
+func compileDetailReportPatterns(patterns []string) ([]detailReportPattern, error) {
+	var compiled []detailReportPattern
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "http://") || strings.HasPrefix(pattern, "https://") {
+			compiled = append(compiled, detailReportPattern{pattern: pattern, roleURI: pattern})
+			continue
+		}
+		regex, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid report name pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, detailReportPattern{pattern: pattern, regex: regex})
+	}
+	return compiled, nil
+}
+
+func (p detailReportPattern) matches(longName, shortName, role string) bool {
+	if p.roleURI != "" {
+		return strings.EqualFold(strings.TrimSpace(role), p.roleURI)
+	}
+	return p.regex.MatchString(longName) || p.regex.MatchString(shortName)
+}
+
+// FindDetailRfilesFromFilingSummaryXML returns every report of the FilingSummary whose name or role matches one of the patterns
+func FindDetailRfilesFromFilingSummaryXML(filePath string, patterns []string) ([]RfileDetailReportObject, error) {
+	compiledPatterns, err := compileDetailReportPatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	XMLdata, err := ReadFilingSummaryXmlFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	root, err := xmlpath.Parse(strings.NewReader(XMLdata))
+	if err != nil {
+		fmt.Printf("error parsing XML: %v\n", err)
+		return nil, err
+	}
+
+	whichFileNameTagToUse := "HtmlFileName"
+	if !xmlpath.MustCompile("/FilingSummary/MyReports/Report[1]/HtmlFileName").Exists(root) {
+		if !xmlpath.MustCompile("/FilingSummary/MyReports/Report[1]/XmlFileName").Exists(root) {
+			return nil, fmt.Errorf("this FilingSummaryFile has neither HtmlFileName or XmlFileName: %s", filePath)
+		}
+		whichFileNameTagToUse = "XmlFileName"
+	}
+
+	reportsPath := xmlpath.MustCompile("/FilingSummary/MyReports/Report")
+	fileNamePath := xmlpath.MustCompile(whichFileNameTagToUse)
+	longNamePath := xmlpath.MustCompile("LongName")
+	shortNamePath := xmlpath.MustCompile("ShortName")
+	menuCategoryPath := xmlpath.MustCompile("MenuCategory")
+	rolePath := xmlpath.MustCompile("Role")
+
+	var detailRfiles []RfileDetailReportObject
+	reportIter := reportsPath.Iter(root)
+	for reportIter.Next() {
+		reportNode := reportIter.Node()
+		fileName, ok := fileNamePath.String(reportNode)
+		if !ok || fileName == "" {
+			continue
+		}
+		longName, _ := longNamePath.String(reportNode)
+		shortName, _ := shortNamePath.String(reportNode)
+		role, _ := rolePath.String(reportNode)
+
+		for _, pattern := range compiledPatterns {
+			if pattern.matches(longName, shortName, role) {
+				menuCategory, _ := menuCategoryPath.String(reportNode)
+				detailRfiles = append(detailRfiles, RfileDetailReportObject{
+					FileName:       fileName,
+					LongName:       longName,
+					ShortName:      shortName,
+					MenuCategory:   menuCategory,
+					Role:           strings.TrimSpace(role),
+					MatchedPattern: pattern.pattern,
+				})
+				break // one match is enough, don't add the same report twice
+			}
+		}
+	}
+	return detailRfiles, nil
+}
+
+// SaveDetailRfileObjects replaces the detailRfiles list of the filing with the reports found on this run
+func SaveDetailRfileObjects(CIK, accessionNumber string, detailRfiles []RfileDetailReportObject) error {
+	if detailRfiles == nil {
+		detailRfiles = []RfileDetailReportObject{}
+	}
+	return filingrepository.Filings.SetFilingReport(CIK, accessionNumber, "detailRfiles", detailRfiles)
+}
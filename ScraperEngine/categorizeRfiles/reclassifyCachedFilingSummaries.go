@@ -0,0 +1,121 @@
+package categorizefinancialstatements
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// RfileClassificationChange is one financial statement whose R file changed between the saved classification and the current rules
+type RfileClassificationChange struct {
+	AccessionNumber        string
+	FinancialStatementType string
+	OldFileName            string
+	OldLongName            string
+	NewFileName            string
+	NewLongName            string
+}
+
+// ReclassifyCachedFilingSummariesGivenCIK re-runs the categorizer over every FilingSummary.xml already downloaded for the CIK
+// and compares the result with the Rfile fields saved in Mongo. Nothing is written unless apply is true
+func ReclassifyCachedFilingSummariesGivenCIK(CIK string, apply bool, client *mongo.Client) ([]RfileClassificationChange, error) {
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		return nil, err
+	}
+
+	accessionNumbers, err := FindCachedFilingSummaryAccessionNumbersGivenCIK(CIK)
+	if err != nil {
+		return nil, err
+	}
+
+	savedRfileObjects, err := RetrieveSavedRfileObjects(CIK)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []RfileClassificationChange
+	for _, accessionNumber := range accessionNumbers {
+		key := storage.FilingKey(CIK, accessionNumber, "FilingSummary.xml")
+		RfileObjects, err := CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(key, rules)
+		if err != nil {
+			fmt.Println("Error categorizing Rfiles:", err)
+			continue
+		}
+
+		var changesOfThisFiling []RfileClassificationChange
+		for i, financialStatementType := range filingrepository.FinancialStatementTypes {
+			newObject := RfileObjects[i]
+			oldObject := savedRfileObjects[accessionNumber][financialStatementType]
+			if newObject.FileName == oldObject.FileName && newObject.LongName == oldObject.LongName {
+				continue
+			}
+			changesOfThisFiling = append(changesOfThisFiling, RfileClassificationChange{
+				AccessionNumber:        accessionNumber,
+				FinancialStatementType: financialStatementType,
+				OldFileName:            oldObject.FileName,
+				OldLongName:            oldObject.LongName,
+				NewFileName:            newObject.FileName,
+				NewLongName:            newObject.LongName,
+			})
+		}
+		changes = append(changes, changesOfThisFiling...)
+
+		if apply && len(changesOfThisFiling) > 0 {
+			if err := SaveRfileObjects(CIK, accessionNumber, RfileObjects, rules.Version); err != nil {
+				return changes, err
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+// FindCachedFilingSummaryAccessionNumbersGivenCIK lists the accession number folders of the CIK that contain a FilingSummary.xml
+func FindCachedFilingSummaryAccessionNumbersGivenCIK(CIK string) ([]string, error) {
+	baseDirectory := path.Join("filingSummaryAndRfiles", CIK)
+	keys, err := storage.SECFiles.List(baseDirectory)
+	if err != nil {
+		return nil, err
+	}
+
+	var accessionNumbers []string
+	for _, key := range keys {
+		if path.Base(key) == "FilingSummary.xml" && path.Dir(path.Dir(key)) == baseDirectory {
+			accessionNumbers = append(accessionNumbers, path.Base(path.Dir(key)))
+		}
+	}
+	sort.Strings(accessionNumbers)
+	return accessionNumbers, nil
+}
+
+// RetrieveSavedRfileObjects returns accessionNumber -> financialStatementType -> saved Rfile fields
+func RetrieveSavedRfileObjects(CIK string) (map[string]map[string]RfileFinancialStatementObject, error) {
+	filings, err := filingrepository.Filings.ListFilingsByCIK(CIK)
+	if err != nil {
+		return nil, err
+	}
+
+	savedRfileObjects := make(map[string]map[string]RfileFinancialStatementObject)
+	for _, filing := range filings {
+		if filing.HasFilingSummary == nil || !*filing.HasFilingSummary {
+			continue
+		}
+		savedRfileObjects[filing.AccessionNumber] = make(map[string]RfileFinancialStatementObject)
+		for financialStatementType, Rfile := range filing.Rfiles {
+			savedRfileObjects[filing.AccessionNumber][financialStatementType] = RfileFinancialStatementObject{
+				FinancialStatementType: financialStatementType,
+				FileName:               Rfile.FileName,
+				LongName:               Rfile.LongName,
+				ShortName:              Rfile.ShortName,
+				MenuCategory:           Rfile.MenuCategory,
+			}
+		}
+	}
+	return savedRfileObjects, nil
+}
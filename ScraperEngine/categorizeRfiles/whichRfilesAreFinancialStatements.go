@@ -2,10 +2,10 @@ package categorizefinancialstatements
 
 import (
 	"fmt"
-	"io"
-	"os"
 	"strings"
 
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	"gopkg.in/xmlpath.v2"
 )
 
@@ -17,8 +17,8 @@ type RfileFinancialStatementObject struct {
 	MenuCategory           string
 }
 
-func CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(filePath string) ([]RfileFinancialStatementObject, error) {
-	XMLdata, err := ReadFilingSummaryXmlFile(filePath)
+func CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(filingSummaryKey string, rules classificationrules.ClassificationRules) ([]RfileFinancialStatementObject, error) {
+	XMLdata, err := ReadFilingSummaryXmlFile(filingSummaryKey)
 	if err != nil {
 		fmt.Printf("error CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML function: %v", err)
 		return nil, err
@@ -40,7 +40,7 @@ func CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(filePath string)
 	doBothHtmlAndXmlDontExist := (!doesHtmlFileNameTagExist && !doesXmlFileNameTagExist)
 	whichFileNameTagToUse := ""
 	if doBothHtmlAndXmlDontExist {
-		fmt.Println(filePath)
+		fmt.Println(filingSummaryKey)
 		return nil, fmt.Errorf("this FilingSummaryFile has neither HtmlFileName or XmlFileName")
 	} else {
 		if doesHtmlFileNameTagExist {
@@ -66,9 +66,9 @@ func CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(filePath string)
 		reportNode := reportIter.Node()
 
 		if longName, ok := longNamePath.String(reportNode); ok {
-			financialStatementTypeFrom1stfilter := whichFinancialStatement1stFilter(longName)
+			financialStatementTypeFrom1stfilter := whichFinancialStatement1stFilter(longName, rules.FinancialStatementNames)
 			if financialStatementTypeFrom1stfilter != "" {
-				confirmationfrom2ndfilter := whichFinancialStatement2ndFilter(longName, financialStatementTypeFrom1stfilter)
+				confirmationfrom2ndfilter := whichFinancialStatement2ndFilter(longName, financialStatementTypeFrom1stfilter, rules.FinancialStatementNames)
 				if confirmationfrom2ndfilter {
 					switch financialStatementTypeFrom1stfilter {
 					case "BS":
@@ -116,17 +116,11 @@ func CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(filePath string)
 	return []RfileFinancialStatementObject{BS_struct, IS_struct, CIS_struct, CF_struct}, nil
 }
 
-func ReadFilingSummaryXmlFile(filePath string) (string, error) {
-	XMLfile, err := os.Open(filePath)
+// ReadFilingSummaryXmlFile reads the FilingSummary.xml at the key of storage.SECFiles
+func ReadFilingSummaryXmlFile(key string) (string, error) {
+	XMLdata, err := storage.SECFiles.Get(key)
 	if err != nil {
-		fmt.Printf("error opening file: %v", err)
-		return "", err
-	}
-	defer XMLfile.Close()
-
-	XMLdata, err := io.ReadAll(XMLfile)
-	if err != nil {
-		fmt.Printf("error reading file: %v", err)
+		fmt.Printf("error reading file %s: %v", key, err)
 		return "", err
 	}
 
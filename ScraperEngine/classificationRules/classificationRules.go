@@ -0,0 +1,167 @@
+// Rules used to decide which R files are financial statements, where the sections of a balance sheet start and end
+// and which line items of a flow statement are not summed over time.
+// The default rules are embedded in the binary, set CLASSIFICATION_RULES_FILE to load them from a JSON file instead
+package classificationrules
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+//go:embed defaultClassificationRules.json
+var defaultClassificationRulesJson []byte
+
+// FinancialStatementNameRules are the words looked for in the LongName of each report in FilingSummary.xml
+type FinancialStatementNameRules struct {
+	BSNames           []string `json:"bsNames"`
+	ISNames           []string `json:"isNames"`
+	CISNames          []string `json:"cisNames"`
+	CFNames           []string `json:"cfNames"`
+	BSExclusionTerms  []string `json:"bsExclusionTerms"`
+	ISExclusionTerms  []string `json:"isExclusionTerms"`
+	CISExclusionTerms []string `json:"cisExclusionTerms"`
+	CFExclusionTerms  []string `json:"cfExclusionTerms"`
+}
+
+// BalanceSheetAnchorRules are the words looked for in the line item names of a balance sheet R file
+// the first 10 fields are used by classifyBalanceSheetLineItems, the last 4 by ProcessBalanceSheetCsvRfile
+type BalanceSheetAnchorRules struct {
+	CurrentAssets                         []string `json:"currentAssets"`
+	TotalCurrentAssets                    []string `json:"totalCurrentAssets"`
+	TotalAssets                           []string `json:"totalAssets"`
+	CurrentLiabilities                    []string `json:"currentLiabilities"`
+	TotalCurrentLiabilities               []string `json:"totalCurrentLiabilities"`
+	TotalLiabilities                      []string `json:"totalLiabilities"`
+	StockholdersEquity                    []string `json:"stockholdersEquity"`
+	TotalStockholdersEquity               []string `json:"totalStockholdersEquity"`
+	StockholdersEquityExclusionTerms      []string `json:"stockholdersEquityExclusionTerms"`
+	TotalLiabilitiesAndEquityWordsInOrder []string `json:"totalLiabilitiesAndEquityWordsInOrder"`
+	StartOfAssets                         []string `json:"startOfAssets"`
+	CommonStock                           []string `json:"commonStock"`
+	TotalEquity                           []string `json:"totalEquity"`
+	OtherEquity                           []string `json:"otherEquity"`
+}
+
+// FlowStatementRules are the words looked for in the line item names of combined income and cash flow statements
+// stock items (per share amounts, share counts) can't be derived by subtracting two year to date columns
+type FlowStatementRules struct {
+	StockItemTerms []string `json:"stockItemTerms"`
+}
+
+// ClassificationRulesOverride replaces the lists of the base rules for one CIK
+// a list that is left out of the override keeps the value of the base rules
+type ClassificationRulesOverride struct {
+	FinancialStatementNames FinancialStatementNameRules `json:"financialStatementNames"`
+	BalanceSheetAnchors     BalanceSheetAnchorRules     `json:"balanceSheetAnchors"`
+	FlowStatements          FlowStatementRules          `json:"flowStatements"`
+}
+
+type ClassificationRules struct {
+	Version                 string                                 `json:"version"`
+	FinancialStatementNames FinancialStatementNameRules            `json:"financialStatementNames"`
+	BalanceSheetAnchors     BalanceSheetAnchorRules                `json:"balanceSheetAnchors"`
+	FlowStatements          FlowStatementRules                     `json:"flowStatements"`
+	CIKOverrides            map[string]ClassificationRulesOverride `json:"cikOverrides"`
+}
+
+var (
+	loadedRules     ClassificationRules
+	loadedRulesErr  error
+	loadedRulesOnce sync.Once
+)
+
+// LoadClassificationRules reads the rule file once and keeps it in memory for the rest of the run
+func LoadClassificationRules() (ClassificationRules, error) {
+	loadedRulesOnce.Do(func() {
+		loadedRules, loadedRulesErr = ReadClassificationRules(os.Getenv("CLASSIFICATION_RULES_FILE"))
+	})
+	return loadedRules, loadedRulesErr
+}
+
+// LoadClassificationRulesForCIK returns the rules with the overrides of the given CIK already applied
+func LoadClassificationRulesForCIK(CIK string) (ClassificationRules, error) {
+	rules, err := LoadClassificationRules()
+	if err != nil {
+		return ClassificationRules{}, err
+	}
+	return rules.ForCIK(CIK), nil
+}
+
+// ReadClassificationRules parses a rule file, an empty filePath returns the embedded default rules
+func ReadClassificationRules(filePath string) (ClassificationRules, error) {
+	data := defaultClassificationRulesJson
+	if filePath != "" {
+		fileData, err := os.ReadFile(filePath)
+		if err != nil {
+			return ClassificationRules{}, fmt.Errorf("error reading classification rules file %s: %w", filePath, err)
+		}
+		data = fileData
+	}
+
+	var rules ClassificationRules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return ClassificationRules{}, fmt.Errorf("error parsing classification rules: %w", err)
+	}
+	if rules.Version == "" {
+		return ClassificationRules{}, fmt.Errorf("classification rules have no version")
+	}
+	return rules, nil
+}
+
+// ForCIK applies the override of the given CIK, the version becomes "<version>+<CIK>" so saved results show which rules were used
+func (rules ClassificationRules) ForCIK(CIK string) ClassificationRules {
+	resolved := ClassificationRules{
+		Version:                 rules.Version,
+		FinancialStatementNames: rules.FinancialStatementNames,
+		BalanceSheetAnchors:     rules.BalanceSheetAnchors,
+		FlowStatements:          rules.FlowStatements,
+	}
+	override, ok := rules.CIKOverrides[CIK]
+	if !ok {
+		return resolved
+	}
+	resolved.Version = rules.Version + "+" + CIK
+
+	names := &resolved.FinancialStatementNames
+	overrideNames := override.FinancialStatementNames
+	names.BSNames = overrideList(names.BSNames, overrideNames.BSNames)
+	names.ISNames = overrideList(names.ISNames, overrideNames.ISNames)
+	names.CISNames = overrideList(names.CISNames, overrideNames.CISNames)
+	names.CFNames = overrideList(names.CFNames, overrideNames.CFNames)
+	names.BSExclusionTerms = overrideList(names.BSExclusionTerms, overrideNames.BSExclusionTerms)
+	names.ISExclusionTerms = overrideList(names.ISExclusionTerms, overrideNames.ISExclusionTerms)
+	names.CISExclusionTerms = overrideList(names.CISExclusionTerms, overrideNames.CISExclusionTerms)
+	names.CFExclusionTerms = overrideList(names.CFExclusionTerms, overrideNames.CFExclusionTerms)
+
+	anchors := &resolved.BalanceSheetAnchors
+	overrideAnchors := override.BalanceSheetAnchors
+	anchors.CurrentAssets = overrideList(anchors.CurrentAssets, overrideAnchors.CurrentAssets)
+	anchors.TotalCurrentAssets = overrideList(anchors.TotalCurrentAssets, overrideAnchors.TotalCurrentAssets)
+	anchors.TotalAssets = overrideList(anchors.TotalAssets, overrideAnchors.TotalAssets)
+	anchors.CurrentLiabilities = overrideList(anchors.CurrentLiabilities, overrideAnchors.CurrentLiabilities)
+	anchors.TotalCurrentLiabilities = overrideList(anchors.TotalCurrentLiabilities, overrideAnchors.TotalCurrentLiabilities)
+	anchors.TotalLiabilities = overrideList(anchors.TotalLiabilities, overrideAnchors.TotalLiabilities)
+	anchors.StockholdersEquity = overrideList(anchors.StockholdersEquity, overrideAnchors.StockholdersEquity)
+	anchors.TotalStockholdersEquity = overrideList(anchors.TotalStockholdersEquity, overrideAnchors.TotalStockholdersEquity)
+	anchors.StockholdersEquityExclusionTerms = overrideList(anchors.StockholdersEquityExclusionTerms, overrideAnchors.StockholdersEquityExclusionTerms)
+	anchors.TotalLiabilitiesAndEquityWordsInOrder = overrideList(anchors.TotalLiabilitiesAndEquityWordsInOrder, overrideAnchors.TotalLiabilitiesAndEquityWordsInOrder)
+	anchors.StartOfAssets = overrideList(anchors.StartOfAssets, overrideAnchors.StartOfAssets)
+	anchors.CommonStock = overrideList(anchors.CommonStock, overrideAnchors.CommonStock)
+	anchors.TotalEquity = overrideList(anchors.TotalEquity, overrideAnchors.TotalEquity)
+	anchors.OtherEquity = overrideList(anchors.OtherEquity, overrideAnchors.OtherEquity)
+
+	resolved.FlowStatements.StockItemTerms = overrideList(resolved.FlowStatements.StockItemTerms, override.FlowStatements.StockItemTerms)
+
+	return resolved
+}
+
+// a nil list means the override file did not mention it, an empty list [] is a deliberate override
+func overrideList(base []string, override []string) []string {
+	if override == nil {
+		return base
+	}
+	return override
+}
@@ -0,0 +1,310 @@
+package combinecsvfiles
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// the same line item is often named slightly differently from one filing to the next
+// eg) "Accounts receivable, net" vs "Accounts receivable, net of allowance of $5", matching by name alone makes them two rows.
+// The aligner renames the line items of every filing to one name per row before the statements are combined:
+// first by XBRL concept, then by exact name, then by how similar the names are
+
+// labels whose tokens overlap this much (jaccard) are the same line item
+const minimumLineItemSimilarity = 0.8
+
+// qualifiers that change from filing to filing without changing the line item: parentheticals, "net of allowance of $22 ...", amounts
+var lineItemQualifierRegex = regexp.MustCompile(`(?i)\([^)]*\)|\bnet\s+of\b.*$|\$?\d[\d,.]*`)
+var lineItemTokenRegex = regexp.MustCompile(`[a-z]+`)
+var lineItemStopWords = map[string]bool{"a": true, "an": true, "and": true, "the": true, "of": true, "for": true, "to": true, "in": true, "on": true, "at": true, "net": true}
+
+// LineItemMapping records which line item of which filing fed a row of the combined statement and how it was matched
+// Method is "concept", "label", "similarity" or "new" when the line item started a row of its own
+type LineItemMapping struct {
+	CombinedLineItem string
+	Section          string
+	AccessionNumber  string
+	OriginalLineItem string
+	Concept          string
+	Method           string
+	Similarity       float64
+}
+
+type alignedLineItem struct {
+	name             string
+	section          string
+	concept          string
+	tokens           map[string]bool
+	accessionNumbers map[string]bool // filings that already have a line item in this row, two line items of one filing never share a row
+}
+
+// LineItemAligner keeps the rows seen so far, statements have to be aligned oldest to newest so the oldest name of a row is kept
+type LineItemAligner struct {
+	conceptsByAccessionNumber map[string][][]string
+	rows                      []*alignedLineItem
+	Mappings                  []LineItemMapping
+}
+
+// NewLineItemAligner takes the lineItem,concept rows of each filing, see GetLineItemConceptsByAccessionNumberGivenCIK, nil aligns by name only
+func NewLineItemAligner(conceptsByAccessionNumber map[string][][]string) *LineItemAligner {
+	return &LineItemAligner{conceptsByAccessionNumber: conceptsByAccessionNumber}
+}
+
+// AlignStatement returns a copy of the statement with every line item with data renamed to the name of its row.
+// sectionOfRow keeps rows of different sections apart (eg current and non current assets) and returns false for rows
+// that must keep their name, nil puts every line item in the same section.
+func (aligner *LineItemAligner) AlignStatement(statement [][]string, sectionOfRow func(rowIndex int) (string, bool)) [][]string {
+	accessionNumber := ""
+	if len(statement) > AccessionNumberRowIndex && len(statement[AccessionNumberRowIndex]) > 1 {
+		accessionNumber = statement[AccessionNumberRowIndex][1]
+	}
+	concepts := conceptsOfStatementRows(statement, aligner.conceptsByAccessionNumber[accessionNumber])
+
+	aligned := make([][]string, len(statement))
+	copy(aligned, statement)
+
+	var rowIndices []int
+	sections := make(map[int]string)
+	for i := FindSeparatorRowIndex(statement) + 1; i < len(statement); i++ {
+		if !DoesDataCellExistInThisRow(statement[i]) {
+			continue
+		}
+		section := ""
+		if sectionOfRow != nil {
+			var align bool
+			if section, align = sectionOfRow(i); !align {
+				continue
+			}
+		}
+		rowIndices = append(rowIndices, i)
+		sections[i] = section
+	}
+
+	matched := make(map[int]bool)
+	assign := func(rowIndex int, row *alignedLineItem, method string, similarity float64) {
+		matched[rowIndex] = true
+		row.accessionNumbers[accessionNumber] = true
+		if row.concept == "" {
+			row.concept = concepts[rowIndex]
+		}
+		if aligned[rowIndex][0] != row.name {
+			newRow := make([]string, len(aligned[rowIndex]))
+			copy(newRow, aligned[rowIndex])
+			newRow[0] = row.name
+			aligned[rowIndex] = newRow
+		}
+		aligner.Mappings = append(aligner.Mappings, LineItemMapping{
+			CombinedLineItem: row.name,
+			Section:          sections[rowIndex],
+			AccessionNumber:  accessionNumber,
+			OriginalLineItem: statement[rowIndex][0],
+			Concept:          concepts[rowIndex],
+			Method:           method,
+			Similarity:       similarity,
+		})
+	}
+	isAvailable := func(row *alignedLineItem, section string) bool {
+		return row.section == section && !row.accessionNumbers[accessionNumber]
+	}
+
+	// concepts and exact names first so a similar name can't take the row of an exact match further down the statement
+	for _, rowIndex := range rowIndices {
+		if concepts[rowIndex] == "" {
+			continue
+		}
+		for _, row := range aligner.rows {
+			if isAvailable(row, sections[rowIndex]) && row.concept == concepts[rowIndex] {
+				assign(rowIndex, row, "concept", 1)
+				break
+			}
+		}
+	}
+	for _, rowIndex := range rowIndices {
+		if matched[rowIndex] {
+			continue
+		}
+		// an exact name wins even when the concepts differ, two rows with the same name can't be looked up by name
+		for _, row := range aligner.rows {
+			if isAvailable(row, sections[rowIndex]) && normalizeLineItemName(row.name) == normalizeLineItemName(statement[rowIndex][0]) {
+				assign(rowIndex, row, "label", 1)
+				break
+			}
+		}
+	}
+	for _, rowIndex := range rowIndices {
+		if matched[rowIndex] {
+			continue
+		}
+		tokens := lineItemTokens(statement[rowIndex][0])
+		var bestRow *alignedLineItem
+		bestSimilarity := 0.0
+		for _, row := range aligner.rows {
+			if !isAvailable(row, sections[rowIndex]) || (row.concept != "" && concepts[rowIndex] != "" && row.concept != concepts[rowIndex]) {
+				continue
+			}
+			if similarity := lineItemSimilarity(tokens, row.tokens); similarity >= minimumLineItemSimilarity && similarity > bestSimilarity {
+				bestRow, bestSimilarity = row, similarity
+			}
+		}
+		if bestRow != nil {
+			assign(rowIndex, bestRow, "similarity", bestSimilarity)
+			continue
+		}
+		row := &alignedLineItem{
+			name:             statement[rowIndex][0],
+			section:          sections[rowIndex],
+			tokens:           tokens,
+			accessionNumbers: make(map[string]bool),
+		}
+		aligner.rows = append(aligner.rows, row)
+		assign(rowIndex, row, "new", 0)
+	}
+	return aligned
+}
+
+// MappingArray returns the mappings as a 2D array with a header row, ready to be saved as CSV
+func (aligner *LineItemAligner) MappingArray() [][]string {
+	array := [][]string{{"combinedLineItem", "section", "accessionNumber", "originalLineItem", "concept", "method", "similarity"}}
+	for _, mapping := range aligner.Mappings {
+		array = append(array, []string{mapping.CombinedLineItem, mapping.Section, mapping.AccessionNumber, mapping.OriginalLineItem,
+			mapping.Concept, mapping.Method, strconv.FormatFloat(mapping.Similarity, 'f', 2, 64)})
+	}
+	return array
+}
+
+// saveLevel1CombinedStatement saves the Level 1 combined statement of the CIK, eg) fileName "IncomeStatement" is saved
+// as <CIK>_combinedIncomeStatementLevel1.csv, and the line item mapping of the aligner next to it
+func saveLevel1CombinedStatement(CIK string, fileName string, statementName string, combinedStatementArray [][]string, aligner *LineItemAligner) error {
+	key := storage.CombinedStatementKey(CIK + "_combined" + fileName + "Level1.csv")
+	if err := storage.PutCsv(storage.SECFiles, key, combinedStatementArray); err != nil {
+		fmt.Printf("Error saving CSV file: %v\n", err)
+		return err
+	}
+	fmt.Printf("Successfully saved combined %s to %s\n", statementName, key)
+	return SaveLineItemMappingAsCsvFile(aligner, CIK+"_combined"+fileName+"Level1LineItemMapping.csv")
+}
+
+// SaveLineItemMappingAsCsvFile saves the mappings to SEC-files/combinedFinancialStatements next to the combined statement
+func SaveLineItemMappingAsCsvFile(aligner *LineItemAligner, fileName string) error {
+	if err := storage.PutCsv(storage.SECFiles, storage.CombinedStatementKey(fileName), aligner.MappingArray()); err != nil {
+		fmt.Printf("Error saving CSV file: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// lineItemTokens returns the words of a line item name without qualifiers and stop words
+func lineItemTokens(lineItemName string) map[string]bool {
+	tokens := make(map[string]bool)
+	name := lineItemQualifierRegex.ReplaceAllString(strings.ToLower(lineItemName), " ")
+	for _, token := range lineItemTokenRegex.FindAllString(name, -1) {
+		if !lineItemStopWords[token] {
+			tokens[token] = true
+		}
+	}
+	return tokens
+}
+
+// lineItemSimilarity is the jaccard index of the two sets of tokens
+func lineItemSimilarity(tokensA map[string]bool, tokensB map[string]bool) float64 {
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+	intersection := 0
+	for token := range tokensA {
+		if tokensB[token] {
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(tokensA)+len(tokensB)-intersection)
+}
+
+// conceptsOfStatementRows returns the concept of every row of the statement, "" for rows without one.
+// lineItemConcepts is in R file order, each row takes the first unused entry with its name so duplicate names keep their own concept
+// and statements cut out of the R file (eg the CIS split out of the IS) still find theirs.
+func conceptsOfStatementRows(statement [][]string, lineItemConcepts [][]string) []string {
+	concepts := make([]string, len(statement))
+	used := make([]bool, len(lineItemConcepts))
+	for i := FindSeparatorRowIndex(statement) + 1; i < len(statement); i++ {
+		if len(statement[i]) == 0 {
+			continue
+		}
+		for k, lineItemConcept := range lineItemConcepts {
+			if !used[k] && len(lineItemConcept) > 1 && normalizeLineItemName(lineItemConcept[0]) == normalizeLineItemName(statement[i][0]) {
+				used[k] = true
+				concepts[i] = lineItemConcept[1]
+				break
+			}
+		}
+	}
+	return concepts
+}
+
+// ReadLineItemConceptsOfCsvRfile reads the R2_concepts.csv saved next to R2.csv by the parser, nil when the R file was parsed without it
+func ReadLineItemConceptsOfCsvRfile(RfileKey string) ([][]string, error) {
+	conceptsKey := strings.TrimSuffix(RfileKey, ".csv") + "_concepts.csv"
+	lineItemConcepts, err := storage.GetCsv(storage.SECFiles, conceptsKey)
+	if err == storage.ErrNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(lineItemConcepts) > 0 {
+		lineItemConcepts = lineItemConcepts[1:] // header row
+	}
+	return lineItemConcepts, nil
+}
+
+// GetLineItemConceptsByAccessionNumberGivenCIK returns the lineItem,concept rows of every filing of the CIK per statement.
+// The CIS also gets the rows of the IS because filings without a CIS R file have theirs split out of the IS.
+func GetLineItemConceptsByAccessionNumberGivenCIK(CIK string, client *mongo.Client) (BSconcepts map[string][][]string, ISconcepts map[string][][]string, CISconcepts map[string][][]string, CFconcepts map[string][][]string, err error) {
+	filings, err := RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate(CIK)
+	if err != nil {
+		fmt.Println("RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate", err)
+		return nil, nil, nil, nil, err
+	}
+	BSfilePaths, ISfilePaths, CISfilePaths, CFfilePaths, err := GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings(filings)
+	if err != nil {
+		fmt.Println("GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings", err)
+		return nil, nil, nil, nil, err
+	}
+
+	readConcepts := func(filePathLists ...[]string) (map[string][][]string, error) {
+		conceptsByAccessionNumber := make(map[string][][]string)
+		for i, filing := range filings {
+			accessionNumber := filing.AccessionNumber
+			for _, filePaths := range filePathLists {
+				if filePaths[i] == "" {
+					continue
+				}
+				lineItemConcepts, err := ReadLineItemConceptsOfCsvRfile(filePaths[i])
+				if err != nil {
+					return nil, err
+				}
+				conceptsByAccessionNumber[accessionNumber] = append(conceptsByAccessionNumber[accessionNumber], lineItemConcepts...)
+			}
+		}
+		return conceptsByAccessionNumber, nil
+	}
+
+	if BSconcepts, err = readConcepts(BSfilePaths); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if ISconcepts, err = readConcepts(ISfilePaths); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if CISconcepts, err = readConcepts(CISfilePaths, ISfilePaths); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if CFconcepts, err = readConcepts(CFfilePaths); err != nil {
+		return nil, nil, nil, nil, err
+	}
+	return BSconcepts, ISconcepts, CISconcepts, CFconcepts, nil
+}
@@ -0,0 +1,280 @@
+package combinecsvfiles
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Balance sheets no classifier can classify are queued for a person to review in the balanceSheetReviews collection
+// of the published database, so the Backend can serve them. The reviewer submits the section boundaries of the R file
+// as BalanceSheetIndices and the Level 1 combiner uses them instead of classifying on the next run.
+// Status is "pending" until the indices are submitted, "submitted" when they came from the Backend and haven't been checked yet,
+// "resolved" once they are checked, and "classified" when the filing got classified without them (eg. after the classification rules were updated).
+// Indices are only checked here, SubmitBalanceSheetReviewIndices for review submit and ResolveSubmittedBalanceSheetReviews for the Backend's
+
+// BalanceSheetReviewLineItem is one row of the R file with its row index, so the reviewer can tell which index is which row
+type BalanceSheetReviewLineItem struct {
+	RowIndex int    `bson:"rowIndex"`
+	LineItem string `bson:"lineItem"`
+	Value    string `bson:"value"` // the first data cell, empty for headings
+}
+
+type BalanceSheetReview struct {
+	CIK             string                       `bson:"cik"`
+	AccessionNumber string                       `bson:"accessionNumber"`
+	Status          string                       `bson:"status"`
+	Reason          string                       `bson:"reason"`
+	LineItems       []BalanceSheetReviewLineItem `bson:"lineItems"`
+	Indices         *BalanceSheetIndices         `bson:"indices,omitempty"`
+	ResolvedBy      string                       `bson:"resolvedBy,omitempty"`
+	CreatedAt       time.Time                    `bson:"createdAt"`
+	UpdatedAt       time.Time                    `bson:"updatedAt"`
+}
+
+func GetBalanceSheetReviewCollection(client *mongo.Client) *mongo.Collection {
+	return utilityfunctions.GetPublishedMongoDBCollectionByName(client, "balanceSheetReviewCollection", "balanceSheetReviews")
+}
+
+// SaveBalanceSheetForReview queues the balance sheet with the reason it couldn't be classified,
+// a review that is already queued gets the new reason and rows and goes back to pending, its indices are kept for the reviewer to fix
+func SaveBalanceSheetForReview(CIK string, BalanceSheetArray [][]string, reason string, client *mongo.Client) error {
+	if client == nil {
+		// the queue is in Mongo, without it the balance sheet is only left out
+		return nil
+	}
+	accessionNumber := BalanceSheetArray[AccessionNumberRowIndex][1]
+	var lineItems []BalanceSheetReviewLineItem
+	for i := SeparatorRowIndex + 1; i < len(BalanceSheetArray); i++ {
+		row := BalanceSheetArray[i]
+		if len(row) == 0 || row[0] == "" {
+			continue
+		}
+		value := ""
+		for j := 1; j < len(row); j++ {
+			if row[j] != "" {
+				value = row[j]
+				break
+			}
+		}
+		lineItems = append(lineItems, BalanceSheetReviewLineItem{RowIndex: i, LineItem: row[0], Value: value})
+	}
+
+	now := time.Now()
+	filter := bson.M{"cik": CIK, "accessionNumber": accessionNumber}
+	update := bson.M{
+		"$set": bson.M{
+			"status":    "pending",
+			"reason":    reason,
+			"lineItems": lineItems,
+			"updatedAt": now,
+		},
+		"$setOnInsert": bson.M{"createdAt": now},
+	}
+	_, err := GetBalanceSheetReviewCollection(client).UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// GetManualBalanceSheetIndicesGivenCIK returns the submitted indices of the resolved reviews of the CIK by accession number,
+// the ones submitted through the Backend are checked first
+func GetManualBalanceSheetIndicesGivenCIK(CIK string, client *mongo.Client) (map[string]BalanceSheetIndices, error) {
+	if client == nil {
+		return map[string]BalanceSheetIndices{}, nil
+	}
+	if err := ResolveSubmittedBalanceSheetReviews(CIK, client); err != nil {
+		return nil, err
+	}
+	reviews, err := ListBalanceSheetReviews(CIK, "resolved", client)
+	if err != nil {
+		return nil, err
+	}
+	indicesByAccessionNumber := make(map[string]BalanceSheetIndices)
+	for _, review := range reviews {
+		if review.Indices != nil {
+			indicesByAccessionNumber[review.AccessionNumber] = *review.Indices
+		}
+	}
+	return indicesByAccessionNumber, nil
+}
+
+// ResolveSubmittedBalanceSheetReviews checks the indices submitted through the Backend the same way review submit does,
+// indices that don't fit the balance sheet send the review back to pending with the reason so the reviewer sees it
+func ResolveSubmittedBalanceSheetReviews(CIK string, client *mongo.Client) error {
+	reviews, err := ListBalanceSheetReviews(CIK, "submitted", client)
+	if err != nil {
+		return err
+	}
+	for _, review := range reviews {
+		if review.Indices == nil {
+			continue
+		}
+		err := SubmitBalanceSheetReviewIndices(CIK, review.AccessionNumber, *review.Indices, review.ResolvedBy, client)
+		if err == nil {
+			continue
+		}
+		fmt.Printf("accession number: %s - submitted section boundaries rejected: %v\n", review.AccessionNumber, err)
+		filter := bson.M{"cik": CIK, "accessionNumber": review.AccessionNumber}
+		update := bson.M{"$set": bson.M{"status": "pending", "reason": "submitted section boundaries rejected: " + err.Error(), "updatedAt": time.Now()}}
+		if _, err := GetBalanceSheetReviewCollection(client).UpdateOne(context.Background(), filter, update); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkBalanceSheetReviewsClassified takes the pending reviews of the accession numbers out of the queue
+func MarkBalanceSheetReviewsClassified(CIK string, accessionNumbers []string, client *mongo.Client) error {
+	if len(accessionNumbers) == 0 || client == nil {
+		return nil
+	}
+	filter := bson.M{"cik": CIK, "status": "pending", "accessionNumber": bson.M{"$in": accessionNumbers}}
+	update := bson.M{"$set": bson.M{"status": "classified", "updatedAt": time.Now()}}
+	_, err := GetBalanceSheetReviewCollection(client).UpdateMany(context.Background(), filter, update)
+	return err
+}
+
+// ListBalanceSheetReviews returns the reviews oldest first, filtered by CIK and status when they are not empty
+func ListBalanceSheetReviews(CIK string, status string, client *mongo.Client) ([]BalanceSheetReview, error) {
+	filter := bson.M{}
+	if CIK != "" {
+		filter["cik"] = CIK
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	cursor, err := GetBalanceSheetReviewCollection(client).Find(context.Background(), filter, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var reviews []BalanceSheetReview
+	if err := cursor.All(context.Background(), &reviews); err != nil {
+		return nil, err
+	}
+	return reviews, nil
+}
+
+func GetBalanceSheetReview(CIK string, accessionNumber string, client *mongo.Client) (BalanceSheetReview, error) {
+	var review BalanceSheetReview
+	err := GetBalanceSheetReviewCollection(client).FindOne(context.Background(), bson.M{"cik": CIK, "accessionNumber": accessionNumber}).Decode(&review)
+	return review, err
+}
+
+// SubmitBalanceSheetReviewIndices checks the indices against the rows saved with the review and resolves it
+func SubmitBalanceSheetReviewIndices(CIK string, accessionNumber string, indices BalanceSheetIndices, resolvedBy string, client *mongo.Client) error {
+	review, err := GetBalanceSheetReview(CIK, accessionNumber, client)
+	if err != nil {
+		return fmt.Errorf("review of %s %s: %w", CIK, accessionNumber, err)
+	}
+	if _, err := BalanceSheetClassificationsFromIndices(balanceSheetArrayOfReview(review), indices); err != nil {
+		return err
+	}
+
+	indices.AccessionNumber = accessionNumber
+	indices.SeparatorRowIndex = SeparatorRowIndex
+	//non current sections are whatever is between the current total and the total
+	if indices.NonCurrentAssetsStart == 0 {
+		indices.NonCurrentAssetsStart, indices.NonCurrentAssetsEnd = indices.CurrentAssetsEnd+1, indices.AssetsEnd-1
+	}
+	if indices.NonCurrentLiabilitiesStart == 0 {
+		indices.NonCurrentLiabilitiesStart, indices.NonCurrentLiabilitiesEnd = indices.CurrentLiabilitiesEnd+1, indices.LiabilitiesEnd-1
+	}
+	filter := bson.M{"cik": CIK, "accessionNumber": accessionNumber}
+	update := bson.M{"$set": bson.M{"status": "resolved", "indices": indices, "resolvedBy": resolvedBy, "updatedAt": time.Now()}}
+	_, err = GetBalanceSheetReviewCollection(client).UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+// balanceSheetArrayOfReview rebuilds enough of the R file from the rows of the review to check indices against,
+// the names and whether the rows have data at the same row indices
+func balanceSheetArrayOfReview(review BalanceSheetReview) [][]string {
+	rowCount := SeparatorRowIndex + 1
+	for _, lineItem := range review.LineItems {
+		if lineItem.RowIndex >= rowCount {
+			rowCount = lineItem.RowIndex + 1
+		}
+	}
+	BalanceSheetArray := make([][]string, rowCount)
+	for i := range BalanceSheetArray {
+		BalanceSheetArray[i] = []string{"", ""}
+	}
+	BalanceSheetArray[AccessionNumberRowIndex][1] = review.AccessionNumber
+	for _, lineItem := range review.LineItems {
+		BalanceSheetArray[lineItem.RowIndex] = []string{lineItem.LineItem, lineItem.Value}
+	}
+	return BalanceSheetArray
+}
+
+// BalanceSheetClassificationsFromIndices turns the section boundaries of a review into the classification the combiner uses.
+// A section may start at its heading or at its first line item, the heading is the row without data right above it then.
+// Total liabilities and equity is the last row with data after the end of equity that is not an other equity
+func BalanceSheetClassificationsFromIndices(BalanceSheetArray [][]string, indices BalanceSheetIndices) (BalanceSheetLineItemClassifications, error) {
+	headingOf := func(name string, start int) (int, error) {
+		if start <= SeparatorRowIndex || start >= len(BalanceSheetArray) {
+			return -1, fmt.Errorf("%s start %d is not a line item row", name, start)
+		}
+		if !DoesDataCellExistInThisRow(BalanceSheetArray[start]) {
+			return start, nil
+		}
+		if start-1 > SeparatorRowIndex && len(BalanceSheetArray[start-1]) > 0 && BalanceSheetArray[start-1][0] != "" && !DoesDataCellExistInThisRow(BalanceSheetArray[start-1]) {
+			return start - 1, nil
+		}
+		return -1, fmt.Errorf("%s starts at row %d but there is no heading row without data above it", name, start)
+	}
+	firstNonZero := func(values ...int) int {
+		for _, value := range values {
+			if value != 0 {
+				return value
+			}
+		}
+		return 0
+	}
+	hasOtherEquities := indices.OtherEquityStart != 0 && indices.OtherEquityEnd >= indices.OtherEquityStart
+	isOtherEquity := func(rowIndex int) bool {
+		return hasOtherEquities && rowIndex >= indices.OtherEquityStart && rowIndex <= indices.OtherEquityEnd
+	}
+
+	var classifications BalanceSheetLineItemClassifications
+	var err error
+	if classifications.CurrentAssets, err = headingOf("current assets", firstNonZero(indices.CurrentAssetsStart, indices.AssetsStart)); err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+	if classifications.CurrentLiabilities, err = headingOf("current liabilities", firstNonZero(indices.CurrentLiabilitiesStart, indices.LiabilitiesStart)); err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+	if classifications.StockholdersEquity, err = headingOf("equity", indices.EquityStart); err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+	classifications.TotalCurrentAssets = indices.CurrentAssetsEnd
+	classifications.TotalAssets = indices.AssetsEnd
+	classifications.TotalCurrentLiabilities = indices.CurrentLiabilitiesEnd
+	classifications.TotalLiabilities = indices.LiabilitiesEnd
+	classifications.TotalStockholdersEquity = indices.EquityEnd
+
+	classifications.TotalLiabilitiesEquityAndOtherEquity = -1
+	for i := indices.EquityEnd + 1; i < len(BalanceSheetArray); i++ {
+		if DoesDataCellExistInThisRow(BalanceSheetArray[i]) && !isOtherEquity(i) {
+			classifications.TotalLiabilitiesEquityAndOtherEquity = i
+		}
+	}
+	if classifications.TotalLiabilitiesEquityAndOtherEquity == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("no total liabilities and equity row with data after the end of equity %d", indices.EquityEnd)
+	}
+	if hasOtherEquities {
+		for i := indices.OtherEquityStart; i <= indices.OtherEquityEnd && i < len(BalanceSheetArray); i++ {
+			if DoesDataCellExistInThisRow(BalanceSheetArray[i]) {
+				classifications.OtherEquities = append(classifications.OtherEquities, i)
+			}
+		}
+	}
+
+	if err := validateBalanceSheetLineItemClassifications(BalanceSheetArray, classifications); err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+	return classifications, nil
+}
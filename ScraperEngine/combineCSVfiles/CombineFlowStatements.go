@@ -0,0 +1,355 @@
+package combinecsvfiles
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Income statements, comprehensive income statements and cash flow statements are flow statements:
+// they have no sections to line up like the balance sheet, but one filing has several columns for the same report period
+// (3 months ended and 9 months ended), so columns are told apart by accessionNumber, reportPeriod and reportDurationInMonths
+
+// FinancialStatementColumn is the metadata of one data column of a parsed R file or of a combined statement
+type FinancialStatementColumn struct {
+	AccessionNumber        string
+	Form                   string
+	ReportDate             string
+	Title                  string
+	Denomination           string
+	ReportPeriod           string
+	ReportDurationInMonths string
+	ValueSource            string // "reported" or "computed", empty for columns of parsed R files
+	DerivedFrom            string // the two columns a computed column was derived from, eg) "12M 0001837014-24-000010 - 9M 0001837014-23-000041"
+}
+
+// metadata rows of a combined statement, in the order of the row index constants in constants.go
+var metadataRowLabels = []string{"accessionNumber", "form", "reportDate", "", "denomination", "reportPeriod", "reportDurationInMonths", "separator"}
+
+// FindSeparatorRowIndex returns the index of the separator row that splits metadata rows from line item rows
+func FindSeparatorRowIndex(statement [][]string) int {
+	for i := 0; i < len(statement); i++ {
+		if len(statement[i]) > 0 && removeBOM(strings.TrimSpace(statement[i][0])) == "separator" {
+			return i
+		}
+	}
+	return -1
+}
+
+// FindMetadataRowIndex returns the index of the metadata row with the given label, -1 if it is not above the separator
+func FindMetadataRowIndex(statement [][]string, label string) int {
+	for i := 0; i < len(statement); i++ {
+		if len(statement[i]) == 0 {
+			continue
+		}
+		cleanedString := removeBOM(strings.TrimSpace(statement[i][0]))
+		if cleanedString == label {
+			return i
+		}
+		if cleanedString == "separator" {
+			break
+		}
+	}
+	return -1
+}
+
+// GetFinancialStatementColumns reads the metadata of every data column of a parsed R file or combined statement
+// the title is taken from the first header row that has no label (eg "3 Months Ended")
+func GetFinancialStatementColumns(statement [][]string) ([]FinancialStatementColumn, error) {
+	separatorRowIndex := FindSeparatorRowIndex(statement)
+	if separatorRowIndex == -1 {
+		return nil, errors.New("separator row not found")
+	}
+	accessionNumberRowIndex := FindMetadataRowIndex(statement, "accessionNumber")
+	reportPeriodRowIndex := FindMetadataRowIndex(statement, "reportPeriod")
+	if accessionNumberRowIndex == -1 || reportPeriodRowIndex == -1 {
+		return nil, errors.New("accessionNumber or reportPeriod row not found")
+	}
+	formRowIndex := FindMetadataRowIndex(statement, "form")
+	reportDateRowIndex := FindMetadataRowIndex(statement, "reportDate")
+	denominationRowIndex := FindMetadataRowIndex(statement, "denomination")
+	reportDurationRowIndex := FindMetadataRowIndex(statement, "reportDurationInMonths")
+	valueSourceRowIndex := FindMetadataRowIndex(statement, "valueSource")
+	derivedFromRowIndex := FindMetadataRowIndex(statement, "derivedFrom")
+	titleRowIndex := -1
+	for i := 0; i < separatorRowIndex; i++ {
+		if i != accessionNumberRowIndex && i != formRowIndex && i != reportDateRowIndex && i != denominationRowIndex && i != reportPeriodRowIndex && i != reportDurationRowIndex && i != valueSourceRowIndex && i != derivedFromRowIndex {
+			titleRowIndex = i
+			break
+		}
+	}
+
+	cellOf := func(rowIndex int, columnIndex int) string {
+		if rowIndex == -1 || columnIndex >= len(statement[rowIndex]) {
+			return ""
+		}
+		return statement[rowIndex][columnIndex]
+	}
+
+	columns := make([]FinancialStatementColumn, 0, len(statement[accessionNumberRowIndex])-1)
+	for j := 1; j < len(statement[accessionNumberRowIndex]); j++ {
+		columns = append(columns, FinancialStatementColumn{
+			AccessionNumber:        cellOf(accessionNumberRowIndex, j),
+			Form:                   cellOf(formRowIndex, j),
+			ReportDate:             cellOf(reportDateRowIndex, j),
+			Title:                  cellOf(titleRowIndex, j),
+			Denomination:           cellOf(denominationRowIndex, j),
+			ReportPeriod:           cellOf(reportPeriodRowIndex, j),
+			ReportDurationInMonths: cellOf(reportDurationRowIndex, j),
+			ValueSource:            cellOf(valueSourceRowIndex, j),
+			DerivedFrom:            cellOf(derivedFromRowIndex, j),
+		})
+	}
+	return columns, nil
+}
+
+// FillInMissingReportDurations sets reportDurationInMonths of 10-K columns without a "12 Months Ended" header to 12
+// a 10-Q column without a duration can't be guessed and is left empty
+func FillInMissingReportDurations(columns []FinancialStatementColumn) []FinancialStatementColumn {
+	for i := range columns {
+		if columns[i].ReportDurationInMonths == "" && strings.HasPrefix(columns[i].Form, "10-K") {
+			columns[i].ReportDurationInMonths = "12"
+		}
+	}
+	return columns
+}
+
+// BuildMetadataRowsOfCombinedStatement writes the columns back as the 8 metadata rows that every combined statement starts with
+// once a column has been computed, valueSource and derivedFrom rows are added right above the separator to tell computed columns
+// from reported ones and to show what they were computed from
+func BuildMetadataRowsOfCombinedStatement(title string, columns []FinancialStatementColumn) [][]string {
+	rows := make([][]string, len(metadataRowLabels))
+	for i, label := range metadataRowLabels {
+		rows[i] = append(make([]string, 0, len(columns)+1), label)
+	}
+	rows[TitleRowIndex][0] = title
+	hasComputedColumns := false
+	for _, column := range columns {
+		if column.ValueSource == "computed" {
+			hasComputedColumns = true
+		}
+	}
+	valueSourceRow := []string{"valueSource"}
+	derivedFromRow := []string{"derivedFrom"}
+	for _, column := range columns {
+		valueSource := column.ValueSource
+		if valueSource == "" {
+			valueSource = "reported"
+		}
+		valueSourceRow = append(valueSourceRow, valueSource)
+		derivedFromRow = append(derivedFromRow, column.DerivedFrom)
+		rows[AccessionNumberRowIndex] = append(rows[AccessionNumberRowIndex], column.AccessionNumber)
+		rows[FormRowIndex] = append(rows[FormRowIndex], column.Form)
+		rows[ReportDateRowIndex] = append(rows[ReportDateRowIndex], column.ReportDate)
+		rows[TitleRowIndex] = append(rows[TitleRowIndex], column.Title)
+		rows[DenominationRowIndex] = append(rows[DenominationRowIndex], column.Denomination)
+		rows[ReportPeriodRowIndex] = append(rows[ReportPeriodRowIndex], column.ReportPeriod)
+		rows[ReportDurationRowIndex] = append(rows[ReportDurationRowIndex], column.ReportDurationInMonths)
+		rows[SeparatorRowIndex] = append(rows[SeparatorRowIndex], "")
+	}
+	if hasComputedColumns {
+		rows = append(rows[:SeparatorRowIndex], valueSourceRow, derivedFromRow, rows[SeparatorRowIndex])
+	}
+	return rows
+}
+
+// QualifyDuplicateLineItemNames renames line items that appear more than once in the same statement
+// eg) "Basic" under "Earnings per share:" and "Basic" under "Weighted average shares:" become
+// "Earnings per share: - Basic" and "Weighted average shares: - Basic", otherwise the lookup by name always finds the first one
+func QualifyDuplicateLineItemNames(statement [][]string) [][]string {
+	separatorRowIndex := FindSeparatorRowIndex(statement)
+	count := make(map[string]int)
+	for i := separatorRowIndex + 1; i < len(statement); i++ {
+		if DoesDataCellExistInThisRow(statement[i]) {
+			count[normalizeLineItemName(statement[i][0])]++
+		}
+	}
+
+	qualified := make([][]string, len(statement))
+	copy(qualified, statement)
+	lastHeadingName := ""
+	usedNames := make(map[string]bool)
+	for i := separatorRowIndex + 1; i < len(qualified); i++ {
+		row := qualified[i]
+		if len(row) == 0 || row[0] == "" {
+			continue
+		}
+		if !DoesDataCellExistInThisRow(row) {
+			lastHeadingName = row[0]
+			continue
+		}
+		if count[normalizeLineItemName(row[0])] < 2 {
+			continue
+		}
+		qualifiedName := row[0]
+		if lastHeadingName != "" {
+			qualifiedName = lastHeadingName + " - " + row[0]
+		}
+		// two duplicates under the same heading, number them
+		for n := 2; usedNames[normalizeLineItemName(qualifiedName)]; n++ {
+			qualifiedName = fmt.Sprintf("%s (%d)", row[0], n)
+			if lastHeadingName != "" {
+				qualifiedName = fmt.Sprintf("%s - %s (%d)", lastHeadingName, row[0], n)
+			}
+		}
+		usedNames[normalizeLineItemName(qualifiedName)] = true
+		newRow := make([]string, len(row))
+		copy(newRow, row)
+		newRow[0] = qualifiedName
+		qualified[i] = newRow
+	}
+	return qualified
+}
+
+// CombineLineItemNamesOfTwoFlowStatementsInOrder keeps every line item of the first statement in its order and
+// puts each new line item of the second statement right after the line item it follows in the second statement
+func CombineLineItemNamesOfTwoFlowStatementsInOrder(statement1 [][]string, statement2 [][]string) []string {
+	var combinedLineItemNames []string
+	positionOf := make(map[string]int)
+	for i := FindSeparatorRowIndex(statement1) + 1; i < len(statement1); i++ {
+		if DoesDataCellExistInThisRow(statement1[i]) {
+			if _, exists := positionOf[normalizeLineItemName(statement1[i][0])]; exists {
+				continue
+			}
+			positionOf[normalizeLineItemName(statement1[i][0])] = len(combinedLineItemNames)
+			combinedLineItemNames = append(combinedLineItemNames, statement1[i][0])
+		}
+	}
+
+	insertAfter := -1 // position of the last line item of statement2 that is already in the combined list
+	for i := FindSeparatorRowIndex(statement2) + 1; i < len(statement2); i++ {
+		if !DoesDataCellExistInThisRow(statement2[i]) {
+			continue
+		}
+		name := normalizeLineItemName(statement2[i][0])
+		if position, exists := positionOf[name]; exists {
+			insertAfter = position
+			continue
+		}
+		insertAt := insertAfter + 1
+		combinedLineItemNames = append(combinedLineItemNames[:insertAt], append([]string{statement2[i][0]}, combinedLineItemNames[insertAt:]...)...)
+		for existingName, position := range positionOf {
+			if position >= insertAt {
+				positionOf[existingName] = position + 1
+			}
+		}
+		positionOf[name] = insertAt
+		insertAfter = insertAt
+	}
+	return combinedLineItemNames
+}
+
+// CombineTwoFlowStatements merges two income, comprehensive income or cash flow statements into one
+// the result always has the 8 metadata rows of constants.go followed by the line items
+func CombineTwoFlowStatements(statement1 [][]string, statement2 [][]string) ([][]string, error) {
+	statement1 = QualifyDuplicateLineItemNames(statement1)
+	statement2 = QualifyDuplicateLineItemNames(statement2)
+
+	columns1, err := GetFinancialStatementColumns(statement1)
+	if err != nil {
+		return nil, fmt.Errorf("first statement: %w", err)
+	}
+	columns2, err := GetFinancialStatementColumns(statement2)
+	if err != nil {
+		return nil, fmt.Errorf("second statement: %w", err)
+	}
+	columns1 = FillInMissingReportDurations(columns1)
+	columns2 = FillInMissingReportDurations(columns2)
+
+	type columnSource struct {
+		statement   [][]string
+		rowIndices  map[string]int
+		columnIndex int
+		column      FinancialStatementColumn
+	}
+	rowIndicesOfStatement1 := lineItemRowIndices(statement1)
+	rowIndicesOfStatement2 := lineItemRowIndices(statement2)
+	var sources []columnSource
+	for j, column := range columns1 {
+		sources = append(sources, columnSource{statement1, rowIndicesOfStatement1, j + 1, column})
+	}
+	for j, column := range columns2 {
+		sources = append(sources, columnSource{statement2, rowIndicesOfStatement2, j + 1, column})
+	}
+
+	sort.SliceStable(sources, func(a, b int) bool {
+		return lessFlowStatementColumn(sources[a].column, sources[b].column)
+	})
+
+	combinedColumns := make([]FinancialStatementColumn, len(sources))
+	for i, source := range sources {
+		combinedColumns[i] = source.column
+	}
+	title := ""
+	if len(statement1) > TitleRowIndex && len(statement1[TitleRowIndex]) > 0 {
+		title = statement1[TitleRowIndex][0]
+	}
+	combinedStatement := BuildMetadataRowsOfCombinedStatement(title, combinedColumns)
+
+	lineItemNames := CombineLineItemNamesOfTwoFlowStatementsInOrder(statement1, statement2)
+	for _, lineItemName := range lineItemNames {
+		row := make([]string, 0, len(sources)+1)
+		row = append(row, lineItemName)
+		for _, source := range sources {
+			cellValue := ""
+			if rowIndex, ok := source.rowIndices[normalizeLineItemName(lineItemName)]; ok && source.columnIndex < len(source.statement[rowIndex]) {
+				cellValue = cleanCellValue(source.statement[rowIndex][source.columnIndex])
+			}
+			row = append(row, cellValue)
+		}
+		combinedStatement = append(combinedStatement, row)
+	}
+
+	return combinedStatement, nil
+}
+
+// lessFlowStatementColumn orders columns by reportPeriod, then reportDurationInMonths so the 3 month column comes
+// before the 9 month column, then reportDate
+func lessFlowStatementColumn(columnA FinancialStatementColumn, columnB FinancialStatementColumn) bool {
+	if columnA.ReportPeriod != columnB.ReportPeriod {
+		return atoiOrZero(columnA.ReportPeriod) < atoiOrZero(columnB.ReportPeriod)
+	}
+	if columnA.ReportDurationInMonths != columnB.ReportDurationInMonths {
+		return atoiOrZero(columnA.ReportDurationInMonths) < atoiOrZero(columnB.ReportDurationInMonths)
+	}
+	return atoiOrZero(columnA.ReportDate) < atoiOrZero(columnB.ReportDate)
+}
+
+// lineItemRowIndices maps the normalized name of every line item row with data to its row index, the first one wins
+func lineItemRowIndices(statement [][]string) map[string]int {
+	rowIndices := make(map[string]int)
+	for i := FindSeparatorRowIndex(statement) + 1; i < len(statement); i++ {
+		if !DoesDataCellExistInThisRow(statement[i]) {
+			continue
+		}
+		name := normalizeLineItemName(statement[i][0])
+		if _, exists := rowIndices[name]; !exists {
+			rowIndices[name] = i
+		}
+	}
+	return rowIndices
+}
+
+// same normalization as LookupCellValueGivenHeaderAndMetadataCells
+func normalizeLineItemName(s string) string {
+	return strings.ReplaceAll(strings.ToLower(s), " ", "")
+}
+
+// keep the leading number of cells like -228us-gaap_AccumulatedOtherComprehensiveIncomeLossNetOfTax, decimals are kept for per share amounts
+var leadingNumberRegex = regexp.MustCompile(`^\s*(-?\d+(\.\d+)?)`)
+
+func cleanCellValue(cellValue string) string {
+	cellValue = strings.TrimSpace(cellValue)
+	if matches := leadingNumberRegex.FindStringSubmatch(cellValue); len(matches) > 1 {
+		return matches[1]
+	}
+	return cellValue
+}
+
+func atoiOrZero(s string) int {
+	value, _ := strconv.Atoi(s)
+	return value
+}
@@ -0,0 +1,84 @@
+package combinecsvfiles
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// CombinedStatementStore is where the published combined statements and their TTM are saved for the Backend
+type CombinedStatementStore interface {
+	// SaveCombinedStatement replaces the statement of the CIK and statement type
+	SaveCombinedStatement(doc CombinedStatementDoc) error
+	// SaveTrailingTwelveMonths replaces the TTM statement of the CIK and statement type
+	SaveTrailingTwelveMonths(doc TrailingTwelveMonthsDoc) error
+}
+
+// CombinedStatements is the store PublishCombinedStatementsGivenCIK and GenerateTrailingTwelveMonthsAndSaveAsCsvFileGivenCIK save to, main sets it to the one DATABASE_BACKEND picks
+var CombinedStatements CombinedStatementStore
+
+// MongoCombinedStatementStore saves to the combinedFinancialStatements collection of the published database
+type MongoCombinedStatementStore struct {
+	Client *mongo.Client
+}
+
+func (store MongoCombinedStatementStore) SaveCombinedStatement(doc CombinedStatementDoc) error {
+	return SaveCombinedStatementToMongoDB(doc, store.Client)
+}
+
+func (store MongoCombinedStatementStore) SaveTrailingTwelveMonths(doc TrailingTwelveMonthsDoc) error {
+	return SaveTrailingTwelveMonthsToMongoDB(doc, store.Client)
+}
+
+// SQLiteCombinedStatementStore saves to the combined_financial_statements and trailing_twelve_months tables of sqlitedatabase,
+// columns, data, provenance and gaps are saved as JSON in the layout the Mongo doc has
+type SQLiteCombinedStatementStore struct {
+	DB *sql.DB
+}
+
+func (store SQLiteCombinedStatementStore) SaveCombinedStatement(doc CombinedStatementDoc) error {
+	columns, err := json.Marshal(doc.Columns)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(doc.Data)
+	if err != nil {
+		return err
+	}
+	provenance, err := json.Marshal(doc.Provenance)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.DB.Exec(`INSERT INTO combined_financial_statements (cik, financial_statement_type, level, columns, data, provenance, generated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (cik, financial_statement_type) DO UPDATE SET
+			level = excluded.level, columns = excluded.columns, data = excluded.data,
+			provenance = excluded.provenance, generated_at = excluded.generated_at`,
+		doc.CIK, doc.FinancialStatementType, doc.Level, string(columns), string(data), string(provenance), doc.GeneratedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (store SQLiteCombinedStatementStore) SaveTrailingTwelveMonths(doc TrailingTwelveMonthsDoc) error {
+	data, err := json.Marshal(doc.Data)
+	if err != nil {
+		return err
+	}
+	gaps := doc.Gaps
+	if gaps == nil {
+		gaps = []TrailingTwelveMonthsGap{}
+	}
+	gapsJSON, err := json.Marshal(gaps)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.DB.Exec(`INSERT INTO trailing_twelve_months (cik, financial_statement_type, data, gaps, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (cik, financial_statement_type) DO UPDATE SET
+			data = excluded.data, gaps = excluded.gaps, updated_at = excluded.updated_at`,
+		doc.CIK, doc.FinancialStatementType, string(data), string(gapsJSON), doc.UpdatedAt.UTC().Format(time.RFC3339))
+	return err
+}
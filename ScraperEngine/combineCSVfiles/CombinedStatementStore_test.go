@@ -0,0 +1,157 @@
+package combinecsvfiles
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	sqlitedatabase "github.com/Programmerdin/FinancialDataSite_Go/sqliteDatabase"
+)
+
+// readCombinedStatement reads back what a store saved, false when there is no statement of the CIK and type
+type readCombinedStatement func(t *testing.T, CIK string, financialStatementType string) (CombinedStatementDoc, bool)
+
+func TestSQLiteCombinedStatementStore(t *testing.T) {
+	testCombinedStatementStore(t, func(t *testing.T) (CombinedStatementStore, readCombinedStatement) {
+		db, err := sqlitedatabase.Open(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		// the Backend reads the row the same way, columns, data and provenance as JSON
+		read := func(t *testing.T, CIK string, financialStatementType string) (CombinedStatementDoc, bool) {
+			doc := CombinedStatementDoc{CIK: CIK, FinancialStatementType: financialStatementType}
+			var columns, data, provenance, generatedAt string
+			err := db.QueryRow(`SELECT level, columns, data, provenance, generated_at FROM combined_financial_statements
+				WHERE cik = ? AND financial_statement_type = ?`, CIK, financialStatementType).Scan(&doc.Level, &columns, &data, &provenance, &generatedAt)
+			if errors.Is(err, sql.ErrNoRows) {
+				return CombinedStatementDoc{}, false
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range []struct {
+				value string
+				into  any
+			}{{columns, &doc.Columns}, {data, &doc.Data}, {provenance, &doc.Provenance}} {
+				if err := json.Unmarshal([]byte(field.value), field.into); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if doc.GeneratedAt, err = time.Parse(time.RFC3339, generatedAt); err != nil {
+				t.Fatal(err)
+			}
+			return doc, true
+		}
+		return SQLiteCombinedStatementStore{DB: db}, read
+	})
+}
+
+func TestSQLiteCombinedStatementStoreTrailingTwelveMonths(t *testing.T) {
+	db, err := sqlitedatabase.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store := SQLiteCombinedStatementStore{DB: db}
+
+	doc := func(revenue string, gaps []TrailingTwelveMonthsGap) TrailingTwelveMonthsDoc {
+		return TrailingTwelveMonthsDoc{
+			CIK:                    "0001837014",
+			FinancialStatementType: "IS",
+			Data:                   [][]string{{"reportPeriod", "20240331"}, {"separator"}, {"Revenue", revenue}},
+			Gaps:                   gaps,
+			UpdatedAt:              time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		}
+	}
+	if err := store.SaveTrailingTwelveMonths(doc("400", nil)); err != nil {
+		t.Fatal(err)
+	}
+	replacement := doc("", []TrailingTwelveMonthsGap{{ReportPeriod: "20240331", MissingPeriods: []string{"3M 20230630"}}})
+	if err := store.SaveTrailingTwelveMonths(replacement); err != nil {
+		t.Fatal(err)
+	}
+
+	// the Backend reads the row the same way, data and gaps as JSON
+	got := TrailingTwelveMonthsDoc{CIK: "0001837014", FinancialStatementType: "IS"}
+	var data, gaps, updatedAt string
+	err = db.QueryRow(`SELECT data, gaps, updated_at FROM trailing_twelve_months WHERE cik = ? AND financial_statement_type = ?`,
+		"0001837014", "IS").Scan(&data, &gaps, &updatedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(data), &got.Data); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(gaps), &got.Gaps); err != nil {
+		t.Fatal(err)
+	}
+	if got.UpdatedAt, err = time.Parse(time.RFC3339, updatedAt); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, replacement) {
+		t.Errorf("got %+v\nwant %+v", got, replacement)
+	}
+}
+
+// testCombinedStatementStore is what every CombinedStatementStore has to do, newStore returns an empty one
+func testCombinedStatementStore(t *testing.T, newStore func(t *testing.T) (CombinedStatementStore, readCombinedStatement)) {
+	doc := func(financialStatementType string, accessionNumber string, cash string) CombinedStatementDoc {
+		return CombinedStatementDoc{
+			CIK:                    "0001837014",
+			FinancialStatementType: financialStatementType,
+			Level:                  1,
+			Columns:                []CombinedStatementColumn{{AccessionNumber: accessionNumber, Form: "10-Q", ReportDate: "2024-03-31", ReportPeriod: "20240331", ReportDurationInMonths: "3"}},
+			Data:                   [][]string{{"accessionNumber", accessionNumber}, {"separator"}, {"Cash and cash equivalents", cash}},
+			Provenance: CombinedStatementProvenance{
+				SourceFile:       "combinedFinancialStatements/0001837014_combinedBalanceSheetLevel1.csv",
+				AccessionNumbers: []string{accessionNumber},
+				LineItems:        []CombinedStatementLineItemSource{{LineItem: "Cash and cash equivalents", Concept: "us-gaap:CashAndCashEquivalentsAtCarryingValue"}},
+			},
+			GeneratedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		}
+	}
+
+	t.Run("save replaces the statement of the CIK and type", func(t *testing.T) {
+		store, read := newStore(t)
+		if err := store.SaveCombinedStatement(doc("BS", "0001837014-24-000010", "100")); err != nil {
+			t.Fatal(err)
+		}
+		replacement := doc("BS", "0001837014-24-000020", "120")
+		replacement.Level = 2
+		if err := store.SaveCombinedStatement(replacement); err != nil {
+			t.Fatal(err)
+		}
+
+		got, found := read(t, "0001837014", "BS")
+		if !found {
+			t.Fatal("no BS saved")
+		}
+		if !reflect.DeepEqual(got, replacement) {
+			t.Errorf("got %+v\nwant %+v", got, replacement)
+		}
+	})
+
+	t.Run("statement types and CIKs are saved apart", func(t *testing.T) {
+		store, read := newStore(t)
+		for _, financialStatementType := range []string{"BS", "IS", "CF"} {
+			if err := store.SaveCombinedStatement(doc(financialStatementType, "0001837014-24-000010", financialStatementType)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, financialStatementType := range []string{"BS", "IS", "CF"} {
+			got, found := read(t, "0001837014", financialStatementType)
+			if !found || got.Data[2][1] != financialStatementType {
+				t.Errorf("%s = %v (found %v), want its own data", financialStatementType, got.Data, found)
+			}
+		}
+		if _, found := read(t, "0000320193", "BS"); found {
+			t.Error("found a BS of a CIK that wasn't saved")
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package combinecsvfiles
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 10-Q cash flow statements (and the income statement of the 10-K) only report year to date columns.
+// A discrete quarter is the difference of two year to date columns of the same fiscal year that end 3 months apart:
+// Q2 = 6M - 3M, Q3 = 9M - 6M, Q4 = 12M - 9M
+
+// fiscal quarters of 52/53 week filers don't end on the last day of the month
+const quarterEndToleranceInDays = 20
+
+// balance rows of the cash flow statement, subtracting them gives nonsense
+var endOfPeriodBalanceRegex = regexp.MustCompile(`(?i)end\s+of\s+(the\s+)?(period|year|quarter)`)
+var beginningOfPeriodBalanceRegex = regexp.MustCompile(`(?i)beginning\s+of\s+(the\s+)?(period|year|quarter)`)
+
+// the rows under an "Earnings per share:" heading that are only named by the heading, eg) "Basic", "Diluted", "Basic and diluted"
+var bareShareQualifierRegex = regexp.MustCompile(`(?i)^\s*(basic|diluted|basic\s+and\s+diluted)\s*:?\s*$`)
+
+// findStockItemRows returns the line item rows that are per share amounts or share counts. A row is one when its name matches
+// stockItemTerms or, for the bare "Basic" and "Diluted" rows, when the heading row above it does (eg "Earnings per share:").
+// Other rows under that heading, eg) "Dividends declared", are flows like any other row
+func findStockItemRows(statement [][]string, stockItemTerms []string) map[int]bool {
+	stockItemRows := make(map[int]bool)
+	heading := ""
+	for i := FindSeparatorRowIndex(statement) + 1; i < len(statement); i++ {
+		if len(statement[i]) == 0 || statement[i][0] == "" {
+			continue
+		}
+		if !DoesDataCellExistInThisRow(statement[i]) {
+			heading = statement[i][0]
+			continue
+		}
+		if containsAny(statement[i][0], stockItemTerms) || (bareShareQualifierRegex.MatchString(statement[i][0]) && containsAny(heading, stockItemTerms)) {
+			stockItemRows[i] = true
+		}
+	}
+	return stockItemRows
+}
+
+type reportPeriodKey struct {
+	reportPeriod string
+	duration     int
+}
+
+type columnWithCells struct {
+	column FinancialStatementColumn
+	cells  []string // one cell per row of the statement, metadata rows included
+}
+
+// DeriveFourthQuarterColumns adds Q4 = 12M - 9M for every fiscal year, companies never file a 10-Q for the fourth quarter
+func DeriveFourthQuarterColumns(statement [][]string, stockItemTerms []string) ([][]string, error) {
+	return DeriveDiscreteQuarterColumns(statement, []int{12}, stockItemTerms)
+}
+
+// DeriveDiscreteQuarterColumns adds a computed 3 month column for every year to date column whose duration is in durations,
+// unless a 3 month column for that report period is already reported. When several filings report the same year to date
+// period the one with the latest reportDate is used so restated numbers win.
+// Line items matching stockItemTerms (per share amounts, share counts) are left empty in the computed column.
+func DeriveDiscreteQuarterColumns(statement [][]string, durations []int, stockItemTerms []string) ([][]string, error) {
+	separatorRowIndex := FindSeparatorRowIndex(statement)
+	columns, err := GetFinancialStatementColumns(statement)
+	if err != nil {
+		return nil, err
+	}
+	columns = FillInMissingReportDurations(columns)
+
+	allColumns := make([]columnWithCells, len(columns))
+	for j, column := range columns {
+		cells := make([]string, len(statement))
+		for i := range statement {
+			if j+1 < len(statement[i]) {
+				cells[i] = statement[i][j+1]
+			}
+		}
+		allColumns[j] = columnWithCells{column, cells}
+	}
+
+	latestColumnOf, keys := latestColumnIndexOfEachReportPeriod(columns)
+	stockItemRows := findStockItemRows(statement, stockItemTerms)
+
+	endOfPeriodRowIndex := -1
+	for i := separatorRowIndex + 1; i < len(statement); i++ {
+		if len(statement[i]) > 0 && endOfPeriodBalanceRegex.MatchString(statement[i][0]) {
+			endOfPeriodRowIndex = i
+			break
+		}
+	}
+
+	for _, key := range keys {
+		if !containsInt(durations, key.duration) {
+			continue
+		}
+		if _, reported := latestColumnOf[reportPeriodKey{key.reportPeriod, 3}]; reported {
+			continue
+		}
+		priorKey, found := findPeriodEndingMonthsBefore(key.reportPeriod, 3, key.duration-3, keys)
+		if !found {
+			fmt.Printf("no %d month column ending 3 months before %s, can't derive the quarter from the %d month column\n", key.duration-3, key.reportPeriod, key.duration)
+			continue
+		}
+		yearToDate := allColumns[latestColumnOf[key]]
+		priorYearToDate := allColumns[latestColumnOf[priorKey]]
+
+		quarter := columnWithCells{
+			column: FinancialStatementColumn{
+				AccessionNumber:        yearToDate.column.AccessionNumber,
+				Form:                   yearToDate.column.Form,
+				ReportDate:             yearToDate.column.ReportDate,
+				Title:                  "3 Months Ended",
+				Denomination:           yearToDate.column.Denomination,
+				ReportPeriod:           key.reportPeriod,
+				ReportDurationInMonths: "3",
+				ValueSource:            "computed",
+				DerivedFrom: fmt.Sprintf("%dM %s - %dM %s", key.duration, yearToDate.column.AccessionNumber,
+					priorKey.duration, priorYearToDate.column.AccessionNumber),
+			},
+			cells: make([]string, len(statement)),
+		}
+		for i := separatorRowIndex + 1; i < len(statement); i++ {
+			if len(statement[i]) == 0 {
+				continue
+			}
+			switch {
+			case endOfPeriodBalanceRegex.MatchString(statement[i][0]):
+				quarter.cells[i] = yearToDate.cells[i]
+			case beginningOfPeriodBalanceRegex.MatchString(statement[i][0]):
+				// the quarter starts where the prior year to date period ended
+				if endOfPeriodRowIndex != -1 {
+					quarter.cells[i] = priorYearToDate.cells[endOfPeriodRowIndex]
+				}
+			case stockItemRows[i]:
+				// stock items are not summed over time, leave them empty rather than make up a number
+			default:
+				quarter.cells[i], _ = subtractCellValues(yearToDate.cells[i], priorYearToDate.cells[i])
+			}
+		}
+		allColumns = append(allColumns, quarter)
+	}
+
+	sort.SliceStable(allColumns, func(a, b int) bool {
+		return lessFlowStatementColumn(allColumns[a].column, allColumns[b].column)
+	})
+
+	sortedColumns := make([]FinancialStatementColumn, len(allColumns))
+	for j, column := range allColumns {
+		sortedColumns[j] = column.column
+	}
+	title := ""
+	if titleRowIndex := findTitleRowIndex(statement); titleRowIndex != -1 {
+		title = statement[titleRowIndex][0]
+	}
+	derivedStatement := BuildMetadataRowsOfCombinedStatement(title, sortedColumns)
+	for i := separatorRowIndex + 1; i < len(statement); i++ {
+		if len(statement[i]) == 0 {
+			continue
+		}
+		row := make([]string, 0, len(allColumns)+1)
+		row = append(row, statement[i][0])
+		for _, column := range allColumns {
+			row = append(row, column.cells[i])
+		}
+		derivedStatement = append(derivedStatement, row)
+	}
+	return derivedStatement, nil
+}
+
+// latestColumnIndexOfEachReportPeriod returns the index of the column with the latest reportDate for every reportPeriod and duration,
+// and the keys sorted oldest to newest
+func latestColumnIndexOfEachReportPeriod(columns []FinancialStatementColumn) (map[reportPeriodKey]int, []reportPeriodKey) {
+	latestColumnOf := make(map[reportPeriodKey]int)
+	for j, column := range columns {
+		key := reportPeriodKey{column.ReportPeriod, atoiOrZero(column.ReportDurationInMonths)}
+		if existing, ok := latestColumnOf[key]; !ok || atoiOrZero(column.ReportDate) > atoiOrZero(columns[existing].ReportDate) {
+			latestColumnOf[key] = j
+		}
+	}
+	keys := make([]reportPeriodKey, 0, len(latestColumnOf))
+	for key := range latestColumnOf {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if keys[a].reportPeriod != keys[b].reportPeriod {
+			return keys[a].reportPeriod < keys[b].reportPeriod
+		}
+		return keys[a].duration < keys[b].duration
+	})
+	return latestColumnOf, keys
+}
+
+// findPeriodEndingMonthsBefore finds the period of the given duration that ends about the given number of months before reportPeriod
+func findPeriodEndingMonthsBefore(reportPeriod string, months int, duration int, keys []reportPeriodKey) (reportPeriodKey, bool) {
+	end, err := time.Parse("20060102", reportPeriod)
+	if err != nil {
+		return reportPeriodKey{}, false
+	}
+	target := end.AddDate(0, -months, 0)
+	best, bestDistance := reportPeriodKey{}, math.MaxFloat64
+	for _, key := range keys {
+		if key.duration != duration {
+			continue
+		}
+		priorEnd, err := time.Parse("20060102", key.reportPeriod)
+		if err != nil {
+			continue
+		}
+		distance := math.Abs(priorEnd.Sub(target).Hours() / 24)
+		if distance <= quarterEndToleranceInDays && distance < bestDistance {
+			best, bestDistance = key, distance
+		}
+	}
+	return best, bestDistance != math.MaxFloat64
+}
+
+// subtractCellValues returns a - b rounded to the decimals of the inputs, false if either cell is not a number
+func subtractCellValues(a string, b string) (string, bool) {
+	return sumCellValues([]string{a, b}, []float64{1, -1})
+}
+
+// sumCellValues returns the sum of cells[i] * signs[i] rounded to the decimals of the inputs, false if any cell is not a number
+func sumCellValues(cells []string, signs []float64) (string, bool) {
+	sum := 0.0
+	decimals := 0
+	for i, cell := range cells {
+		cell = strings.TrimSpace(cell)
+		value, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return "", false
+		}
+		sum += value * signs[i]
+		decimals = max(decimals, decimalPlaces(cell))
+	}
+	result := strconv.FormatFloat(sum, 'f', decimals, 64)
+	if strings.Trim(result, "-0.") == "" {
+		result = strings.TrimPrefix(result, "-")
+	}
+	return result, true
+}
+
+func decimalPlaces(s string) int {
+	if index := strings.Index(s, "."); index != -1 {
+		return len(s) - index - 1
+	}
+	return 0
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// findTitleRowIndex returns the index of the metadata row that holds the column titles
+func findTitleRowIndex(statement [][]string) int {
+	for i := 0; i < FindSeparatorRowIndex(statement); i++ {
+		if len(statement[i]) > 0 && !isMetadataRowLabel(removeBOM(strings.TrimSpace(statement[i][0]))) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isMetadataRowLabel(label string) bool {
+	if label == "valueSource" || label == "derivedFrom" {
+		return true
+	}
+	for i, metadataRowLabel := range metadataRowLabels {
+		if i != TitleRowIndex && label == metadataRowLabel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package combinecsvfiles
+
+import (
+	"testing"
+)
+
+func TestDeriveFourthQuarterColumnsLeavesOnlyStockItemsEmpty(t *testing.T) {
+	columns := []FinancialStatementColumn{
+		{AccessionNumber: "a3", Form: "10-Q", ReportPeriod: "20230930", ReportDurationInMonths: "9"},
+		{AccessionNumber: "a4", Form: "10-K", ReportPeriod: "20231231", ReportDurationInMonths: "12"},
+	}
+	statement := append(BuildMetadataRowsOfCombinedStatement("Consolidated Statements of Operations - USD ($) $ in Millions", columns), [][]string{
+		{"Revenue", "90", "130"},
+		{"Net income", "30", "42"},
+		{"Earnings per share:", "", ""},
+		{"Basic", "0.30", "0.42"},
+		{"Diluted", "0.29", "0.41"},
+		{"Dividends declared", "9", "12"},
+		{"Net income attributable to noncontrolling interests", "3", "4"},
+		{"Weighted average shares outstanding", "100", "100"},
+	}...)
+
+	derived, err := DeriveFourthQuarterColumns(statement, testStockItemTerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	derivedColumns, err := GetFinancialStatementColumns(derived)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q4 := -1
+	for j, column := range derivedColumns {
+		if column.ReportPeriod == "20231231" && column.ReportDurationInMonths == "3" {
+			q4 = j
+		}
+	}
+	if q4 == -1 {
+		t.Fatalf("no Q4 column in %v", derivedColumns)
+	}
+
+	tests := []struct {
+		lineItem string
+		want     string
+	}{
+		{"Revenue", "40"},
+		{"Basic", ""},
+		{"Diluted", ""},
+		{"Dividends declared", "3"},
+		{"Net income attributable to noncontrolling interests", "1"},
+		{"Weighted average shares outstanding", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.lineItem, func(t *testing.T) {
+			row := rowOf(derived, test.lineItem)
+			if row == nil {
+				t.Fatal("row not found")
+			}
+			if row[q4] != test.want {
+				t.Errorf("Q4 = %q, want %q", row[q4], test.want)
+			}
+		})
+	}
+}
@@ -2,11 +2,10 @@ package combinecsvfiles
 
 import (
 	"fmt"
-	"path/filepath"
 	"reflect"
 	"strings"
 
-	utilityFunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
 
 	"go.mongodb.org/mongo-driver/mongo"
 )
@@ -24,22 +23,51 @@ type BalanceSheetLineItemClassifications struct {
 	OtherEquities                        []int
 }
 
-func GenerateLevel1CombinedBalanceSheetsAndSaveAsCsvFileGivenCIK(CIK string, client *mongo.Client) {
+func GenerateLevel1CombinedBalanceSheetsAndSaveAsCsvFileGivenCIK(CIK string, client *mongo.Client) error {
 	BalanceSheetArrays, _, _, _, err := GetCsvRfilesIntoArrayVariables(CIK, client)
 	if err != nil {
 		fmt.Println("Error getting CSV files:", err)
-		return
+		return err
+	}
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		fmt.Println("Error loading classification rules:", err)
+		return err
+	}
+	anchors := rules.BalanceSheetAnchors
+
+	//balance sheets a reviewer has submitted section boundaries for use them instead of being classified, see BalanceSheetReviewQueue.go
+	manualIndices, err := GetManualBalanceSheetIndicesGivenCIK(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting manual balance sheet indices:", err)
+		return err
 	}
 
 	var failedAccessionNumbers []string
+	var classifiedAccessionNumbers []string
 	var balanceSheetLineItemClassificationsSlice []BalanceSheetLineItemClassifications
 	for i := 0; i < len(BalanceSheetArrays); i++ {
 		BalanceSheetArray := BalanceSheetArrays[i]
 		accessionNumber := BalanceSheetArray[0][1]
-		BalanceSheetLineItemClassifications, err := classifyBalanceSheetLineItems(BalanceSheetArray)
+		var BalanceSheetLineItemClassifications BalanceSheetLineItemClassifications
+		var err error
+		if indices, ok := manualIndices[accessionNumber]; ok {
+			BalanceSheetLineItemClassifications, err = BalanceSheetClassificationsFromIndices(BalanceSheetArray, indices)
+			if err != nil {
+				err = fmt.Errorf("accession number: %s - manual section boundaries: %w", accessionNumber, err)
+			}
+		} else {
+			BalanceSheetLineItemClassifications, err = classifyBalanceSheetLineItemsWithFallback(BalanceSheetArray, anchors, client)
+			if err == nil {
+				classifiedAccessionNumbers = append(classifiedAccessionNumbers, accessionNumber)
+			}
+		}
 		if err != nil {
 			fmt.Printf("Error classifying balance sheet line items for accession number %s: %v\n", accessionNumber, err)
 			failedAccessionNumbers = append(failedAccessionNumbers, accessionNumber)
+			if err := SaveBalanceSheetForReview(CIK, BalanceSheetArray, err.Error(), client); err != nil {
+				fmt.Println("Error saving balance sheet for review:", err)
+			}
 			//remove the balance sheet from the slice
 			BalanceSheetArrays = append(BalanceSheetArrays[:i], BalanceSheetArrays[i+1:]...)
 			i-- // Decrement i since we removed an element
@@ -49,21 +77,49 @@ func GenerateLevel1CombinedBalanceSheetsAndSaveAsCsvFileGivenCIK(CIK string, cli
 		// fmt.Printf("Successfully classified balance sheet for accession number: %s\n", accessionNumber)
 		// fmt.Printf("Classifications: %+v\n", BalanceSheetLineItemClassifications)
 	}
+	if err := MarkBalanceSheetReviewsClassified(CIK, classifiedAccessionNumbers, client); err != nil {
+		fmt.Println("Error updating balance sheet reviews:", err)
+	}
 	if len(failedAccessionNumbers) > 0 {
 		fmt.Println("\nFailed to classify the following accession numbers:")
 		for _, accNum := range failedAccessionNumbers {
 			fmt.Printf("- %s\n", accNum)
 		}
-		fmt.Printf("Total failures: %d\n", len(failedAccessionNumbers))
+		fmt.Printf("Total failures: %d, queued for review\n", len(failedAccessionNumbers))
 	}
 	if len(balanceSheetLineItemClassificationsSlice) != len(BalanceSheetArrays) {
 		fmt.Println("Error: Number of balance sheets classified does not match number of balance sheets")
 	}
 	// fmt.Println(balanceSheetLineItemClassificationsSlice)
+	if len(balanceSheetLineItemClassificationsSlice) == 0 {
+		fmt.Println("Error: no balance sheet could be classified")
+		return fmt.Errorf("no balance sheet of %s could be classified, %d failed", CIK, len(failedAccessionNumbers))
+	}
+
+	//rename the line items of every balance sheet to one name per row before combining, see AlignLineItems.go
+	BSconcepts, _, _, _, err := GetLineItemConceptsByAccessionNumberGivenCIK(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting line item concepts:", err)
+		return err
+	}
+	aligner := NewLineItemAligner(BSconcepts)
+	for i := range BalanceSheetArrays {
+		BalanceSheetArrays[i] = aligner.AlignStatement(BalanceSheetArrays[i], balanceSheetSectionOfRow(balanceSheetLineItemClassificationsSlice[i]))
+	}
 
 	combinedBalanceSheetArray := BalanceSheetArrays[0]
+	combinedBalanceSheetClassifications := balanceSheetLineItemClassificationsSlice[0]
 	for i := 0; i < len(balanceSheetLineItemClassificationsSlice)-1; i++ {
-		combinedBalanceSheetArray = CombineTwoBalanceSheets(combinedBalanceSheetArray, BalanceSheetArrays[i+1])
+		if i > 0 {
+			//the combined balance sheet has the standard names for the title lines so the anchor rules classify it
+			combinedBalanceSheetClassifications, err = classifyBalanceSheetLineItemsWithFallback(combinedBalanceSheetArray, anchors, client)
+			if err != nil {
+				// the classification of the previous combine no longer fits the rows, combining with it would put line items in the wrong sections
+				fmt.Println("Error classifying the combined balance sheet:", err)
+				return fmt.Errorf("classifying the combined balance sheet of %s after %d balance sheets: %w", CIK, i+1, err)
+			}
+		}
+		combinedBalanceSheetArray = CombineTwoBalanceSheets(combinedBalanceSheetArray, BalanceSheetArrays[i+1], combinedBalanceSheetClassifications, balanceSheetLineItemClassificationsSlice[i+1])
 	}
 
 	fmt.Print("Combined Balance Sheet Array: [\n")
@@ -76,18 +132,34 @@ func GenerateLevel1CombinedBalanceSheetsAndSaveAsCsvFileGivenCIK(CIK string, cli
 	}
 	fmt.Print("]\n")
 
-	//convert combinedBalanceSheetArray to csv file and save it to SEC-files/combinedFinancialStatements
-	directory := filepath.Join("SEC-files", "combinedFinancialStatements")
-	fileName := CIK + "_combinedBalanceSheetLevel1.csv"
-	if err := utilityFunctions.Save2DarrayToCsvFile(combinedBalanceSheetArray, directory, fileName); err != nil {
-		fmt.Printf("Error saving CSV file: %v\n", err)
-		return
-	}
-	fmt.Printf("Successfully saved combined balance sheet to %s\n", filepath.Join(directory, fileName))
+	return saveLevel1CombinedStatement(CIK, "BalanceSheet", "balance sheet", combinedBalanceSheetArray, aligner)
+}
 
+// balanceSheetSectionOfRow puts the line items of a balance sheet in the same sections CombineTwoBalanceSheets uses,
+// the header and total rows are renamed by CombineTwoBalanceSheets itself so they are left out
+func balanceSheetSectionOfRow(classifications BalanceSheetLineItemClassifications) func(rowIndex int) (string, bool) {
+	return func(rowIndex int) (string, bool) {
+		switch {
+		case classifications.CurrentAssets < rowIndex && rowIndex < classifications.TotalCurrentAssets:
+			return "Current Assets", true
+		case classifications.TotalCurrentAssets < rowIndex && rowIndex < classifications.TotalAssets:
+			return "Non Current Assets", true
+		case classifications.CurrentLiabilities < rowIndex && rowIndex < classifications.TotalCurrentLiabilities:
+			return "Current Liabilities", true
+		case classifications.TotalCurrentLiabilities < rowIndex && rowIndex < classifications.TotalLiabilities:
+			return "Non Current Liabilities", true
+		case classifications.StockholdersEquity < rowIndex && rowIndex < classifications.TotalStockholdersEquity:
+			return "Stockholders' Equity", true
+		case containsInt(classifications.OtherEquities, rowIndex):
+			return "Other Equities", true
+		}
+		return "", false
+	}
 }
 
-func CombineTwoBalanceSheets(BalanceSheet1Array [][]string, BalanceSheet2Array [][]string) (CombinedBalanceSheet [][]string) {
+// CombineTwoBalanceSheets takes the classifications of both balance sheets instead of classifying them again,
+// so balance sheets classified from manual section boundaries can be combined too
+func CombineTwoBalanceSheets(BalanceSheet1Array [][]string, BalanceSheet2Array [][]string, BalanceSheet1Classifications BalanceSheetLineItemClassifications, BalanceSheet2Classifications BalanceSheetLineItemClassifications) (CombinedBalanceSheet [][]string) {
 	//go thru the combinedBalanceSheetLineItems and essentailly create a new balance sheet
 	//for new balance sheet, we basically draw out the left col and the top rows for dates n stuff
 	// and for each cell we do find a value that matches all the left col and top rows for the given cell in two input balancesheet arrays
@@ -111,15 +183,6 @@ func CombineTwoBalanceSheets(BalanceSheet1Array [][]string, BalanceSheet2Array [
 	combinedBalanceSheetArray = RearrangeAllColumns(combinedBalanceSheetArray, rearrangedColumnIndices)
 
 	//add in line item names
-	BalanceSheet1Classifications, err := classifyBalanceSheetLineItems(BalanceSheet1Array)
-	if err != nil {
-		fmt.Println(err)
-	}
-	BalanceSheet2Classifications, err := classifyBalanceSheetLineItems(BalanceSheet2Array)
-	if err != nil {
-		fmt.Println(err)
-	}
-
 	//convert the title line item names to the names I want to use, otherwise FillInDataCells wont work properly
 	//ex) if the OG line item name is "Total Shareholders' Equity" but since the combinedBalanceSheet has "Total Stockholders' Equity" and FIllinDataCEll funciton only matches exact match so it won't find the line item.
 	//resulting in a combinedbalance sheet with missing data cells
@@ -328,7 +391,7 @@ func CombineLineItemNamesOfTwoBalanceSheetsIntoOne(BalanceSheet1Array [][]string
 
 }
 
-func classifyBalanceSheetLineItems(BalanceSheetArray [][]string) (BalanceSheetLineItemClassifications, error) {
+func classifyBalanceSheetLineItems(BalanceSheetArray [][]string, anchors classificationrules.BalanceSheetAnchorRules) (BalanceSheetLineItemClassifications, error) {
 	var (
 		currentAssetsRowIndex                        int = -1 // Using -1 as sentinel value
 		totalCurrentAssetsRowIndex                   int = -1
@@ -359,31 +422,31 @@ func classifyBalanceSheetLineItems(BalanceSheetArray [][]string) (BalanceSheetLi
 		if len(row) == 0 {
 			continue // Skip empty rows
 		}
-		if containsAny(row[0], []string{"Current Assets"}) && currentAssetsRowIndex == -1 {
+		if containsAny(row[0], anchors.CurrentAssets) && currentAssetsRowIndex == -1 {
 			currentAssetsRowIndex = i
 		}
-		if containsAny(row[0], []string{"Total Current Assets"}) && totalCurrentAssetsRowIndex == -1 && DoesDataCellExistInThisRow(row) {
+		if containsAny(row[0], anchors.TotalCurrentAssets) && totalCurrentAssetsRowIndex == -1 && DoesDataCellExistInThisRow(row) {
 			totalCurrentAssetsRowIndex = i
 		}
-		if containsAny(row[0], []string{"Total Assets"}) && totalAssetsRowIndex == -1 && DoesDataCellExistInThisRow(row) {
+		if containsAny(row[0], anchors.TotalAssets) && totalAssetsRowIndex == -1 && DoesDataCellExistInThisRow(row) {
 			totalAssetsRowIndex = i
 		}
-		if containsAny(row[0], []string{"Current Liabilities"}) && currentLiabilitiesRowIndex == -1 {
+		if containsAny(row[0], anchors.CurrentLiabilities) && currentLiabilitiesRowIndex == -1 {
 			currentLiabilitiesRowIndex = i
 		}
-		if containsAny(row[0], []string{"Total Current Liabilities"}) && totalCurrentLiabilitiesRowIndex == -1 && DoesDataCellExistInThisRow(row) {
+		if containsAny(row[0], anchors.TotalCurrentLiabilities) && totalCurrentLiabilitiesRowIndex == -1 && DoesDataCellExistInThisRow(row) {
 			totalCurrentLiabilitiesRowIndex = i
 		}
-		if containsAny(row[0], []string{"Total Liabilities"}) && totalLiabilitiesRowIndex == -1 && DoesDataCellExistInThisRow(row) {
+		if containsAny(row[0], anchors.TotalLiabilities) && totalLiabilitiesRowIndex == -1 && DoesDataCellExistInThisRow(row) {
 			totalLiabilitiesRowIndex = i
 		}
-		if containsAny(row[0], []string{"Stockholders' Equity", "Shareholders' Equity", "Shareowners' Equity", "Equity"}) && notContainsAny(row[0], []string{"Investment", "marketable", "securities"}) && stockholdersEquityRowIndex == -1 {
+		if containsAny(row[0], anchors.StockholdersEquity) && notContainsAny(row[0], anchors.StockholdersEquityExclusionTerms) && stockholdersEquityRowIndex == -1 {
 			stockholdersEquityRowIndex = i
 		}
-		if containsAny(row[0], []string{"Total Stockholders' Equity", "Total Shareholders' Equity", "Total Shareowners' Equity", "Total Equity"}) && notContainsAny(row[0], []string{"Investment", "marketable", "securities"}) && totalStockholdersEquityRowIndex == -1 && DoesDataCellExistInThisRow(row) {
+		if containsAny(row[0], anchors.TotalStockholdersEquity) && notContainsAny(row[0], anchors.StockholdersEquityExclusionTerms) && totalStockholdersEquityRowIndex == -1 && DoesDataCellExistInThisRow(row) {
 			totalStockholdersEquityRowIndex = i
 		}
-		if CheckWordsInOrder(row[0], []string{"Total Liabilities", "and", "Equity"}) && totalLiabilitiesEquityAndOtherEquityRowIndex == -1 && DoesDataCellExistInThisRow(row) {
+		if CheckWordsInOrder(row[0], anchors.TotalLiabilitiesAndEquityWordsInOrder) && totalLiabilitiesEquityAndOtherEquityRowIndex == -1 && DoesDataCellExistInThisRow(row) {
 			totalLiabilitiesEquityAndOtherEquityRowIndex = i
 		}
 
@@ -444,77 +507,7 @@ func classifyBalanceSheetLineItems(BalanceSheetArray [][]string) (BalanceSheetLi
 			totalLiabilitiesEquityAndOtherEquityRowIndex)
 	}
 
-	//check if all data cell rows are accouneted for
-	var dataCellRowIndex []int
-	for i := SeparatorRowIndex + 1; i < len(BalanceSheetArray); i++ {
-		if len(BalanceSheetArray[i]) == 0 {
-			continue // Skip empty rows
-		}
-		if DoesDataCellExistInThisRow(BalanceSheetArray[i]) {
-			dataCellRowIndex = append(dataCellRowIndex, i)
-		}
-	}
-	var accountedForRowIndex []int
-	//currentAssetsRowIndex to totalAssetsRowIndex
-	//currentLiabilitiesRowIndex to totalLiabilitiesRowIndex
-	//stocholdersEquityRowIndex to totalLiabilitiesEquityAndOtherEquityRowIndex
-	//otherEquitiesRowIndex
-	for i := currentAssetsRowIndex + 1; i <= totalAssetsRowIndex; i++ {
-		accountedForRowIndex = append(accountedForRowIndex, i)
-	}
-	for i := currentLiabilitiesRowIndex + 1; i <= totalLiabilitiesRowIndex; i++ {
-		accountedForRowIndex = append(accountedForRowIndex, i)
-	}
-	for i := stockholdersEquityRowIndex + 1; i <= totalLiabilitiesEquityAndOtherEquityRowIndex; i++ {
-		accountedForRowIndex = append(accountedForRowIndex, i)
-	}
-	accountedForRowIndex = append(accountedForRowIndex, otherEquitiesRowIndex...)
-
-	// Check if there are any data cell rows that are not accounted for
-	for _, dataRow := range dataCellRowIndex {
-		found := false
-		for _, accountedRow := range accountedForRowIndex {
-			if dataRow == accountedRow {
-				found = true
-				break
-			}
-		}
-		if !found {
-			// fmt.Println(
-			// 	"currentAssets", currentAssetsRowIndex,
-			// 	"totalCurrentAssets", totalCurrentAssetsRowIndex,
-			// 	"totalAssets", totalAssetsRowIndex,
-			// 	"currentLiabilities", currentLiabilitiesRowIndex,
-			// 	"totalCurrentLiabilities", totalCurrentLiabilitiesRowIndex,
-			// 	"totalLiabilities", totalLiabilitiesRowIndex,
-			// 	"stockholdersEquity", stockholdersEquityRowIndex,
-			// 	"totalStockholdersEquity", totalStockholdersEquityRowIndex,
-			// 	"totalLiabilitiesEquityAndOtherEquity", totalLiabilitiesEquityAndOtherEquityRowIndex,
-			// 	"otherEquities", otherEquitiesRowIndex,
-			// )
-			return BalanceSheetLineItemClassifications{},
-				fmt.Errorf("accession number: %s - found unaccounted data cell at row %d", accessionNumber, dataRow)
-		}
-	}
-
-	//check if OtherEquities have duplicate line item names
-	var lineItemNames []string
-	for _, rowIndex := range otherEquitiesRowIndex {
-		row := BalanceSheetArray[rowIndex]
-		if len(row) == 0 {
-			continue // Skip empty rows
-		}
-		lineItemName := row[0]
-		// Check for exact match
-		for _, existingName := range lineItemNames {
-			if lineItemName == existingName {
-				return BalanceSheetLineItemClassifications{}, fmt.Errorf("duplicate lineItemName found in the financial statement: OtherEquities: %s", lineItemName)
-			}
-		}
-		lineItemNames = append(lineItemNames, lineItemName)
-	}
-
-	return BalanceSheetLineItemClassifications{
+	classifications := BalanceSheetLineItemClassifications{
 		CurrentAssets:                        currentAssetsRowIndex,
 		TotalCurrentAssets:                   totalCurrentAssetsRowIndex,
 		TotalAssets:                          totalAssetsRowIndex,
@@ -525,7 +518,24 @@ func classifyBalanceSheetLineItems(BalanceSheetArray [][]string) (BalanceSheetLi
 		TotalStockholdersEquity:              totalStockholdersEquityRowIndex,
 		TotalLiabilitiesEquityAndOtherEquity: totalLiabilitiesEquityAndOtherEquityRowIndex,
 		OtherEquities:                        otherEquitiesRowIndex,
-	}, nil
+	}
+
+	//check if all data cell rows are accouneted for
+	//currentAssetsRowIndex to totalAssetsRowIndex
+	//currentLiabilitiesRowIndex to totalLiabilitiesRowIndex
+	//stocholdersEquityRowIndex to totalLiabilitiesEquityAndOtherEquityRowIndex
+	//otherEquitiesRowIndex
+	if dataRow, found := findUnaccountedDataRow(BalanceSheetArray, classifications); found {
+		return BalanceSheetLineItemClassifications{},
+			fmt.Errorf("accession number: %s - found unaccounted data cell at row %d", accessionNumber, dataRow)
+	}
+
+	//check if OtherEquities have duplicate line item names
+	if err := findDuplicateOtherEquityName(BalanceSheetArray, otherEquitiesRowIndex); err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+
+	return classifications, nil
 }
 
 // PrintBalanceSheetFields demonstrates how to iterate through the fields of BalanceSheetLineItemClassifications
@@ -0,0 +1,43 @@
+package combinecsvfiles
+
+import (
+	"fmt"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GenerateLevel1CombinedCashFlowStatementsAndSaveAsCsvFileGivenCIK merges the cash flow statement of every filing of the CIK
+// and adds a computed 3 month column for each quarter that is only reported as part of a 6, 9 or 12 month year to date column
+func GenerateLevel1CombinedCashFlowStatementsAndSaveAsCsvFileGivenCIK(CIK string, client *mongo.Client) error {
+	_, _, _, CashflowStatementArrays, err := GetCsvRfilesIntoArrayVariables(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting CSV files:", err)
+		return err
+	}
+
+	_, _, _, CFconcepts, err := GetLineItemConceptsByAccessionNumberGivenCIK(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting line item concepts:", err)
+		return err
+	}
+	aligner := NewLineItemAligner(CFconcepts)
+	combinedCashFlowStatementArray, err := CombineFlowStatementArrays(CashflowStatementArrays, aligner)
+	if err != nil {
+		fmt.Println("Error combining cash flow statements:", err)
+		return err
+	}
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		fmt.Println("Error loading classification rules:", err)
+		return err
+	}
+	combinedCashFlowStatementArray, err = DeriveDiscreteQuarterColumns(combinedCashFlowStatementArray, []int{6, 9, 12}, rules.FlowStatements.StockItemTerms)
+	if err != nil {
+		fmt.Println("Error deriving quarters of cash flow statements:", err)
+		return err
+	}
+
+	return saveLevel1CombinedStatement(CIK, "CashFlowStatement", "cash flow statement", combinedCashFlowStatementArray, aligner)
+}
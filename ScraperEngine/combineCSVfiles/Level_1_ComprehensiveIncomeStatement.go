@@ -0,0 +1,135 @@
+package combinecsvfiles
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// some filers fold the comprehensive income statement into the income statement ("Statements of Operations and Comprehensive Loss"),
+// those are categorized as IS and the other comprehensive income section has to be cut out of the IS R file
+var otherComprehensiveIncomeRegex = regexp.MustCompile(`(?i)other\s+comprehensive`)
+var comprehensiveIncomeRegex = regexp.MustCompile(`(?i)comprehensive\s+(\(?income|\(?loss|\(?earnings)`)
+var netIncomeRegex = regexp.MustCompile(`(?i)^\s*net\s+(\(?income|\(?loss|\(?earnings)`)
+var perShareRegex = regexp.MustCompile(`(?i)per\s+(common\s+)?share`)
+
+// ErrNoComprehensiveIncomeStatement is returned when no filing of the CIK has a comprehensive income statement,
+// plenty of companies have no other comprehensive income so the CIS is optional
+var ErrNoComprehensiveIncomeStatement = errors.New("no filing has a comprehensive income statement")
+
+// GenerateLevel1CombinedComprehensiveIncomeStatementsAndSaveAsCsvFileGivenCIK merges the comprehensive income statement of every filing
+// of the CIK, filings without a CIS R file use the other comprehensive income section of their income statement instead
+func GenerateLevel1CombinedComprehensiveIncomeStatementsAndSaveAsCsvFileGivenCIK(CIK string, client *mongo.Client) error {
+	ComprehensiveIncomeStatementArrays, err := GetComprehensiveIncomeStatementArraysGivenCIK(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting CSV files:", err)
+		return err
+	}
+	if len(ComprehensiveIncomeStatementArrays) == 0 {
+		return ErrNoComprehensiveIncomeStatement
+	}
+
+	_, _, CISconcepts, _, err := GetLineItemConceptsByAccessionNumberGivenCIK(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting line item concepts:", err)
+		return err
+	}
+	aligner := NewLineItemAligner(CISconcepts)
+	combinedComprehensiveIncomeStatementArray, err := CombineFlowStatementArrays(ComprehensiveIncomeStatementArrays, aligner)
+	if err != nil {
+		fmt.Println("Error combining comprehensive income statements:", err)
+		return err
+	}
+
+	return saveLevel1CombinedStatement(CIK, "ComprehensiveIncomeStatement", "comprehensive income statement", combinedComprehensiveIncomeStatementArray, aligner)
+}
+
+// GetComprehensiveIncomeStatementArraysGivenCIK returns one comprehensive income statement per filing, oldest to newest,
+// taken from the CIS R file or split out of the IS R file when the filing has no separate CIS
+func GetComprehensiveIncomeStatementArraysGivenCIK(CIK string, client *mongo.Client) ([][][]string, error) {
+	filings, err := RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate(CIK)
+	if err != nil {
+		fmt.Println("RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate", err)
+		return nil, err
+	}
+	_, ISfilePaths, CISfilePaths, _, err := GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings(filings)
+	if err != nil {
+		fmt.Println("GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings", err)
+		return nil, err
+	}
+
+	CIS_arrays := [][][]string{}
+	for i := range CISfilePaths {
+		if CISfilePaths[i] != "" {
+			financialStatement, err := storage.GetCsv(storage.SECFiles, CISfilePaths[i])
+			if err != nil {
+				fmt.Println("Error reading CSV file:", err)
+				return nil, err
+			}
+			CIS_arrays = append(CIS_arrays, financialStatement)
+			continue
+		}
+		if ISfilePaths[i] == "" {
+			continue
+		}
+		financialStatement, err := storage.GetCsv(storage.SECFiles, ISfilePaths[i])
+		if err != nil {
+			fmt.Println("Error reading CSV file:", err)
+			return nil, err
+		}
+		if _, comprehensiveIncomeStatement, found := SplitComprehensiveIncomeOutOfIncomeStatement(financialStatement); found {
+			CIS_arrays = append(CIS_arrays, comprehensiveIncomeStatement)
+		}
+	}
+	return CIS_arrays, nil
+}
+
+// SplitComprehensiveIncomeOutOfIncomeStatement cuts the other comprehensive income section, from the first "Other comprehensive" row
+// to the last "Comprehensive income/loss" row, out of an income statement. The comprehensive income statement gets the metadata rows,
+// the net income row right above the section and the section itself, the income statement keeps everything else (eg EPS rows below).
+// found is false when the statement has no such section, the statement is then returned as is.
+func SplitComprehensiveIncomeOutOfIncomeStatement(statement [][]string) (incomeStatement [][]string, comprehensiveIncomeStatement [][]string, found bool) {
+	separatorRowIndex := FindSeparatorRowIndex(statement)
+	if separatorRowIndex == -1 {
+		return statement, nil, false
+	}
+
+	sectionStartRowIndex := -1
+	for i := separatorRowIndex + 1; i < len(statement); i++ {
+		if len(statement[i]) > 0 && otherComprehensiveIncomeRegex.MatchString(statement[i][0]) {
+			sectionStartRowIndex = i
+			break
+		}
+	}
+	if sectionStartRowIndex == -1 {
+		return statement, nil, false
+	}
+	sectionEndRowIndex := sectionStartRowIndex
+	for i := sectionStartRowIndex; i < len(statement); i++ {
+		if len(statement[i]) > 0 && comprehensiveIncomeRegex.MatchString(statement[i][0]) {
+			sectionEndRowIndex = i
+		}
+	}
+
+	netIncomeRowIndex := -1
+	for i := sectionStartRowIndex - 1; i > separatorRowIndex; i-- {
+		if netIncomeRegex.MatchString(statement[i][0]) && !perShareRegex.MatchString(statement[i][0]) && DoesDataCellExistInThisRow(statement[i]) {
+			netIncomeRowIndex = i
+			break
+		}
+	}
+
+	comprehensiveIncomeStatement = append(comprehensiveIncomeStatement, statement[:separatorRowIndex+1]...)
+	if netIncomeRowIndex != -1 {
+		comprehensiveIncomeStatement = append(comprehensiveIncomeStatement, statement[netIncomeRowIndex])
+	}
+	comprehensiveIncomeStatement = append(comprehensiveIncomeStatement, statement[sectionStartRowIndex:sectionEndRowIndex+1]...)
+
+	incomeStatement = append(incomeStatement, statement[:sectionStartRowIndex]...)
+	incomeStatement = append(incomeStatement, statement[sectionEndRowIndex+1:]...)
+	return incomeStatement, comprehensiveIncomeStatement, true
+}
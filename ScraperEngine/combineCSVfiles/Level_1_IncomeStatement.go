@@ -0,0 +1,94 @@
+package combinecsvfiles
+
+import (
+	"fmt"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// GenerateLevel1CombinedIncomeStatementsAndSaveAsCsvFileGivenCIK merges the income statement of every filing of the CIK
+// into one CSV with a column per accessionNumber, reportPeriod and reportDurationInMonths (3, 6, 9 and 12 month columns side by side)
+// plus a computed fourth quarter column for every fiscal year
+func GenerateLevel1CombinedIncomeStatementsAndSaveAsCsvFileGivenCIK(CIK string, client *mongo.Client) error {
+	_, IncomeStatementArrays, _, _, err := GetCsvRfilesIntoArrayVariables(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting CSV files:", err)
+		return err
+	}
+
+	// drop the other comprehensive income section of "Statements of Operations and Comprehensive Income", it goes into the combined CIS
+	for i := range IncomeStatementArrays {
+		IncomeStatementArrays[i], _, _ = SplitComprehensiveIncomeOutOfIncomeStatement(IncomeStatementArrays[i])
+	}
+
+	_, ISconcepts, _, _, err := GetLineItemConceptsByAccessionNumberGivenCIK(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting line item concepts:", err)
+		return err
+	}
+	aligner := NewLineItemAligner(ISconcepts)
+	combinedIncomeStatementArray, err := CombineFlowStatementArrays(IncomeStatementArrays, aligner)
+	if err != nil {
+		fmt.Println("Error combining income statements:", err)
+		return err
+	}
+
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		fmt.Println("Error loading classification rules:", err)
+		return err
+	}
+	combinedIncomeStatementArray, err = DeriveFourthQuarterColumns(combinedIncomeStatementArray, rules.FlowStatements.StockItemTerms)
+	if err != nil {
+		fmt.Println("Error deriving fourth quarters of income statements:", err)
+		return err
+	}
+
+	return saveLevel1CombinedStatement(CIK, "IncomeStatement", "income statement", combinedIncomeStatementArray, aligner)
+}
+
+// CombineFlowStatementArrays folds the statements oldest to newest with CombineTwoFlowStatements,
+// a statement without the metadata rows is skipped and reported instead of failing the whole CIK.
+// The line items of each statement are renamed by the aligner first, nil combines them by name only.
+func CombineFlowStatementArrays(statementArrays [][][]string, aligner *LineItemAligner) ([][]string, error) {
+	var combinedStatementArray [][]string
+	var failedAccessionNumbers []string
+	for _, statementArray := range statementArrays {
+		if _, err := GetFinancialStatementColumns(statementArray); err != nil {
+			accessionNumber := ""
+			if len(statementArray) > 0 && len(statementArray[0]) > 1 {
+				accessionNumber = statementArray[0][1]
+			}
+			fmt.Printf("Skipping statement of accession number %s: %v\n", accessionNumber, err)
+			failedAccessionNumbers = append(failedAccessionNumbers, accessionNumber)
+			continue
+		}
+		if aligner != nil {
+			statementArray = aligner.AlignStatement(statementArray, nil)
+		}
+		if combinedStatementArray == nil {
+			// combining with an empty statement normalizes the metadata rows and cell values of the first one
+			combined, err := CombineTwoFlowStatements(statementArray, [][]string{{"accessionNumber"}, {"reportPeriod"}, {"separator"}})
+			if err != nil {
+				return nil, err
+			}
+			combinedStatementArray = combined
+			continue
+		}
+		combined, err := CombineTwoFlowStatements(combinedStatementArray, statementArray)
+		if err != nil {
+			return nil, err
+		}
+		combinedStatementArray = combined
+	}
+
+	if len(failedAccessionNumbers) > 0 {
+		fmt.Printf("Total statements skipped: %d %v\n", len(failedAccessionNumbers), failedAccessionNumbers)
+	}
+	if combinedStatementArray == nil {
+		return nil, fmt.Errorf("no statement to combine")
+	}
+	return combinedStatementArray, nil
+}
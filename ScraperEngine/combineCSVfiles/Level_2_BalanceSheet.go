@@ -2,32 +2,34 @@ package combinecsvfiles
 
 import (
 	"fmt"
-	"path/filepath"
 	"strconv"
 	"strings"
 
-	utilityFunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 )
 
-func TesterFunctionForLevel2BalanceSheets(CIK string) [][]string {
-	base_directory := filepath.Join("SEC-files", "combinedFinancialStatements")
-	fileName := CIK + "_combinedBalanceSheetLevel1.csv"
-	filepath := filepath.Join(base_directory, fileName)
-	Level1BalanceSheetArray, err := utilityFunctions.ReadCsvFileToArray(filepath)
+func TesterFunctionForLevel2BalanceSheets(CIK string) ([][]string, error) {
+	Level1BalanceSheetArray, err := storage.GetCsv(storage.SECFiles, storage.CombinedStatementKey(CIK+"_combinedBalanceSheetLevel1.csv"))
 	if err != nil {
 		fmt.Println("Error reading CSV file:", err)
-		return nil
+		return nil, err
 	}
 	Level1BalanceSheetArray, _ = DeleteDuplicateBalanceSheetColumnsWithSameReportPeriodAndKeepTheMostRecentReportDateColumn(Level1BalanceSheetArray)
-	utilityFunctions.Save2DarrayToCsvFile(Level1BalanceSheetArray, base_directory, CIK+"_test.csv")
+	if err := storage.PutCsv(storage.SECFiles, storage.CombinedStatementKey(CIK+"_test.csv"), Level1BalanceSheetArray); err != nil {
+		fmt.Printf("Error saving CSV file: %v\n", err)
+		return nil, err
+	}
 	fmt.Println("check 1")
 
 	BalanceSheetArrayInProcess, _ := DeleteEmptyLineItemBalanceSheetRows(Level1BalanceSheetArray)
 	fmt.Println("check 2")
 
-	utilityFunctions.Save2DarrayToCsvFile(BalanceSheetArrayInProcess, base_directory, CIK+"_combinedBalanceSheetLevel2.csv")
+	if err := storage.PutCsv(storage.SECFiles, storage.CombinedStatementKey(CIK+"_combinedBalanceSheetLevel2.csv"), BalanceSheetArrayInProcess); err != nil {
+		fmt.Printf("Error saving CSV file: %v\n", err)
+		return nil, err
+	}
 	fmt.Println("Saved Balance Sheet Array to CSV file")
-	return BalanceSheetArrayInProcess
+	return BalanceSheetArrayInProcess, nil
 }
 
 func DeleteDuplicateBalanceSheetColumnsWithSameReportPeriodAndKeepTheMostRecentReportDateColumn(Level1BalanceSheetArray [][]string) (ProcessedBalanceSheetArray [][]string, err error) {
@@ -0,0 +1,258 @@
+package combinecsvfiles
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	standardtemplate "github.com/Programmerdin/FinancialDataSite_Go/standardTemplate"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+)
+
+// Level 3 statements have the same rows for every company so they can be compared, see standardTemplate
+
+// StandardizedLineItemMapping records which template line a line item of the combined statement went into
+// Method is "concept", "label", "other" when it matched no line and went to the other line of its section,
+// or "subtotal" for a total that matched no line, those are left out so the other line doesn't count them twice
+type StandardizedLineItemMapping struct {
+	TemplateLineID string
+	LineItem       string
+	Concept        string
+	Section        string
+	Method         string
+}
+
+// BuildStandardizedStatement maps every line item with data of a combined statement to a line of the template and returns the
+// Level 3 statement with the metadata rows of the combined statement and one row per template line.
+// conceptOf maps the normalized line item names to their XBRL concept, see readConceptsOfCombinedStatement.
+func BuildStandardizedStatement(statement [][]string, statementTemplate standardtemplate.StatementTemplate, conceptOf map[string]string) ([][]string, []StandardizedLineItemMapping) {
+	separatorRowIndex := FindSeparatorRowIndex(statement)
+	rowIndicesOfLine := make([][]int, len(statementTemplate.Lines))
+	var mappings []StandardizedLineItemMapping
+
+	section := statementTemplate.Sections[0]
+	for i := separatorRowIndex + 1; i < len(statement); i++ {
+		if !DoesDataCellExistInThisRow(statement[i]) {
+			continue
+		}
+		lineItemName := statement[i][0]
+		concept := conceptOfLineItem(lineItemName, conceptOf)
+
+		lineIndex, method := matchTemplateLine(lineItemName, concept, section, statementTemplate)
+		if lineIndex == -1 {
+			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(lineItemName)), "total") {
+				mappings = append(mappings, StandardizedLineItemMapping{LineItem: lineItemName, Concept: concept, Section: section, Method: "subtotal"})
+				continue
+			}
+			lineIndex, method = statementTemplate.OtherLineIndex(section), "other"
+		}
+		line := statementTemplate.Lines[lineIndex]
+		rowIndicesOfLine[lineIndex] = append(rowIndicesOfLine[lineIndex], i)
+		mappings = append(mappings, StandardizedLineItemMapping{TemplateLineID: line.ID, LineItem: lineItemName, Concept: concept, Section: line.Section, Method: method})
+
+		// the line items after a total belong to the next section
+		section = line.Section
+		if next := statementTemplate.SectionIndex(line.Section) + 1; line.Total && next < len(statementTemplate.Sections) {
+			section = statementTemplate.Sections[next]
+		}
+	}
+
+	standardizedStatement := make([][]string, 0, separatorRowIndex+1+len(statementTemplate.Lines))
+	for i := 0; i <= separatorRowIndex; i++ {
+		row := make([]string, len(statement[i]))
+		copy(row, statement[i])
+		standardizedStatement = append(standardizedStatement, row)
+	}
+	columnCount := len(statement[AccessionNumberRowIndex])
+	for lineIndex, line := range statementTemplate.Lines {
+		row := make([]string, columnCount)
+		row[0] = line.Label
+		for j := 1; j < columnCount; j++ {
+			var cells []string
+			for _, rowIndex := range rowIndicesOfLine[lineIndex] {
+				if j < len(statement[rowIndex]) && cleanCellValue(statement[rowIndex][j]) != "" {
+					cells = append(cells, cleanCellValue(statement[rowIndex][j]))
+				}
+			}
+			row[j] = combineCellsOfTemplateLine(cells, line.Total || line.StockItem)
+		}
+		standardizedStatement = append(standardizedStatement, row)
+	}
+	return standardizedStatement, mappings
+}
+
+// matchTemplateLine returns the index of the template line of a line item and how it was matched, -1 if no line matches.
+// Concepts are matched across the whole statement, names are matched within the current section first so
+// "Other" under current assets and "Other" under non current assets end up in different lines.
+func matchTemplateLine(lineItemName string, concept string, section string, statementTemplate standardtemplate.StatementTemplate) (int, string) {
+	if concept != "" {
+		for lineIndex, line := range statementTemplate.Lines {
+			for _, lineConcept := range line.Concepts {
+				if lineConcept == concept {
+					return lineIndex, "concept"
+				}
+			}
+		}
+	}
+	for _, sameSectionOnly := range []bool{true, false} {
+		for lineIndex, line := range statementTemplate.Lines {
+			if sameSectionOnly && line.Section != section {
+				continue
+			}
+			if templateLineMatchesName(line, lineItemName) {
+				return lineIndex, "label"
+			}
+		}
+	}
+	return -1, ""
+}
+
+func templateLineMatchesName(line standardtemplate.TemplateLine, lineItemName string) bool {
+	if len(line.ExclusionTerms) > 0 && !notContainsAny(lineItemName, line.ExclusionTerms) {
+		return false
+	}
+	if containsAny(lineItemName, line.Terms) {
+		return true
+	}
+	for _, wordsInOrder := range line.WordsInOrder {
+		if CheckWordsInOrder(lineItemName, wordsInOrder) {
+			return true
+		}
+	}
+	return false
+}
+
+// combineCellsOfTemplateLine adds up the cells of the line items of one template line,
+// totals and stock items take the first cell since adding them up means nothing
+func combineCellsOfTemplateLine(cells []string, takeFirst bool) string {
+	if len(cells) == 0 {
+		return ""
+	}
+	if takeFirst {
+		return cells[0]
+	}
+	var numbers []string
+	for _, cell := range cells {
+		if _, err := strconv.ParseFloat(cell, 64); err == nil {
+			numbers = append(numbers, cell)
+		}
+	}
+	if len(numbers) == 0 {
+		return ""
+	}
+	signs := make([]float64, len(numbers))
+	for i := range signs {
+		signs[i] = 1
+	}
+	sum, _ := sumCellValues(numbers, signs)
+	return sum
+}
+
+// conceptOfLineItem looks up the concept of a line item, names qualified by QualifyDuplicateLineItemNames
+// ("Earnings per share: - Basic") are also looked up by the original name
+func conceptOfLineItem(lineItemName string, conceptOf map[string]string) string {
+	if concept, ok := conceptOf[normalizeLineItemName(lineItemName)]; ok {
+		return concept
+	}
+	if index := strings.LastIndex(lineItemName, " - "); index != -1 {
+		return conceptOf[normalizeLineItemName(lineItemName[index+3:])]
+	}
+	return ""
+}
+
+// readConceptsOfCombinedStatement reads the concepts of the rows of a combined statement from the line item mapping CSV
+// saved by the Level 1 combiners, an empty map when the statement was combined without concepts
+func readConceptsOfCombinedStatement(mappingKey string) (map[string]string, error) {
+	conceptOf := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	mappingArray, err := storage.GetCsv(storage.SECFiles, mappingKey)
+	if err == storage.ErrNotExist {
+		return conceptOf, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(mappingArray); i++ {
+		// combinedLineItem, section, accessionNumber, originalLineItem, concept, method, similarity
+		if len(mappingArray[i]) < 5 || mappingArray[i][4] == "" {
+			continue
+		}
+		name := normalizeLineItemName(mappingArray[i][0])
+		if existing, exists := conceptOf[name]; exists && existing != mappingArray[i][4] {
+			// duplicate names like "Basic" under EPS and under shares, the name alone can't tell which concept it is
+			ambiguous[name] = true
+			continue
+		}
+		conceptOf[name] = mappingArray[i][4]
+	}
+	for name := range ambiguous {
+		delete(conceptOf, name)
+	}
+	return conceptOf, nil
+}
+
+// GenerateLevel3StandardizedStatementsAndSaveAsCsvFilesGivenCIK maps the combined balance sheet (Level 2 when it exists),
+// income statement and cash flow statement of the CIK to the standard template and saves the Level 3 statements
+// and which line items went into which line to SEC-files/combinedFinancialStatements
+func GenerateLevel3StandardizedStatementsAndSaveAsCsvFilesGivenCIK(CIK string) error {
+	template, err := standardtemplate.LoadStandardTemplate()
+	if err != nil {
+		fmt.Println("Error loading standard template:", err)
+		return err
+	}
+
+	balanceSheetFileName := CIK + "_combinedBalanceSheetLevel2.csv"
+	if exists, err := storage.SECFiles.Exists(storage.CombinedStatementKey(balanceSheetFileName)); err != nil || !exists {
+		balanceSheetFileName = CIK + "_combinedBalanceSheetLevel1.csv"
+	}
+	statements := []struct {
+		name                    string
+		template                standardtemplate.StatementTemplate
+		combinedFileName        string
+		lineItemMappingFileName string
+		standardizedFileName    string
+		mappingFileName         string
+	}{
+		{"balance sheet", template.BalanceSheet, balanceSheetFileName, CIK + "_combinedBalanceSheetLevel1LineItemMapping.csv", CIK + "_combinedBalanceSheetLevel3.csv", CIK + "_combinedBalanceSheetLevel3Mapping.csv"},
+		{"income statement", template.IncomeStatement, CIK + "_combinedIncomeStatementLevel1.csv", CIK + "_combinedIncomeStatementLevel1LineItemMapping.csv", CIK + "_combinedIncomeStatementLevel3.csv", CIK + "_combinedIncomeStatementLevel3Mapping.csv"},
+		{"cash flow statement", template.CashFlowStatement, CIK + "_combinedCashFlowStatementLevel1.csv", CIK + "_combinedCashFlowStatementLevel1LineItemMapping.csv", CIK + "_combinedCashFlowStatementLevel3.csv", CIK + "_combinedCashFlowStatementLevel3Mapping.csv"},
+	}
+	for _, statement := range statements {
+		combinedKey := storage.CombinedStatementKey(statement.combinedFileName)
+		combinedStatement, err := storage.GetCsv(storage.SECFiles, combinedKey)
+		if err == storage.ErrNotExist {
+			return fmt.Errorf("%s not found, run combine first: %w", combinedKey, err)
+		}
+		if err != nil {
+			fmt.Println("Error reading CSV file:", err)
+			return err
+		}
+		conceptOf, err := readConceptsOfCombinedStatement(storage.CombinedStatementKey(statement.lineItemMappingFileName))
+		if err != nil {
+			fmt.Println("Error reading line item mapping:", err)
+			return err
+		}
+
+		standardizedStatement, mappings := BuildStandardizedStatement(combinedStatement, statement.template, conceptOf)
+		if err := storage.PutCsv(storage.SECFiles, storage.CombinedStatementKey(statement.standardizedFileName), standardizedStatement); err != nil {
+			fmt.Printf("Error saving CSV file: %v\n", err)
+			return err
+		}
+
+		mappingArray := [][]string{{"templateLine", "section", "lineItem", "concept", "method"}}
+		otherCount := 0
+		for _, mapping := range mappings {
+			mappingArray = append(mappingArray, []string{mapping.TemplateLineID, mapping.Section, mapping.LineItem, mapping.Concept, mapping.Method})
+			if mapping.Method == "other" {
+				otherCount++
+			}
+		}
+		if err := storage.PutCsv(storage.SECFiles, storage.CombinedStatementKey(statement.mappingFileName), mappingArray); err != nil {
+			fmt.Printf("Error saving CSV file: %v\n", err)
+			return err
+		}
+		fmt.Printf("Successfully saved Level 3 %s to %s, %d of %d line items went into other lines\n",
+			statement.name, storage.CombinedStatementKey(statement.standardizedFileName), otherCount, len(mappings))
+	}
+	return nil
+}
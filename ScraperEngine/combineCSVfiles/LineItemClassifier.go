@@ -0,0 +1,416 @@
+package combinecsvfiles
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// classifyBalanceSheetLineItems only knows the anchor words of classificationRules, balance sheets it can't classify
+// are handed to the LineItemClassifiers listed in LINE_ITEM_CLASSIFIERS ("local,openai" by default, "none" to turn them off)
+// in that order, the first one that returns a valid classification wins
+
+const lineItemClassifierTimeout = 2 * time.Minute
+
+// LineItemClassifier finds the section headings and totals of a parsed balance sheet R file.
+// The row indices returned are indices of BalanceSheetArray and have to pass validateBalanceSheetLineItemClassifications
+type LineItemClassifier interface {
+	Name() string
+	ClassifyBalanceSheet(ctx context.Context, BalanceSheetArray [][]string) (BalanceSheetLineItemClassifications, error)
+}
+
+var (
+	fallbackClassifiers     []LineItemClassifier
+	fallbackClassifiersOnce sync.Once
+)
+
+// fallbackLineItemClassifiers builds the classifiers of LINE_ITEM_CLASSIFIERS once per run,
+// the openai classifier is skipped when no API key or base URL is set and logs its prompts to Mongo when client is not nil
+func fallbackLineItemClassifiers(client *mongo.Client) []LineItemClassifier {
+	fallbackClassifiersOnce.Do(func() {
+		names := os.Getenv("LINE_ITEM_CLASSIFIERS")
+		if names == "" {
+			names = "local,openai"
+		}
+		for _, name := range strings.Split(names, ",") {
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "none", "":
+			case "local":
+				fallbackClassifiers = append(fallbackClassifiers, LocalLineItemClassifier{})
+			case "openai":
+				openAIClient, err := NewOpenAIClient()
+				if err != nil {
+					fmt.Println("Skipping openai line item classifier:", err)
+					continue
+				}
+				if client != nil {
+					openAIClient.WithPromptLog(GetPromptLogCollection(client))
+				}
+				fallbackClassifiers = append(fallbackClassifiers, NewOpenAILineItemClassifier(openAIClient))
+			default:
+				fmt.Printf("Unknown line item classifier %q in LINE_ITEM_CLASSIFIERS\n", name)
+			}
+		}
+	})
+	return fallbackClassifiers
+}
+
+// classifyBalanceSheetLineItemsWithFallback classifies with the anchor rules first and falls back to the LineItemClassifiers,
+// the error of the anchor rules is returned when none of them can classify the balance sheet either
+func classifyBalanceSheetLineItemsWithFallback(BalanceSheetArray [][]string, anchors classificationrules.BalanceSheetAnchorRules, client *mongo.Client) (BalanceSheetLineItemClassifications, error) {
+	classifications, err := classifyBalanceSheetLineItems(BalanceSheetArray, anchors)
+	if err == nil {
+		return classifications, nil
+	}
+	accessionNumber := ""
+	if len(BalanceSheetArray) > 0 && len(BalanceSheetArray[AccessionNumberRowIndex]) > 1 {
+		accessionNumber = BalanceSheetArray[AccessionNumberRowIndex][1]
+	}
+	for _, classifier := range fallbackLineItemClassifiers(client) {
+		ctx, cancel := context.WithTimeout(context.Background(), lineItemClassifierTimeout)
+		classifications, classifierErr := classifier.ClassifyBalanceSheet(ctx, BalanceSheetArray)
+		cancel()
+		if classifierErr != nil {
+			fmt.Printf("accession number: %s - %s classifier failed: %v\n", accessionNumber, classifier.Name(), classifierErr)
+			continue
+		}
+		fmt.Printf("accession number: %s - classified by the %s classifier\n", accessionNumber, classifier.Name())
+		return classifications, nil
+	}
+	return BalanceSheetLineItemClassifications{}, err
+}
+
+// validateBalanceSheetLineItemClassifications checks a classification that didn't come from the anchor rules:
+// every index is a line item row, the headings and totals are in balance sheet order, the totals have data,
+// and every row with data is in a section or is an other equity
+func validateBalanceSheetLineItemClassifications(BalanceSheetArray [][]string, classifications BalanceSheetLineItemClassifications) error {
+	ordered := []struct {
+		name     string
+		rowIndex int
+		total    bool
+	}{
+		{"currentAssets", classifications.CurrentAssets, false},
+		{"totalCurrentAssets", classifications.TotalCurrentAssets, true},
+		{"totalAssets", classifications.TotalAssets, true},
+		{"currentLiabilities", classifications.CurrentLiabilities, false},
+		{"totalCurrentLiabilities", classifications.TotalCurrentLiabilities, true},
+		{"totalLiabilities", classifications.TotalLiabilities, true},
+		{"stockholdersEquity", classifications.StockholdersEquity, false},
+		{"totalStockholdersEquity", classifications.TotalStockholdersEquity, true},
+		{"totalLiabilitiesAndEquity", classifications.TotalLiabilitiesEquityAndOtherEquity, true},
+	}
+	for i, section := range ordered {
+		if section.rowIndex <= SeparatorRowIndex || section.rowIndex >= len(BalanceSheetArray) {
+			return fmt.Errorf("%s row %d is not a line item row", section.name, section.rowIndex)
+		}
+		if section.total && !DoesDataCellExistInThisRow(BalanceSheetArray[section.rowIndex]) {
+			return fmt.Errorf("%s row %d has no data", section.name, section.rowIndex)
+		}
+		if i > 0 && section.rowIndex <= ordered[i-1].rowIndex {
+			return fmt.Errorf("%s row %d is not below %s row %d", section.name, section.rowIndex, ordered[i-1].name, ordered[i-1].rowIndex)
+		}
+	}
+	for _, rowIndex := range classifications.OtherEquities {
+		if rowIndex <= SeparatorRowIndex || rowIndex >= len(BalanceSheetArray) || !DoesDataCellExistInThisRow(BalanceSheetArray[rowIndex]) {
+			return fmt.Errorf("other equity row %d is not a line item row with data", rowIndex)
+		}
+		if rowIndex <= classifications.TotalLiabilities ||
+			(rowIndex > classifications.StockholdersEquity && rowIndex <= classifications.TotalLiabilitiesEquityAndOtherEquity) {
+			return fmt.Errorf("other equity row %d is inside another section", rowIndex)
+		}
+	}
+	if dataRow, found := findUnaccountedDataRow(BalanceSheetArray, classifications); found {
+		return fmt.Errorf("found unaccounted data cell at row %d", dataRow)
+	}
+	return findDuplicateOtherEquityName(BalanceSheetArray, classifications.OtherEquities)
+}
+
+// findUnaccountedDataRow returns the first row with data that is not in the assets, liabilities or equity section
+// and is not an other equity
+func findUnaccountedDataRow(BalanceSheetArray [][]string, classifications BalanceSheetLineItemClassifications) (int, bool) {
+	for i := SeparatorRowIndex + 1; i < len(BalanceSheetArray); i++ {
+		if len(BalanceSheetArray[i]) == 0 || !DoesDataCellExistInThisRow(BalanceSheetArray[i]) {
+			continue
+		}
+		if (i > classifications.CurrentAssets && i <= classifications.TotalAssets) ||
+			(i > classifications.CurrentLiabilities && i <= classifications.TotalLiabilities) ||
+			(i > classifications.StockholdersEquity && i <= classifications.TotalLiabilitiesEquityAndOtherEquity) ||
+			containsInt(classifications.OtherEquities, i) {
+			continue
+		}
+		return i, true
+	}
+	return 0, false
+}
+
+// other equities are combined by name so two with the same name can't be told apart
+func findDuplicateOtherEquityName(BalanceSheetArray [][]string, otherEquitiesRowIndex []int) error {
+	var lineItemNames []string
+	for _, rowIndex := range otherEquitiesRowIndex {
+		row := BalanceSheetArray[rowIndex]
+		if len(row) == 0 {
+			continue // Skip empty rows
+		}
+		lineItemName := row[0]
+		// Check for exact match
+		for _, existingName := range lineItemNames {
+			if lineItemName == existingName {
+				return fmt.Errorf("duplicate lineItemName found in the financial statement: OtherEquities: %s", lineItemName)
+			}
+		}
+		lineItemNames = append(lineItemNames, lineItemName)
+	}
+	return nil
+}
+
+// LocalLineItemClassifier classifies with generic words instead of the anchor rules of the CIK,
+// and finds the total liabilities and equity row by its values when the name doesn't give it away.
+// It needs no network and always gives the same answer for the same R file
+type LocalLineItemClassifier struct{}
+
+var equityWords = []string{"equity", "deficit", "capital"}
+
+func (LocalLineItemClassifier) Name() string {
+	return "local"
+}
+
+func (LocalLineItemClassifier) ClassifyBalanceSheet(ctx context.Context, BalanceSheetArray [][]string) (BalanceSheetLineItemClassifications, error) {
+	hasData := func(i int) bool {
+		return DoesDataCellExistInThisRow(BalanceSheetArray[i])
+	}
+	// firstDataRow returns the first row with data in [from, to) that matches, -1 if there is none
+	firstDataRow := func(from int, to int, matches func(name string) bool) int {
+		for i := from; i < to && i < len(BalanceSheetArray); i++ {
+			if hasData(i) && matches(BalanceSheetArray[i][0]) {
+				return i
+			}
+		}
+		return -1
+	}
+	// headingAbove returns the last row without data between from and the first row with data after from
+	headingAbove := func(from int) int {
+		heading := -1
+		for i := from; i < len(BalanceSheetArray); i++ {
+			if hasData(i) {
+				break
+			}
+			if len(BalanceSheetArray[i]) > 0 && strings.TrimSpace(BalanceSheetArray[i][0]) != "" {
+				heading = i
+			}
+		}
+		return heading
+	}
+
+	classifications := BalanceSheetLineItemClassifications{}
+	classifications.CurrentAssets = headingAbove(SeparatorRowIndex + 1)
+	classifications.TotalCurrentAssets = firstDataRow(SeparatorRowIndex+1, len(BalanceSheetArray), func(name string) bool {
+		return CheckWordsInOrder(name, []string{"total", "current", "assets"})
+	})
+	if classifications.CurrentAssets == -1 || classifications.TotalCurrentAssets == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("could not find the current assets section")
+	}
+	classifications.TotalAssets = firstDataRow(classifications.TotalCurrentAssets+1, len(BalanceSheetArray), func(name string) bool {
+		return CheckWordsInOrder(name, []string{"total", "assets"}) && notContainsAny(name, []string{"current"})
+	})
+	if classifications.TotalAssets == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("could not find total assets")
+	}
+	classifications.CurrentLiabilities = headingAbove(classifications.TotalAssets + 1)
+	classifications.TotalCurrentLiabilities = firstDataRow(classifications.TotalAssets+1, len(BalanceSheetArray), func(name string) bool {
+		return CheckWordsInOrder(name, []string{"total", "current", "liabilities"})
+	})
+	if classifications.CurrentLiabilities == -1 || classifications.TotalCurrentLiabilities == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("could not find the current liabilities section")
+	}
+
+	classifications.TotalLiabilitiesEquityAndOtherEquity = firstDataRow(classifications.TotalCurrentLiabilities+1, len(BalanceSheetArray), func(name string) bool {
+		return CheckWordsInOrder(name, []string{"total", "liabilities"}) && containsAny(name, equityWords)
+	})
+	if classifications.TotalLiabilitiesEquityAndOtherEquity == -1 {
+		// total liabilities and equity always has the same values as total assets
+		totalAssetsValues := strings.Join(BalanceSheetArray[classifications.TotalAssets][1:], ",")
+		for i := classifications.TotalCurrentLiabilities + 1; i < len(BalanceSheetArray); i++ {
+			if hasData(i) && strings.Join(BalanceSheetArray[i][1:], ",") == totalAssetsValues {
+				classifications.TotalLiabilitiesEquityAndOtherEquity = i
+				break
+			}
+		}
+	}
+	if classifications.TotalLiabilitiesEquityAndOtherEquity == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("could not find total liabilities and equity")
+	}
+	classifications.TotalLiabilities = firstDataRow(classifications.TotalCurrentLiabilities+1, classifications.TotalLiabilitiesEquityAndOtherEquity, func(name string) bool {
+		return CheckWordsInOrder(name, []string{"total", "liabilities"}) && notContainsAny(name, append([]string{"current"}, equityWords...))
+	})
+	if classifications.TotalLiabilities == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("could not find total liabilities")
+	}
+	classifications.TotalStockholdersEquity = firstDataRow(classifications.TotalLiabilities+1, classifications.TotalLiabilitiesEquityAndOtherEquity, func(name string) bool {
+		return strings.HasPrefix(strings.ToLower(strings.TrimSpace(name)), "total") && containsAny(name, equityWords) && notContainsAny(name, []string{"liabilities"})
+	})
+	if classifications.TotalStockholdersEquity == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("could not find total stockholders equity")
+	}
+	classifications.StockholdersEquity = -1
+	for i := classifications.TotalLiabilities + 1; i < classifications.TotalStockholdersEquity; i++ {
+		if !hasData(i) && len(BalanceSheetArray[i]) > 0 && containsAny(BalanceSheetArray[i][0], equityWords) {
+			classifications.StockholdersEquity = i
+			break
+		}
+	}
+	if classifications.StockholdersEquity == -1 {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("could not find the stockholders equity heading")
+	}
+
+	// rows with data between total liabilities and the equity heading, and after total liabilities and equity, are other equities
+	for i := classifications.TotalLiabilities + 1; i < len(BalanceSheetArray); i++ {
+		if hasData(i) && (i < classifications.StockholdersEquity || i > classifications.TotalLiabilitiesEquityAndOtherEquity) {
+			classifications.OtherEquities = append(classifications.OtherEquities, i)
+		}
+	}
+
+	if err := validateBalanceSheetLineItemClassifications(BalanceSheetArray, classifications); err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+	return classifications, nil
+}
+
+// OpenAILineItemClassifier asks the model of the OpenAIClient for the row indices of the sections as JSON
+type OpenAILineItemClassifier struct {
+	client *OpenAIClient
+}
+
+func NewOpenAILineItemClassifier(client *OpenAIClient) *OpenAILineItemClassifier {
+	return &OpenAILineItemClassifier{client: client}
+}
+
+func (c *OpenAILineItemClassifier) Name() string {
+	return "openai (" + c.client.Model() + ")"
+}
+
+// balanceSheetClassificationResponse is the JSON the model has to answer with,
+// pointers so a missing key can be told apart from row 0
+type balanceSheetClassificationResponse struct {
+	CurrentAssets             *int  `json:"currentAssets"`
+	TotalCurrentAssets        *int  `json:"totalCurrentAssets"`
+	TotalAssets               *int  `json:"totalAssets"`
+	CurrentLiabilities        *int  `json:"currentLiabilities"`
+	TotalCurrentLiabilities   *int  `json:"totalCurrentLiabilities"`
+	TotalLiabilities          *int  `json:"totalLiabilities"`
+	StockholdersEquity        *int  `json:"stockholdersEquity"`
+	TotalStockholdersEquity   *int  `json:"totalStockholdersEquity"`
+	TotalLiabilitiesAndEquity *int  `json:"totalLiabilitiesAndEquity"`
+	OtherEquities             []int `json:"otherEquities"`
+}
+
+const balanceSheetClassificationInstructions = `Below are the rows of a balance sheet from an SEC filing, one per line as "row index | line item name | first value" ("-" when the row has no values).
+Find the rows of the balance sheet sections and answer with only a JSON object with these keys, each the row index from the list:
+"currentAssets": the heading row right above the first current asset (a row without values),
+"totalCurrentAssets": total current assets,
+"totalAssets": total assets,
+"currentLiabilities": the heading row right above the first current liability (a row without values),
+"totalCurrentLiabilities": total current liabilities,
+"totalLiabilities": total liabilities,
+"stockholdersEquity": the heading row right above the first stockholders' equity line item (a row without values),
+"totalStockholdersEquity": total stockholders' equity,
+"totalLiabilitiesAndEquity": total liabilities and stockholders' equity,
+"otherEquities": a list of the rows with values between total liabilities and the stockholders' equity heading or after total liabilities and equity (eg. redeemable noncontrolling interest), [] if there are none.
+`
+
+func (c *OpenAILineItemClassifier) ClassifyBalanceSheet(ctx context.Context, BalanceSheetArray [][]string) (BalanceSheetLineItemClassifications, error) {
+	var prompt strings.Builder
+	prompt.WriteString(balanceSheetClassificationInstructions)
+	prompt.WriteString("\n")
+	for i := SeparatorRowIndex + 1; i < len(BalanceSheetArray); i++ {
+		row := BalanceSheetArray[i]
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		firstValue := "-"
+		for j := 1; j < len(row); j++ {
+			if row[j] != "" {
+				firstValue = row[j]
+				break
+			}
+		}
+		fmt.Fprintf(&prompt, "%d | %s | %s\n", i, row[0], firstValue)
+	}
+
+	accessionNumber := ""
+	if len(BalanceSheetArray[AccessionNumberRowIndex]) > 1 {
+		accessionNumber = BalanceSheetArray[AccessionNumberRowIndex][1]
+	}
+	answer, err := c.client.SendPromptRequest(ctx, PromptRequest{
+		Prompt:          prompt.String(),
+		StatementRows:   BalanceSheetArray,
+		Purpose:         "balanceSheetClassification",
+		AccessionNumber: accessionNumber,
+	})
+	if err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+	classifications, err := parseBalanceSheetClassificationResponse(answer)
+	if err != nil {
+		return BalanceSheetLineItemClassifications{}, err
+	}
+	if err := validateBalanceSheetLineItemClassifications(BalanceSheetArray, classifications); err != nil {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("invalid classification from the model: %w", err)
+	}
+	return classifications, nil
+}
+
+// parseBalanceSheetClassificationResponse reads the JSON object out of the answer of the model,
+// models like to wrap it in a ```json block so everything outside the outermost braces is dropped
+func parseBalanceSheetClassificationResponse(answer string) (BalanceSheetLineItemClassifications, error) {
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start == -1 || end < start {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("no JSON object in the answer of the model: %q", answer)
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(answer[start : end+1])))
+	decoder.DisallowUnknownFields()
+	var response balanceSheetClassificationResponse
+	if err := decoder.Decode(&response); err != nil {
+		return BalanceSheetLineItemClassifications{}, fmt.Errorf("error parsing the answer of the model: %w", err)
+	}
+
+	required := []struct {
+		name  string
+		value *int
+	}{
+		{"currentAssets", response.CurrentAssets},
+		{"totalCurrentAssets", response.TotalCurrentAssets},
+		{"totalAssets", response.TotalAssets},
+		{"currentLiabilities", response.CurrentLiabilities},
+		{"totalCurrentLiabilities", response.TotalCurrentLiabilities},
+		{"totalLiabilities", response.TotalLiabilities},
+		{"stockholdersEquity", response.StockholdersEquity},
+		{"totalStockholdersEquity", response.TotalStockholdersEquity},
+		{"totalLiabilitiesAndEquity", response.TotalLiabilitiesAndEquity},
+	}
+	for _, field := range required {
+		if field.value == nil {
+			return BalanceSheetLineItemClassifications{}, fmt.Errorf("the answer of the model has no %s", field.name)
+		}
+	}
+	return BalanceSheetLineItemClassifications{
+		CurrentAssets:                        *response.CurrentAssets,
+		TotalCurrentAssets:                   *response.TotalCurrentAssets,
+		TotalAssets:                          *response.TotalAssets,
+		CurrentLiabilities:                   *response.CurrentLiabilities,
+		TotalCurrentLiabilities:              *response.TotalCurrentLiabilities,
+		TotalLiabilities:                     *response.TotalLiabilities,
+		StockholdersEquity:                   *response.StockholdersEquity,
+		TotalStockholdersEquity:              *response.TotalStockholdersEquity,
+		TotalLiabilitiesEquityAndOtherEquity: *response.TotalLiabilitiesAndEquity,
+		OtherEquities:                        response.OtherEquities,
+	}, nil
+}
@@ -4,55 +4,112 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
 	openai "github.com/sashabaranov/go-openai"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+const openAISystemMessage = "You are a financial expert analyzing balance sheet data."
+
 // OpenAIClient wraps the OpenAI client and provides methods for our specific use cases
+// any server with an OpenAI compatible chat completions API works, set OPENAI_BASE_URL and OPENAI_MODEL to use one
 type OpenAIClient struct {
-	client *openai.Client
+	client    *openai.Client
+	model     string
+	promptLog *mongo.Collection // nil when prompts aren't logged, see WithPromptLog
 }
 
 // NewOpenAIClient creates a new OpenAIClient instance
+// the API key can be left out when OPENAI_BASE_URL points to a local server that doesn't need one
 func NewOpenAIClient() (*OpenAIClient, error) {
 	apiKey := os.Getenv("OPENAI_API_KEY")
-	if apiKey == "" {
+	baseURL := os.Getenv("OPENAI_BASE_URL")
+	if apiKey == "" && baseURL == "" {
 		return nil, fmt.Errorf("OPENAI_API_KEY not found in environment variables")
 	}
 
-	client := openai.NewClient(apiKey)
-	return &OpenAIClient{client: client}, nil
+	config := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		config.BaseURL = baseURL
+	}
+	model := os.Getenv("OPENAI_MODEL")
+	if model == "" {
+		model = openai.GPT4
+	}
+	return &OpenAIClient{client: openai.NewClientWithConfig(config), model: model}, nil
+}
+
+// Model returns the name of the model the prompts are sent to
+func (c *OpenAIClient) Model() string {
+	return c.model
+}
+
+// WithPromptLog logs every prompt and response to the collection and answers prompts that were already answered from it,
+// see PromptLogEntry
+func (c *OpenAIClient) WithPromptLog(collection *mongo.Collection) *OpenAIClient {
+	c.promptLog = collection
+	return c
 }
 
 // SendPrompt sends a prompt to OpenAI and returns the response
 func (c *OpenAIClient) SendPrompt(ctx context.Context, prompt string) (string, error) {
+	return c.SendPromptRequest(ctx, PromptRequest{Prompt: prompt})
+}
+
+// SendPromptRequest sends the prompt of the request to OpenAI and returns the response,
+// with a prompt log the response of an earlier identical request is reused instead
+func (c *OpenAIClient) SendPromptRequest(ctx context.Context, request PromptRequest) (string, error) {
+	entry := newPromptLogEntry(request, c.model, openAISystemMessage)
+	if c.promptLog != nil {
+		if cached, found := findCachedPromptResponse(ctx, c.promptLog, entry); found {
+			return cached.Response, nil
+		}
+	}
+
+	start := time.Now()
 	resp, err := c.client.CreateChatCompletion(
 		ctx,
 		openai.ChatCompletionRequest{
-			Model: openai.GPT4,
+			Model: c.model,
 			Messages: []openai.ChatCompletionMessage{
 				{
 					Role:    openai.ChatMessageRoleSystem,
-					Content: "You are a financial expert analyzing balance sheet data.",
+					Content: openAISystemMessage,
 				},
 				{
 					Role:    openai.ChatMessageRoleUser,
-					Content: prompt,
+					Content: request.Prompt,
 				},
 			},
 			MaxTokens: 1000,
 		},
 	)
+	entry.LatencyMs = time.Since(start).Milliseconds()
 
+	if err == nil && len(resp.Choices) == 0 {
+		err = fmt.Errorf("no response choices returned from OpenAI")
+	} else if err != nil {
+		err = fmt.Errorf("OpenAI API error: %v", err)
+	}
 	if err != nil {
-		return "", fmt.Errorf("OpenAI API error: %v", err)
+		entry.Error = err.Error()
+	} else {
+		entry.Response = resp.Choices[0].Message.Content
+		entry.PromptTokens = resp.Usage.PromptTokens
+		entry.CompletionTokens = resp.Usage.CompletionTokens
+		entry.TotalTokens = resp.Usage.TotalTokens
 	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("no response choices returned from OpenAI")
+	if c.promptLog != nil {
+		if logErr := savePromptLogEntry(ctx, c.promptLog, entry); logErr != nil {
+			// the answer is still good, it just won't be reused next run
+			fmt.Println("Error saving prompt log entry:", logErr)
+		}
 	}
-
-	return resp.Choices[0].Message.Content, nil
+	if err != nil {
+		return "", err
+	}
+	return entry.Response, nil
 }
 
 // TestOpenAIConnection tests the connection to OpenAI
@@ -1,29 +1,23 @@
 package combinecsvfiles
 
 import (
-	"context"
 	"fmt"
-	"log"
-	"os"
-	"path/filepath"
 	"strings"
 
-	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func GetCsvRfilesIntoArrayVariables(CIK string, client *mongo.Client) (BalanceSheetArrays [][][]string, IncomeStatementArrays [][][]string, ComprehensiveIncomeStatementArrays [][][]string, CashflowStatementArrays [][][]string, err error) {
-	MongoDocs, err := RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate(CIK, client)
+	filings, err := RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate(CIK)
 	if err != nil {
 		fmt.Println("RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate", err)
 		return nil, nil, nil, nil, err
 	}
-	BSfilePaths, ISfilePaths, CISfilePaths, CFfilePaths, err := GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenMongoDocs(MongoDocs)
+	BSfilePaths, ISfilePaths, CISfilePaths, CFfilePaths, err := GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings(filings)
 	if err != nil {
-		fmt.Println("GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenMongoDocs", err)
+		fmt.Println("GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings", err)
 		return nil, nil, nil, nil, err
 	}
 
@@ -33,7 +27,7 @@ func GetCsvRfilesIntoArrayVariables(CIK string, client *mongo.Client) (BalanceSh
 		if filePath == "" {
 			continue
 		}
-		financialStatement, err := utilityfunctions.ReadCsvFileToArray(filePath)
+		financialStatement, err := storage.GetCsv(storage.SECFiles, filePath)
 		if err != nil {
 			fmt.Println("Error reading CSV file:", err)
 			return nil, nil, nil, nil, err
@@ -46,7 +40,7 @@ func GetCsvRfilesIntoArrayVariables(CIK string, client *mongo.Client) (BalanceSh
 		if filePath == "" {
 			continue
 		}
-		financialStatement, err := utilityfunctions.ReadCsvFileToArray(filePath)
+		financialStatement, err := storage.GetCsv(storage.SECFiles, filePath)
 		if err != nil {
 			fmt.Println("Error reading CSV file:", err)
 			return nil, nil, nil, nil, err
@@ -59,7 +53,7 @@ func GetCsvRfilesIntoArrayVariables(CIK string, client *mongo.Client) (BalanceSh
 		if filePath == "" {
 			continue
 		}
-		financialStatement, err := utilityfunctions.ReadCsvFileToArray(filePath)
+		financialStatement, err := storage.GetCsv(storage.SECFiles, filePath)
 		if err != nil {
 			fmt.Println("Error reading CSV file:", err)
 			return nil, nil, nil, nil, err
@@ -72,7 +66,7 @@ func GetCsvRfilesIntoArrayVariables(CIK string, client *mongo.Client) (BalanceSh
 		if filePath == "" {
 			continue
 		}
-		financialStatement, err := utilityfunctions.ReadCsvFileToArray(filePath)
+		financialStatement, err := storage.GetCsv(storage.SECFiles, filePath)
 		if err != nil {
 			fmt.Println("Error reading CSV file:", err)
 			return nil, nil, nil, nil, err
@@ -83,54 +77,36 @@ func GetCsvRfilesIntoArrayVariables(CIK string, client *mongo.Client) (BalanceSh
 	return BS_arrays, IS_arrays, CIS_arrays, CF_arrays, nil
 }
 
-func GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenMongoDocs(MongoDocs []bson.M) (BSfilePaths []string, ISfilePaths []string, CISfilePaths []string, CFfilePaths []string, error error) {
-	basefilepath := filepath.Join("SEC-files", "filingSummaryAndRfiles")
-	for _, MongoDoc := range MongoDocs {
-		accessionNumber, _ := MongoDoc["accessionnumber"].(string) // Assuming accessionnumber is always present and is a string
-		CIK, _ := MongoDoc["cik"].(string)                         // Get CIK from MongoDoc
-
-		BSfilePaths = append(BSfilePaths, getCsvFilePath(basefilepath, CIK, accessionNumber, MongoDoc["Rfile_BS_fileName"]))
-		ISfilePaths = append(ISfilePaths, getCsvFilePath(basefilepath, CIK, accessionNumber, MongoDoc["Rfile_IS_fileName"]))
-		CISfilePaths = append(CISfilePaths, getCsvFilePath(basefilepath, CIK, accessionNumber, MongoDoc["Rfile_CIS_fileName"]))
-		CFfilePaths = append(CFfilePaths, getCsvFilePath(basefilepath, CIK, accessionNumber, MongoDoc["Rfile_CF_fileName"]))
+func GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings(filings []filingrepository.Filing) (BSfilePaths []string, ISfilePaths []string, CISfilePaths []string, CFfilePaths []string, error error) {
+	for _, filing := range filings {
+		BSfilePaths = append(BSfilePaths, getCsvFilePath(filing.CIK, filing.AccessionNumber, filing.Rfiles["BS"].FileName))
+		ISfilePaths = append(ISfilePaths, getCsvFilePath(filing.CIK, filing.AccessionNumber, filing.Rfiles["IS"].FileName))
+		CISfilePaths = append(CISfilePaths, getCsvFilePath(filing.CIK, filing.AccessionNumber, filing.Rfiles["CIS"].FileName))
+		CFfilePaths = append(CFfilePaths, getCsvFilePath(filing.CIK, filing.AccessionNumber, filing.Rfiles["CF"].FileName))
 	}
 
-	//make sure the slice lengths are the same if they are not 0, Not checking CIS since not all docs have CIS
-	if len(BSfilePaths) != len(ISfilePaths) || len(BSfilePaths) != len(CFfilePaths) {
-		error = fmt.Errorf("length of BSfilePaths, ISfilePaths, CFfilePaths is not the same")
+	//make sure the slice lengths are the same, docs without CIS still get an empty path so CIS is checked too
+	if len(BSfilePaths) != len(ISfilePaths) || len(BSfilePaths) != len(CISfilePaths) || len(BSfilePaths) != len(CFfilePaths) {
+		error = fmt.Errorf("length of BSfilePaths, ISfilePaths, CISfilePaths, CFfilePaths is not the same")
 	}
 	return BSfilePaths, ISfilePaths, CISfilePaths, CFfilePaths, error
 }
 
-func getCsvFilePath(basePath string, CIK string, accessionNumber string, value interface{}) string {
-	// Attempt to assert that 'value' is of type string.
-	if valueString, ok := value.(string); ok && valueString != "" {
-		// If 'ok' is true, the assertion succeeded, and 'valueString' is now a string.
-		// Also check if the 'valueString' is not empty.
-		csvFilename := strings.TrimSuffix(valueString, ".htm") + ".csv" // Create the new filename.
-		return filepath.Join(basePath, CIK, accessionNumber, csvFilename)
+// getCsvFilePath returns the storage.SECFiles key of the CSV of the R file, "" when the filing has no such R file
+func getCsvFilePath(CIK string, accessionNumber string, RfileName string) string {
+	if RfileName == "" {
+		return ""
 	}
-	return ""
+	csvFilename := strings.TrimSuffix(RfileName, ".htm") + ".csv" // Create the new filename.
+	return storage.FilingKey(CIK, accessionNumber, csvFilename)
 }
 
-func RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate(CIK string, client *mongo.Client) ([]bson.M, error) {
-	databaseName := os.Getenv("DATABASE_NAME")
-	collectionName := os.Getenv("10K10QMetaDataCollection")
-	collection := client.Database(databaseName).Collection(collectionName)
-
-	// Finding multiple documents with the specified CIK and Sorting by reportdate in ascending order(old to new) and filtering by CIK
-	cur, err := collection.Find(context.Background(), bson.D{primitive.E{Key: "cik", Value: CIK}}, options.Find().SetSort(bson.D{primitive.E{Key: "reportdate", Value: 1}}))
+// RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate returns the filings of the CIK sorted by report date in ascending order(old to new)
+func RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate(CIK string) ([]filingrepository.Filing, error) {
+	filings, err := filingrepository.Filings.ListFilingsByCIK(CIK)
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	defer cur.Close(context.Background())
-
-	// Iterate through the cursor
-	var MongoDocs []bson.M
-	if err = cur.All(context.Background(), &MongoDocs); err != nil {
-		log.Fatal(err)
+		fmt.Println("Error finding filings:", err)
+		return nil, err
 	}
-
-	return MongoDocs, err
+	return filings, nil
 }
@@ -4,35 +4,36 @@ import (
 	"errors"
 	"fmt"
 
-	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 )
 
 // process as much as possible with code. For line items code cant deal with, ChatGPT api will be needed
 type BalanceSheetIndices struct {
-	ReportDate                 string
-	Form                       string
-	AccessionNumber            string
-	TotalLineItemCount         int
-	SeparatorRowIndex          int
-	AssetsStart                int
-	AssetsEnd                  int
-	LiabilitiesStart           int
-	LiabilitiesEnd             int
-	EquityStart                int
-	EquityEnd                  int
-	OtherEquityStart           int
-	OtherEquityEnd             int
-	CurrentAssetsStart         int
-	CurrentAssetsEnd           int
-	NonCurrentAssetsStart      int
-	NonCurrentAssetsEnd        int
-	CurrentLiabilitiesStart    int
-	CurrentLiabilitiesEnd      int
-	NonCurrentLiabilitiesStart int
-	NonCurrentLiabilitiesEnd   int
+	ReportDate                 string `bson:"reportDate"`
+	Form                       string `bson:"form"`
+	AccessionNumber            string `bson:"accessionNumber"`
+	TotalLineItemCount         int    `bson:"totalLineItemCount"`
+	SeparatorRowIndex          int    `bson:"separatorRowIndex"`
+	AssetsStart                int    `bson:"assetsStart"`
+	AssetsEnd                  int    `bson:"assetsEnd"`
+	LiabilitiesStart           int    `bson:"liabilitiesStart"`
+	LiabilitiesEnd             int    `bson:"liabilitiesEnd"`
+	EquityStart                int    `bson:"equityStart"`
+	EquityEnd                  int    `bson:"equityEnd"`
+	OtherEquityStart           int    `bson:"otherEquityStart"`
+	OtherEquityEnd             int    `bson:"otherEquityEnd"`
+	CurrentAssetsStart         int    `bson:"currentAssetsStart"`
+	CurrentAssetsEnd           int    `bson:"currentAssetsEnd"`
+	NonCurrentAssetsStart      int    `bson:"nonCurrentAssetsStart"`
+	NonCurrentAssetsEnd        int    `bson:"nonCurrentAssetsEnd"`
+	CurrentLiabilitiesStart    int    `bson:"currentLiabilitiesStart"`
+	CurrentLiabilitiesEnd      int    `bson:"currentLiabilitiesEnd"`
+	NonCurrentLiabilitiesStart int    `bson:"nonCurrentLiabilitiesStart"`
+	NonCurrentLiabilitiesEnd   int    `bson:"nonCurrentLiabilitiesEnd"`
 }
 
-func ProcessBalanceSheetCsvRfile(RfilePath string) (BalanceSheetIndices, error) {
+func ProcessBalanceSheetCsvRfile(RfilePath string, anchors classificationrules.BalanceSheetAnchorRules) (BalanceSheetIndices, error) {
 	RfileData2Darray, reportDate, form, accessionNumber, totalLineItemCount, separatorRowIndex, err := CommonInitialProcessorForCsvRfile(RfilePath)
 	if err != nil {
 		fmt.Println(err)
@@ -63,15 +64,15 @@ func ProcessBalanceSheetCsvRfile(RfilePath string) (BalanceSheetIndices, error)
 	var startRowIndex_NonCurrentLiabilities int
 	var endRowIndex_NonCurrentLiabilities int
 
-	possibleWords_TotalAssets := []string{"Total Assets"}
-	possibleWords_StartAssets := []string{"Cash and Cash Equivalents"}
-	possibleWords_TotalLiabilities := []string{"Total Liabilities"}
-	possibleWords_commonStock := []string{"Common Stock", "Common Share"}
-	possibleWords_TotalEquity := []string{"Total Stockholders", "Total Shareholders"}
-	possibleWords_OtherEquity := []string{"Preferred Stock", "Preferred Equity", "Convertible Debt"}
+	possibleWords_TotalAssets := anchors.TotalAssets
+	possibleWords_StartAssets := anchors.StartOfAssets
+	possibleWords_TotalLiabilities := anchors.TotalLiabilities
+	possibleWords_commonStock := anchors.CommonStock
+	possibleWords_TotalEquity := anchors.TotalEquity
+	possibleWords_OtherEquity := anchors.OtherEquity
 
-	possibleWords_CurrentAssets := []string{"Total Current Assets"}
-	possibleWords_CurrentLiabilities := []string{"Total Current Liabilities"}
+	possibleWords_CurrentAssets := anchors.TotalCurrentAssets
+	possibleWords_CurrentLiabilities := anchors.TotalCurrentLiabilities
 
 	type BalanceSheetSection struct {
 		rowIndex    *int
@@ -279,7 +280,7 @@ func ProcessBalanceSheetCsvRfile(RfilePath string) (BalanceSheetIndices, error)
 // This function finds the common fields for all financial statement rfiles and returns them
 // FirstEmptyRow serves as the separation row between header cells and data cells of R files that have been parsed
 func CommonInitialProcessorForCsvRfile(RfilePath string) (RfileData2Darray_ [][]string, reportDate_ string, form_ string, accessionNumber_ string, totalLineItemCount_ int, separatorRowIndex_ int, err error) {
-	RfileData2Darray, err := utilityfunctions.ReadCsvFileToArray(RfilePath)
+	RfileData2Darray, err := storage.GetCsv(storage.SECFiles, RfilePath)
 	if err != nil {
 		fmt.Println(err)
 		return nil, "", "", "", 0, 0, err
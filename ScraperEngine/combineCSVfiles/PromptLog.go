@@ -0,0 +1,147 @@
+package combinecsvfiles
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PromptRequest is a prompt with what it was asked about, StatementRows are hashed into the key of the prompt log
+// so the same statement gets the same answer on every run
+type PromptRequest struct {
+	Prompt          string
+	StatementRows   [][]string
+	Purpose         string // eg) balanceSheetClassification
+	AccessionNumber string
+}
+
+// PromptLogEntry is one prompt sent to the model and what came back, saved to the llmPromptLog collection.
+// Entries without Error are reused for requests with the same StatementHash, PromptHash and Model
+type PromptLogEntry struct {
+	ID               primitive.ObjectID `bson:"_id,omitempty"`
+	StatementHash    string             `bson:"statementHash"`
+	PromptHash       string             `bson:"promptHash"`
+	Model            string             `bson:"model"`
+	Purpose          string             `bson:"purpose,omitempty"`
+	AccessionNumber  string             `bson:"accessionNumber,omitempty"`
+	SystemMessage    string             `bson:"systemMessage"`
+	Prompt           string             `bson:"prompt"`
+	Response         string             `bson:"response"`
+	Error            string             `bson:"error,omitempty"`
+	LatencyMs        int64              `bson:"latencyMs"`
+	PromptTokens     int                `bson:"promptTokens"`
+	CompletionTokens int                `bson:"completionTokens"`
+	TotalTokens      int                `bson:"totalTokens"`
+	CacheHits        int                `bson:"cacheHits"`
+	CreatedAt        time.Time          `bson:"createdAt"`
+	LastUsedAt       time.Time          `bson:"lastUsedAt"`
+}
+
+func GetPromptLogCollection(client *mongo.Client) *mongo.Collection {
+	return utilityfunctions.GetMongoDBCollectionByName(client, "PromptLogCollection", "llmPromptLog")
+}
+
+// HashStatementRows returns the sha256 of the cells of the statement, an empty string for no rows
+func HashStatementRows(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	hash := sha256.New()
+	for _, row := range rows {
+		hash.Write([]byte(strings.Join(row, "\x1f")))
+		hash.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func newPromptLogEntry(request PromptRequest, model string, systemMessage string) PromptLogEntry {
+	promptHash := sha256.Sum256([]byte(systemMessage + "\n" + request.Prompt))
+	now := time.Now()
+	return PromptLogEntry{
+		StatementHash:   HashStatementRows(request.StatementRows),
+		PromptHash:      hex.EncodeToString(promptHash[:]),
+		Model:           model,
+		Purpose:         request.Purpose,
+		AccessionNumber: request.AccessionNumber,
+		SystemMessage:   systemMessage,
+		Prompt:          request.Prompt,
+		CreatedAt:       now,
+		LastUsedAt:      now,
+	}
+}
+
+// findCachedPromptResponse looks for an earlier successful answer to the same request and counts the hit,
+// Mongo errors are printed and treated as a miss so the prompt is just sent again
+func findCachedPromptResponse(ctx context.Context, collection *mongo.Collection, entry PromptLogEntry) (PromptLogEntry, bool) {
+	filter := bson.M{
+		"statementHash": entry.StatementHash,
+		"promptHash":    entry.PromptHash,
+		"model":         entry.Model,
+		"error":         bson.M{"$exists": false},
+	}
+	var cached PromptLogEntry
+	err := collection.FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"createdAt": -1})).Decode(&cached)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			fmt.Println("Error reading prompt log:", err)
+		}
+		return PromptLogEntry{}, false
+	}
+	update := bson.M{"$inc": bson.M{"cacheHits": 1}, "$set": bson.M{"lastUsedAt": time.Now()}}
+	if _, err := collection.UpdateByID(ctx, cached.ID, update); err != nil {
+		fmt.Println("Error updating prompt log entry:", err)
+	}
+	return cached, true
+}
+
+func savePromptLogEntry(ctx context.Context, collection *mongo.Collection, entry PromptLogEntry) error {
+	_, err := collection.InsertOne(ctx, entry)
+	return err
+}
+
+// ListPromptLogEntries returns the newest entries first, filtered by accession number and purpose when they are not empty
+func ListPromptLogEntries(accessionNumber string, purpose string, limit int64, client *mongo.Client) ([]PromptLogEntry, error) {
+	filter := bson.M{}
+	if accessionNumber != "" {
+		filter["accessionNumber"] = accessionNumber
+	}
+	if purpose != "" {
+		filter["purpose"] = purpose
+	}
+	findOptions := options.Find().SetSort(bson.M{"createdAt": -1})
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+	cursor, err := GetPromptLogCollection(client).Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var entries []PromptLogEntry
+	if err := cursor.All(context.Background(), &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// GetPromptLogEntry returns the entry with the hex object id
+func GetPromptLogEntry(id string, client *mongo.Client) (PromptLogEntry, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return PromptLogEntry{}, fmt.Errorf("invalid prompt log id %q: %w", id, err)
+	}
+	var entry PromptLogEntry
+	if err := GetPromptLogCollection(client).FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&entry); err != nil {
+		return PromptLogEntry{}, err
+	}
+	return entry, nil
+}
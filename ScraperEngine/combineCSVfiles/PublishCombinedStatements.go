@@ -0,0 +1,218 @@
+package combinecsvfiles
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	utilityFunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// The Backend serves the combined statements from the combinedFinancialStatements collection of the published database
+// (the combined_financial_statements table with DATABASE_BACKEND=sqlite), one doc per CIK and statement type. StockPage reads financialStatementType and data, data is the combined CSV as is
+// (metadata rows, separator, line item rows) so the website shows exactly what the CSV has
+
+// CombinedStatementColumn is the metadata of one column of a published statement
+type CombinedStatementColumn struct {
+	AccessionNumber        string `bson:"accessionNumber" json:"accessionNumber"`
+	Form                   string `bson:"form" json:"form"`
+	ReportDate             string `bson:"reportDate" json:"reportDate"`
+	ReportPeriod           string `bson:"reportPeriod" json:"reportPeriod"`
+	ReportDurationInMonths string `bson:"reportDurationInMonths" json:"reportDurationInMonths"`
+	ValueSource            string `bson:"valueSource,omitempty" json:"valueSource,omitempty"` // "reported" or "computed"
+}
+
+// CombinedStatementProvenance is where a published statement came from
+type CombinedStatementProvenance struct {
+	SourceFile          string                            `bson:"sourceFile" json:"sourceFile"`
+	AccessionNumbers    []string                          `bson:"accessionNumbers" json:"accessionNumbers"` // the filings the columns were taken from, in the order of the columns
+	LineItemMappingFile string                            `bson:"lineItemMappingFile" json:"lineItemMappingFile"`
+	LineItems           []CombinedStatementLineItemSource `bson:"lineItems" json:"lineItems"` // in the order of the line item rows of data
+}
+
+// CombinedStatementLineItemSource is the XBRL concept a line item row was aligned by, empty when the R files had none
+// or the name is used by rows of different concepts
+type CombinedStatementLineItemSource struct {
+	LineItem string `bson:"lineItem" json:"lineItem"`
+	Concept  string `bson:"concept" json:"concept"`
+}
+
+// CombinedStatementDoc is what is saved to Mongo for the Backend
+type CombinedStatementDoc struct {
+	CIK                    string                      `bson:"cik"`
+	FinancialStatementType string                      `bson:"financialStatementType"` // BS, IS or CF
+	Level                  int                         `bson:"level"`
+	Columns                []CombinedStatementColumn   `bson:"columns"`
+	Data                   [][]string                  `bson:"data"`
+	Provenance             CombinedStatementProvenance `bson:"provenance"`
+	GeneratedAt            time.Time                   `bson:"generatedAt"`
+}
+
+// PublishCombinedStatementsGivenCIK saves the combined BS, IS and CF CSVs of the CIK to CombinedStatements for the Backend
+func PublishCombinedStatementsGivenCIK(CIK string, client *mongo.Client) error {
+	docs, err := ReadCombinedStatementDocsGivenCIK(CIK)
+	if err != nil {
+		return err
+	}
+	for _, doc := range docs {
+		if err := CombinedStatements.SaveCombinedStatement(doc); err != nil {
+			fmt.Println("Error SaveCombinedStatement function:", err)
+			return err
+		}
+		fmt.Printf("Successfully published %s Level %d of %s with %d columns\n", doc.FinancialStatementType, doc.Level, CIK, len(doc.Columns))
+	}
+	return nil
+}
+
+// ReadCombinedStatementDocsGivenCIK reads the combined BS, IS and CF CSVs of the CIK that get published.
+// The balance sheet is the Level 2 one when it was generated, a statement without a CSV is skipped.
+// CIS isn't published, StockPage only knows BS, IS and CF
+func ReadCombinedStatementDocsGivenCIK(CIK string) ([]CombinedStatementDoc, error) {
+	balanceSheetFileName, balanceSheetLevel := CIK+"_combinedBalanceSheetLevel2.csv", 2
+	if exists, err := storage.SECFiles.Exists(storage.CombinedStatementKey(balanceSheetFileName)); err != nil || !exists {
+		balanceSheetFileName, balanceSheetLevel = CIK+"_combinedBalanceSheetLevel1.csv", 1
+	}
+	// the Level 2 balance sheet keeps the line items of Level 1, so both use the Level 1 mapping
+	statements := []struct {
+		financialStatementType  string
+		fileName                string
+		level                   int
+		lineItemMappingFileName string
+	}{
+		{"BS", balanceSheetFileName, balanceSheetLevel, CIK + "_combinedBalanceSheetLevel1LineItemMapping.csv"},
+		{"IS", CIK + "_combinedIncomeStatementLevel1.csv", 1, CIK + "_combinedIncomeStatementLevel1LineItemMapping.csv"},
+		{"CF", CIK + "_combinedCashFlowStatementLevel1.csv", 1, CIK + "_combinedCashFlowStatementLevel1LineItemMapping.csv"},
+	}
+
+	var docs []CombinedStatementDoc
+	for _, statement := range statements {
+		key := storage.CombinedStatementKey(statement.fileName)
+		data, err := storage.GetCsv(storage.SECFiles, key)
+		if err == storage.ErrNotExist {
+			fmt.Printf("%s not found, %s not published\n", key, statement.financialStatementType)
+			continue
+		}
+		if err != nil {
+			fmt.Println("Error reading CSV file:", err)
+			return nil, err
+		}
+		doc, err := BuildCombinedStatementDoc(CIK, statement.financialStatementType, statement.level, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		doc.Provenance.SourceFile = key
+
+		mappingKey := storage.CombinedStatementKey(statement.lineItemMappingFileName)
+		conceptOf, err := readConceptsOfCombinedStatement(mappingKey)
+		if err != nil {
+			fmt.Println("Error reading line item mapping:", err)
+			return nil, err
+		}
+		doc.Provenance.LineItemMappingFile = mappingKey
+		for _, lineItem := range GetCombinedStatementLineItems(doc.Data) {
+			doc.Provenance.LineItems = append(doc.Provenance.LineItems, CombinedStatementLineItemSource{
+				LineItem: lineItem.Name,
+				Concept:  conceptOf[normalizeLineItemName(lineItem.Name)],
+			})
+		}
+		docs = append(docs, doc)
+	}
+	if len(docs) == 0 {
+		return nil, fmt.Errorf("no combined statements found for %s, run combine first", CIK)
+	}
+	return docs, nil
+}
+
+// BuildCombinedStatementDoc reads the columns and the filings they came from out of the metadata rows of a combined statement
+func BuildCombinedStatementDoc(CIK string, financialStatementType string, level int, data [][]string) (CombinedStatementDoc, error) {
+	for i := range data {
+		if len(data[i]) > 0 {
+			data[i][0] = removeBOM(data[i][0])
+		}
+	}
+	statementColumns, err := GetFinancialStatementColumns(data)
+	if err != nil {
+		return CombinedStatementDoc{}, err
+	}
+
+	columns := make([]CombinedStatementColumn, 0, len(statementColumns))
+	accessionNumbers := []string{}
+	seen := make(map[string]bool)
+	for _, column := range statementColumns {
+		columns = append(columns, CombinedStatementColumn{
+			AccessionNumber:        column.AccessionNumber,
+			Form:                   column.Form,
+			ReportDate:             column.ReportDate,
+			ReportPeriod:           column.ReportPeriod,
+			ReportDurationInMonths: column.ReportDurationInMonths,
+			ValueSource:            column.ValueSource,
+		})
+		if column.AccessionNumber != "" && !seen[column.AccessionNumber] {
+			seen[column.AccessionNumber] = true
+			accessionNumbers = append(accessionNumbers, column.AccessionNumber)
+		}
+	}
+
+	return CombinedStatementDoc{
+		CIK:                    CIK,
+		FinancialStatementType: financialStatementType,
+		Level:                  level,
+		Columns:                columns,
+		Data:                   data,
+		Provenance:             CombinedStatementProvenance{AccessionNumbers: accessionNumbers},
+		GeneratedAt:            time.Now(),
+	}, nil
+}
+
+// CombinedStatementLineItem is one line item row of a combined statement with its numeric values
+type CombinedStatementLineItem struct {
+	RowIndex int            // index of the row in data
+	Name     string         // the name as it is in the CSV
+	Heading  string         // the last heading row above it, eg) "Current assets:", empty when there is none
+	Values   map[int]string // index in Columns -> number, cells that aren't a finite number are left out
+}
+
+// GetCombinedStatementLineItems returns the line item rows below the separator, heading rows (no values) only set Heading of the rows after them
+func GetCombinedStatementLineItems(data [][]string) []CombinedStatementLineItem {
+	separatorRowIndex := FindSeparatorRowIndex(data)
+	if separatorRowIndex == -1 {
+		return nil
+	}
+	var lineItems []CombinedStatementLineItem
+	heading := ""
+	for i := separatorRowIndex + 1; i < len(data); i++ {
+		row := data[i]
+		if len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		if !DoesDataCellExistInThisRow(row) {
+			heading = row[0]
+			continue
+		}
+		lineItem := CombinedStatementLineItem{RowIndex: i, Name: row[0], Heading: heading, Values: make(map[int]string)}
+		for j := 1; j < len(row); j++ {
+			cell := cleanCellValue(row[j])
+			// ParseFloat takes NaN and Inf too, a published value is a finite number
+			if value, err := strconv.ParseFloat(cell, 64); err == nil && !math.IsNaN(value) && !math.IsInf(value, 0) {
+				lineItem.Values[j-1] = cell
+			}
+		}
+		lineItems = append(lineItems, lineItem)
+	}
+	return lineItems
+}
+
+// SaveCombinedStatementToMongoDB replaces the doc of the CIK and statement type in the database the Backend reads
+func SaveCombinedStatementToMongoDB(doc CombinedStatementDoc, client *mongo.Client) error {
+	collection := utilityFunctions.GetPublishedMongoDBCollectionByName(client, "combinedFinancialStatementsCollection", "combinedFinancialStatements")
+	filter := bson.M{"cik": doc.CIK, "financialStatementType": doc.FinancialStatementType}
+	_, err := collection.ReplaceOne(context.Background(), filter, doc, options.Replace().SetUpsert(true))
+	return err
+}
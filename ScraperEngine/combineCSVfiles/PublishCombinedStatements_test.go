@@ -0,0 +1,74 @@
+package combinecsvfiles
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+)
+
+func TestGetCombinedStatementLineItems(t *testing.T) {
+	key := storage.CombinedStatementKey("0001837014_combinedBalanceSheetLevel1.csv")
+	data, err := storage.GetCsv(storage.NewLocalStore("testdata"), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := BuildCombinedStatementDoc("0001837014", "BS", 1, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lineItems := make(map[string]CombinedStatementLineItem)
+	for _, lineItem := range GetCombinedStatementLineItems(doc.Data) {
+		lineItems[lineItem.Name] = lineItem
+	}
+
+	// values are by report period so a value at the wrong index of doc.Columns shows up as the wrong period
+	tests := []struct {
+		name    string
+		heading string
+		values  map[string]string
+	}{
+		{"Cash and cash equivalents", "Current assets:", map[string]string{"20231231": "36716", "20240331": "29846", "20240630": "24155"}},
+		{"Restricted cash", "Current assets:", map[string]string{"20240630": "1004"}},
+		{"Accounts receivable", "Current assets:", map[string]string{"20231231": "1244", "20240331": "1102"}},
+		{"Inventory", "Current assets:", map[string]string{"20240331": "10812", "20240630": "11960"}},
+		{"Total assets", "Current assets:", map[string]string{"20231231": "40306", "20240331": "43030", "20240630": "38350"}},
+		{"Deferred revenue", "Current liabilities:", map[string]string{"20231231": "1883", "20240331": "2043"}},
+		{"Accumulated deficit", "Stockholders' equity:", map[string]string{"20231231": "-186744", "20240331": "-194530", "20240630": "-201300"}},
+		{"Total liabilities and stockholders' equity", "Stockholders' equity:", map[string]string{"20231231": "40306", "20240331": "43030", "20240630": "38350"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lineItem, ok := lineItems[test.name]
+			if !ok {
+				t.Fatalf("no line item %q", test.name)
+			}
+			if lineItem.Heading != test.heading {
+				t.Errorf("Heading = %q, want %q", lineItem.Heading, test.heading)
+			}
+			if doc.Data[lineItem.RowIndex][0] != test.name {
+				t.Errorf("RowIndex %d is %q", lineItem.RowIndex, doc.Data[lineItem.RowIndex][0])
+			}
+			values := make(map[string]string)
+			for columnIndex, value := range lineItem.Values {
+				if columnIndex >= len(doc.Columns) {
+					t.Fatalf("column index %d, the statement has %d columns", columnIndex, len(doc.Columns))
+				}
+				values[doc.Columns[columnIndex].ReportPeriod] = value
+			}
+			if !reflect.DeepEqual(values, test.values) {
+				t.Errorf("got %v, want %v", values, test.values)
+			}
+		})
+	}
+
+	for _, heading := range []string{"Current assets:", "Current liabilities:", "Stockholders' equity:"} {
+		if _, ok := lineItems[heading]; ok {
+			t.Errorf("heading row %q returned as a line item", heading)
+		}
+	}
+	if len(lineItems) != 14 {
+		t.Errorf("got %d line items, want the 14 rows with values", len(lineItems))
+	}
+}
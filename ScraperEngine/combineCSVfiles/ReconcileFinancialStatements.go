@@ -0,0 +1,312 @@
+package combinecsvfiles
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// a mismatch between statements of the same filing usually means one of them was parsed or categorized wrong
+
+// ReconciliationCheck ties one line item of one statement to one line item of another statement for one column
+// Status is "passed", "failed", "warning" when the difference is explained (see Note, not counted as a failure)
+// or "skipped" when a line item or the matching column couldn't be found (see Note)
+type ReconciliationCheck struct {
+	Check            string `bson:"check"`
+	ReportPeriod     string `bson:"reportPeriod"`
+	DurationInMonths string `bson:"durationInMonths"`
+	LeftLineItem     string `bson:"leftLineItem"`
+	LeftValue        string `bson:"leftValue"`
+	RightLineItem    string `bson:"rightLineItem"`
+	RightValue       string `bson:"rightValue"`
+	Status           string `bson:"status"`
+	Note             string `bson:"note,omitempty"`
+}
+
+// FilingReconciliationReport is saved on the filing doc under reconciliation
+type FilingReconciliationReport struct {
+	AccessionNumber string                `bson:"accessionNumber"`
+	Form            string                `bson:"form"`
+	ReportDate      string                `bson:"reportDate"`
+	Checks          []ReconciliationCheck `bson:"checks"`
+	Failures        int                   `bson:"failures"`
+}
+
+// ReconcileFinancialStatementsGivenCIK runs the reconciliation checks on every filing of the CIK,
+// saves each report on its filing doc and all failures to SEC-files/combinedFinancialStatements/CIK_reconciliationReport.csv
+func ReconcileFinancialStatementsGivenCIK(CIK string, client *mongo.Client) ([]FilingReconciliationReport, error) {
+	filings, err := RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate(CIK)
+	if err != nil {
+		fmt.Println("RetrieveFinancialStatementMetaDataDocsOldestToNewestReportDate", err)
+		return nil, err
+	}
+	BSfilePaths, ISfilePaths, CISfilePaths, CFfilePaths, err := GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings(filings)
+	if err != nil {
+		fmt.Println("GenerateFilePathsOfCSVfilesOfFinancialStatementsGivenFilings", err)
+		return nil, err
+	}
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		fmt.Println("Error loading classification rules:", err)
+		return nil, err
+	}
+
+	readIfExists := func(filePath string) [][]string {
+		if filePath == "" {
+			return nil
+		}
+		statement, err := storage.GetCsv(storage.SECFiles, filePath)
+		if err != nil {
+			fmt.Println("Error reading CSV file:", err)
+			return nil
+		}
+		return statement
+	}
+
+	var reports []FilingReconciliationReport
+	reportArray := [][]string{{"accessionNumber", "check", "reportPeriod", "durationInMonths", "leftLineItem", "leftValue", "rightLineItem", "rightValue", "status", "note"}}
+	for i, filing := range filings {
+		accessionNumber := filing.AccessionNumber
+		form := filing.Form
+		reportDate := filing.ReportDate
+
+		balanceSheet := readIfExists(BSfilePaths[i])
+		incomeStatement := readIfExists(ISfilePaths[i])
+		comprehensiveIncomeStatement := readIfExists(CISfilePaths[i])
+		cashFlowStatement := readIfExists(CFfilePaths[i])
+		if incomeStatement != nil {
+			var splitComprehensiveIncomeStatement [][]string
+			incomeStatement, splitComprehensiveIncomeStatement, _ = SplitComprehensiveIncomeOutOfIncomeStatement(incomeStatement)
+			if comprehensiveIncomeStatement == nil {
+				comprehensiveIncomeStatement = splitComprehensiveIncomeStatement
+			}
+		}
+
+		report := ReconcileFinancialStatementsOfFiling(balanceSheet, incomeStatement, comprehensiveIncomeStatement, cashFlowStatement, rules.BalanceSheetAnchors)
+		report.AccessionNumber = accessionNumber
+		report.Form = form
+		report.ReportDate = reportDate
+		if err := SaveFilingReconciliationReport(CIK, report); err != nil {
+			fmt.Println("Error SaveFilingReconciliationReport function:", err)
+			return reports, err
+		}
+		reports = append(reports, report)
+
+		for _, check := range report.Checks {
+			if check.Status == "passed" {
+				continue
+			}
+			reportArray = append(reportArray, []string{accessionNumber, check.Check, check.ReportPeriod, check.DurationInMonths,
+				check.LeftLineItem, check.LeftValue, check.RightLineItem, check.RightValue, check.Status, check.Note})
+		}
+	}
+
+	key := storage.CombinedStatementKey(CIK + "_reconciliationReport.csv")
+	if err := storage.PutCsv(storage.SECFiles, key, reportArray); err != nil {
+		fmt.Printf("Error saving CSV file: %v\n", err)
+		return reports, err
+	}
+	return reports, nil
+}
+
+// ReconcileFinancialStatementsOfFiling ties the statements of one filing together, any of them can be nil:
+// net income on the IS = the starting line of the CF, ending cash on the CF = cash on the BS, net income on the CIS = net income on the IS
+func ReconcileFinancialStatementsOfFiling(balanceSheet [][]string, incomeStatement [][]string, comprehensiveIncomeStatement [][]string, cashFlowStatement [][]string, anchors classificationrules.BalanceSheetAnchorRules) FilingReconciliationReport {
+	report := FilingReconciliationReport{Checks: []ReconciliationCheck{}}
+
+	incomeStatementNetIncomeRowIndex := findNetIncomeRowIndex(incomeStatement)
+	cashFlowStartingRowIndex := findFirstDataRowIndex(cashFlowStatement)
+	report.Checks = append(report.Checks, reconcileRowsOfTwoStatements("IS net income = CF starting line",
+		incomeStatement, incomeStatementNetIncomeRowIndex, cashFlowStatement, cashFlowStartingRowIndex, true)...)
+
+	comprehensiveIncomeStatementNetIncomeRowIndex := findNetIncomeRowIndex(comprehensiveIncomeStatement)
+	if comprehensiveIncomeStatement != nil {
+		report.Checks = append(report.Checks, reconcileRowsOfTwoStatements("CIS net income = IS net income",
+			comprehensiveIncomeStatement, comprehensiveIncomeStatementNetIncomeRowIndex, incomeStatement, incomeStatementNetIncomeRowIndex, true)...)
+	}
+
+	cashFlowEndingCashRowIndex := -1
+	for i := FindSeparatorRowIndex(cashFlowStatement) + 1; cashFlowStatement != nil && i < len(cashFlowStatement); i++ {
+		if DoesDataCellExistInThisRow(cashFlowStatement[i]) && endOfPeriodBalanceRegex.MatchString(cashFlowStatement[i][0]) {
+			cashFlowEndingCashRowIndex = i
+			break
+		}
+	}
+	balanceSheetCashRowIndex := -1
+	for i := FindSeparatorRowIndex(balanceSheet) + 1; balanceSheet != nil && i < len(balanceSheet); i++ {
+		if DoesDataCellExistInThisRow(balanceSheet[i]) && containsAny(balanceSheet[i][0], anchors.StartOfAssets) {
+			balanceSheetCashRowIndex = i
+			break
+		}
+	}
+	// the balance sheet has no duration, match its columns on reportPeriod only
+	cashChecks := reconcileRowsOfTwoStatements("CF ending cash = BS cash",
+		cashFlowStatement, cashFlowEndingCashRowIndex, balanceSheet, balanceSheetCashRowIndex, false)
+	report.Checks = append(report.Checks, allowRestrictedCash(cashChecks, balanceSheet, balanceSheetCashRowIndex)...)
+
+	for _, check := range report.Checks {
+		if check.Status == "failed" {
+			report.Failures++
+		}
+	}
+	return report
+}
+
+// since ASU 2016-18 the ending cash of the CF includes restricted cash, which the balance sheet can have on lines of its own
+var restrictedCashRegex = regexp.MustCompile(`(?i)restricted\s+cash`)
+
+// allowRestrictedCash passes the failed CF ending cash checks where BS cash plus the restricted cash lines of the BS is the CF ending cash.
+// When the CF ending cash says it includes restricted cash but the BS has no such line to add, the check is a warning instead
+func allowRestrictedCash(checks []ReconciliationCheck, balanceSheet [][]string, balanceSheetCashRowIndex int) []ReconciliationCheck {
+	columns, err := GetFinancialStatementColumns(balanceSheet)
+	if err != nil {
+		return checks
+	}
+	var restrictedCashRowIndices []int
+	for i := FindSeparatorRowIndex(balanceSheet) + 1; i < len(balanceSheet); i++ {
+		if i != balanceSheetCashRowIndex && DoesDataCellExistInThisRow(balanceSheet[i]) && restrictedCashRegex.MatchString(balanceSheet[i][0]) {
+			restrictedCashRowIndices = append(restrictedCashRowIndices, i)
+		}
+	}
+
+	for c := range checks {
+		check := &checks[c]
+		if check.Status != "failed" {
+			continue
+		}
+		columnIndex := -1
+		for j, column := range columns {
+			if column.ReportPeriod == check.ReportPeriod {
+				columnIndex = j + 1
+				break
+			}
+		}
+		if columnIndex != -1 && len(restrictedCashRowIndices) > 0 {
+			cells := []string{check.RightValue}
+			signs := []float64{1}
+			for _, rowIndex := range restrictedCashRowIndices {
+				if columnIndex < len(balanceSheet[rowIndex]) && balanceSheet[rowIndex][columnIndex] != "" {
+					cells = append(cells, cleanCellValue(balanceSheet[rowIndex][columnIndex]))
+					signs = append(signs, 1)
+				}
+			}
+			total, ok := sumCellValues(cells, signs)
+			leftValue, errLeft := strconv.ParseFloat(check.LeftValue, 64)
+			totalValue, errTotal := strconv.ParseFloat(total, 64)
+			if ok && errLeft == nil && errTotal == nil && math.Abs(leftValue-totalValue) <= 1e-9 {
+				check.Status = "passed"
+				check.Note = "BS cash plus restricted cash " + total
+				continue
+			}
+		}
+		if restrictedCashRegex.MatchString(check.LeftLineItem) {
+			check.Status = "warning"
+			check.Note = "CF ending cash includes restricted cash the BS doesn't show on a line of its own"
+		}
+	}
+	return checks
+}
+
+// reconcileRowsOfTwoStatements compares the row of the left statement to the row of the right statement in every column of the
+// left statement, the right column is found by reportPeriod (and reportDurationInMonths when matchDuration)
+func reconcileRowsOfTwoStatements(name string, left [][]string, leftRowIndex int, right [][]string, rightRowIndex int, matchDuration bool) []ReconciliationCheck {
+	if left == nil || right == nil {
+		return []ReconciliationCheck{{Check: name, Status: "skipped", Note: "statement missing"}}
+	}
+	leftColumns, err := GetFinancialStatementColumns(left)
+	if err != nil {
+		return []ReconciliationCheck{{Check: name, Status: "skipped", Note: err.Error()}}
+	}
+	rightColumns, err := GetFinancialStatementColumns(right)
+	if err != nil {
+		return []ReconciliationCheck{{Check: name, Status: "skipped", Note: err.Error()}}
+	}
+	if leftRowIndex == -1 || rightRowIndex == -1 {
+		return []ReconciliationCheck{{Check: name, Status: "skipped", Note: "line item not found"}}
+	}
+	leftColumns = FillInMissingReportDurations(leftColumns)
+	rightColumns = FillInMissingReportDurations(rightColumns)
+
+	var checks []ReconciliationCheck
+	for j, leftColumn := range leftColumns {
+		check := ReconciliationCheck{
+			Check:            name,
+			ReportPeriod:     leftColumn.ReportPeriod,
+			DurationInMonths: leftColumn.ReportDurationInMonths,
+			LeftLineItem:     left[leftRowIndex][0],
+			RightLineItem:    right[rightRowIndex][0],
+		}
+		if j+1 < len(left[leftRowIndex]) {
+			check.LeftValue = cleanCellValue(left[leftRowIndex][j+1])
+		}
+
+		rightColumnIndex := -1
+		for k, rightColumn := range rightColumns {
+			if rightColumn.ReportPeriod == leftColumn.ReportPeriod && (!matchDuration || rightColumn.ReportDurationInMonths == leftColumn.ReportDurationInMonths) {
+				rightColumnIndex = k + 1
+				break
+			}
+		}
+		if rightColumnIndex == -1 {
+			check.Status = "skipped"
+			check.Note = "no matching column"
+			checks = append(checks, check)
+			continue
+		}
+		if rightColumnIndex < len(right[rightRowIndex]) {
+			check.RightValue = cleanCellValue(right[rightRowIndex][rightColumnIndex])
+		}
+
+		leftValue, errLeft := strconv.ParseFloat(check.LeftValue, 64)
+		rightValue, errRight := strconv.ParseFloat(check.RightValue, 64)
+		switch {
+		case errLeft != nil || errRight != nil:
+			check.Status = "skipped"
+			check.Note = "value is not a number"
+		case math.Abs(leftValue-rightValue) > 1e-9:
+			check.Status = "failed"
+		default:
+			check.Status = "passed"
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// findNetIncomeRowIndex returns the first net income/loss row with data, -1 if there is none
+func findNetIncomeRowIndex(statement [][]string) int {
+	if statement == nil {
+		return -1
+	}
+	for i := FindSeparatorRowIndex(statement) + 1; i < len(statement); i++ {
+		if DoesDataCellExistInThisRow(statement[i]) && netIncomeRegex.MatchString(statement[i][0]) && !perShareRegex.MatchString(statement[i][0]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// findFirstDataRowIndex returns the first line item with data, the starting line of a cash flow statement
+func findFirstDataRowIndex(statement [][]string) int {
+	if statement == nil {
+		return -1
+	}
+	for i := FindSeparatorRowIndex(statement) + 1; i < len(statement); i++ {
+		if DoesDataCellExistInThisRow(statement[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SaveFilingReconciliationReport saves the report as the reconciliation report of the filing
+func SaveFilingReconciliationReport(CIK string, report FilingReconciliationReport) error {
+	return filingrepository.Filings.SetFilingReport(CIK, report.AccessionNumber, "reconciliation", report)
+}
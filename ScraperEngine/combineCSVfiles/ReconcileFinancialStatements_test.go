@@ -0,0 +1,64 @@
+package combinecsvfiles
+
+import (
+	"testing"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+)
+
+func TestReconcileCashAllowsRestrictedCash(t *testing.T) {
+	anchors := classificationrules.BalanceSheetAnchorRules{StartOfAssets: []string{"Cash and cash equivalents"}}
+	balanceSheetColumns := []FinancialStatementColumn{{AccessionNumber: "a1", Form: "10-K", ReportPeriod: "20231231"}}
+	cashFlowColumns := []FinancialStatementColumn{{AccessionNumber: "a1", Form: "10-K", ReportPeriod: "20231231", ReportDurationInMonths: "12"}}
+
+	tests := []struct {
+		name              string
+		balanceSheetRows  [][]string
+		cashFlowEndingRow []string
+		want              string
+	}{
+		{
+			name:              "restricted cash on a line of its own",
+			balanceSheetRows:  [][]string{{"Cash and cash equivalents", "100"}, {"Restricted cash", "4"}, {"Restricted cash, noncurrent", "1"}},
+			cashFlowEndingRow: []string{"Cash, cash equivalents and restricted cash at end of period", "105"},
+			want:              "passed",
+		},
+		{
+			name:              "restricted cash not on the balance sheet",
+			balanceSheetRows:  [][]string{{"Cash and cash equivalents", "100"}},
+			cashFlowEndingRow: []string{"Cash, cash equivalents and restricted cash at end of period", "105"},
+			want:              "warning",
+		},
+		{
+			name:              "no restricted cash",
+			balanceSheetRows:  [][]string{{"Cash and cash equivalents", "100"}},
+			cashFlowEndingRow: []string{"Cash and cash equivalents at end of period", "105"},
+			want:              "failed",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			balanceSheet := append(BuildMetadataRowsOfCombinedStatement("Balance Sheet", balanceSheetColumns), test.balanceSheetRows...)
+			cashFlowStatement := append(BuildMetadataRowsOfCombinedStatement("Cash Flows", cashFlowColumns), test.cashFlowEndingRow)
+
+			report := ReconcileFinancialStatementsOfFiling(balanceSheet, nil, nil, cashFlowStatement, anchors)
+			for _, check := range report.Checks {
+				if check.Check != "CF ending cash = BS cash" {
+					continue
+				}
+				if check.Status != test.want {
+					t.Errorf("got %s (%s), want %s", check.Status, check.Note, test.want)
+				}
+				wantFailures := 0
+				if test.want == "failed" {
+					wantFailures = 1
+				}
+				if report.Failures != wantFailures {
+					t.Errorf("got %d failures, want %d", report.Failures, wantFailures)
+				}
+				return
+			}
+			t.Fatal("no cash check in the report")
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package combinecsvfiles
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	utilityFunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TrailingTwelveMonthsGap is a report period whose TTM column could not be built, the cells of that column are left empty
+type TrailingTwelveMonthsGap struct {
+	ReportPeriod   string   `bson:"reportPeriod" json:"reportPeriod"`
+	MissingPeriods []string `bson:"missingPeriods" json:"missingPeriods"` // eg) "3M 20230630"
+}
+
+// TrailingTwelveMonthsDoc is what is saved to CombinedStatements for the Backend, data has the same layout as the CSV
+type TrailingTwelveMonthsDoc struct {
+	CIK                    string                    `bson:"cik"`
+	FinancialStatementType string                    `bson:"financialStatementType"` // IS or CF
+	Data                   [][]string                `bson:"data"`
+	Gaps                   []TrailingTwelveMonthsGap `bson:"gaps"`
+	UpdatedAt              time.Time                 `bson:"updatedAt"`
+}
+
+// BuildTrailingTwelveMonthsStatement turns a combined income or cash flow statement (with its discrete quarter columns already derived)
+// into one TTM column per quarter end. TTM is the sum of the last four 3 month columns, when one of them is missing it falls back to
+// FY + YTD - prior year YTD. Periods where neither works are returned as gaps instead of being zero filled.
+func BuildTrailingTwelveMonthsStatement(statement [][]string, stockItemTerms []string) ([][]string, []TrailingTwelveMonthsGap, error) {
+	separatorRowIndex := FindSeparatorRowIndex(statement)
+	columns, err := GetFinancialStatementColumns(statement)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns = FillInMissingReportDurations(columns)
+	latestColumnOf, keys := latestColumnIndexOfEachReportPeriod(columns)
+	stockItemRows := findStockItemRows(statement, stockItemTerms)
+
+	endOfPeriodRowIndex := -1
+	for i := separatorRowIndex + 1; i < len(statement); i++ {
+		if len(statement[i]) > 0 && endOfPeriodBalanceRegex.MatchString(statement[i][0]) {
+			endOfPeriodRowIndex = i
+			break
+		}
+	}
+
+	var reportPeriods []string
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if (key.duration == 3 || key.duration == 12) && !seen[key.reportPeriod] {
+			seen[key.reportPeriod] = true
+			reportPeriods = append(reportPeriods, key.reportPeriod)
+		}
+	}
+
+	var ttmColumns []FinancialStatementColumn
+	var ttmCells [][]string // one slice of cells per TTM column, indexed like the rows of statement
+	var gaps []TrailingTwelveMonthsGap
+	for _, reportPeriod := range reportPeriods {
+		componentKeys, signs, missingPeriods := findTrailingTwelveMonthsComponents(reportPeriod, keys, latestColumnOf)
+		if componentKeys == nil {
+			gaps = append(gaps, TrailingTwelveMonthsGap{ReportPeriod: reportPeriod, MissingPeriods: missingPeriods})
+			continue
+		}
+
+		var derivedFrom []string
+		for i, key := range componentKeys {
+			operator := "+"
+			if signs[i] < 0 {
+				operator = "-"
+			}
+			if i > 0 {
+				derivedFrom = append(derivedFrom, operator)
+			}
+			derivedFrom = append(derivedFrom, fmt.Sprintf("%dM %s", key.duration, key.reportPeriod))
+		}
+		latest := columns[latestColumnOf[componentKeys[0]]]
+		ttmColumns = append(ttmColumns, FinancialStatementColumn{
+			AccessionNumber:        latest.AccessionNumber,
+			Form:                   latest.Form,
+			ReportDate:             latest.ReportDate,
+			Title:                  "Trailing 12 Months",
+			Denomination:           latest.Denomination,
+			ReportPeriod:           reportPeriod,
+			ReportDurationInMonths: "12",
+			ValueSource:            "computed",
+			DerivedFrom:            strings.Join(derivedFrom, " "),
+		})
+
+		cellOf := func(rowIndex int, key reportPeriodKey) string {
+			if columnIndex := latestColumnOf[key] + 1; rowIndex != -1 && columnIndex < len(statement[rowIndex]) {
+				return statement[rowIndex][columnIndex]
+			}
+			return ""
+		}
+		cells := make([]string, len(statement))
+		for i := separatorRowIndex + 1; i < len(statement); i++ {
+			if len(statement[i]) == 0 || stockItemRows[i] {
+				continue
+			}
+			switch {
+			case endOfPeriodBalanceRegex.MatchString(statement[i][0]):
+				// the balance at the end of the latest component, the first one
+				cells[i] = cellOf(i, componentKeys[0])
+			case beginningOfPeriodBalanceRegex.MatchString(statement[i][0]):
+				cells[i] = trailingTwelveMonthsBeginningBalance(i, endOfPeriodRowIndex, componentKeys, signs, cellOf)
+			default:
+				componentCells := make([]string, len(componentKeys))
+				for c, key := range componentKeys {
+					componentCells[c] = cellOf(i, key)
+				}
+				// an empty component leaves the TTM cell empty
+				cells[i], _ = sumCellValues(componentCells, signs)
+			}
+		}
+		ttmCells = append(ttmCells, cells)
+	}
+
+	title := ""
+	if titleRowIndex := findTitleRowIndex(statement); titleRowIndex != -1 {
+		title = statement[titleRowIndex][0]
+	}
+	ttmStatement := BuildMetadataRowsOfCombinedStatement(title, ttmColumns)
+	for i := separatorRowIndex + 1; i < len(statement); i++ {
+		if len(statement[i]) == 0 || stockItemRows[i] {
+			continue
+		}
+		row := []string{statement[i][0]}
+		for _, cells := range ttmCells {
+			row = append(row, cells[i])
+		}
+		ttmStatement = append(ttmStatement, row)
+	}
+	return ttmStatement, gaps, nil
+}
+
+// trailingTwelveMonthsBeginningBalance is the balance the 12 months start with, balances aren't summed like the flows.
+// The components are latest first, so it is the beginning balance of the earliest one, or for FY + YTD - prior year YTD
+// the end balance of the prior year YTD, the same way DeriveDiscreteQuarterColumns starts a quarter
+func trailingTwelveMonthsBeginningBalance(rowIndex int, endOfPeriodRowIndex int, componentKeys []reportPeriodKey, signs []float64, cellOf func(int, reportPeriodKey) string) string {
+	for c, key := range componentKeys {
+		if signs[c] < 0 {
+			return cellOf(endOfPeriodRowIndex, key)
+		}
+	}
+	return cellOf(rowIndex, componentKeys[len(componentKeys)-1])
+}
+
+// findTrailingTwelveMonthsComponents returns the columns to add up (sign 1) or subtract (sign -1) for the TTM ending at reportPeriod,
+// nil and the missing quarters when there is no way to build it
+func findTrailingTwelveMonthsComponents(reportPeriod string, keys []reportPeriodKey, latestColumnOf map[reportPeriodKey]int) ([]reportPeriodKey, []float64, []string) {
+	// the last four quarters
+	var quarters []reportPeriodKey
+	var missingPeriods []string
+	for monthsBack := 0; monthsBack <= 9; monthsBack += 3 {
+		quarter, found := findPeriodEndingMonthsBefore(reportPeriod, monthsBack, 3, keys)
+		if !found {
+			missingPeriods = append(missingPeriods, "3M "+monthsBeforeReportPeriod(reportPeriod, monthsBack))
+			continue
+		}
+		quarters = append(quarters, quarter)
+	}
+	if len(quarters) == 4 {
+		return quarters, []float64{1, 1, 1, 1}, nil
+	}
+
+	// fiscal year end, the annual column is the TTM
+	if _, ok := latestColumnOf[reportPeriodKey{reportPeriod, 12}]; ok {
+		return []reportPeriodKey{{reportPeriod, 12}}, []float64{1}, nil
+	}
+
+	// FY + YTD - prior year YTD
+	for _, duration := range []int{9, 6, 3} {
+		yearToDate := reportPeriodKey{reportPeriod, duration}
+		if _, ok := latestColumnOf[yearToDate]; !ok {
+			continue
+		}
+		priorYearToDate, found := findPeriodEndingMonthsBefore(reportPeriod, 12, duration, keys)
+		if !found {
+			continue
+		}
+		fiscalYear, found := findPeriodEndingMonthsBefore(reportPeriod, duration, 12, keys)
+		if !found {
+			continue
+		}
+		return []reportPeriodKey{yearToDate, fiscalYear, priorYearToDate}, []float64{1, 1, -1}, nil
+	}
+	return nil, nil, missingPeriods
+}
+
+// 20230630, 3 -> 20230330, fiscal quarters don't always end on the last day of the month so this is approximate
+func monthsBeforeReportPeriod(reportPeriod string, months int) string {
+	end, err := time.Parse("20060102", reportPeriod)
+	if err != nil {
+		return reportPeriod
+	}
+	return end.AddDate(0, -months, 0).Format("20060102")
+}
+
+// GenerateTrailingTwelveMonthsAndSaveAsCsvFileGivenCIK builds the TTM income statement and cash flow statement of the CIK from the
+// Level 1 combined CSVs, saves them next to those CSVs and to CombinedStatements for the Backend. Gaps are printed and saved with the doc.
+func GenerateTrailingTwelveMonthsAndSaveAsCsvFileGivenCIK(CIK string) error {
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		fmt.Println("Error loading classification rules:", err)
+		return err
+	}
+
+	statements := []struct {
+		financialStatementType string
+		combinedFileName       string
+		ttmFileName            string
+	}{
+		{"IS", CIK + "_combinedIncomeStatementLevel1.csv", CIK + "_trailingTwelveMonthsIncomeStatement.csv"},
+		{"CF", CIK + "_combinedCashFlowStatementLevel1.csv", CIK + "_trailingTwelveMonthsCashFlowStatement.csv"},
+	}
+	for _, statement := range statements {
+		combinedFilePath := storage.CombinedStatementKey(statement.combinedFileName)
+		combinedStatement, err := storage.GetCsv(storage.SECFiles, combinedFilePath)
+		if err == storage.ErrNotExist {
+			return fmt.Errorf("%s not found, run combine first: %w", combinedFilePath, err)
+		}
+		if err != nil {
+			fmt.Println("Error reading CSV file:", err)
+			return err
+		}
+
+		ttmStatement, gaps, err := BuildTrailingTwelveMonthsStatement(combinedStatement, rules.FlowStatements.StockItemTerms)
+		if err != nil {
+			return fmt.Errorf("%s: %w", combinedFilePath, err)
+		}
+		for _, gap := range gaps {
+			fmt.Printf("%s TTM gap at %s, missing %s\n", statement.financialStatementType, gap.ReportPeriod, strings.Join(gap.MissingPeriods, ", "))
+		}
+
+		if err := storage.PutCsv(storage.SECFiles, storage.CombinedStatementKey(statement.ttmFileName), ttmStatement); err != nil {
+			fmt.Printf("Error saving CSV file: %v\n", err)
+			return err
+		}
+		doc := TrailingTwelveMonthsDoc{
+			CIK:                    CIK,
+			FinancialStatementType: statement.financialStatementType,
+			Data:                   ttmStatement,
+			Gaps:                   gaps,
+			UpdatedAt:              time.Now(),
+		}
+		if err := CombinedStatements.SaveTrailingTwelveMonths(doc); err != nil {
+			fmt.Println("Error saving the TTM statement:", err)
+			return err
+		}
+		fmt.Printf("Successfully saved %s TTM to %s\n", statement.financialStatementType, storage.CombinedStatementKey(statement.ttmFileName))
+	}
+	return nil
+}
+
+// SaveTrailingTwelveMonthsToMongoDB replaces the TTM doc of the CIK and statement type in the database the Backend reads
+func SaveTrailingTwelveMonthsToMongoDB(doc TrailingTwelveMonthsDoc, client *mongo.Client) error {
+	collection := utilityFunctions.GetPublishedMongoDBCollectionByName(client, "trailingTwelveMonthsCollection", "trailingTwelveMonths")
+	filter := bson.M{"cik": doc.CIK, "financialStatementType": doc.FinancialStatementType}
+	_, err := collection.ReplaceOne(context.Background(), filter, doc, options.Replace().SetUpsert(true))
+	return err
+}
@@ -0,0 +1,92 @@
+package combinecsvfiles
+
+import (
+	"reflect"
+	"testing"
+)
+
+// cashFlowStatementFixture builds a combined cash flow statement with the given columns and line item rows
+func cashFlowStatementFixture(columns []FinancialStatementColumn, lineItemRows [][]string) [][]string {
+	statement := BuildMetadataRowsOfCombinedStatement("Consolidated Statements of Cash Flows - USD ($) $ in Millions", columns)
+	return append(statement, lineItemRows...)
+}
+
+// rowOf returns the cells of the line item row named name, nil when there is no such row
+func rowOf(statement [][]string, name string) []string {
+	for i := FindSeparatorRowIndex(statement) + 1; i < len(statement); i++ {
+		if len(statement[i]) > 0 && statement[i][0] == name {
+			return statement[i][1:]
+		}
+	}
+	return nil
+}
+
+var testStockItemTerms = []string{"Per Share", "Weighted Average"}
+
+func TestBuildTrailingTwelveMonthsStatementFourQuarters(t *testing.T) {
+	columns := []FinancialStatementColumn{
+		{AccessionNumber: "a1", Form: "10-Q", ReportPeriod: "20230331", ReportDurationInMonths: "3"},
+		{AccessionNumber: "a2", Form: "10-Q", ReportPeriod: "20230630", ReportDurationInMonths: "3"},
+		{AccessionNumber: "a3", Form: "10-Q", ReportPeriod: "20230930", ReportDurationInMonths: "3"},
+		{AccessionNumber: "a4", Form: "10-K", ReportPeriod: "20231231", ReportDurationInMonths: "3", ValueSource: "computed"},
+	}
+	statement := cashFlowStatementFixture(columns, [][]string{
+		{"Net income", "10", "20", "30", "40"},
+		{"Cash, cash equivalents and restricted cash, beginning of period", "100", "110", "120", "130"},
+		{"Net change in cash", "10", "10", "10", "10"},
+		{"Cash, cash equivalents and restricted cash, end of period", "110", "120", "130", "140"},
+		{"Earnings per share:", "", "", "", ""},
+		{"Basic", "1", "1", "1", "1"},
+	})
+
+	ttm, gaps, err := BuildTrailingTwelveMonthsStatement(statement, testStockItemTerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gaps) != 3 {
+		t.Errorf("got %d gaps, want 3 for the first three quarters", len(gaps))
+	}
+
+	expected := map[string][]string{
+		"Net income": {"100"},
+		"Cash, cash equivalents and restricted cash, beginning of period": {"100"},
+		"Net change in cash": {"40"},
+		"Cash, cash equivalents and restricted cash, end of period": {"140"},
+		"Basic": nil,
+	}
+	for name, want := range expected {
+		if got := rowOf(ttm, name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestBuildTrailingTwelveMonthsStatementFiscalYearPlusYearToDate(t *testing.T) {
+	columns := []FinancialStatementColumn{
+		{AccessionNumber: "a1", Form: "10-Q", ReportPeriod: "20220930", ReportDurationInMonths: "9"},
+		{AccessionNumber: "a2", Form: "10-K", ReportPeriod: "20221231", ReportDurationInMonths: "12"},
+		{AccessionNumber: "a3", Form: "10-Q", ReportPeriod: "20230930", ReportDurationInMonths: "3"},
+		{AccessionNumber: "a3", Form: "10-Q", ReportPeriod: "20230930", ReportDurationInMonths: "9"},
+	}
+	statement := cashFlowStatementFixture(columns, [][]string{
+		{"Net income", "90", "120", "35", "105"},
+		{"Cash at beginning of year", "50", "50", "70", "80"},
+		{"Cash at end of year", "60", "80", "75", "75"},
+	})
+
+	ttm, _, err := BuildTrailingTwelveMonthsStatement(statement, testStockItemTerms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 20221231 is the annual column, 20230930 is 9M 2023 + FY 2022 - 9M 2022
+	expected := map[string][]string{
+		"Net income":                {"120", "135"},
+		"Cash at beginning of year": {"50", "60"},
+		"Cash at end of year":       {"80", "75"},
+	}
+	for name, want := range expected {
+		if got := rowOf(ttm, name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package combinecsvfiles
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// every line item is rounded to the denomination of the statement, so the sum of n line items can be off from the rounded total
+// by up to (n-1)/2, a total compared to a single other total has to match exactly
+const roundingTolerancePerLineItem = 0.5
+
+// BalanceSheetDiscrepancy is one check that didn't add up in one column of a balance sheet
+type BalanceSheetDiscrepancy struct {
+	Check        string  `bson:"check"`
+	ReportPeriod string  `bson:"reportPeriod"`
+	Expected     float64 `bson:"expected"` // the total reported on the balance sheet
+	Actual       float64 `bson:"actual"`   // the sum of its parts
+	Difference   float64 `bson:"difference"`
+}
+
+// BalanceSheetValidationResult is saved on the filing doc under balanceSheetValidation
+// Status is "passed", "failed" (see Discrepancies) or "unclassified" when the line items couldn't be classified (see Error)
+type BalanceSheetValidationResult struct {
+	AccessionNumber string                    `bson:"accessionNumber"`
+	Status          string                    `bson:"status"`
+	Discrepancies   []BalanceSheetDiscrepancy `bson:"discrepancies"`
+	Error           string                    `bson:"error,omitempty"`
+	ValidatedAt     time.Time                 `bson:"validatedAt"`
+}
+
+// ValidateBalanceSheetsGivenCIK checks the accounting identity of the balance sheet of every filing of the CIK
+// and saves the result on each filing doc
+func ValidateBalanceSheetsGivenCIK(CIK string, client *mongo.Client) ([]BalanceSheetValidationResult, error) {
+	BalanceSheetArrays, _, _, _, err := GetCsvRfilesIntoArrayVariables(CIK, client)
+	if err != nil {
+		fmt.Println("Error getting CSV files:", err)
+		return nil, err
+	}
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		fmt.Println("Error loading classification rules:", err)
+		return nil, err
+	}
+
+	var results []BalanceSheetValidationResult
+	for _, BalanceSheetArray := range BalanceSheetArrays {
+		result := ValidateBalanceSheet(BalanceSheetArray, rules.BalanceSheetAnchors, client)
+		if err := SaveBalanceSheetValidationResult(CIK, result); err != nil {
+			fmt.Println("Error SaveBalanceSheetValidationResult function:", err)
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// ValidateBalanceSheet checks, for every column of a parsed balance sheet R file:
+// total assets = total liabilities and equity, total assets = total liabilities + equity + other equity,
+// total current assets and total current liabilities = the sum of the line items above them
+func ValidateBalanceSheet(BalanceSheetArray [][]string, anchors classificationrules.BalanceSheetAnchorRules, client *mongo.Client) BalanceSheetValidationResult {
+	result := BalanceSheetValidationResult{ValidatedAt: time.Now(), Discrepancies: []BalanceSheetDiscrepancy{}}
+	if len(BalanceSheetArray) > 0 && len(BalanceSheetArray[0]) > 1 {
+		result.AccessionNumber = BalanceSheetArray[AccessionNumberRowIndex][1]
+	}
+
+	classifications, err := classifyBalanceSheetLineItemsWithFallback(BalanceSheetArray, anchors, client)
+	if err != nil {
+		result.Status = "unclassified"
+		result.Error = err.Error()
+		return result
+	}
+
+	for j := 1; j < len(BalanceSheetArray[AccessionNumberRowIndex]); j++ {
+		reportPeriod := ""
+		if j < len(BalanceSheetArray[ReportPeriodRowIndex]) {
+			reportPeriod = BalanceSheetArray[ReportPeriodRowIndex][j]
+		}
+		check := func(name string, totalRowIndex int, partRowIndices []int) {
+			total, ok := balanceSheetCellValue(BalanceSheetArray, totalRowIndex, j)
+			if !ok {
+				return
+			}
+			sum := 0.0
+			for _, rowIndex := range partRowIndices {
+				if value, ok := balanceSheetCellValue(BalanceSheetArray, rowIndex, j); ok {
+					sum += value
+				}
+			}
+			tolerance := math.Max(0, roundingTolerancePerLineItem*float64(len(partRowIndices)-1))
+			if difference := total - sum; math.Abs(difference) > tolerance+1e-9 {
+				result.Discrepancies = append(result.Discrepancies, BalanceSheetDiscrepancy{
+					Check:        name,
+					ReportPeriod: reportPeriod,
+					Expected:     total,
+					Actual:       sum,
+					Difference:   difference,
+				})
+			}
+		}
+
+		check("total assets = total liabilities and equity",
+			classifications.TotalAssets, []int{classifications.TotalLiabilitiesEquityAndOtherEquity})
+		check("total assets = total liabilities + equity + other equity",
+			classifications.TotalAssets, equityPartsOfBalanceSheet(BalanceSheetArray, classifications))
+		check("total current assets = sum of current assets",
+			classifications.TotalCurrentAssets, dataRowIndicesBetween(BalanceSheetArray, classifications.CurrentAssets, classifications.TotalCurrentAssets))
+		check("total current liabilities = sum of current liabilities",
+			classifications.TotalCurrentLiabilities, dataRowIndicesBetween(BalanceSheetArray, classifications.CurrentLiabilities, classifications.TotalCurrentLiabilities))
+	}
+
+	result.Status = "passed"
+	if len(result.Discrepancies) > 0 {
+		result.Status = "failed"
+	}
+	return result
+}
+
+// equityPartsOfBalanceSheet returns total liabilities, the other equity rows between total liabilities and stockholders' equity
+// (redeemable/mezzanine equity) and the equity total. Rows between total stockholders' equity and total liabilities and equity
+// (noncontrolling interests) are added unless one of them is a total, which then replaces the equity total.
+func equityPartsOfBalanceSheet(BalanceSheetArray [][]string, classifications BalanceSheetLineItemClassifications) []int {
+	parts := []int{classifications.TotalLiabilities}
+	for _, rowIndex := range classifications.OtherEquities {
+		if rowIndex < classifications.StockholdersEquity {
+			parts = append(parts, rowIndex)
+		}
+	}
+
+	equityRowIndices := []int{classifications.TotalStockholdersEquity}
+	for _, rowIndex := range dataRowIndicesBetween(BalanceSheetArray, classifications.TotalStockholdersEquity, classifications.TotalLiabilitiesEquityAndOtherEquity) {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(BalanceSheetArray[rowIndex][0])), "total") {
+			equityRowIndices = []int{rowIndex}
+			continue
+		}
+		equityRowIndices = append(equityRowIndices, rowIndex)
+	}
+	return append(parts, equityRowIndices...)
+}
+
+// dataRowIndicesBetween returns the rows with data strictly between the two row indices
+func dataRowIndicesBetween(BalanceSheetArray [][]string, startRowIndex int, endRowIndex int) []int {
+	var rowIndices []int
+	for i := startRowIndex + 1; i < endRowIndex && i < len(BalanceSheetArray); i++ {
+		if DoesDataCellExistInThisRow(BalanceSheetArray[i]) {
+			rowIndices = append(rowIndices, i)
+		}
+	}
+	return rowIndices
+}
+
+func balanceSheetCellValue(BalanceSheetArray [][]string, rowIndex int, columnIndex int) (float64, bool) {
+	if rowIndex < 0 || rowIndex >= len(BalanceSheetArray) || columnIndex >= len(BalanceSheetArray[rowIndex]) {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(cleanCellValue(BalanceSheetArray[rowIndex][columnIndex]), 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
+
+// SaveBalanceSheetValidationResult saves the result as the balanceSheetValidation report of the filing
+func SaveBalanceSheetValidationResult(CIK string, result BalanceSheetValidationResult) error {
+	return filingrepository.Filings.SetFilingReport(CIK, result.AccessionNumber, "balanceSheetValidation", result)
+}
@@ -0,0 +1,101 @@
+package combinecsvfiles
+
+import (
+	"testing"
+
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+)
+
+// the stage runs on the in-memory filing repository and a local SEC-files directory, no Mongo
+func TestValidateBalanceSheetsGivenCIKSavesResultOnFiling(t *testing.T) {
+	t.Setenv("LINE_ITEM_CLASSIFIERS", "none")
+	previousFilings, previousSECFiles := filingrepository.Filings, storage.SECFiles
+	t.Cleanup(func() { filingrepository.Filings, storage.SECFiles = previousFilings, previousSECFiles })
+	filingrepository.Filings = filingrepository.NewMemoryFilingRepository()
+	storage.SECFiles = storage.NewLocalStore(t.TempDir())
+
+	const CIK = "0001837014"
+	balanceSheetRows := map[string][][]string{
+		"0001837014-24-000010": {
+			{"Current Assets", ""},
+			{"Cash and Cash Equivalents", "100"},
+			{"Accounts receivable", "50"},
+			{"Total Current Assets", "150"},
+			{"Property and equipment", "50"},
+			{"Total Assets", "200"},
+			{"Current Liabilities", ""},
+			{"Accounts payable", "30"},
+			{"Total Current Liabilities", "30"},
+			{"Long-term debt", "70"},
+			{"Total Liabilities", "100"},
+			{"Stockholders' Equity", ""},
+			{"Common Stock", "60"},
+			{"Retained earnings", "40"},
+			{"Total Stockholders' Equity", "100"},
+			{"Total Liabilities and Stockholders' Equity", "200"},
+		},
+		// total current assets is off by 10
+		"0001837014-24-000020": {
+			{"Current Assets", ""},
+			{"Cash and Cash Equivalents", "100"},
+			{"Accounts receivable", "40"},
+			{"Total Current Assets", "150"},
+			{"Property and equipment", "50"},
+			{"Total Assets", "200"},
+			{"Current Liabilities", ""},
+			{"Accounts payable", "30"},
+			{"Total Current Liabilities", "30"},
+			{"Long-term debt", "70"},
+			{"Total Liabilities", "100"},
+			{"Stockholders' Equity", ""},
+			{"Common Stock", "60"},
+			{"Retained earnings", "40"},
+			{"Total Stockholders' Equity", "100"},
+			{"Total Liabilities and Stockholders' Equity", "200"},
+		},
+	}
+	reportDates := map[string]string{"0001837014-24-000010": "2024-03-31", "0001837014-24-000020": "2024-06-30"}
+	for accessionNumber, rows := range balanceSheetRows {
+		if err := filingrepository.Filings.UpsertFilingMetadata(filingrepository.FilingMetadata{CIK: CIK, AccessionNumber: accessionNumber, ReportDate: reportDates[accessionNumber], Form: "10-Q"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := filingrepository.Filings.SetRfiles(CIK, accessionNumber, map[string]filingrepository.Rfile{"BS": {FileName: "R2.htm"}}, "test"); err != nil {
+			t.Fatal(err)
+		}
+		columns := []FinancialStatementColumn{{AccessionNumber: accessionNumber, Form: "10-Q", ReportPeriod: reportDates[accessionNumber]}}
+		balanceSheet := append(BuildMetadataRowsOfCombinedStatement("Condensed Consolidated Balance Sheets - USD ($)", columns), rows...)
+		if err := storage.PutCsv(storage.SECFiles, storage.FilingKey(CIK, accessionNumber, "R2.csv"), balanceSheet); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err := ValidateBalanceSheetsGivenCIK(CIK, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		accessionNumber string
+		status          string
+	}{
+		{"0001837014-24-000010", "passed"},
+		{"0001837014-24-000020", "failed"},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, want := range want {
+		if results[i].AccessionNumber != want.accessionNumber || results[i].Status != want.status {
+			t.Errorf("result %d = %s %s (%s), want %s %s", i, results[i].AccessionNumber, results[i].Status, results[i].Error, want.accessionNumber, want.status)
+		}
+
+		var saved BalanceSheetValidationResult
+		found, err := filingrepository.Filings.GetFilingReport(want.accessionNumber, "balanceSheetValidation", &saved)
+		if err != nil || !found {
+			t.Fatalf("GetFilingReport = %v, %v, want the saved result", found, err)
+		}
+		if saved.Status != want.status || len(saved.Discrepancies) != len(results[i].Discrepancies) {
+			t.Errorf("saved %s with %d discrepancies, want %s with %d", saved.Status, len(saved.Discrepancies), want.status, len(results[i].Discrepancies))
+		}
+	}
+}
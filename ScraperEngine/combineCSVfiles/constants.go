@@ -20,6 +20,7 @@ var (
     AccessionNumberRowIndex = 0
     FormRowIndex           = 1
     ReportDateRowIndex     = 2
+    TitleRowIndex          = 3
     DenominationRowIndex   = 4
     ReportPeriodRowIndex   = 5
     ReportDurationRowIndex = 6
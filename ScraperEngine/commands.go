@@ -0,0 +1,967 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	categorizefinancialstatements "github.com/Programmerdin/FinancialDataSite_Go/categorizeRfiles"
+	combinecsvfiles "github.com/Programmerdin/FinancialDataSite_Go/combineCSVfiles"
+	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
+	geteverythinggivencik "github.com/Programmerdin/FinancialDataSite_Go/getEverythingGivenCIK"
+	jobqueue "github.com/Programmerdin/FinancialDataSite_Go/jobQueue"
+	parserfiles "github.com/Programmerdin/FinancialDataSite_Go/parseRfiles"
+	postgresdatabase "github.com/Programmerdin/FinancialDataSite_Go/postgresDatabase"
+	segmentdata "github.com/Programmerdin/FinancialDataSite_Go/segmentData"
+	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// runCommand runs one of the commands that can be given as the first argument of the binary
+func runCommand(command string, args []string, client *mongo.Client) error {
+	if client == nil && commandsThatNeedMongo[command] {
+		return fmt.Errorf("%s keeps its data in Mongo, set MONGODB_URI or mongodb_id and mongodb_password", command)
+	}
+	switch command {
+	case "fetch", "categorize", "parse":
+		return runStageCommand(command, args, client)
+	case "all":
+		return runAllCommand(args, client)
+	case "batch":
+		return runBatchCommand(args, client)
+	case "worker":
+		return runWorkerCommand(args, client)
+	case "jobs":
+		return runJobsCommand(args, client)
+	case "pipeline":
+		return runPipelineCommand(args)
+	case "reclassify":
+		return runReclassifyCommand(args, client)
+	case "details":
+		return runDetailsCommand(args, client)
+	case "segments":
+		return runSegmentsCommand(args, client)
+	case "combine":
+		return runCombineCommand(args, client)
+	case "publish":
+		return runPublishCommand(args, client)
+	case "postgres":
+		return runPostgresCommand(args)
+	case "ttm":
+		return runTrailingTwelveMonthsCommand(args)
+	case "standardize":
+		return runStandardizeCommand(args)
+	case "validate":
+		return runValidateCommand(args, client)
+	case "reconcile":
+		return runReconcileCommand(args, client)
+	case "prompts":
+		return runPromptsCommand(args, client)
+	case "review":
+		return runReviewCommand(args, client)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// commandsThatNeedMongo can't run with DATABASE_BACKEND=sqlite unless Mongo is configured too
+var commandsThatNeedMongo = map[string]bool{
+	"worker":   true,
+	"jobs":     true,
+	"segments": true,
+	"prompts":  true,
+	"review":   true,
+}
+
+// pipelineFlags are the flags shared by the commands that run stages of the pipeline
+type pipelineFlags struct {
+	dataDir     *string
+	concurrency *int
+	maxAttempts *int
+	keepGoing   *bool
+	dryRun      *bool
+}
+
+func addPipelineFlags(flags *flag.FlagSet) pipelineFlags {
+	return pipelineFlags{
+		dataDir:     flags.String("data-dir", "", "directory the local SEC-files store is in, defaults to the current directory, not used with SEC_FILES_STORE=s3"),
+		concurrency: flags.Int("concurrency", fetchdata.Concurrency, "requests sent to SEC per second, 1 to 10"),
+		maxAttempts: flags.Int("max-attempts", geteverythinggivencik.MaxAttempts, "times a filing is tried at a stage before it is left for pipeline reset"),
+		keepGoing:   flags.Bool("keep-going", false, "run the next stages even when a stage fails"),
+		dryRun:      flags.Bool("dry-run", false, "print the stages that would run without running them"),
+	}
+}
+
+// apply sets the concurrency and max attempts and changes to the data directory
+func (f pipelineFlags) apply(command string) error {
+	if *f.concurrency < 1 || *f.concurrency > 10 {
+		return fmt.Errorf("%s: --concurrency must be between 1 and 10, SEC allows 10 requests per second", command)
+	}
+	fetchdata.Concurrency = *f.concurrency
+	if *f.maxAttempts < 1 {
+		return fmt.Errorf("%s: --max-attempts must be at least 1", command)
+	}
+	geteverythinggivencik.MaxAttempts = *f.maxAttempts
+	if *f.dataDir != "" {
+		if err := os.Chdir(*f.dataDir); err != nil {
+			return fmt.Errorf("%s: --data-dir: %w", command, err)
+		}
+	}
+	return nil
+}
+
+// companyFlags are --cik and --ticker, every command that runs for one company takes them
+type companyFlags struct {
+	CIK    *string
+	ticker *string
+}
+
+func addCompanyFlags(flags *flag.FlagSet) companyFlags {
+	return companyFlags{
+		CIK:    flags.String("cik", "", "10 digit CIK of the company"),
+		ticker: flags.String("ticker", "", "ticker of the company, instead of --cik"),
+	}
+}
+
+// resolve returns the CIK, looking the ticker up when it's given instead
+func (f companyFlags) resolve(command string) (string, error) {
+	switch {
+	case *f.CIK != "" && *f.ticker != "":
+		return "", fmt.Errorf("%s: give either --cik or --ticker", command)
+	case *f.CIK != "":
+		return *f.CIK, nil
+	case *f.ticker != "":
+		CIK, err := fetchdata.FindCIKGivenTicker(*f.ticker)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", command, err)
+		}
+		fmt.Printf("%s is CIK %s\n", strings.ToUpper(*f.ticker), CIK)
+		return CIK, nil
+	default:
+		return "", fmt.Errorf("%s: --cik or --ticker is required", command)
+	}
+}
+
+// stageFlags are the pipeline flags plus the company the stages run for
+type stageFlags struct {
+	pipelineFlags
+	companyFlags
+}
+
+func addStageFlags(flags *flag.FlagSet) *stageFlags {
+	return &stageFlags{
+		pipelineFlags: addPipelineFlags(flags),
+		companyFlags:  addCompanyFlags(flags),
+	}
+}
+
+// apply applies the pipeline flags and returns the CIK of the company
+func (f *stageFlags) apply(command string) (string, error) {
+	if err := f.pipelineFlags.apply(command); err != nil {
+		return "", err
+	}
+	return f.companyFlags.resolve(command)
+}
+
+// runStageCommand runs a single stage of the pipeline (fetch, categorize or parse)
+func runStageCommand(command string, args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	stageFlags := addStageFlags(flags)
+	flags.Parse(args)
+	CIK, err := stageFlags.apply(command)
+	if err != nil {
+		return err
+	}
+
+	stages, err := geteverythinggivencik.SelectStages([]string{command})
+	if err != nil {
+		return err
+	}
+	return runStages(CIK, stages, stageFlags, client)
+}
+
+// runAllCommand runs every stage of the pipeline, or the ones given with --stages, in order
+func runAllCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("all", flag.ExitOnError)
+	stageFlags := addStageFlags(flags)
+	var stageNames stringListFlag
+	flags.Var(&stageNames, "stages", "comma separated stages to run, eg) fetch,categorize, defaults to all")
+	flags.Parse(args)
+	CIK, err := stageFlags.apply("all")
+	if err != nil {
+		return err
+	}
+
+	stages, err := geteverythinggivencik.SelectStages(stageNames.values())
+	if err != nil {
+		return fmt.Errorf("all: %w", err)
+	}
+	return runStages(CIK, stages, stageFlags, client)
+}
+
+// runBatchCommand runs the pipeline for many companies at once, listed in a file, on the command line or as the constituents of an index.
+// The workers share one SEC rate limit, so more workers only help while companies are busy with the stages that don't download
+func runBatchCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("batch", flag.ExitOnError)
+	pipelineFlags := addPipelineFlags(flags)
+	listFile := flags.String("file", "", "file with one CIK or ticker per line, # starts a comment")
+	var CIKs, tickers, stageNames stringListFlag
+	flags.Var(&CIKs, "ciks", "comma separated CIKs, can be repeated")
+	flags.Var(&tickers, "tickers", "comma separated tickers, can be repeated")
+	index := flags.String("index", "", "run the constituents of an index, eg) sp500")
+	workers := flags.Int("workers", 4, "companies processed at the same time")
+	flags.Var(&stageNames, "stages", "comma separated stages to run, eg) fetch,categorize, defaults to all")
+	summaryFile := flags.String("summary-file", "", "also save the summary table as a CSV, relative to --data-dir, eg) batchSummary.csv")
+	flags.Parse(args)
+	if err := pipelineFlags.apply("batch"); err != nil {
+		return err
+	}
+	if *workers < 1 {
+		return fmt.Errorf("batch: --workers must be at least 1")
+	}
+	stages, err := geteverythinggivencik.SelectStages(stageNames.values())
+	if err != nil {
+		return fmt.Errorf("batch: %w", err)
+	}
+
+	entries := append(CIKs.values(), tickers.values()...)
+	if *listFile != "" {
+		fileEntries, err := geteverythinggivencik.ReadCompanyListFile(*listFile)
+		if err != nil {
+			return fmt.Errorf("batch: %w", err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+	if *index != "" {
+		indexTickers, err := fetchdata.GetIndexConstituentTickers(*index)
+		if err != nil {
+			return fmt.Errorf("batch: %w", err)
+		}
+		entries = append(entries, indexTickers...)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("batch: give the companies with --file, --ciks, --tickers or --index")
+	}
+
+	companies, unresolved := geteverythinggivencik.ResolveCompanies(entries)
+	for _, result := range unresolved {
+		fmt.Printf("Skipping %s: %v\n", result.Company.Ticker, result.Err)
+	}
+	if *pipelineFlags.dryRun {
+		directory, _ := os.Getwd()
+		fmt.Printf("Would run %d companies on %d workers in %s, %d requests per second:\n", len(companies), *workers, directory, fetchdata.Concurrency)
+		for _, stage := range stages {
+			fmt.Printf("  %-10s %s\n", stage.Name, stage.Description)
+		}
+		for _, company := range companies {
+			fmt.Printf("  %s %s\n", company.CIK, company.Ticker)
+		}
+		return nil
+	}
+
+	results := append(geteverythinggivencik.RunBatch(companies, stages, *workers, *pipelineFlags.keepGoing, client), unresolved...)
+
+	summary := [][]string{{"cik", "ticker", "status", "duration"}}
+	for _, stage := range stages {
+		summary[0] = append(summary[0], stage.Name)
+	}
+	summary[0] = append(summary[0], "error")
+	failed := 0
+	for _, result := range results {
+		status := "ok"
+		if result.Failed() {
+			status = "failed"
+			failed++
+		}
+		row := []string{result.Company.CIK, result.Company.Ticker, status, result.Duration.Round(time.Second).String()}
+		var errorMessages []string
+		if result.Err != nil {
+			errorMessages = append(errorMessages, result.Err.Error())
+		}
+		for i := range stages {
+			if i >= len(result.Results) {
+				row = append(row, "")
+				continue
+			}
+			row = append(row, result.Results[i].Status)
+			if result.Results[i].Err != nil {
+				errorMessages = append(errorMessages, result.Results[i].Stage+": "+result.Results[i].Err.Error())
+			}
+		}
+		summary = append(summary, append(row, strings.ReplaceAll(strings.Join(errorMessages, "; "), "\n", "; ")))
+	}
+
+	fmt.Printf("\nSummary of %d companies:\n", len(results))
+	for _, row := range summary {
+		fmt.Printf("  %-10s %-6s %-7s %9s", row[0], row[1], row[2], row[3])
+		for _, cell := range row[4 : len(row)-1] {
+			fmt.Printf(" %-10s", cell)
+		}
+		errorMessage := row[len(row)-1]
+		if len(errorMessage) > 100 {
+			errorMessage = errorMessage[:100] + "..."
+		}
+		fmt.Printf(" %s\n", errorMessage)
+	}
+	if *summaryFile != "" {
+		directory, fileName := filepath.Split(*summaryFile)
+		if directory == "" {
+			directory = "."
+		}
+		if err := utilityfunctions.Save2DarrayToCsvFile(summary, directory, fileName); err != nil {
+			return fmt.Errorf("batch: %w", err)
+		}
+		fmt.Printf("Saved the summary to %s\n", *summaryFile)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d companies failed", failed, len(results))
+	}
+	return nil
+}
+
+// runStages prints the plan on --dry-run, otherwise runs the stages and prints how each went.
+// The error says how many stages failed so the binary exits non zero
+func runStages(CIK string, stages []geteverythinggivencik.Stage, stageFlags *stageFlags, client *mongo.Client) error {
+	if *stageFlags.dryRun {
+		directory, _ := os.Getwd()
+		fmt.Printf("Would run for CIK %s in %s, %d requests per second:\n", CIK, directory, fetchdata.Concurrency)
+		for _, stage := range stages {
+			fmt.Printf("  %-10s %s\n", stage.Name, stage.Description)
+		}
+		return nil
+	}
+
+	results := geteverythinggivencik.RunStages(CIK, stages, *stageFlags.keepGoing, client)
+
+	fmt.Printf("\nSummary for CIK %s:\n", CIK)
+	failed := 0
+	for _, result := range results {
+		duration := ""
+		if result.Status != "skipped" {
+			duration = result.Duration.Round(100 * time.Millisecond).String()
+		}
+		fmt.Printf("  %-10s %-7s %8s", result.Stage, result.Status, duration)
+		if result.Err != nil {
+			failed++
+			fmt.Printf("  %s", strings.ReplaceAll(result.Err.Error(), "\n", "; "))
+		}
+		fmt.Println()
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d stages failed for CIK %s", failed, len(stages), CIK)
+	}
+	return nil
+}
+
+// runWorkerCommand claims scrape jobs from the job queue and runs them until it gets SIGINT or SIGTERM
+func runWorkerCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("worker", flag.ExitOnError)
+	pipelineFlags := addPipelineFlags(flags)
+	workerID := flags.String("id", jobqueue.DefaultWorkerID(), "name of the worker saved on the jobs it claims")
+	lease := flags.Duration("lease", 5*time.Minute, "how long a claimed job stays claimed without a heartbeat")
+	pollInterval := flags.Duration("poll", 10*time.Second, "how often to look for a job when the queue is empty")
+	flags.Parse(args)
+	if err := pipelineFlags.apply("worker"); err != nil {
+		return err
+	}
+	if *lease < 3*time.Second {
+		return fmt.Errorf("worker: --lease must be at least 3s")
+	}
+	if *pipelineFlags.dryRun {
+		fmt.Printf("Would claim jobs as %s from %s with a %s lease, polling every %s\n",
+			*workerID, jobqueue.GetJobCollection(client).Name(), *lease, *pollInterval)
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return jobqueue.RunWorker(ctx, jobqueue.WorkerOptions{
+		WorkerID:     *workerID,
+		Lease:        *lease,
+		PollInterval: *pollInterval,
+		KeepGoing:    *pipelineFlags.keepGoing,
+	}, client)
+}
+
+// runJobsCommand adds a scrape job to the queue ("jobs enqueue"), lists the jobs ("jobs list") or prints one ("jobs show --id")
+func runJobsCommand(args []string, client *mongo.Client) error {
+	if len(args) == 0 {
+		return fmt.Errorf("jobs: expected enqueue, list or show")
+	}
+	switch args[0] {
+	case "enqueue":
+		flags := flag.NewFlagSet("jobs enqueue", flag.ExitOnError)
+		CIK := flags.String("cik", "", "10 digit CIK of the company")
+		ticker := flags.String("ticker", "", "ticker of the company, the CIK is looked up")
+		var stageNames stringListFlag
+		flags.Var(&stageNames, "stages", "comma separated stages to run, eg) fetch,categorize, defaults to all")
+		attempts := flags.Int("attempts", jobqueue.DefaultMaxAttempts, "times the job is run before it is marked failed")
+		requestedBy := flags.String("by", os.Getenv("USER"), "who asked for the job")
+		flags.Parse(args[1:])
+
+		job, created, err := jobqueue.Enqueue(*CIK, strings.ToUpper(*ticker), stageNames.values(), *attempts, *requestedBy, client)
+		if err != nil {
+			return err
+		}
+		if !created {
+			fmt.Printf("%s %s already has job %s, %s\n", job.CIK, job.Ticker, job.ID.Hex(), job.Status)
+			return nil
+		}
+		fmt.Printf("Queued job %s for %s %s\n", job.ID.Hex(), job.CIK, job.Ticker)
+		return nil
+	case "list":
+		flags := flag.NewFlagSet("jobs list", flag.ExitOnError)
+		CIK := flags.String("cik", "", "only the jobs of this CIK")
+		status := flags.String("status", "", "queued, running, succeeded or failed, empty for all")
+		limit := flags.Int64("limit", 20, "number of jobs to list, newest first, 0 for all")
+		flags.Parse(args[1:])
+
+		jobs, err := jobqueue.ListJobs(*CIK, *status, *limit, client)
+		if err != nil {
+			return err
+		}
+		for _, job := range jobs {
+			fmt.Printf("%s %s %s %s %-9s attempt %d/%d, %d/%d stages %s\n", job.ID.Hex(), job.CreatedAt.Format("2006-01-02 15:04"),
+				valueOrNone(job.CIK), valueOrNone(job.Ticker), job.Status, job.Attempts, job.MaxAttempts,
+				job.Progress.CompletedStages, job.Progress.TotalStages, job.Progress.Message)
+		}
+		fmt.Printf("Jobs: %d\n", len(jobs))
+		return nil
+	case "show":
+		flags := flag.NewFlagSet("jobs show", flag.ExitOnError)
+		id := flags.String("id", "", "id of the job, see jobs list")
+		flags.Parse(args[1:])
+		if *id == "" {
+			return fmt.Errorf("jobs show: --id is required")
+		}
+
+		job, err := jobqueue.GetJob(*id, client)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s: %s, attempt %d of %d, requested by %s\n", valueOrNone(job.CIK), valueOrNone(job.Ticker), job.Status,
+			job.Attempts, job.MaxAttempts, valueOrNone(job.RequestedBy))
+		fmt.Printf("progress: %s %d/%d %s\n", valueOrNone(job.Progress.Stage), job.Progress.CompletedStages, job.Progress.TotalStages, job.Progress.Message)
+		if job.LeaseOwner != "" {
+			fmt.Printf("claimed by %s until %s, last heartbeat %s\n", job.LeaseOwner, job.LeaseExpiresAt.Format(time.RFC3339), job.HeartbeatAt.Format(time.RFC3339))
+		}
+		for _, result := range job.StageResults {
+			fmt.Printf("  %-10s %-7s %6dms %s\n", result.Stage, result.Status, result.DurationMs, result.Error)
+		}
+		if job.Error != "" {
+			fmt.Printf("error: %s\n", job.Error)
+		}
+		return nil
+	default:
+		return fmt.Errorf("jobs: unknown subcommand %q, expected enqueue, list or show", args[0])
+	}
+}
+
+// runPipelineCommand shows where the filings of a CIK are in the pipeline ("pipeline status")
+// or sends them back to run a stage again ("pipeline reset --stage parsed")
+func runPipelineCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("pipeline: expected status or reset")
+	}
+	switch args[0] {
+	case "status":
+		flags := flag.NewFlagSet("pipeline status", flag.ExitOnError)
+		company := addCompanyFlags(flags)
+		flags.Parse(args[1:])
+		CIK, err := company.resolve("pipeline status")
+		if err != nil {
+			return err
+		}
+
+		states, err := geteverythinggivencik.GetFilingPipelineStatesGivenCIK(CIK)
+		if err != nil {
+			return err
+		}
+		filingsAtStage := make(map[string]int)
+		skipped := 0
+		var failedStates []geteverythinggivencik.FilingPipelineState
+		for _, state := range states {
+			filingsAtStage[state.Stage]++
+			if state.Skipped != "" {
+				skipped++
+			}
+			if state.FailedStage != "" {
+				failedStates = append(failedStates, state)
+			}
+		}
+		for _, stage := range geteverythinggivencik.FilingStages {
+			fmt.Printf("  %-20s %d\n", stage.Name, filingsAtStage[stage.Name])
+		}
+		fmt.Printf("Filings: %d, skipped: %d, failed: %d\n", len(states), skipped, len(failedStates))
+		for _, state := range failedStates {
+			fmt.Printf("%s failed %s %d times: %s\n", state.AccessionNumber, state.FailedStage, state.Attempts, state.Error)
+		}
+		CIKState, err := geteverythinggivencik.GetCIKPipelineStateGivenCIK(CIK)
+		if err != nil {
+			return err
+		}
+		if CIKState != nil {
+			fmt.Printf("%s failed %s %d times: %s\n", CIK, CIKState.FailedStage, CIKState.Attempts, CIKState.Error)
+		}
+		return nil
+	case "reset":
+		flags := flag.NewFlagSet("pipeline reset", flag.ExitOnError)
+		company := addCompanyFlags(flags)
+		accessionNumber := flags.String("accession", "", "only reset this filing")
+		stage := flags.String("stage", "", "stage to run again, eg) parsed, the filings that got past it go back to the stage before it")
+		flags.Parse(args[1:])
+		CIK, err := company.resolve("pipeline reset")
+		if err != nil {
+			return err
+		}
+		if *stage == "" {
+			return fmt.Errorf("pipeline reset: --stage is required")
+		}
+
+		count, err := geteverythinggivencik.ResetFilingPipelineStates(CIK, *accessionNumber, *stage)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Reset %d filings, run all --cik %s to run %s again\n", count, CIK, *stage)
+		return nil
+	default:
+		return fmt.Errorf("pipeline: unknown subcommand %q, expected status or reset", args[0])
+	}
+}
+
+// runReclassifyCommand re-runs classification over the cached FilingSummary files of a CIK and prints what changed
+func runReclassifyCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("reclassify", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	apply := flags.Bool("apply", false, "save the new classification to Mongo")
+	flags.Parse(args)
+	CIK, err := company.resolve("reclassify")
+	if err != nil {
+		return err
+	}
+
+	changes, err := categorizefinancialstatements.ReclassifyCachedFilingSummariesGivenCIK(CIK, *apply, client)
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		fmt.Printf("%s %s: %s (%s) -> %s (%s)\n",
+			change.AccessionNumber, change.FinancialStatementType,
+			valueOrNone(change.OldFileName), change.OldLongName,
+			valueOrNone(change.NewFileName), change.NewLongName)
+	}
+	fmt.Printf("Total changes: %d\n", len(changes))
+	if len(changes) > 0 && !*apply {
+		fmt.Println("Run again with --apply to save the new classification")
+	}
+	return nil
+}
+
+// runDetailsCommand downloads and parses the detail R files (segments, debt maturities, leases...) matching the given patterns
+func runDetailsCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("details", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	var patterns stringListFlag
+	flags.Var(&patterns, "pattern", "report name regular expression or XBRL role URI, can be repeated")
+	flags.Parse(args)
+	CIK, err := company.resolve("details")
+	if err != nil {
+		return err
+	}
+
+	return parserfiles.DownloadAndParseDetailRfilesGivenCIK(CIK, patterns, client)
+}
+
+// runSegmentsCommand captures the dimensional facts of every filing and saves the segment time series of the CIK as a CSV
+func runSegmentsCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("segments", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	concept := flags.String("concept", "", "only export this concept, eg) us-gaap:RevenueFromContractWithCustomerExcludingAssessedTax")
+	skipCapture := flags.Bool("skip-capture", false, "only rebuild the CSV from the facts already in Mongo")
+	flags.Parse(args)
+	CIK, err := company.resolve("segments")
+	if err != nil {
+		return err
+	}
+
+	if !*skipCapture {
+		if err := segmentdata.CaptureDimensionalFactsGivenCIK(CIK, client); err != nil {
+			return err
+		}
+	}
+	_, err = segmentdata.GenerateSegmentTimeSeriesAndSaveAsCsvFileGivenCIK(CIK, *concept, client)
+	return err
+}
+
+// runCombineCommand merges the parsed R files of every filing of the CIK into Level 1 combined statements
+func runCombineCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("combine", flag.ExitOnError)
+	stageFlags := addStageFlags(flags)
+	var statements stringListFlag
+	flags.Var(&statements, "statement", "BS, IS, CIS or CF, can be repeated, defaults to all")
+	flags.Parse(args)
+	CIK, err := stageFlags.apply("combine")
+	if err != nil {
+		return err
+	}
+	if len(statements) == 0 {
+		statements = stringListFlag{"BS", "IS", "CIS", "CF"}
+	}
+	for _, statement := range statements {
+		switch strings.ToUpper(statement) {
+		case "BS", "IS", "CIS", "CF":
+		default:
+			return fmt.Errorf("combine: unknown statement %q", statement)
+		}
+	}
+
+	stage := geteverythinggivencik.Stage{
+		Name:        "combine",
+		Description: "combine the CSVs of every filing into Level 1 " + strings.ToUpper(strings.Join(statements, ", ")) + " and publish them for the Backend",
+		Run: func(ctx context.Context, CIK string, client *mongo.Client) error {
+			if err := geteverythinggivencik.CombineStatements(CIK, statements, client); err != nil {
+				return err
+			}
+			return combinecsvfiles.PublishCombinedStatementsGivenCIK(CIK, client)
+		},
+	}
+	return runStages(CIK, []geteverythinggivencik.Stage{stage}, stageFlags, client)
+}
+
+// runPublishCommand saves the combined statements of the CIK to the combinedFinancialStatements collection the Backend reads,
+// combine does it too, this is for CSVs that were changed or generated by hand
+func runPublishCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("publish", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	flags.Parse(args)
+	CIK, err := company.resolve("publish")
+	if err != nil {
+		return err
+	}
+
+	return combinecsvfiles.PublishCombinedStatementsGivenCIK(CIK, client)
+}
+
+// runPostgresCommand applies the migrations of the Postgres database in POSTGRES_URL (migrate)
+// or loads the filings and the published combined statements of a CIK into it (load)
+func runPostgresCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("postgres: expected migrate or load")
+	}
+	ctx := context.Background()
+	switch args[0] {
+	case "migrate":
+		pool, err := postgresdatabase.Open(ctx, postgresdatabase.URLFromEnv())
+		if err != nil {
+			return err
+		}
+		pool.Close()
+		fmt.Println("Postgres schema is up to date")
+		return nil
+	case "load":
+		flags := flag.NewFlagSet("postgres load", flag.ExitOnError)
+		company := addCompanyFlags(flags)
+		flags.Parse(args[1:])
+		CIK, err := company.resolve("postgres load")
+		if err != nil {
+			return err
+		}
+
+		pool, err := postgresdatabase.Open(ctx, postgresdatabase.URLFromEnv())
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		return postgresdatabase.LoadCIK(ctx, pool, CIK)
+	default:
+		return fmt.Errorf("postgres: unknown subcommand %q, expected migrate or load", args[0])
+	}
+}
+
+// runTrailingTwelveMonthsCommand builds the TTM income statement and cash flow statement from the Level 1 combined CSVs
+func runTrailingTwelveMonthsCommand(args []string) error {
+	flags := flag.NewFlagSet("ttm", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	flags.Parse(args)
+	CIK, err := company.resolve("ttm")
+	if err != nil {
+		return err
+	}
+
+	return combinecsvfiles.GenerateTrailingTwelveMonthsAndSaveAsCsvFileGivenCIK(CIK)
+}
+
+// runStandardizeCommand maps the combined statements of the CIK to the standard template (Level 3) so companies can be compared
+func runStandardizeCommand(args []string) error {
+	flags := flag.NewFlagSet("standardize", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	flags.Parse(args)
+	CIK, err := company.resolve("standardize")
+	if err != nil {
+		return err
+	}
+
+	return combinecsvfiles.GenerateLevel3StandardizedStatementsAndSaveAsCsvFilesGivenCIK(CIK)
+}
+
+// runValidateCommand checks that the balance sheet of every filing adds up and saves the status on each filing doc
+func runValidateCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	flags.Parse(args)
+	CIK, err := company.resolve("validate")
+	if err != nil {
+		return err
+	}
+
+	results, err := combinecsvfiles.ValidateBalanceSheetsGivenCIK(CIK, client)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		fmt.Printf("%s: %s %s\n", result.AccessionNumber, result.Status, result.Error)
+		for _, discrepancy := range result.Discrepancies {
+			fmt.Printf("  %s %s: reported %.2f, sum %.2f, off by %.2f\n", discrepancy.ReportPeriod, discrepancy.Check,
+				discrepancy.Expected, discrepancy.Actual, discrepancy.Difference)
+		}
+		if result.Status != "passed" {
+			failed++
+		}
+	}
+	fmt.Printf("Balance sheets validated: %d, not passed: %d\n", len(results), failed)
+	return nil
+}
+
+// runReconcileCommand ties net income and cash across the statements of every filing and prints the filings that don't tie
+func runReconcileCommand(args []string, client *mongo.Client) error {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	company := addCompanyFlags(flags)
+	flags.Parse(args)
+	CIK, err := company.resolve("reconcile")
+	if err != nil {
+		return err
+	}
+
+	reports, err := combinecsvfiles.ReconcileFinancialStatementsGivenCIK(CIK, client)
+	if err != nil {
+		return err
+	}
+	failedFilings := 0
+	for _, report := range reports {
+		if report.Failures == 0 {
+			continue
+		}
+		failedFilings++
+		fmt.Printf("%s %s %s: %d failed checks\n", report.AccessionNumber, report.Form, report.ReportDate, report.Failures)
+		for _, check := range report.Checks {
+			if check.Status == "failed" {
+				fmt.Printf("  %s %sM %s: %s (%s) vs %s (%s)\n", check.ReportPeriod, check.DurationInMonths, check.Check,
+					check.LeftValue, check.LeftLineItem, check.RightValue, check.RightLineItem)
+			}
+		}
+	}
+	fmt.Printf("Filings reconciled: %d, with failures: %d\n", len(reports), failedFilings)
+	return nil
+}
+
+// runPromptsCommand lists the prompts logged by the LLM classifiers ("prompts list") or prints one of them in full ("prompts show --id")
+func runPromptsCommand(args []string, client *mongo.Client) error {
+	if len(args) == 0 {
+		return fmt.Errorf("prompts: expected list or show")
+	}
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("prompts list", flag.ExitOnError)
+		accessionNumber := flags.String("accession", "", "only the prompts about this accession number")
+		purpose := flags.String("purpose", "", "only the prompts with this purpose, eg) balanceSheetClassification")
+		limit := flags.Int64("limit", 20, "number of prompts to list, newest first, 0 for all")
+		flags.Parse(args[1:])
+
+		entries, err := combinecsvfiles.ListPromptLogEntries(*accessionNumber, *purpose, *limit, client)
+		if err != nil {
+			return err
+		}
+		totalTokens, cacheHits := 0, 0
+		for _, entry := range entries {
+			status := "ok"
+			if entry.Error != "" {
+				status = "error"
+			}
+			fmt.Printf("%s %s %s %s %s: %s, %dms, %d tokens, reused %d times\n", entry.ID.Hex(), entry.CreatedAt.Format("2006-01-02 15:04"),
+				entry.Model, valueOrNone(entry.Purpose), valueOrNone(entry.AccessionNumber), status, entry.LatencyMs, entry.TotalTokens, entry.CacheHits)
+			totalTokens += entry.TotalTokens
+			cacheHits += entry.CacheHits
+		}
+		fmt.Printf("Prompts: %d, tokens: %d, answered from the log: %d\n", len(entries), totalTokens, cacheHits)
+		return nil
+	case "show":
+		flags := flag.NewFlagSet("prompts show", flag.ExitOnError)
+		id := flags.String("id", "", "id of the prompt, see prompts list")
+		flags.Parse(args[1:])
+		if *id == "" {
+			return fmt.Errorf("prompts show: --id is required")
+		}
+
+		entry, err := combinecsvfiles.GetPromptLogEntry(*id, client)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("model: %s\npurpose: %s\naccession number: %s\nstatement hash: %s\ncreated: %s, last used: %s, reused %d times\n",
+			entry.Model, valueOrNone(entry.Purpose), valueOrNone(entry.AccessionNumber), valueOrNone(entry.StatementHash),
+			entry.CreatedAt.Format("2006-01-02 15:04:05"), entry.LastUsedAt.Format("2006-01-02 15:04:05"), entry.CacheHits)
+		fmt.Printf("latency: %dms, tokens: %d prompt + %d completion = %d\n", entry.LatencyMs, entry.PromptTokens, entry.CompletionTokens, entry.TotalTokens)
+		fmt.Printf("\n--- system ---\n%s\n\n--- prompt ---\n%s\n\n--- response ---\n%s\n", entry.SystemMessage, entry.Prompt, entry.Response)
+		if entry.Error != "" {
+			fmt.Printf("\n--- error ---\n%s\n", entry.Error)
+		}
+		return nil
+	default:
+		return fmt.Errorf("prompts: unknown subcommand %q, expected list or show", args[0])
+	}
+}
+
+// runReviewCommand works through the balance sheets the combiner couldn't classify:
+// "review list" shows the queue, "review show" the rows of one filing with their row indices,
+// "review submit" saves the section boundaries the combiner uses on its next run
+func runReviewCommand(args []string, client *mongo.Client) error {
+	if len(args) == 0 {
+		return fmt.Errorf("review: expected list, show or submit")
+	}
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("review list", flag.ExitOnError)
+		CIK := flags.String("cik", "", "only the reviews of this CIK")
+		status := flags.String("status", "pending", "pending, resolved, classified, or empty for all")
+		flags.Parse(args[1:])
+
+		reviews, err := combinecsvfiles.ListBalanceSheetReviews(*CIK, *status, client)
+		if err != nil {
+			return err
+		}
+		for _, review := range reviews {
+			fmt.Printf("%s %s %s (%s): %s\n", review.CIK, review.AccessionNumber, review.Status, review.UpdatedAt.Format("2006-01-02"), review.Reason)
+		}
+		fmt.Printf("Reviews: %d\n", len(reviews))
+		return nil
+	case "show":
+		flags := flag.NewFlagSet("review show", flag.ExitOnError)
+		company := addCompanyFlags(flags)
+		accessionNumber := flags.String("accession", "", "accession number of the filing")
+		flags.Parse(args[1:])
+		CIK, err := company.resolve("review show")
+		if err != nil {
+			return err
+		}
+		if *accessionNumber == "" {
+			return fmt.Errorf("review show: --accession is required")
+		}
+
+		review, err := combinecsvfiles.GetBalanceSheetReview(CIK, *accessionNumber, client)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s: %s\n%s\n\n", review.CIK, review.AccessionNumber, review.Status, review.Reason)
+		for _, lineItem := range review.LineItems {
+			fmt.Printf("%4d  %-70s %s\n", lineItem.RowIndex, lineItem.LineItem, lineItem.Value)
+		}
+		if review.Indices != nil {
+			fmt.Printf("\nsubmitted by %s: %+v\n", valueOrNone(review.ResolvedBy), *review.Indices)
+		}
+		return nil
+	case "submit":
+		flags := flag.NewFlagSet("review submit", flag.ExitOnError)
+		company := addCompanyFlags(flags)
+		accessionNumber := flags.String("accession", "", "accession number of the filing")
+		var currentAssets, assets, currentLiabilities, liabilities, equity, otherEquity rowRangeFlag
+		flags.Var(&currentAssets, "current-assets", "first row-total current assets row, eg) 9-15")
+		flags.Var(&assets, "assets", "first row-total assets row")
+		flags.Var(&currentLiabilities, "current-liabilities", "first row-total current liabilities row")
+		flags.Var(&liabilities, "liabilities", "first row-total liabilities row")
+		flags.Var(&equity, "equity", "first row-total stockholders' equity row")
+		flags.Var(&otherEquity, "other-equity", "rows of the equity outside stockholders' equity, eg) redeemable noncontrolling interest")
+		resolvedBy := flags.String("by", os.Getenv("USER"), "who reviewed the balance sheet")
+		flags.Parse(args[1:])
+		CIK, err := company.resolve("review submit")
+		if err != nil {
+			return err
+		}
+		if *accessionNumber == "" {
+			return fmt.Errorf("review submit: --accession is required")
+		}
+
+		indices := combinecsvfiles.BalanceSheetIndices{
+			AssetsStart: assets.start, AssetsEnd: assets.end,
+			CurrentAssetsStart: currentAssets.start, CurrentAssetsEnd: currentAssets.end,
+			LiabilitiesStart: liabilities.start, LiabilitiesEnd: liabilities.end,
+			CurrentLiabilitiesStart: currentLiabilities.start, CurrentLiabilitiesEnd: currentLiabilities.end,
+			EquityStart: equity.start, EquityEnd: equity.end,
+			OtherEquityStart: otherEquity.start, OtherEquityEnd: otherEquity.end,
+		}
+		if err := combinecsvfiles.SubmitBalanceSheetReviewIndices(CIK, *accessionNumber, indices, *resolvedBy, client); err != nil {
+			return err
+		}
+		fmt.Printf("Saved the section boundaries of %s, run combine --cik %s --statement BS to use them\n", *accessionNumber, CIK)
+		return nil
+	default:
+		return fmt.Errorf("review: unknown subcommand %q, expected list, show or submit", args[0])
+	}
+}
+
+// rowRangeFlag is a first-last pair of row indices of an R file
+type rowRangeFlag struct {
+	start, end int
+}
+
+func (f *rowRangeFlag) String() string {
+	return fmt.Sprintf("%d-%d", f.start, f.end)
+}
+
+func (f *rowRangeFlag) Set(value string) error {
+	if _, err := fmt.Sscanf(value, "%d-%d", &f.start, &f.end); err != nil {
+		return fmt.Errorf("expected first-last row, eg) 9-15: %w", err)
+	}
+	if f.start > f.end {
+		return fmt.Errorf("first row %d is after last row %d", f.start, f.end)
+	}
+	return nil
+}
+
+// stringListFlag collects every value of a flag that is given more than once
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// values splits the values that were given comma separated, eg) --stages fetch,categorize
+func (f stringListFlag) values() []string {
+	var values []string
+	for _, value := range f {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+func valueOrNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
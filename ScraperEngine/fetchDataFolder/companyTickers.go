@@ -0,0 +1,45 @@
+package fetchdata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	"github.com/tidwall/gjson"
+)
+
+// company_tickers.json maps every ticker SEC knows to its CIK:
+// {"0":{"cik_str":320193,"ticker":"AAPL","title":"Apple Inc."},"1":{...}}
+const companyTickersUrl = "https://www.sec.gov/files/company_tickers.json"
+
+// FindCIKGivenTicker returns the 10 digit CIK of the ticker from SEC-files/company_tickers.json,
+// the file is downloaded from SEC the first time. SEC writes share classes with a dash, BRK.B is found as BRK-B
+func FindCIKGivenTicker(ticker string) (string, error) {
+	ticker = strings.ReplaceAll(strings.TrimSpace(ticker), ".", "-")
+	key := "company_tickers.json"
+	if exists, err := storage.SECFiles.Exists(key); err != nil {
+		return "", err
+	} else if !exists {
+		if err := DownloadOneSECFile(companyTickersUrl, key); err != nil {
+			return "", fmt.Errorf("error downloading company_tickers.json: %v", err)
+		}
+	}
+
+	jsonString, err := ReadJsonFile(key)
+	if err != nil {
+		return "", err
+	}
+
+	CIK := ""
+	gjson.Parse(jsonString).ForEach(func(key, value gjson.Result) bool {
+		if strings.EqualFold(value.Get("ticker").String(), ticker) {
+			CIK = fmt.Sprintf("%010d", value.Get("cik_str").Int())
+			return false
+		}
+		return true
+	})
+	if CIK == "" {
+		return "", fmt.Errorf("ticker %s is not in %s", ticker, key)
+	}
+	return CIK, nil
+}
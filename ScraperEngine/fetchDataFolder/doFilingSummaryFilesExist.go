@@ -1,47 +1,46 @@
 package fetchdata
 
 import (
-	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strings"
 	"sync"
-	"time"
 
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
 	"github.com/tidwall/gjson"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func CheckAllFilingIndexJsonForExistenceOfFilingSummary(CIK string, client *mongo.Client) {
-	accessionNumber_slice, _ := GetListOfFilingsThatHaveNotCheckedExistenceOfFilingSummary(CIK, client)
-
-	var wg sync.WaitGroup
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
+// CheckAllFilingIndexJsonForExistenceOfFilingSummary checks Concurrency filings at a time,
+// the filings that couldn't be checked are left unchecked for the next run and returned in one error
+func CheckAllFilingIndexJsonForExistenceOfFilingSummary(CIK string, client *mongo.Client) error {
+	accessionNumber_slice, err := GetListOfFilingsThatHaveNotCheckedExistenceOfFilingSummary(CIK, client)
+	if err != nil {
+		fmt.Println("Error GetListOfFilingsThatHaveNotCheckedExistenceOfFilingSummary function:", err)
+		return err
+	}
 
-	batchSize := 10
-	for i := 0; i < len(accessionNumber_slice); i += batchSize {
-		<-ticker.C // wait for the next tick
-		batchEndIndex := i + batchSize
-		if batchEndIndex > len(accessionNumber_slice) {
-			batchEndIndex = len(accessionNumber_slice)
-		}
-		for j := i; j < batchEndIndex; j++ {
-			wg.Add(1)
-			go func(j int) {
-				defer wg.Done()
-				CheckOneFilingIndexJsonForExistenceOfFilingSummary(CIK, accessionNumber_slice[j], client)
-			}(j)
+	var mutex sync.Mutex
+	var failedAccessionNumbers []string
+	RunConcurrently(len(accessionNumber_slice), func(i int) {
+		if _, err := CheckOneFilingIndexJsonForExistenceOfFilingSummary(CIK, accessionNumber_slice[i], client); err != nil {
+			fmt.Println(err)
+			mutex.Lock()
+			failedAccessionNumbers = append(failedAccessionNumbers, accessionNumber_slice[i])
+			mutex.Unlock()
 		}
-		wg.Wait() // wait for the current batch to finish before proceeding to the next batch
+	})
+
+	if len(failedAccessionNumbers) > 0 {
+		return fmt.Errorf("failed to check index.json of %d of %d filings: %v", len(failedAccessionNumbers), len(accessionNumber_slice), failedAccessionNumbers)
 	}
+	return nil
 }
 
-func CheckOneFilingIndexJsonForExistenceOfFilingSummary(CIK string, accessionNumber string, client *mongo.Client) {
+// CheckOneFilingIndexJsonForExistenceOfFilingSummary saves whether the filing has a FilingSummary.xml to Mongo and returns it
+func CheckOneFilingIndexJsonForExistenceOfFilingSummary(CIK string, accessionNumber string, client *mongo.Client) (bool, error) {
 	userAgent := os.Getenv("USER_AGENT")
 	companyName := os.Getenv("COMPANY_NAME")
 	email := os.Getenv("EMAIL")
@@ -51,26 +50,27 @@ func CheckOneFilingIndexJsonForExistenceOfFilingSummary(CIK string, accessionNum
 	// Create a new request
 	req, err := http.NewRequest("GET", SEC_indexJson_url, nil)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return false, fmt.Errorf("accession number %s: %v", accessionNumber, err)
 	}
 
 	// Set the User-Agent header
 	req.Header.Set("User-Agent", fmt.Sprintf("%s - %s (mailto:%s)", userAgent, companyName, email))
 
-	// Create a new HTTP client and send the request
+	// Create a new HTTP client and send the request once it's our turn
 	HTTPclient := &http.Client{}
+	WaitForSECRequest()
 	resp, err := HTTPclient.Do(req)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return false, fmt.Errorf("accession number %s: %v", accessionNumber, err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("accession number %s: index.json returned status code %d", accessionNumber, resp.StatusCode)
+	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return false, fmt.Errorf("accession number %s: %v", accessionNumber, err)
 	}
 
 	jsonString := string(body)
@@ -86,66 +86,25 @@ func CheckOneFilingIndexJsonForExistenceOfFilingSummary(CIK string, accessionNum
 		return true // Continue iterating
 	})
 
-	databaseName := os.Getenv("DATABASE_NAME")
-	collectionName := os.Getenv("10K10QMetaDataCollection")
-	collection := client.Database(databaseName).Collection(collectionName)
-	ctx := context.Background()
-	filter := bson.M{"accessionnumber": accessionNumber, "cik": CIK}
-
-	// Output the result and update the 'hasFilingSummary' field to Mongo
-	if hasFilingSummary {
-		update := bson.M{"$set": bson.M{"hasFilingSummary": true}}
-		_, err := collection.UpdateOne(ctx, filter, update)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-	} else {
-		update := bson.M{"$set": bson.M{"hasFilingSummary": false}}
-		_, err := collection.UpdateOne(ctx, filter, update)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	// save the result so the filing isn't checked again
+	if err := filingrepository.Filings.SetHasFilingSummary(CIK, accessionNumber, hasFilingSummary); err != nil {
+		return false, fmt.Errorf("accession number %s: %v", accessionNumber, err)
 	}
+	return hasFilingSummary, nil
 }
 
 func GetListOfFilingsThatHaveNotCheckedExistenceOfFilingSummary(CIK string, client *mongo.Client) ([]string, error) {
-	databaseName := os.Getenv("DATABASE_NAME")
-	collectionName := os.Getenv("10K10QMetaDataCollection")
-	collection := client.Database(databaseName).Collection(collectionName)
-
-	// Create a filter to find documents where 'hasFilingSummary' does not exist
-	filter := bson.M{"hasFilingSummary": bson.M{"$exists": false}}
-	projection := bson.M{"accessionnumber": 1, "cik": 1, "_id": 0} // Project only the accessionNumber and cik fields
-
-	// Use a context with timeout or a background context as needed
-	ctx := context.Background()
-
-	// Perform the query to find all matching documents
-	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(projection))
+	filings, err := filingrepository.Filings.ListFilingsByCIK(CIK)
 	if err != nil {
 		return nil, err
 	}
-	defer cursor.Close(ctx)
-
-	var accessionNumbers []string // Slice to hold the accession numbers
 
-	// Iterate through the cursor and collect accession numbers and cik values
-	for cursor.Next(ctx) {
-		var result struct {
-			AccessionNumber string `bson:"accessionnumber"`
+	// filings of the CIK where hasFilingSummary isn't set yet
+	var accessionNumbers []string
+	for _, filing := range filings {
+		if filing.HasFilingSummary == nil {
+			accessionNumbers = append(accessionNumbers, filing.AccessionNumber)
 		}
-		if err := cursor.Decode(&result); err != nil {
-			return nil, err
-		}
-		accessionNumbers = append(accessionNumbers, result.AccessionNumber)
 	}
-
-	// Check if the cursor encountered any errors during iteration
-	if err := cursor.Err(); err != nil {
-		return nil, err
-	}
-
 	return accessionNumbers, nil
 }
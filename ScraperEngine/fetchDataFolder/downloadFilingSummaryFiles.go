@@ -1,14 +1,11 @@
 package fetchdata
 
 import (
-	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
-	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
-	"go.mongodb.org/mongo-driver/bson"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -20,25 +17,27 @@ func DownloadFilingSummaryFiles(CIK string, client *mongo.Client) error {
 	}
 
 	var accessionNumbersToDownloadFilingSummary []string
-	var filePathsOfFilingSummaryFilesToDownload []string
+	var keysOfFilingSummaryFilesToDownload []string
 	for _, accessionNumber := range accessionNumber_slice {
-		filePath := filepath.Join("SEC-files", "filingSummaryAndRfiles", CIK, accessionNumber, "FilingSummary.xml")
-		//check if the file exists locally
-		if _, err := os.Stat(filePath); err == nil {
-			// File exists
-			fmt.Println("File exists:", filePath)
-		} else if os.IsNotExist(err) {
-			// File does not exist, add it to the list of files to download
-			accessionNumbersToDownloadFilingSummary = append(accessionNumbersToDownloadFilingSummary, accessionNumber)
-			filePathsOfFilingSummaryFilesToDownload = append(filePathsOfFilingSummaryFilesToDownload, filePath)
-		} else {
+		key := storage.FilingKey(CIK, accessionNumber, "FilingSummary.xml")
+		//check if the file is already in the store
+		if exists, err := storage.SECFiles.Exists(key); err != nil {
 			// Error occurred while checking file existence
 			fmt.Println("Error occurred while checking file existence:", err)
+		} else if exists {
+			fmt.Println("File exists:", key)
+		} else {
+			// File does not exist, add it to the list of files to download
+			accessionNumbersToDownloadFilingSummary = append(accessionNumbersToDownloadFilingSummary, accessionNumber)
+			keysOfFilingSummaryFilesToDownload = append(keysOfFilingSummaryFilesToDownload, key)
 		}
 	}
 
 	downloadUrlsOfFilingSummaryFiles := GenerateLinksToDownloadFilingSummaryFiles(CIK, accessionNumbersToDownloadFilingSummary)
-	DownloadManySECFiles(downloadUrlsOfFilingSummaryFiles, filePathsOfFilingSummaryFilesToDownload)
+	if err := DownloadManySECFiles(downloadUrlsOfFilingSummaryFiles, keysOfFilingSummaryFilesToDownload); err != nil {
+		fmt.Println("Error DownloadManySECFiles function:", err)
+		return err
+	}
 	return nil
 }
 
@@ -54,32 +53,5 @@ func GenerateLinksToDownloadFilingSummaryFiles(CIK string, accessionNumber_slice
 }
 
 func RetrieveAccessionNumbersThatHaveFilingSummary(CIK string, client *mongo.Client) ([]string, error) {
-	// go to mongodb and get slice of accessionNumber from those docs that have hasFilingSummary = true
-	var accessionNumber_slice []string
-
-	collection := utilityfunctions.GetMongoDBCollection(client)
-	filter := bson.M{"hasFilingSummary": true, "cik": CIK}
-
-	ctx := context.TODO()
-	cursor, err := collection.Find(ctx, filter)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var result struct {
-			AccessionNumber string `bson:"accessionnumber"`
-		}
-		if err := cursor.Decode(&result); err != nil {
-			return nil, err
-		}
-		accessionNumber_slice = append(accessionNumber_slice, result.AccessionNumber)
-	}
-
-	if err := cursor.Err(); err != nil {
-		return nil, err
-	}
-
-	return accessionNumber_slice, nil
+	return filingrepository.AccessionNumbersThatHaveFilingSummary(filingrepository.Filings, CIK)
 }
@@ -0,0 +1,64 @@
+package fetchdata
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+)
+
+// SEC doesn't publish index constituents, so they come from a CSV with a Symbol column.
+// The URL of an index can be changed with <INDEX>_CONSTITUENTS_URL, eg) SP500_CONSTITUENTS_URL
+var indexConstituentsUrls = map[string]string{
+	"sp500": "https://raw.githubusercontent.com/datasets/s-and-p-500-companies/main/data/constituents.csv",
+}
+
+// GetIndexConstituentTickers returns the tickers of the index from SEC-files/indexConstituents/<index>.csv,
+// the file is downloaded the first time, delete it to get the current constituents
+func GetIndexConstituentTickers(index string) ([]string, error) {
+	index = strings.ToLower(index)
+	url := os.Getenv(strings.ToUpper(index) + "_CONSTITUENTS_URL")
+	if url == "" {
+		url = indexConstituentsUrls[index]
+	}
+	if url == "" {
+		return nil, fmt.Errorf("unknown index %q, set %s_CONSTITUENTS_URL to a CSV with a Symbol column", index, strings.ToUpper(index))
+	}
+
+	key := path.Join("indexConstituents", index+".csv")
+	if exists, err := storage.SECFiles.Exists(key); err != nil {
+		return nil, err
+	} else if !exists {
+		if err := DownloadOneSECFile(url, key); err != nil {
+			return nil, fmt.Errorf("error downloading the constituents of %s: %v", index, err)
+		}
+	}
+
+	rows, err := storage.GetCsv(storage.SECFiles, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s is empty", key)
+	}
+	symbolColumn := -1
+	for j, header := range rows[0] {
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(header, "\uFEFF"))) {
+		case "symbol", "ticker":
+			symbolColumn = j
+		}
+	}
+	if symbolColumn == -1 {
+		return nil, fmt.Errorf("%s has no Symbol column", key)
+	}
+
+	var tickers []string
+	for _, row := range rows[1:] {
+		if symbolColumn < len(row) && strings.TrimSpace(row[symbolColumn]) != "" {
+			tickers = append(tickers, strings.TrimSpace(row[symbolColumn]))
+		}
+	}
+	return tickers, nil
+}
@@ -6,49 +6,40 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
 	"sync"
-	"time"
-)
 
-func DownloadManySECFiles(downloadLinks []string, filePaths []string) error {
-	if len(downloadLinks) != len(filePaths) {
-		return errors.New("the length of downloadLinks and filePaths must match")
-	}
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+)
 
-	var wg sync.WaitGroup
-	ticker := time.NewTicker(1010 * time.Millisecond) // Ticker that fires every 1.010 second (if i do 1second it fks with SEC API limit)
-	defer ticker.Stop()                               // Stop the ticker to release associated resources
+// Concurrency is how many requests are sent to SEC per second, SEC allows at most 10
+var Concurrency = 10
 
-	batchSize := 10 // Number of files to download per second
-	for i := 0; i < len(downloadLinks); i += batchSize {
-		<-ticker.C // Wait for the ticker to fire
+// DownloadManySECFiles downloads the files Concurrency at a time to the keys of storage.SECFiles and keeps going when one fails,
+// the files that failed are returned in one error
+func DownloadManySECFiles(downloadLinks []string, keys []string) error {
+	if len(downloadLinks) != len(keys) {
+		return errors.New("the length of downloadLinks and keys must match")
+	}
 
-		// Calculate the number of goroutines to start for this batch
-		end := i + batchSize
-		if end > len(downloadLinks) {
-			end = len(downloadLinks)
+	var mutex sync.Mutex
+	var failedDownloads []string
+	RunConcurrently(len(downloadLinks), func(i int) {
+		if err := DownloadOneSECFile(downloadLinks[i], keys[i]); err != nil {
+			fmt.Println("Error downloading file:", err)
+			mutex.Lock()
+			failedDownloads = append(failedDownloads, downloadLinks[i])
+			mutex.Unlock()
 		}
+	})
 
-		// Start a batch of downloads
-		for j := i; j < end; j++ {
-			wg.Add(1)
-			go func(link, path string) {
-				defer wg.Done()
-				// Call the download function
-				if err := DownloadOneSECFile(link, path); err != nil {
-					fmt.Println("Error downloading file:", err)
-				}
-			}(downloadLinks[j], filePaths[j])
-		}
+	if len(failedDownloads) > 0 {
+		return fmt.Errorf("failed to download %d of %d files: %v", len(failedDownloads), len(downloadLinks), failedDownloads)
 	}
-
-	// Wait for all downloads to finish
-	wg.Wait()
 	return nil
 }
 
-func DownloadOneSECFile(downloadLink string, filePath string) error {
+// DownloadOneSECFile downloads the file and saves it to the key of storage.SECFiles
+func DownloadOneSECFile(downloadLink string, key string) error {
 	userAgent := os.Getenv("USER_AGENT")
 	companyName := os.Getenv("COMPANY_NAME")
 	email := os.Getenv("EMAIL")
@@ -62,8 +53,9 @@ func DownloadOneSECFile(downloadLink string, filePath string) error {
 	// Set the User-Agent header
 	req.Header.Set("User-Agent", fmt.Sprintf("%s - %s (mailto:%s)", userAgent, companyName, email))
 
-	// Create a new HTTP client and send the request
+	// Create a new HTTP client and send the request once it's our turn
 	client := &http.Client{}
+	WaitForSECRequest()
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending request: %v", err)
@@ -75,25 +67,15 @@ func DownloadOneSECFile(downloadLink string, filePath string) error {
 		return fmt.Errorf("server returned non-200 status code: %d", resp.StatusCode)
 	}
 
-	// Create the necessary parent directories for the file
-	dirPath := filepath.Dir(filePath)
-	if err := os.MkdirAll(dirPath, 0755); err != nil {
-		return fmt.Errorf("error creating directory: %v", err)
-	}
-
-	// Open the file to write the response body into
-	out, err := os.Create(filePath)
+	// Read the response body and save it to the store
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("error creating file: %v", err)
+		return fmt.Errorf("error reading response: %v", err)
 	}
-	defer out.Close()
-
-	// Copy the response body to the file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return fmt.Errorf("error writing to file: %v", err)
+	if err := storage.SECFiles.Put(key, body); err != nil {
+		return fmt.Errorf("error saving file: %v", err)
 	}
 
-	fmt.Printf("File successfully downloaded and saved to: %s\n", filePath)
+	fmt.Printf("File successfully downloaded and saved to: %s\n", key)
 	return nil
 }
@@ -0,0 +1,68 @@
+package fetchdata
+
+import (
+	"sync"
+	"time"
+)
+
+// every request to SEC goes through one limiter for the whole process, so companies processed at the same time
+// share the Concurrency requests per second instead of each sending that many
+var secRateLimiter = &rateLimiter{}
+
+type rateLimiter struct {
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// WaitForSECRequest blocks until the request can be sent without going over Concurrency requests per second
+func WaitForSECRequest() {
+	secRateLimiter.wait(Concurrency)
+}
+
+// wait hands out evenly spaced times to send at, 1.010 seconds per requestsPerSecond requests (1 second exactly fks with the SEC limit)
+func (limiter *rateLimiter) wait(requestsPerSecond int) {
+	if requestsPerSecond < 1 {
+		requestsPerSecond = 1
+	}
+	interval := 1010 * time.Millisecond / time.Duration(requestsPerSecond)
+
+	limiter.mutex.Lock()
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	sendAt := limiter.next
+	limiter.next = limiter.next.Add(interval)
+	limiter.mutex.Unlock()
+
+	time.Sleep(time.Until(sendAt))
+}
+
+// RunConcurrently calls fn for 0 to count-1 on Concurrency goroutines and waits for all of them,
+// the requests fn sends to SEC are spaced by WaitForSECRequest
+func RunConcurrently(count int, fn func(i int)) {
+	workers := Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > count {
+		workers = count
+	}
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+}
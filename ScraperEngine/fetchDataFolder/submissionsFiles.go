@@ -1,33 +1,19 @@
 package fetchdata
 
 import (
-	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"path"
 	"strings"
 	"sync"
 
-	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	"github.com/tidwall/gjson"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-type FilingMetaData struct {
-	CIK                string `json:"cik"`
-	AccessionNumber    string `json:"accessionnumber"`
-	FilingDate         string `json:"filingdate"`
-	ReportDate         string `json:"reportdate"`
-	AcceptanceDateTime string `json:"acceptancedatetime"`
-	Act                string `json:"act"`
-	Form               string `json:"form"`
-	FileNumber         string `json:"filenumber"`
-	FilmNumber         string `json:"filmnumber"`
-	Items              string `json:"items"`
-	Size               string `json:"size"`
-}
+// FilingMetaData is the filing metadata the repository stores
+type FilingMetaData = filingrepository.FilingMetadata
 
 func Store10K10QmetadataFromSubmissionFilesCIKtoMongoDB(CIK string, client *mongo.Client) error {
 	metadataSlice, err := Get10K10QMetadataFromSubmissionFilesGivenCIK(CIK)
@@ -36,26 +22,16 @@ func Store10K10QmetadataFromSubmissionFilesCIKtoMongoDB(CIK string, client *mong
 	}
 	// fmt.Println("metadataSlice:", metadataSlice)
 
-	collection := utilityfunctions.GetMongoDBCollection(client)
-
-	// Create a context with timeout or a background context as needed
-	ctx := context.Background()
-
 	var wg sync.WaitGroup
 	errorChannel := make(chan error, len(metadataSlice)) // Buffer error channel to the size of metadataSlice
 
-	// Insert or update each meta data record into MongoDB concurrently
+	// Insert or update each meta data record concurrently
 	for _, metaData := range metadataSlice {
 		wg.Add(1)                    // Increment the WaitGroup counter
 		go func(md FilingMetaData) { // Pass metaData as a local variable to the goroutine
 			defer wg.Done() // Decrement the counter when the goroutine completes
 
-			filter := bson.M{"accessionnumber": md.AccessionNumber}
-			update := bson.M{"$setOnInsert": md}
-			opts := options.Update().SetUpsert(true)
-
-			_, err := collection.UpdateOne(ctx, filter, update, opts)
-			if err != nil {
+			if err := filingrepository.Filings.UpsertFilingMetadata(md); err != nil {
 				errorChannel <- fmt.Errorf("failed to store metadata: %v", err)
 				return
 			}
@@ -103,7 +79,7 @@ func Get10K10QMetadataFromSubmissionFilesGivenCIK(CIK string) ([]FilingMetaData,
 // 2. Submissions JSON (uses no prefix)
 //
 // Parameters:
-//   - filePath: Path to the JSON file containing SEC filing metadata
+//   - filePath: Key of the JSON file containing SEC filing metadata in storage.SECFiles
 //   - CIK: Company Identifier Key for the company
 //
 // Returns:
@@ -128,7 +104,7 @@ func Extract10K10QmetadataFromSubmissionFile(filePath string, CIK string) ([]Fil
 	}
 
 	// Determine JSON structure type and set appropriate prefix
-	var fileName string = filepath.Base(filePath)
+	var fileName string = path.Base(filePath)
 	var doesFileNameIncludeSubmissions bool = strings.Contains(fileName, "submissions")
 	var prefix string = "filings.recent."
 	if doesFileNameIncludeSubmissions {
@@ -181,26 +157,23 @@ func Extract10K10QmetadataFromSubmissionFile(filePath string, CIK string) ([]Fil
 // This function generates a list of all the submission files for a given CIK
 func FindSubmissionFilesGivenCIK(CIK string) (submissionFilePaths []string, err error) {
 	var submissionFiles []string
-	// baseDirectory := "SEC-files/submissions"
-	baseDirectory := filepath.Join("SEC-files", "submissions")
-
-	files, err := os.ReadDir(baseDirectory)
+	keys, err := storage.SECFiles.List("submissions")
 	if err != nil {
 		return nil, err
 	}
 
-	for _, file := range files {
-		if !file.IsDir() && strings.Contains(file.Name(), CIK) {
-			fullPath := filepath.Join(baseDirectory, file.Name())
-			submissionFiles = append(submissionFiles, fullPath)
+	for _, key := range keys {
+		if strings.Contains(path.Base(key), CIK) {
+			submissionFiles = append(submissionFiles, key)
 		}
 	}
 
 	return submissionFiles, nil
 }
 
-func ReadJsonFile(filePath string) (string, error) {
-	jsonData, err := os.ReadFile(filePath)
+// ReadJsonFile reads a JSON file of storage.SECFiles
+func ReadJsonFile(key string) (string, error) {
+	jsonData, err := storage.SECFiles.Get(key)
 	if err != nil {
 		return "", fmt.Errorf("error reading JSON file: %v", err)
 	}
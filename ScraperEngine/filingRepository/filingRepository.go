@@ -0,0 +1,115 @@
+package filingrepository
+
+import (
+	"errors"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Every stage reads and writes the 10-K/10-Q metadata docs of a CIK through a FilingRepository,
+// the Mongo collection 10K10QMetaDataCollection, the SQLite database with DATABASE_BACKEND=sqlite, or the in-memory one in tests
+
+// FinancialStatementTypes are the statements a filing can have an R file for
+var FinancialStatementTypes = []string{"BS", "IS", "CIS", "CF"}
+
+// FilingMetadata is what the submissions file says about one 10-K or 10-Q
+type FilingMetadata struct {
+	CIK                string `json:"cik" bson:"cik"`
+	AccessionNumber    string `json:"accessionnumber" bson:"accessionnumber"`
+	FilingDate         string `json:"filingdate" bson:"filingdate"`
+	ReportDate         string `json:"reportdate" bson:"reportdate"`
+	AcceptanceDateTime string `json:"acceptancedatetime" bson:"acceptancedatetime"`
+	Act                string `json:"act" bson:"act"`
+	Form               string `json:"form" bson:"form"`
+	FileNumber         string `json:"filenumber" bson:"filenumber"`
+	FilmNumber         string `json:"filmnumber" bson:"filmnumber"`
+	Items              string `json:"items" bson:"items"`
+	Size               string `json:"size" bson:"size"`
+}
+
+// Rfile is the R file of one financial statement, as found in the FilingSummary.xml of the filing
+type Rfile struct {
+	FileName     string
+	LongName     string
+	ShortName    string
+	MenuCategory string
+}
+
+// Filing is the metadata of a filing plus what the stages found out about it
+type Filing struct {
+	FilingMetadata
+	HasFilingSummary           *bool            // nil until index.json of the filing was checked
+	Rfiles                     map[string]Rfile // financialStatementType -> R file, only the statements the filing has
+	ClassificationRulesVersion string           // version of the rules that picked Rfiles
+}
+
+// FilingRepository stores the filings of every CIK
+type FilingRepository interface {
+	// UpsertFilingMetadata adds the filing, a filing that is already there keeps what it has
+	UpsertFilingMetadata(metadata FilingMetadata) error
+	SetHasFilingSummary(CIK string, accessionNumber string, hasFilingSummary bool) error
+	// SetRfiles replaces the R files of the filing, statements missing from Rfiles are removed
+	SetRfiles(CIK string, accessionNumber string, Rfiles map[string]Rfile, classificationRulesVersion string) error
+	// GetFiling returns ErrFilingNotFound when there is no such filing
+	GetFiling(accessionNumber string) (Filing, error)
+	// ListFilingsByCIK returns the filings of the CIK oldest to newest report date
+	ListFilingsByCIK(CIK string) ([]Filing, error)
+	// SetFilingReport saves what a stage found out about the filing under name, eg) balanceSheetValidation, replacing the one before.
+	// The report is encoded with its bson tags whatever the repository
+	SetFilingReport(CIK string, accessionNumber string, name string, report any) error
+	// GetFilingReport decodes the report saved under name into report, false when there is none
+	GetFilingReport(accessionNumber string, name string, report any) (bool, error)
+}
+
+// ErrFilingNotFound is returned by GetFiling
+var ErrFilingNotFound = errors.New("filing not found")
+
+// Filings is the repository every stage uses, main sets it to the one DATABASE_BACKEND picks
+var Filings FilingRepository
+
+// AccessionNumbersThatHaveFilingSummary returns the filings of the CIK whose index.json lists a FilingSummary.xml
+func AccessionNumbersThatHaveFilingSummary(repository FilingRepository, CIK string) ([]string, error) {
+	filings, err := repository.ListFilingsByCIK(CIK)
+	if err != nil {
+		return nil, err
+	}
+	var accessionNumbers []string
+	for _, filing := range filings {
+		if filing.HasFilingSummary != nil && *filing.HasFilingSummary {
+			accessionNumbers = append(accessionNumbers, filing.AccessionNumber)
+		}
+	}
+	return accessionNumbers, nil
+}
+
+// filingReport wraps the report so slices can be encoded too, a bson document can't be an array
+type filingReport struct {
+	Report any `bson:"report"`
+}
+
+// encodeFilingReport is the report as extended JSON for the repositories that don't keep bson
+func encodeFilingReport(report any) (string, error) {
+	data, err := bson.MarshalExtJSON(filingReport{Report: report}, true, false)
+	return string(data), err
+}
+
+func decodeFilingReport(data string, report any) error {
+	var wrapper struct {
+		Report bson.RawValue `bson:"report"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(data), true, &wrapper); err != nil {
+		return err
+	}
+	return wrapper.Report.Unmarshal(report)
+}
+
+// sortByReportDate sorts oldest to newest report date, filings of the same date by accession number
+func sortByReportDate(filings []Filing) {
+	sort.SliceStable(filings, func(i, j int) bool {
+		if filings[i].ReportDate != filings[j].ReportDate {
+			return filings[i].ReportDate < filings[j].ReportDate
+		}
+		return filings[i].AccessionNumber < filings[j].AccessionNumber
+	})
+}
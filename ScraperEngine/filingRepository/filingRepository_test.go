@@ -0,0 +1,214 @@
+package filingrepository_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	sqlitedatabase "github.com/Programmerdin/FinancialDataSite_Go/sqliteDatabase"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestMemoryFilingRepository(t *testing.T) {
+	testFilingRepository(t, func(t *testing.T) filingrepository.FilingRepository {
+		return filingrepository.NewMemoryFilingRepository()
+	})
+}
+
+func TestSQLiteFilingRepository(t *testing.T) {
+	testFilingRepository(t, func(t *testing.T) filingrepository.FilingRepository {
+		db, err := sqlitedatabase.Open(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return filingrepository.NewSQLiteFilingRepository(db)
+	})
+}
+
+// TestMongoFilingRepository runs against the deployment of MONGODB_URI, every case gets a database of its own that is dropped after
+func TestMongoFilingRepository(t *testing.T) {
+	mongoURI := os.Getenv("MONGODB_URI")
+	if mongoURI == "" {
+		t.Skip("MONGODB_URI is not set")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	testFilingRepository(t, func(t *testing.T) filingrepository.FilingRepository {
+		databaseName := fmt.Sprintf("filingRepositoryTest_%d", time.Now().UnixNano())
+		t.Setenv("DATABASE_NAME", databaseName)
+		t.Setenv("10K10QMetaDataCollection", "10K10QMetaData")
+		t.Cleanup(func() { client.Database(databaseName).Drop(context.Background()) })
+		return filingrepository.NewMongoFilingRepository(client)
+	})
+}
+
+// testFilingRepository is what every FilingRepository has to do, newRepository returns an empty one
+func testFilingRepository(t *testing.T, newRepository func(t *testing.T) filingrepository.FilingRepository) {
+	const CIK = "0001837014"
+	filing := func(accessionNumber string, reportDate string) filingrepository.FilingMetadata {
+		return filingrepository.FilingMetadata{CIK: CIK, AccessionNumber: accessionNumber, ReportDate: reportDate, Form: "10-Q"}
+	}
+
+	t.Run("upsert keeps the filing that is already there", func(t *testing.T) {
+		repository := newRepository(t)
+		mustDo(t, repository.UpsertFilingMetadata(filing("0001837014-24-000010", "2024-03-31")))
+		mustDo(t, repository.SetHasFilingSummary(CIK, "0001837014-24-000010", true))
+		mustDo(t, repository.SetRfiles(CIK, "0001837014-24-000010", map[string]filingrepository.Rfile{"BS": {FileName: "R2.htm"}}, "v1"))
+
+		again := filing("0001837014-24-000010", "2024-03-31")
+		again.Form = "10-Q/A"
+		mustDo(t, repository.UpsertFilingMetadata(again))
+
+		got, err := repository.GetFiling("0001837014-24-000010")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Form != "10-Q" {
+			t.Errorf("Form = %q, want the first upsert's 10-Q", got.Form)
+		}
+		if got.HasFilingSummary == nil || !*got.HasFilingSummary {
+			t.Errorf("HasFilingSummary = %v, want true", got.HasFilingSummary)
+		}
+		if got.Rfiles["BS"].FileName != "R2.htm" || got.ClassificationRulesVersion != "v1" {
+			t.Errorf("Rfiles = %v version %q, want R2.htm v1", got.Rfiles, got.ClassificationRulesVersion)
+		}
+	})
+
+	t.Run("SetRfiles removes the statements that are missing", func(t *testing.T) {
+		repository := newRepository(t)
+		mustDo(t, repository.UpsertFilingMetadata(filing("0001837014-24-000010", "2024-03-31")))
+		mustDo(t, repository.SetRfiles(CIK, "0001837014-24-000010", map[string]filingrepository.Rfile{
+			"BS": {FileName: "R2.htm", LongName: "Balance Sheets"},
+			"IS": {FileName: "R4.htm"},
+			"CF": {FileName: "R7.htm"},
+		}, "v1"))
+		mustDo(t, repository.SetRfiles(CIK, "0001837014-24-000010", map[string]filingrepository.Rfile{
+			"BS":  {FileName: "R3.htm", LongName: "Balance Sheets", ShortName: "BS", MenuCategory: "Statements"},
+			"CIS": {},
+		}, "v2"))
+
+		got, err := repository.GetFiling("0001837014-24-000010")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]filingrepository.Rfile{"BS": {FileName: "R3.htm", LongName: "Balance Sheets", ShortName: "BS", MenuCategory: "Statements"}}
+		if !reflect.DeepEqual(got.Rfiles, want) {
+			t.Errorf("Rfiles = %v, want %v", got.Rfiles, want)
+		}
+		if got.ClassificationRulesVersion != "v2" {
+			t.Errorf("ClassificationRulesVersion = %q, want v2", got.ClassificationRulesVersion)
+		}
+	})
+
+	t.Run("unknown filings are left alone", func(t *testing.T) {
+		repository := newRepository(t)
+		mustDo(t, repository.UpsertFilingMetadata(filing("0001837014-24-000010", "2024-03-31")))
+
+		// another CIK's filing is as unknown as one that isn't there
+		for _, CIKOfUpdate := range []string{CIK, "0000320193"} {
+			accessionNumber := "0001837014-24-000099"
+			if CIKOfUpdate != CIK {
+				accessionNumber = "0001837014-24-000010"
+			}
+			mustDo(t, repository.SetHasFilingSummary(CIKOfUpdate, accessionNumber, true))
+			mustDo(t, repository.SetRfiles(CIKOfUpdate, accessionNumber, map[string]filingrepository.Rfile{"BS": {FileName: "R2.htm"}}, "v1"))
+			mustDo(t, repository.SetFilingReport(CIKOfUpdate, accessionNumber, "reconciliation", map[string]string{"status": "passed"}))
+		}
+
+		if _, err := repository.GetFiling("0001837014-24-000099"); !errors.Is(err, filingrepository.ErrFilingNotFound) {
+			t.Errorf("GetFiling of an unknown filing = %v, want ErrFilingNotFound", err)
+		}
+		got, err := repository.GetFiling("0001837014-24-000010")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.HasFilingSummary != nil || len(got.Rfiles) != 0 {
+			t.Errorf("filing changed by another CIK: HasFilingSummary %v Rfiles %v", got.HasFilingSummary, got.Rfiles)
+		}
+		var report map[string]string
+		if found, err := repository.GetFilingReport("0001837014-24-000010", "reconciliation", &report); err != nil || found {
+			t.Errorf("GetFilingReport = %v, %v, want no report", found, err)
+		}
+	})
+
+	t.Run("filings are listed by report date then accession number", func(t *testing.T) {
+		repository := newRepository(t)
+		mustDo(t, repository.UpsertFilingMetadata(filing("0001837014-24-000030", "2024-06-30")))
+		mustDo(t, repository.UpsertFilingMetadata(filing("0001837014-24-000020", "2024-03-31")))
+		mustDo(t, repository.UpsertFilingMetadata(filing("0001837014-24-000010", "2024-06-30")))
+		mustDo(t, repository.UpsertFilingMetadata(filingrepository.FilingMetadata{CIK: "0000320193", AccessionNumber: "0000320193-24-000001", ReportDate: "2024-01-31"}))
+
+		filings, err := repository.ListFilingsByCIK(CIK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var accessionNumbers []string
+		for _, filing := range filings {
+			accessionNumbers = append(accessionNumbers, filing.AccessionNumber)
+		}
+		want := []string{"0001837014-24-000020", "0001837014-24-000010", "0001837014-24-000030"}
+		if !reflect.DeepEqual(accessionNumbers, want) {
+			t.Errorf("got %v, want %v", accessionNumbers, want)
+		}
+	})
+
+	t.Run("filing reports round trip", func(t *testing.T) {
+		type check struct {
+			Check      string  `bson:"check"`
+			Difference float64 `bson:"difference"`
+		}
+		type report struct {
+			Status string  `bson:"status"`
+			Checks []check `bson:"checks"`
+		}
+		repository := newRepository(t)
+		mustDo(t, repository.UpsertFilingMetadata(filing("0001837014-24-000010", "2024-03-31")))
+
+		mustDo(t, repository.SetFilingReport(CIK, "0001837014-24-000010", "reconciliation", report{Status: "failed"}))
+		saved := report{Status: "passed", Checks: []check{{Check: "CF ending cash = BS cash", Difference: 0.5}}}
+		mustDo(t, repository.SetFilingReport(CIK, "0001837014-24-000010", "reconciliation", saved))
+		mustDo(t, repository.SetFilingReport(CIK, "0001837014-24-000010", "detailRfiles", []string{"R9.htm", "R10.htm"}))
+
+		var got report
+		if found, err := repository.GetFilingReport("0001837014-24-000010", "reconciliation", &got); err != nil || !found {
+			t.Fatalf("GetFilingReport = %v, %v, want the report", found, err)
+		}
+		if !reflect.DeepEqual(got, saved) {
+			t.Errorf("got %+v, want %+v", got, saved)
+		}
+		var detailRfiles []string
+		if found, err := repository.GetFilingReport("0001837014-24-000010", "detailRfiles", &detailRfiles); err != nil || !found {
+			t.Fatalf("GetFilingReport = %v, %v, want the report", found, err)
+		}
+		if want := []string{"R9.htm", "R10.htm"}; !reflect.DeepEqual(detailRfiles, want) {
+			t.Errorf("got %v, want %v", detailRfiles, want)
+		}
+		if found, err := repository.GetFilingReport("0001837014-24-000010", "balanceSheetValidation", &got); err != nil || found {
+			t.Errorf("GetFilingReport of a report that wasn't saved = %v, %v, want false", found, err)
+		}
+	})
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+package filingrepository
+
+import (
+	"fmt"
+	"sync"
+)
+
+// MemoryFilingRepository keeps the filings in a map so the stages can run without Mongo, eg) in unit tests
+type MemoryFilingRepository struct {
+	mutex   sync.Mutex
+	filings map[string]Filing            // accessionNumber -> filing
+	reports map[string]map[string]string // accessionNumber -> name -> encoded report
+}
+
+func NewMemoryFilingRepository() *MemoryFilingRepository {
+	return &MemoryFilingRepository{filings: make(map[string]Filing), reports: make(map[string]map[string]string)}
+}
+
+func (repository *MemoryFilingRepository) UpsertFilingMetadata(metadata FilingMetadata) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	if _, ok := repository.filings[metadata.AccessionNumber]; !ok {
+		repository.filings[metadata.AccessionNumber] = Filing{FilingMetadata: metadata}
+	}
+	return nil
+}
+
+// SetHasFilingSummary does nothing for a filing that isn't there, same as an update without upsert in Mongo
+func (repository *MemoryFilingRepository) SetHasFilingSummary(CIK string, accessionNumber string, hasFilingSummary bool) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	filing, ok := repository.filings[accessionNumber]
+	if !ok || filing.CIK != CIK {
+		return nil
+	}
+	filing.HasFilingSummary = &hasFilingSummary
+	repository.filings[accessionNumber] = filing
+	return nil
+}
+
+func (repository *MemoryFilingRepository) SetRfiles(CIK string, accessionNumber string, Rfiles map[string]Rfile, classificationRulesVersion string) error {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	filing, ok := repository.filings[accessionNumber]
+	if !ok || filing.CIK != CIK {
+		return nil
+	}
+	filing.Rfiles = make(map[string]Rfile)
+	for financialStatementType, Rfile := range Rfiles {
+		if Rfile.FileName != "" {
+			filing.Rfiles[financialStatementType] = Rfile
+		}
+	}
+	filing.ClassificationRulesVersion = classificationRulesVersion
+	repository.filings[accessionNumber] = filing
+	return nil
+}
+
+func (repository *MemoryFilingRepository) GetFiling(accessionNumber string) (Filing, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	filing, ok := repository.filings[accessionNumber]
+	if !ok {
+		return Filing{}, fmt.Errorf("accession number %s: %w", accessionNumber, ErrFilingNotFound)
+	}
+	return copyFiling(filing), nil
+}
+
+func (repository *MemoryFilingRepository) ListFilingsByCIK(CIK string) ([]Filing, error) {
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	var filings []Filing
+	for _, filing := range repository.filings {
+		if filing.CIK == CIK {
+			filings = append(filings, copyFiling(filing))
+		}
+	}
+	sortByReportDate(filings)
+	return filings, nil
+}
+
+func (repository *MemoryFilingRepository) SetFilingReport(CIK string, accessionNumber string, name string, report any) error {
+	encoded, err := encodeFilingReport(report)
+	if err != nil {
+		return err
+	}
+	repository.mutex.Lock()
+	defer repository.mutex.Unlock()
+	filing, ok := repository.filings[accessionNumber]
+	if !ok || filing.CIK != CIK {
+		return nil
+	}
+	if repository.reports[accessionNumber] == nil {
+		repository.reports[accessionNumber] = make(map[string]string)
+	}
+	repository.reports[accessionNumber][name] = encoded
+	return nil
+}
+
+func (repository *MemoryFilingRepository) GetFilingReport(accessionNumber string, name string, report any) (bool, error) {
+	repository.mutex.Lock()
+	encoded, ok := repository.reports[accessionNumber][name]
+	repository.mutex.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, decodeFilingReport(encoded, report)
+}
+
+// copyFiling keeps callers from changing the stored filing through its map and pointer
+func copyFiling(filing Filing) Filing {
+	if filing.HasFilingSummary != nil {
+		hasFilingSummary := *filing.HasFilingSummary
+		filing.HasFilingSummary = &hasFilingSummary
+	}
+	if filing.Rfiles != nil {
+		Rfiles := make(map[string]Rfile, len(filing.Rfiles))
+		for financialStatementType, Rfile := range filing.Rfiles {
+			Rfiles[financialStatementType] = Rfile
+		}
+		filing.Rfiles = Rfiles
+	}
+	return filing
+}
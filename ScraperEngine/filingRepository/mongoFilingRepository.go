@@ -0,0 +1,168 @@
+package filingrepository
+
+import (
+	"context"
+	"fmt"
+
+	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoFilingRepository keeps one doc per filing in the 10K10QMetaDataCollection collection.
+// The R files are flat fields of the doc, Rfile_BS_fileName, Rfile_BS_longName, ... because the docs saved so far look like that
+type MongoFilingRepository struct {
+	collection *mongo.Collection
+}
+
+func NewMongoFilingRepository(client *mongo.Client) *MongoFilingRepository {
+	return &MongoFilingRepository{collection: utilityfunctions.GetMongoDBCollection(client)}
+}
+
+// mongoFilingDoc is the part of the doc that maps onto fields as is
+type mongoFilingDoc struct {
+	FilingMetadata             `bson:",inline"`
+	HasFilingSummary           *bool  `bson:"hasFilingSummary,omitempty"`
+	ClassificationRulesVersion string `bson:"classificationRulesVersion,omitempty"`
+}
+
+var rfileFields = []string{"fileName", "longName", "shortName", "menuCategory"}
+
+func rfileFieldName(financialStatementType string, field string) string {
+	return fmt.Sprintf("Rfile_%s_%s", financialStatementType, field)
+}
+
+func (repository *MongoFilingRepository) UpsertFilingMetadata(metadata FilingMetadata) error {
+	filter := bson.M{"accessionnumber": metadata.AccessionNumber}
+	update := bson.M{"$setOnInsert": metadata}
+	_, err := repository.collection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (repository *MongoFilingRepository) SetHasFilingSummary(CIK string, accessionNumber string, hasFilingSummary bool) error {
+	filter := bson.M{"accessionnumber": accessionNumber, "cik": CIK}
+	update := bson.M{"$set": bson.M{"hasFilingSummary": hasFilingSummary}}
+	_, err := repository.collection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+func (repository *MongoFilingRepository) SetRfiles(CIK string, accessionNumber string, Rfiles map[string]Rfile, classificationRulesVersion string) error {
+	set := bson.M{"classificationRulesVersion": classificationRulesVersion}
+	unset := bson.M{}
+	for _, financialStatementType := range FinancialStatementTypes {
+		Rfile, ok := Rfiles[financialStatementType]
+		if !ok || Rfile.FileName == "" {
+			for _, field := range rfileFields {
+				unset[rfileFieldName(financialStatementType, field)] = ""
+			}
+			continue
+		}
+		set[rfileFieldName(financialStatementType, "fileName")] = Rfile.FileName
+		set[rfileFieldName(financialStatementType, "longName")] = Rfile.LongName
+		set[rfileFieldName(financialStatementType, "shortName")] = Rfile.ShortName
+		set[rfileFieldName(financialStatementType, "menuCategory")] = Rfile.MenuCategory
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	filter := bson.M{"accessionnumber": accessionNumber, "cik": CIK}
+	_, err := repository.collection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+func (repository *MongoFilingRepository) GetFiling(accessionNumber string) (Filing, error) {
+	raw, err := repository.collection.FindOne(context.Background(), bson.M{"accessionnumber": accessionNumber}).Raw()
+	if err == mongo.ErrNoDocuments {
+		return Filing{}, fmt.Errorf("accession number %s: %w", accessionNumber, ErrFilingNotFound)
+	}
+	if err != nil {
+		return Filing{}, err
+	}
+	return decodeFiling(raw)
+}
+
+func (repository *MongoFilingRepository) ListFilingsByCIK(CIK string) ([]Filing, error) {
+	ctx := context.Background()
+	cursor, err := repository.collection.Find(ctx, bson.M{"cik": CIK}, options.Find().SetSort(bson.D{{Key: "reportdate", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var filings []Filing
+	for cursor.Next(ctx) {
+		filing, err := decodeFiling(cursor.Current)
+		if err != nil {
+			return nil, err
+		}
+		filings = append(filings, filing)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	// Mongo leaves the order of filings of the same report date up to itself
+	sortByReportDate(filings)
+	return filings, nil
+}
+
+// SetFilingReport sets the report as the field name of the filing doc
+func (repository *MongoFilingRepository) SetFilingReport(CIK string, accessionNumber string, name string, report any) error {
+	filter := bson.M{"accessionnumber": accessionNumber, "cik": CIK}
+	_, err := repository.collection.UpdateOne(context.Background(), filter, bson.M{"$set": bson.M{name: report}})
+	return err
+}
+
+func (repository *MongoFilingRepository) GetFilingReport(accessionNumber string, name string, report any) (bool, error) {
+	findOptions := options.FindOne().SetProjection(bson.M{name: 1})
+	raw, err := repository.collection.FindOne(context.Background(), bson.M{"accessionnumber": accessionNumber}, findOptions).Raw()
+	if err == mongo.ErrNoDocuments {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	value, err := raw.LookupErr(name)
+	if err != nil {
+		return false, nil
+	}
+	return true, value.Unmarshal(report)
+}
+
+func decodeFiling(raw bson.Raw) (Filing, error) {
+	var doc mongoFilingDoc
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return Filing{}, err
+	}
+	var fields bson.M
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return Filing{}, err
+	}
+
+	filing := Filing{
+		FilingMetadata:             doc.FilingMetadata,
+		HasFilingSummary:           doc.HasFilingSummary,
+		ClassificationRulesVersion: doc.ClassificationRulesVersion,
+	}
+	for _, financialStatementType := range FinancialStatementTypes {
+		fileName, _ := fields[rfileFieldName(financialStatementType, "fileName")].(string)
+		if fileName == "" {
+			continue
+		}
+		if filing.Rfiles == nil {
+			filing.Rfiles = make(map[string]Rfile)
+		}
+		longName, _ := fields[rfileFieldName(financialStatementType, "longName")].(string)
+		shortName, _ := fields[rfileFieldName(financialStatementType, "shortName")].(string)
+		menuCategory, _ := fields[rfileFieldName(financialStatementType, "menuCategory")].(string)
+		filing.Rfiles[financialStatementType] = Rfile{
+			FileName:     fileName,
+			LongName:     longName,
+			ShortName:    shortName,
+			MenuCategory: menuCategory,
+		}
+	}
+	return filing, nil
+}
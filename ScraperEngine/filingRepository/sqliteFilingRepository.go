@@ -0,0 +1,162 @@
+package filingrepository
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SQLiteFilingRepository keeps the filings in the filings and filing_rfiles tables of sqlitedatabase
+type SQLiteFilingRepository struct {
+	db *sql.DB
+}
+
+func NewSQLiteFilingRepository(db *sql.DB) *SQLiteFilingRepository {
+	return &SQLiteFilingRepository{db: db}
+}
+
+const filingColumns = `accession_number, cik, filing_date, report_date, acceptance_date_time, act, form, file_number, film_number, items, size,
+	has_filing_summary, classification_rules_version`
+
+func (repository *SQLiteFilingRepository) UpsertFilingMetadata(metadata FilingMetadata) error {
+	_, err := repository.db.Exec(`INSERT INTO filings (accession_number, cik, filing_date, report_date, acceptance_date_time, act, form, file_number, film_number, items, size)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (accession_number) DO NOTHING`,
+		metadata.AccessionNumber, metadata.CIK, metadata.FilingDate, metadata.ReportDate, metadata.AcceptanceDateTime, metadata.Act,
+		metadata.Form, metadata.FileNumber, metadata.FilmNumber, metadata.Items, metadata.Size)
+	return err
+}
+
+func (repository *SQLiteFilingRepository) SetHasFilingSummary(CIK string, accessionNumber string, hasFilingSummary bool) error {
+	_, err := repository.db.Exec(`UPDATE filings SET has_filing_summary = ? WHERE accession_number = ? AND cik = ?`, hasFilingSummary, accessionNumber, CIK)
+	return err
+}
+
+func (repository *SQLiteFilingRepository) SetRfiles(CIK string, accessionNumber string, Rfiles map[string]Rfile, classificationRulesVersion string) error {
+	tx, err := repository.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE filings SET classification_rules_version = ? WHERE accession_number = ? AND cik = ?`, classificationRulesVersion, accessionNumber, CIK)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil || updated == 0 {
+		// no such filing, same as an update that matches nothing in Mongo
+		return err
+	}
+
+	if _, err := tx.Exec(`DELETE FROM filing_rfiles WHERE accession_number = ?`, accessionNumber); err != nil {
+		return err
+	}
+	for _, financialStatementType := range FinancialStatementTypes {
+		Rfile, ok := Rfiles[financialStatementType]
+		if !ok || Rfile.FileName == "" {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO filing_rfiles (accession_number, financial_statement_type, file_name, long_name, short_name, menu_category)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			accessionNumber, financialStatementType, Rfile.FileName, Rfile.LongName, Rfile.ShortName, Rfile.MenuCategory)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (repository *SQLiteFilingRepository) GetFiling(accessionNumber string) (Filing, error) {
+	filings, err := repository.queryFilings(`SELECT `+filingColumns+` FROM filings WHERE accession_number = ?`,
+		`SELECT accession_number, financial_statement_type, file_name, long_name, short_name, menu_category FROM filing_rfiles WHERE accession_number = ?`,
+		accessionNumber)
+	if err != nil {
+		return Filing{}, err
+	}
+	if len(filings) == 0 {
+		return Filing{}, fmt.Errorf("accession number %s: %w", accessionNumber, ErrFilingNotFound)
+	}
+	return filings[0], nil
+}
+
+func (repository *SQLiteFilingRepository) ListFilingsByCIK(CIK string) ([]Filing, error) {
+	return repository.queryFilings(`SELECT `+filingColumns+` FROM filings WHERE cik = ? ORDER BY report_date, accession_number`,
+		`SELECT r.accession_number, r.financial_statement_type, r.file_name, r.long_name, r.short_name, r.menu_category
+		FROM filing_rfiles r JOIN filings f ON f.accession_number = r.accession_number WHERE f.cik = ?`,
+		CIK)
+}
+
+// SetFilingReport does nothing for a filing that isn't there, the report is extended JSON in filing_reports
+func (repository *SQLiteFilingRepository) SetFilingReport(CIK string, accessionNumber string, name string, report any) error {
+	encoded, err := encodeFilingReport(report)
+	if err != nil {
+		return err
+	}
+	_, err = repository.db.Exec(`INSERT INTO filing_reports (accession_number, name, report)
+		SELECT accession_number, ?, ? FROM filings WHERE accession_number = ? AND cik = ?
+		ON CONFLICT (accession_number, name) DO UPDATE SET report = excluded.report`,
+		name, encoded, accessionNumber, CIK)
+	return err
+}
+
+func (repository *SQLiteFilingRepository) GetFilingReport(accessionNumber string, name string, report any) (bool, error) {
+	var encoded string
+	err := repository.db.QueryRow(`SELECT report FROM filing_reports WHERE accession_number = ? AND name = ?`, accessionNumber, name).Scan(&encoded)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, decodeFilingReport(encoded, report)
+}
+
+// queryFilings reads the filings of the first query and attaches the R files of the second, both take the same argument
+func (repository *SQLiteFilingRepository) queryFilings(filingsQuery string, RfilesQuery string, argument string) ([]Filing, error) {
+	rows, err := repository.db.Query(filingsQuery, argument)
+	if err != nil {
+		return nil, err
+	}
+	var filings []Filing
+	indexByAccessionNumber := make(map[string]int)
+	for rows.Next() {
+		var filing Filing
+		var hasFilingSummary sql.NullBool
+		err := rows.Scan(&filing.AccessionNumber, &filing.CIK, &filing.FilingDate, &filing.ReportDate, &filing.AcceptanceDateTime, &filing.Act,
+			&filing.Form, &filing.FileNumber, &filing.FilmNumber, &filing.Items, &filing.Size, &hasFilingSummary, &filing.ClassificationRulesVersion)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if hasFilingSummary.Valid {
+			filing.HasFilingSummary = &hasFilingSummary.Bool
+		}
+		indexByAccessionNumber[filing.AccessionNumber] = len(filings)
+		filings = append(filings, filing)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = repository.db.Query(RfilesQuery, argument)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var accessionNumber, financialStatementType string
+		var file Rfile
+		if err := rows.Scan(&accessionNumber, &financialStatementType, &file.FileName, &file.LongName, &file.ShortName, &file.MenuCategory); err != nil {
+			return nil, err
+		}
+		i, ok := indexByAccessionNumber[accessionNumber]
+		if !ok {
+			continue
+		}
+		if filings[i].Rfiles == nil {
+			filings[i].Rfiles = make(map[string]Rfile)
+		}
+		filings[i].Rfiles[financialStatementType] = file
+	}
+	return filings, rows.Err()
+}
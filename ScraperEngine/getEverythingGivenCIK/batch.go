@@ -0,0 +1,149 @@
+package geteverythinggivencik
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Company is one company of a batch, Ticker is empty when the batch listed it by CIK
+type Company struct {
+	CIK    string
+	Ticker string
+}
+
+// CompanyResult is how the stages went for one company of a batch,
+// Err is set when the company couldn't be run at all, eg) its ticker isn't known to SEC
+type CompanyResult struct {
+	Company  Company
+	Results  []StageResult
+	Duration time.Duration
+	Err      error
+}
+
+// Failed is true when the company couldn't be run or one of its stages failed
+func (result CompanyResult) Failed() bool {
+	if result.Err != nil {
+		return true
+	}
+	for _, stageResult := range result.Results {
+		if stageResult.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadCompanyListFile reads the CIKs and tickers of a batch, one or more per line separated by commas, # starts a comment
+func ReadCompanyListFile(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		for _, entry := range strings.Split(line, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ResolveCompanies turns the entries of a batch into companies, an entry of only digits is a CIK and anything else a ticker.
+// Entries that can't be resolved come back as failed results, a company listed twice is run once
+func ResolveCompanies(entries []string) ([]Company, []CompanyResult) {
+	var companies []Company
+	var unresolved []CompanyResult
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		company := Company{}
+		if isAllDigits(entry) {
+			company.CIK = fmt.Sprintf("%010s", entry)
+		} else {
+			company.Ticker = strings.ToUpper(entry)
+			CIK, err := fetchdata.FindCIKGivenTicker(entry)
+			if err != nil {
+				unresolved = append(unresolved, CompanyResult{Company: company, Err: err})
+				continue
+			}
+			company.CIK = CIK
+		}
+		if seen[company.CIK] {
+			continue
+		}
+		seen[company.CIK] = true
+		companies = append(companies, company)
+	}
+	return companies, unresolved
+}
+
+func isAllDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// RunBatch runs the stages for every company on a pool of workers goroutines and returns the results in the order of companies.
+// The workers share the fetchdata rate limiter so the batch as a whole stays under the SEC limit
+func RunBatch(companies []Company, stages []Stage, workers int, keepGoing bool, client *mongo.Client) []CompanyResult {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]CompanyResult, len(companies))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = runCompany(companies[i], stages, keepGoing, client)
+			}
+		}()
+	}
+
+	for i := range companies {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	return results
+}
+
+// runCompany keeps a panic in one company from taking the rest of the batch down with it
+func runCompany(company Company, stages []Stage, keepGoing bool, client *mongo.Client) (result CompanyResult) {
+	start := time.Now()
+	result.Company = company
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result.Err = errors.New(fmt.Sprint("panic: ", recovered))
+		}
+		result.Duration = time.Since(start)
+		fmt.Printf("=== finished %s %s in %s\n", company.CIK, company.Ticker, result.Duration.Round(time.Second))
+	}()
+
+	result.Results = RunStages(company.CIK, stages, keepGoing, client)
+	return result
+}
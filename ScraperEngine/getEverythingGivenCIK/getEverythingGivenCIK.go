@@ -1,21 +1,158 @@
 package geteverythinggivencik
 
 import (
-	categorizefinancialstatements "github.com/Programmerdin/FinancialDataSite_Go/categorizeRfiles"
-	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
-	parserfiles "github.com/Programmerdin/FinancialDataSite_Go/parseRfiles"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	combinecsvfiles "github.com/Programmerdin/FinancialDataSite_Go/combineCSVfiles"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func GetEverythingGivenCIK(CIK string, client *mongo.Client) {
-	fetchdata.Store10K10QmetadataFromSubmissionFilesCIKtoMongoDB(CIK, client)
-	fetchdata.CheckAllFilingIndexJsonForExistenceOfFilingSummary(CIK, client)
-	fetchdata.DownloadFilingSummaryFiles(CIK, client)
+// Stage is one step of getting the financial statements of a company,
+// every stage reads what the stages before it saved to Mongo and SEC-files so they can also be run one at a time.
+// Run stops early when ctx is canceled
+type Stage struct {
+	Name        string
+	Description string
+	Run         func(ctx context.Context, CIK string, client *mongo.Client) error
+}
+
+// Stages are all the stages in the order they have to run, each one runs a group of FilingStages
+// so a stage only works on the filings that are ready for it, see orchestrator.go
+var Stages = []Stage{
+	{
+		Name:        "fetch",
+		Description: "store the 10-K/10-Q metadata of the submission files, check which filings have a FilingSummary.xml and download them",
+		Run:         filingStagesRunner(StageDiscovered, StageSummaryChecked, StageSummaryDownloaded),
+	},
+	{
+		Name:        "categorize",
+		Description: "find the R files of the financial statements in every FilingSummary.xml",
+		Run:         filingStagesRunner(StageCategorized),
+	},
+	{
+		Name:        "parse",
+		Description: "download the R files of the financial statements and parse them into CSVs",
+		Run:         filingStagesRunner(StageRfilesDownloaded, StageParsed),
+	},
+	{
+		Name:        "combine",
+		Description: "combine the CSVs of every filing into Level 1 BS, IS, CIS and CF and publish them for the Backend",
+		Run:         filingStagesRunner(StageMerged),
+	},
+}
+
+func filingStagesRunner(stageNames ...string) func(ctx context.Context, CIK string, client *mongo.Client) error {
+	return func(ctx context.Context, CIK string, client *mongo.Client) error {
+		_, err := RunFilingStages(ctx, CIK, stageNames, client)
+		return err
+	}
+}
+
+// StageResult is how one stage went, Status is "ok", "failed" or "skipped"
+type StageResult struct {
+	Stage    string
+	Status   string
+	Duration time.Duration
+	Err      error
+}
+
+func GetEverythingGivenCIK(CIK string, client *mongo.Client) error {
+	for _, result := range RunStages(CIK, Stages, false, client) {
+		if result.Err != nil {
+			return result.Err
+		}
+	}
+	return nil
+}
+
+// SelectStages returns the stages with the given names in the order they have to run, no names returns all of them
+func SelectStages(names []string) ([]Stage, error) {
+	if len(names) == 0 {
+		return Stages, nil
+	}
+	selected := make(map[string]bool)
+	for _, name := range names {
+		found := false
+		for _, stage := range Stages {
+			if stage.Name == strings.ToLower(name) {
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown stage %q, expected fetch, categorize, parse or combine", name)
+		}
+		selected[strings.ToLower(name)] = true
+	}
+
+	var stages []Stage
+	for _, stage := range Stages {
+		if selected[stage.Name] {
+			stages = append(stages, stage)
+		}
+	}
+	return stages, nil
+}
+
+// RunStages runs the stages in order. A failed stage skips the stages after it unless keepGoing is set,
+// then the filings that got through the failed stage go on and the ones that failed wait for the next run
+func RunStages(CIK string, stages []Stage, keepGoing bool, client *mongo.Client) []StageResult {
+	return RunStagesContext(context.Background(), CIK, stages, keepGoing, client)
+}
 
-	categorizefinancialstatements.ParseManyFilingSummaryXmlFilesAndSaveToMongoGivenCIK(CIK, client)
-	parserfiles.DownloadRfiles(CIK, client)
-	parserfiles.ParseManyRfilesAndSaveAsCSVs(CIK, client)
+// RunStagesContext is RunStages that stops once ctx is canceled, the running stage stops after the filing it's working on
+// and the stages after it are skipped
+func RunStagesContext(ctx context.Context, CIK string, stages []Stage, keepGoing bool, client *mongo.Client) []StageResult {
+	var results []StageResult
+	failed := false
+	for _, stage := range stages {
+		if ctx.Err() != nil || (failed && !keepGoing) {
+			results = append(results, StageResult{Stage: stage.Name, Status: "skipped", Err: ctx.Err()})
+			continue
+		}
 
-	// BalanceSheetArrays, _, _, _, _ := combinecsvfiles.GetCsvRfilesIntoArrayVariables(CIK, client)
+		fmt.Printf("=== %s %s: %s\n", stage.Name, CIK, stage.Description)
+		start := time.Now()
+		err := stage.Run(ctx, CIK, client)
+		result := StageResult{Stage: stage.Name, Status: "ok", Duration: time.Since(start), Err: err}
+		if err != nil {
+			fmt.Printf("Error in stage %s: %v\n", stage.Name, err)
+			result.Status = "failed"
+			failed = true
+		}
+		results = append(results, result)
+	}
+	return results
+}
 
+// CombineStatements generates the Level 1 combined statements (BS, IS, CIS or CF) of the CIK,
+// a statement that fails doesn't stop the others
+func CombineStatements(CIK string, statements []string, client *mongo.Client) error {
+	var errs []error
+	for _, statement := range statements {
+		var err error
+		switch strings.ToUpper(statement) {
+		case "BS":
+			err = combinecsvfiles.GenerateLevel1CombinedBalanceSheetsAndSaveAsCsvFileGivenCIK(CIK, client)
+		case "IS":
+			err = combinecsvfiles.GenerateLevel1CombinedIncomeStatementsAndSaveAsCsvFileGivenCIK(CIK, client)
+		case "CIS":
+			err = combinecsvfiles.GenerateLevel1CombinedComprehensiveIncomeStatementsAndSaveAsCsvFileGivenCIK(CIK, client)
+			if errors.Is(err, combinecsvfiles.ErrNoComprehensiveIncomeStatement) {
+				fmt.Printf("%s: %v, skipping CIS\n", CIK, err)
+				err = nil
+			}
+		case "CF":
+			err = combinecsvfiles.GenerateLevel1CombinedCashFlowStatementsAndSaveAsCsvFileGivenCIK(CIK, client)
+		default:
+			err = fmt.Errorf("unknown statement %q, expected BS, IS, CIS or CF", statement)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", strings.ToUpper(statement), err))
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -0,0 +1,134 @@
+package geteverythinggivencik
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryPipelineStateStore keeps the states in a map so the orchestrator can run without a database, eg) in unit tests
+type MemoryPipelineStateStore struct {
+	mutex  sync.Mutex
+	states map[string]map[string]FilingPipelineState // CIK -> accessionNumber -> state, "" is the failure of the whole CIK
+}
+
+func NewMemoryPipelineStateStore() *MemoryPipelineStateStore {
+	return &MemoryPipelineStateStore{states: make(map[string]map[string]FilingPipelineState)}
+}
+
+func (store *MemoryPipelineStateStore) ListFilingStates(CIK string) ([]FilingPipelineState, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	var states []FilingPipelineState
+	for accessionNumber, state := range store.states[CIK] {
+		if accessionNumber != "" {
+			states = append(states, state)
+		}
+	}
+	return states, nil
+}
+
+func (store *MemoryPipelineStateStore) AddDiscoveredFilings(CIK string, accessionNumbers []string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.states[CIK] == nil {
+		store.states[CIK] = make(map[string]FilingPipelineState)
+	}
+	for _, accessionNumber := range accessionNumbers {
+		if _, ok := store.states[CIK][accessionNumber]; !ok {
+			store.states[CIK][accessionNumber] = FilingPipelineState{CIK: CIK, AccessionNumber: accessionNumber, Stage: StageDiscovered, UpdatedAt: time.Now()}
+		}
+	}
+	return nil
+}
+
+// SaveStageSucceeded does nothing for a filing that isn't tracked, same as an update without upsert in Mongo
+func (store *MemoryPipelineStateStore) SaveStageSucceeded(CIK string, accessionNumber string, stage string, skipped string) error {
+	store.update(CIK, accessionNumber, func(state *FilingPipelineState) {
+		state.Stage, state.Attempts, state.FailedStage, state.Error, state.Skipped = stage, 0, "", "", skipped
+	})
+	return nil
+}
+
+func (store *MemoryPipelineStateStore) SaveStageFailed(CIK string, accessionNumber string, stage string, errorMessage string) error {
+	store.update(CIK, accessionNumber, func(state *FilingPipelineState) {
+		state.FailedStage, state.Error = stage, errorMessage
+		state.Attempts++
+	})
+	return nil
+}
+
+func (store *MemoryPipelineStateStore) GetCIKState(CIK string) (*FilingPipelineState, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	state, ok := store.states[CIK][""]
+	if !ok {
+		return nil, nil
+	}
+	return &state, nil
+}
+
+func (store *MemoryPipelineStateStore) SaveCIKStageFailed(CIK string, stage string, errorMessage string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.states[CIK] == nil {
+		store.states[CIK] = make(map[string]FilingPipelineState)
+	}
+	state := store.states[CIK][""]
+	state.CIK, state.FailedStage, state.Error, state.UpdatedAt = CIK, stage, errorMessage, time.Now()
+	state.Attempts++
+	store.states[CIK][""] = state
+	return nil
+}
+
+func (store *MemoryPipelineStateStore) ClearCIKStageFailed(CIK string, stage string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if state, ok := store.states[CIK][""]; ok && state.FailedStage == stage {
+		delete(store.states[CIK], "")
+	}
+	return nil
+}
+
+func (store *MemoryPipelineStateStore) ResetStages(CIK string, accessionNumber string, stages []string, previousStage string) (int64, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	isOneOfStages := func(name string) bool {
+		for _, stage := range stages {
+			if stage == name {
+				return true
+			}
+		}
+		return false
+	}
+	var count int64
+	for stateAccessionNumber, state := range store.states[CIK] {
+		if stateAccessionNumber == "" || (accessionNumber != "" && stateAccessionNumber != accessionNumber) {
+			continue
+		}
+		switch {
+		case isOneOfStages(state.Stage):
+			state.Stage, state.Attempts, state.FailedStage, state.Error, state.Skipped = previousStage, 0, "", "", ""
+		case isOneOfStages(state.FailedStage):
+			state.Attempts, state.FailedStage, state.Error = 0, "", ""
+		default:
+			continue
+		}
+		state.UpdatedAt = time.Now()
+		store.states[CIK][stateAccessionNumber] = state
+		count++
+	}
+	return count, nil
+}
+
+// update changes the state of a tracked filing
+func (store *MemoryPipelineStateStore) update(CIK string, accessionNumber string, change func(state *FilingPipelineState)) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	state, ok := store.states[CIK][accessionNumber]
+	if !ok {
+		return
+	}
+	change(&state)
+	state.UpdatedAt = time.Now()
+	store.states[CIK][accessionNumber] = state
+}
@@ -0,0 +1,130 @@
+package geteverythinggivencik
+
+import (
+	"context"
+	"time"
+
+	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoPipelineStateStore keeps one doc per filing in the pipelineState collection, the failure of the whole CIK is the doc with accessionNumber ""
+type MongoPipelineStateStore struct {
+	collection *mongo.Collection
+}
+
+func NewMongoPipelineStateStore(client *mongo.Client) *MongoPipelineStateStore {
+	return &MongoPipelineStateStore{collection: GetPipelineStateCollection(client)}
+}
+
+func GetPipelineStateCollection(client *mongo.Client) *mongo.Collection {
+	return utilityfunctions.GetMongoDBCollectionByName(client, "PipelineStateCollection", "pipelineState")
+}
+
+func (store *MongoPipelineStateStore) ListFilingStates(CIK string) ([]FilingPipelineState, error) {
+	cursor, err := store.collection.Find(context.Background(), bson.M{"cik": CIK, "accessionNumber": bson.M{"$ne": ""}})
+	if err != nil {
+		return nil, err
+	}
+	var states []FilingPipelineState
+	if err := cursor.All(context.Background(), &states); err != nil {
+		return nil, err
+	}
+	return states, nil
+}
+
+func (store *MongoPipelineStateStore) AddDiscoveredFilings(CIK string, accessionNumbers []string) error {
+	if len(accessionNumbers) == 0 {
+		return nil
+	}
+	now := time.Now()
+	var models []mongo.WriteModel
+	for _, accessionNumber := range accessionNumbers {
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"cik": CIK, "accessionNumber": accessionNumber}).
+			SetUpdate(bson.M{"$setOnInsert": bson.M{"stage": StageDiscovered, "attempts": 0, "updatedAt": now}}).
+			SetUpsert(true))
+	}
+	_, err := store.collection.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+func (store *MongoPipelineStateStore) SaveStageSucceeded(CIK string, accessionNumber string, stage string, skipped string) error {
+	set := bson.M{"stage": stage, "attempts": 0, "updatedAt": time.Now()}
+	unset := bson.M{"failedStage": "", "error": ""}
+	if skipped != "" {
+		set["skipped"] = skipped
+	} else {
+		unset["skipped"] = ""
+	}
+	filter := bson.M{"cik": CIK, "accessionNumber": accessionNumber}
+	_, err := store.collection.UpdateOne(context.Background(), filter, bson.M{"$set": set, "$unset": unset})
+	return err
+}
+
+func (store *MongoPipelineStateStore) SaveStageFailed(CIK string, accessionNumber string, stage string, errorMessage string) error {
+	filter := bson.M{"cik": CIK, "accessionNumber": accessionNumber}
+	update := bson.M{
+		"$set": bson.M{"failedStage": stage, "error": errorMessage, "updatedAt": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := store.collection.UpdateOne(context.Background(), filter, update)
+	return err
+}
+
+func (store *MongoPipelineStateStore) GetCIKState(CIK string) (*FilingPipelineState, error) {
+	var state FilingPipelineState
+	err := store.collection.FindOne(context.Background(), bson.M{"cik": CIK, "accessionNumber": ""}).Decode(&state)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (store *MongoPipelineStateStore) SaveCIKStageFailed(CIK string, stage string, errorMessage string) error {
+	filter := bson.M{"cik": CIK, "accessionNumber": ""}
+	update := bson.M{
+		"$set": bson.M{"failedStage": stage, "error": errorMessage, "updatedAt": time.Now()},
+		"$inc": bson.M{"attempts": 1},
+	}
+	_, err := store.collection.UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (store *MongoPipelineStateStore) ClearCIKStageFailed(CIK string, stage string) error {
+	_, err := store.collection.DeleteOne(context.Background(), bson.M{"cik": CIK, "accessionNumber": "", "failedStage": stage})
+	return err
+}
+
+func (store *MongoPipelineStateStore) ResetStages(CIK string, accessionNumber string, stages []string, previousStage string) (int64, error) {
+	pastStageFilter := bson.M{"cik": CIK, "stage": bson.M{"$in": stages}}
+	failedFilter := bson.M{"cik": CIK, "failedStage": bson.M{"$in": stages}}
+	if accessionNumber != "" {
+		pastStageFilter["accessionNumber"] = accessionNumber
+		failedFilter["accessionNumber"] = accessionNumber
+	} else {
+		// the failure of the whole CIK isn't a filing, it is cleared by the next run of the stage
+		failedFilter["accessionNumber"] = bson.M{"$ne": ""}
+	}
+	now := time.Now()
+	result, err := store.collection.UpdateMany(context.Background(), pastStageFilter, bson.M{
+		"$set":   bson.M{"stage": previousStage, "attempts": 0, "updatedAt": now},
+		"$unset": bson.M{"failedStage": "", "error": "", "skipped": ""},
+	})
+	if err != nil {
+		return 0, err
+	}
+	failedResult, err := store.collection.UpdateMany(context.Background(), failedFilter, bson.M{
+		"$set":   bson.M{"attempts": 0, "updatedAt": now},
+		"$unset": bson.M{"failedStage": "", "error": ""},
+	})
+	if err != nil {
+		return result.ModifiedCount, err
+	}
+	return result.ModifiedCount + failedResult.ModifiedCount, nil
+}
@@ -0,0 +1,385 @@
+package geteverythinggivencik
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	categorizefinancialstatements "github.com/Programmerdin/FinancialDataSite_Go/categorizeRfiles"
+	classificationrules "github.com/Programmerdin/FinancialDataSite_Go/classificationRules"
+	combinecsvfiles "github.com/Programmerdin/FinancialDataSite_Go/combineCSVfiles"
+	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	parserfiles "github.com/Programmerdin/FinancialDataSite_Go/parseRfiles"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// The orchestrator moves every filing of a CIK through the FilingStages one stage at a time and saves where each filing got
+// (see pipelineState.go), so a run picks up where the last one stopped and only the filings that failed are tried again.
+// A filing that fails a stage doesn't hold the other filings back, it stays at its last successful stage
+
+const (
+	StageDiscovered        = "discovered"
+	StageSummaryChecked    = "summary-checked"
+	StageSummaryDownloaded = "summary-downloaded"
+	StageCategorized       = "categorized"
+	StageRfilesDownloaded  = "rfiles-downloaded"
+	StageParsed            = "parsed"
+	StageMerged            = "merged"
+)
+
+// MaxAttempts is how many times a filing is tried at a stage before it is left for ResetFilingPipelineStates
+var MaxAttempts = 3
+
+// filingStageOutcome is how one filing did in a stage, Skipped is set when it succeeded but has nothing for the stages after it
+type filingStageOutcome struct {
+	Err     error
+	Skipped string
+}
+
+// FilingStage is one step every filing goes through, run gets the filings that are at the stage before it
+// and returns the outcome of every one of them. The error is a failure of the whole CIK (eg combining the statements of every filing),
+// it is saved once for the CIK and the filings stay where they are without counting an attempt
+type FilingStage struct {
+	Name string
+	run  func(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error)
+}
+
+// FilingStages are in the order a filing goes through them, discovered has no run because it finds the filings of the CIK
+var FilingStages = []FilingStage{
+	{Name: StageDiscovered},
+	{Name: StageSummaryChecked, run: checkFilingSummaries},
+	{Name: StageSummaryDownloaded, run: downloadFilingSummaries},
+	{Name: StageCategorized, run: categorizeRfiles},
+	{Name: StageRfilesDownloaded, run: downloadRfiles},
+	{Name: StageParsed, run: parseRfiles},
+	{Name: StageMerged, run: mergeStatements},
+}
+
+func filingStageIndex(name string) int {
+	for i, stage := range FilingStages {
+		if stage.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// FilingStageCounts is what happened to the filings of the CIK in one stage of a run,
+// GivenUp are the filings that have failed the stage MaxAttempts times and weren't tried,
+// FailedForCIK is set when the stage failed for the whole CIK and none of the filings were counted
+type FilingStageCounts struct {
+	Stage        string
+	Succeeded    int
+	Skipped      int
+	Failed       int
+	GivenUp      int
+	FailedForCIK bool
+}
+
+// RunFilingStages runs the named FilingStages for the filings of the CIK that are ready for them.
+// The error lists the filings that failed, the counts are returned either way.
+// Once ctx is canceled the filings that weren't run are left where they are and the stages after it don't run
+func RunFilingStages(ctx context.Context, CIK string, stageNames []string, client *mongo.Client) ([]FilingStageCounts, error) {
+	selected := make(map[string]bool)
+	for _, name := range stageNames {
+		if filingStageIndex(name) < 0 {
+			return nil, fmt.Errorf("unknown filing stage %q", name)
+		}
+		selected[name] = true
+	}
+
+	var allCounts []FilingStageCounts
+	var errs []error
+	if selected[StageDiscovered] {
+		accessionNumbers, err := discoverFilings(CIK, client)
+		counts := FilingStageCounts{Stage: StageDiscovered, Succeeded: len(accessionNumbers)}
+		if err != nil {
+			fmt.Println("Error discovering filings:", err)
+			errs = append(errs, fmt.Errorf("%s: %w", StageDiscovered, err))
+			counts.Failed = 1
+		}
+		allCounts = append(allCounts, counts)
+	}
+
+	states, err := GetFilingPipelineStatesGivenCIK(CIK)
+	if err != nil {
+		return allCounts, errors.Join(append(errs, err)...)
+	}
+
+	for i, stage := range FilingStages {
+		if i == 0 || !selected[stage.Name] {
+			continue
+		}
+		if ctx.Err() != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", stage.Name, ctx.Err()))
+			break
+		}
+		previous := FilingStages[i-1].Name
+
+		counts := FilingStageCounts{Stage: stage.Name}
+		var ready []string
+		for accessionNumber, state := range states {
+			if state.Stage != previous || state.Skipped != "" {
+				continue
+			}
+			if state.FailedStage == stage.Name && state.Attempts >= MaxAttempts {
+				counts.GivenUp++
+				continue
+			}
+			ready = append(ready, accessionNumber)
+		}
+		sort.Strings(ready)
+		if len(ready) == 0 {
+			allCounts = append(allCounts, counts)
+			continue
+		}
+
+		fmt.Printf("--- %s: %d filings\n", stage.Name, len(ready))
+		outcomes, err := stage.run(ctx, CIK, ready, client)
+		if err != nil {
+			counts.FailedForCIK = true
+			fmt.Printf("--- %s failed for %s, %d filings left at %s: %v\n", stage.Name, CIK, len(ready), previous, err)
+			if err := PipelineStates.SaveCIKStageFailed(CIK, stage.Name, err.Error()); err != nil {
+				fmt.Println("Error saving pipeline state:", err)
+			}
+			errs = append(errs, fmt.Errorf("%s failed for %s: %w", stage.Name, CIK, err))
+			allCounts = append(allCounts, counts)
+			continue
+		}
+		if err := PipelineStates.ClearCIKStageFailed(CIK, stage.Name); err != nil {
+			fmt.Println("Error saving pipeline state:", err)
+		}
+		var failedAccessionNumbers []string
+		for _, accessionNumber := range ready {
+			outcome, ok := outcomes[accessionNumber]
+			if !ok && ctx.Err() != nil {
+				// canceled before the filing was run, it isn't a failed attempt
+				continue
+			}
+			if !ok {
+				outcome.Err = fmt.Errorf("%s didn't report on the filing", stage.Name)
+			}
+			state := states[accessionNumber]
+			if outcome.Err != nil {
+				counts.Failed++
+				failedAccessionNumbers = append(failedAccessionNumbers, accessionNumber)
+				fmt.Printf("%s failed %s: %v\n", accessionNumber, stage.Name, outcome.Err)
+				if err := PipelineStates.SaveStageFailed(CIK, accessionNumber, stage.Name, outcome.Err.Error()); err != nil {
+					fmt.Println("Error saving pipeline state:", err)
+				}
+				state.FailedStage, state.Error, state.Attempts = stage.Name, outcome.Err.Error(), state.Attempts+1
+			} else {
+				if outcome.Skipped != "" {
+					counts.Skipped++
+				} else {
+					counts.Succeeded++
+				}
+				if err := PipelineStates.SaveStageSucceeded(CIK, accessionNumber, stage.Name, outcome.Skipped); err != nil {
+					fmt.Println("Error saving pipeline state:", err)
+				}
+				state.Stage, state.FailedStage, state.Error, state.Attempts, state.Skipped = stage.Name, "", "", 0, outcome.Skipped
+			}
+			state.UpdatedAt = time.Now()
+			states[accessionNumber] = state
+		}
+		fmt.Printf("--- %s: %d succeeded, %d skipped, %d failed, %d given up after %d attempts\n",
+			stage.Name, counts.Succeeded, counts.Skipped, counts.Failed, counts.GivenUp, MaxAttempts)
+		if len(failedAccessionNumbers) > 0 {
+			errs = append(errs, fmt.Errorf("%s failed for %d filings: %v", stage.Name, len(failedAccessionNumbers), failedAccessionNumbers))
+		}
+		allCounts = append(allCounts, counts)
+	}
+
+	return allCounts, errors.Join(errs...)
+}
+
+// discoverFilings stores the 10-K/10-Q metadata of the submission files and starts tracking the filings of the CIK
+func discoverFilings(CIK string, client *mongo.Client) ([]string, error) {
+	if err := fetchdata.Store10K10QmetadataFromSubmissionFilesCIKtoMongoDB(CIK, client); err != nil {
+		return nil, err
+	}
+
+	filings, err := filingrepository.Filings.ListFilingsByCIK(CIK)
+	if err != nil {
+		return nil, err
+	}
+	var accessionNumbers []string
+	for _, filing := range filings {
+		accessionNumbers = append(accessionNumbers, filing.AccessionNumber)
+	}
+
+	return accessionNumbers, PipelineStates.AddDiscoveredFilings(CIK, accessionNumbers)
+}
+
+// checkFilingSummaries requests index.json of fetchdata.Concurrency filings at a time
+func checkFilingSummaries(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error) {
+	outcomes := make(map[string]filingStageOutcome)
+	var mutex sync.Mutex
+	fetchdata.RunConcurrently(len(accessionNumbers), func(i int) {
+		if ctx.Err() != nil {
+			return
+		}
+		hasFilingSummary, err := fetchdata.CheckOneFilingIndexJsonForExistenceOfFilingSummary(CIK, accessionNumbers[i], client)
+		outcome := filingStageOutcome{Err: err}
+		if err == nil && !hasFilingSummary {
+			outcome.Skipped = "no FilingSummary.xml"
+		}
+		mutex.Lock()
+		outcomes[accessionNumbers[i]] = outcome
+		mutex.Unlock()
+	})
+	return outcomes, nil
+}
+
+// downloadFilingSummaries downloads the FilingSummary.xml files that aren't in the store yet,
+// a filing succeeded when its file is in the store afterwards
+func downloadFilingSummaries(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error) {
+	var accessionNumbersToDownload []string
+	var keys []string
+	for _, accessionNumber := range accessionNumbers {
+		key := storage.FilingKey(CIK, accessionNumber, "FilingSummary.xml")
+		if exists, err := storage.SECFiles.Exists(key); err == nil && !exists {
+			accessionNumbersToDownload = append(accessionNumbersToDownload, accessionNumber)
+			keys = append(keys, key)
+		}
+	}
+	downloadErr := fetchdata.DownloadManySECFiles(fetchdata.GenerateLinksToDownloadFilingSummaryFiles(CIK, accessionNumbersToDownload), keys)
+
+	outcomes := make(map[string]filingStageOutcome)
+	for _, accessionNumber := range accessionNumbers {
+		exists, err := storage.SECFiles.Exists(storage.FilingKey(CIK, accessionNumber, "FilingSummary.xml"))
+		if err != nil || !exists {
+			outcomes[accessionNumber] = filingStageOutcome{Err: fmt.Errorf("FilingSummary.xml not downloaded: %v", errors.Join(err, downloadErr))}
+			continue
+		}
+		outcomes[accessionNumber] = filingStageOutcome{}
+	}
+	return outcomes, nil
+}
+
+func categorizeRfiles(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error) {
+	rules, err := classificationrules.LoadClassificationRulesForCIK(CIK)
+	if err != nil {
+		return nil, err
+	}
+	outcomes := make(map[string]filingStageOutcome)
+
+	for _, accessionNumber := range accessionNumbers {
+		if ctx.Err() != nil {
+			break
+		}
+		key := storage.FilingKey(CIK, accessionNumber, "FilingSummary.xml")
+		RfileObjects, err := categorizefinancialstatements.CategorizeRfilesOfFinancialStatementsFromFilingSummaryXML(key, rules)
+		if err == nil {
+			err = categorizefinancialstatements.SaveRfileObjects(CIK, accessionNumber, RfileObjects, rules.Version)
+		}
+		outcomes[accessionNumber] = filingStageOutcome{Err: err}
+	}
+	return outcomes, nil
+}
+
+// rfileNamesByAccessionNumber groups the R files of the financial statements of the CIK by filing,
+// filings without a balance sheet R file are left out
+func rfileNamesByAccessionNumber(CIK string, client *mongo.Client) (map[string][]string, error) {
+	accessionNumbers, RfileNames, err := parserfiles.RetrieveRfileNamesAndAccessionNumbersFromMongoDB(CIK, client)
+	if err != nil {
+		return nil, err
+	}
+	namesByAccessionNumber := make(map[string][]string)
+	for i := range accessionNumbers {
+		namesByAccessionNumber[accessionNumbers[i]] = append(namesByAccessionNumber[accessionNumbers[i]], RfileNames[i])
+	}
+	return namesByAccessionNumber, nil
+}
+
+// downloadRfiles downloads the R files of the financial statements that aren't in the store yet,
+// a filing succeeded when all of its R files are in the store afterwards
+func downloadRfiles(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error) {
+	namesByAccessionNumber, err := rfileNamesByAccessionNumber(CIK, client)
+	if err != nil {
+		return nil, err
+	}
+	outcomes := make(map[string]filingStageOutcome)
+
+	var downloadAccessionNumbers []string
+	var downloadRfileNames []string
+	for _, accessionNumber := range accessionNumbers {
+		for _, RfileName := range namesByAccessionNumber[accessionNumber] {
+			downloadAccessionNumbers = append(downloadAccessionNumbers, accessionNumber)
+			downloadRfileNames = append(downloadRfileNames, RfileName)
+		}
+	}
+	downloadLinks, keys, err := parserfiles.GenerateDownloadLinksAndKeysForRfiles(CIK, downloadAccessionNumbers, downloadRfileNames)
+	if err == nil {
+		err = fetchdata.DownloadManySECFiles(downloadLinks, keys)
+	}
+
+	for _, accessionNumber := range accessionNumbers {
+		RfileNames, ok := namesByAccessionNumber[accessionNumber]
+		if !ok {
+			outcomes[accessionNumber] = filingStageOutcome{Skipped: "no balance sheet R file"}
+			continue
+		}
+		var missing []string
+		for _, RfileName := range RfileNames {
+			if exists, existsErr := storage.SECFiles.Exists(storage.FilingKey(CIK, accessionNumber, RfileName)); existsErr != nil || !exists {
+				missing = append(missing, RfileName)
+			}
+		}
+		if len(missing) > 0 {
+			outcomes[accessionNumber] = filingStageOutcome{Err: fmt.Errorf("R files not downloaded %v: %v", missing, err)}
+			continue
+		}
+		outcomes[accessionNumber] = filingStageOutcome{}
+	}
+	return outcomes, nil
+}
+
+// parseRfiles parses every R file of the filings again, so a reset of the stage picks up parser changes
+func parseRfiles(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error) {
+	namesByAccessionNumber, err := rfileNamesByAccessionNumber(CIK, client)
+	if err != nil {
+		return nil, err
+	}
+	outcomes := make(map[string]filingStageOutcome)
+
+	for _, accessionNumber := range accessionNumbers {
+		if ctx.Err() != nil {
+			break
+		}
+		var failedRfiles []string
+		for _, RfileName := range namesByAccessionNumber[accessionNumber] {
+			if err := parserfiles.ParseRfileAndSaveAsCSV(CIK, accessionNumber, RfileName, client); err != nil {
+				failedRfiles = append(failedRfiles, fmt.Sprintf("%s: %v", RfileName, err))
+			}
+		}
+		if len(failedRfiles) > 0 {
+			outcomes[accessionNumber] = filingStageOutcome{Err: errors.New(strings.Join(failedRfiles, "; "))}
+			continue
+		}
+		outcomes[accessionNumber] = filingStageOutcome{}
+	}
+	return outcomes, nil
+}
+
+// mergeStatements combines the CSVs of every parsed filing of the CIK, not just the new ones,
+// a failure to combine or publish is a failure of the CIK rather than of any one filing
+func mergeStatements(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error) {
+	if err := CombineStatements(CIK, []string{"BS", "IS", "CIS", "CF"}, client); err != nil {
+		return nil, err
+	}
+	if err := combinecsvfiles.PublishCombinedStatementsGivenCIK(CIK, client); err != nil {
+		return nil, err
+	}
+	outcomes := make(map[string]filingStageOutcome)
+	for _, accessionNumber := range accessionNumbers {
+		outcomes[accessionNumber] = filingStageOutcome{}
+	}
+	return outcomes, nil
+}
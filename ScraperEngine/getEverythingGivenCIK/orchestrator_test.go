@@ -0,0 +1,267 @@
+package geteverythinggivencik
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	sqlitedatabase "github.com/Programmerdin/FinancialDataSite_Go/sqliteDatabase"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const testCIK = "0001837014"
+
+// pipelineStateStores are the stores the orchestrator tests run against, newStore returns an empty one
+var pipelineStateStores = []struct {
+	name     string
+	newStore func(t *testing.T) PipelineStateStore
+}{
+	{"memory", func(t *testing.T) PipelineStateStore { return NewMemoryPipelineStateStore() }},
+	{"sqlite", func(t *testing.T) PipelineStateStore {
+		db, err := sqlitedatabase.Open(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewSQLitePipelineStateStore(db)
+	}},
+}
+
+// stageRun is a stub of FilingStage.run that gets the accession numbers the stage was called with
+type stageRun func(ctx context.Context, accessionNumbers []string) (map[string]filingStageOutcome, error)
+
+// useStubStages swaps the runs of FilingStages and PipelineStates for the test, a stage without a stub succeeds for every filing
+func useStubStages(t *testing.T, store PipelineStateStore, runs map[string]stageRun) {
+	originalStages, originalStates := FilingStages, PipelineStates
+	t.Cleanup(func() { FilingStages, PipelineStates = originalStages, originalStates })
+
+	PipelineStates = store
+	FilingStages = nil
+	for _, stage := range originalStages {
+		run := runs[stage.Name]
+		if run == nil {
+			run = succeedFor
+		}
+		if stage.Name != StageDiscovered {
+			stage.run = func(ctx context.Context, CIK string, accessionNumbers []string, client *mongo.Client) (map[string]filingStageOutcome, error) {
+				return run(ctx, accessionNumbers)
+			}
+		}
+		FilingStages = append(FilingStages, stage)
+	}
+}
+
+func succeedFor(ctx context.Context, accessionNumbers []string) (map[string]filingStageOutcome, error) {
+	outcomes := make(map[string]filingStageOutcome)
+	for _, accessionNumber := range accessionNumbers {
+		outcomes[accessionNumber] = filingStageOutcome{}
+	}
+	return outcomes, nil
+}
+
+func mustGetStates(t *testing.T) map[string]FilingPipelineState {
+	t.Helper()
+	states, err := GetFilingPipelineStatesGivenCIK(testCIK)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return states
+}
+
+// each stage is its own RunFilingStages call, like fetch, categorize and parse are separate commands,
+// so every call has to pick up the filings where the one before it left them
+func TestRunFilingStagesOneAfterAnother(t *testing.T) {
+	for _, store := range pipelineStateStores {
+		t.Run(store.name, func(t *testing.T) {
+			ran := make(map[string][]string)
+			runs := make(map[string]stageRun)
+			for _, stage := range FilingStages[1:] {
+				name := stage.Name
+				runs[name] = func(ctx context.Context, accessionNumbers []string) (map[string]filingStageOutcome, error) {
+					ran[name] = accessionNumbers
+					outcomes, _ := succeedFor(ctx, accessionNumbers)
+					if name == StageSummaryChecked {
+						outcomes["0001837014-20-000001"] = filingStageOutcome{Skipped: "no FilingSummary.xml"}
+					}
+					return outcomes, nil
+				}
+			}
+			useStubStages(t, store.newStore(t), runs)
+			mustDo(t, PipelineStates.AddDiscoveredFilings(testCIK, []string{"0001837014-20-000001", "0001837014-24-000010"}))
+
+			for _, stage := range FilingStages[1:] {
+				if _, err := RunFilingStages(context.Background(), testCIK, []string{stage.Name}, nil); err != nil {
+					t.Fatalf("%s: %v", stage.Name, err)
+				}
+			}
+
+			want := map[string][]string{StageSummaryChecked: {"0001837014-20-000001", "0001837014-24-000010"}}
+			for _, stage := range FilingStages[2:] {
+				want[stage.Name] = []string{"0001837014-24-000010"}
+			}
+			if !reflect.DeepEqual(ran, want) {
+				t.Errorf("stages ran for %v, want %v", ran, want)
+			}
+			states := mustGetStates(t)
+			if state := states["0001837014-24-000010"]; state.Stage != StageMerged {
+				t.Errorf("0001837014-24-000010 is at %q, want %q", state.Stage, StageMerged)
+			}
+			if state := states["0001837014-20-000001"]; state.Stage != StageSummaryChecked || state.Skipped == "" {
+				t.Errorf("0001837014-20-000001 is at %q skipped %q, want skipped at %q", state.Stage, state.Skipped, StageSummaryChecked)
+			}
+
+			// discovering the filings again keeps where they got
+			mustDo(t, PipelineStates.AddDiscoveredFilings(testCIK, []string{"0001837014-20-000001", "0001837014-24-000010"}))
+			if state := mustGetStates(t)["0001837014-24-000010"]; state.Stage != StageMerged {
+				t.Errorf("after discovering again 0001837014-24-000010 is at %q, want %q", state.Stage, StageMerged)
+			}
+		})
+	}
+}
+
+func TestRunFilingStagesRetriesUntilMaxAttempts(t *testing.T) {
+	ranFor := 0
+	useStubStages(t, NewMemoryPipelineStateStore(), map[string]stageRun{
+		StageSummaryChecked: func(ctx context.Context, accessionNumbers []string) (map[string]filingStageOutcome, error) {
+			ranFor += len(accessionNumbers)
+			outcomes, _ := succeedFor(ctx, accessionNumbers)
+			outcomes["0001837014-24-000010"] = filingStageOutcome{Err: errors.New("index.json returned 503")}
+			return outcomes, nil
+		},
+	})
+	mustDo(t, PipelineStates.AddDiscoveredFilings(testCIK, []string{"0001837014-24-000010", "0001837014-24-000020"}))
+
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		counts, err := RunFilingStages(context.Background(), testCIK, []string{StageSummaryChecked}, nil)
+		if err == nil {
+			t.Fatalf("attempt %d: want the failed filing in the error", attempt)
+		}
+		wantSucceeded := 0
+		if attempt == 1 {
+			wantSucceeded = 1
+		}
+		if want := (FilingStageCounts{Stage: StageSummaryChecked, Succeeded: wantSucceeded, Failed: 1}); counts[0] != want {
+			t.Errorf("attempt %d: counts = %+v, want %+v", attempt, counts[0], want)
+		}
+		state := mustGetStates(t)["0001837014-24-000010"]
+		if state.Stage != StageDiscovered || state.FailedStage != StageSummaryChecked || state.Attempts != attempt || state.Error != "index.json returned 503" {
+			t.Errorf("attempt %d: state = %+v, want left at discovered after %d attempts", attempt, state, attempt)
+		}
+	}
+
+	// given up, it isn't run again until it is reset
+	counts, err := RunFilingStages(context.Background(), testCIK, []string{StageSummaryChecked}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (FilingStageCounts{Stage: StageSummaryChecked, GivenUp: 1}); counts[0] != want {
+		t.Errorf("after %d attempts counts = %+v, want %+v", MaxAttempts, counts[0], want)
+	}
+	if want := 1 + MaxAttempts; ranFor != want {
+		t.Errorf("stage ran for %d filings, want %d", ranFor, want)
+	}
+
+	count, err := ResetFilingPipelineStates(testCIK, "", StageSummaryChecked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("reset %d filings, want the succeeded and the given up one", count)
+	}
+	for accessionNumber, state := range mustGetStates(t) {
+		if state.Stage != StageDiscovered || state.FailedStage != "" || state.Attempts != 0 {
+			t.Errorf("after reset %s = %+v, want back at discovered without attempts", accessionNumber, state)
+		}
+	}
+}
+
+func TestRunFilingStagesFailedForCIK(t *testing.T) {
+	failCIK := true
+	useStubStages(t, NewMemoryPipelineStateStore(), map[string]stageRun{
+		StageMerged: func(ctx context.Context, accessionNumbers []string) (map[string]filingStageOutcome, error) {
+			if failCIK {
+				return nil, errors.New("combining the statements failed")
+			}
+			return succeedFor(ctx, accessionNumbers)
+		},
+	})
+	mustDo(t, PipelineStates.AddDiscoveredFilings(testCIK, []string{"0001837014-24-000010"}))
+	mustDo(t, PipelineStates.SaveStageSucceeded(testCIK, "0001837014-24-000010", StageParsed, ""))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		counts, err := RunFilingStages(context.Background(), testCIK, []string{StageMerged}, nil)
+		if err == nil {
+			t.Fatal("want the failure of the CIK")
+		}
+		if want := (FilingStageCounts{Stage: StageMerged, FailedForCIK: true}); counts[0] != want {
+			t.Errorf("counts = %+v, want %+v", counts[0], want)
+		}
+		CIKState, err := GetCIKPipelineStateGivenCIK(testCIK)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if CIKState == nil || CIKState.FailedStage != StageMerged || CIKState.Attempts != attempt {
+			t.Errorf("CIK state = %+v, want %s failed %d times", CIKState, StageMerged, attempt)
+		}
+		// the filing doesn't count the attempt
+		if state := mustGetStates(t)["0001837014-24-000010"]; state.Stage != StageParsed || state.Attempts != 0 || state.FailedStage != "" {
+			t.Errorf("filing = %+v, want left at parsed without an attempt", state)
+		}
+	}
+
+	failCIK = false
+	if _, err := RunFilingStages(context.Background(), testCIK, []string{StageMerged}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if CIKState, err := GetCIKPipelineStateGivenCIK(testCIK); err != nil || CIKState != nil {
+		t.Errorf("CIK state = %+v, %v, want cleared once the stage ran", CIKState, err)
+	}
+	if state := mustGetStates(t)["0001837014-24-000010"]; state.Stage != StageMerged {
+		t.Errorf("filing is at %q, want %q", state.Stage, StageMerged)
+	}
+}
+
+func TestRunFilingStagesCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ranLater := false
+	useStubStages(t, NewMemoryPipelineStateStore(), map[string]stageRun{
+		// runs the first filing and is canceled before the second one, like Ctrl+C in the middle of a stage
+		StageSummaryChecked: func(ctx context.Context, accessionNumbers []string) (map[string]filingStageOutcome, error) {
+			cancel()
+			return map[string]filingStageOutcome{accessionNumbers[0]: {}}, nil
+		},
+		StageSummaryDownloaded: func(ctx context.Context, accessionNumbers []string) (map[string]filingStageOutcome, error) {
+			ranLater = true
+			return succeedFor(ctx, accessionNumbers)
+		},
+	})
+	mustDo(t, PipelineStates.AddDiscoveredFilings(testCIK, []string{"0001837014-24-000010", "0001837014-24-000020"}))
+
+	counts, err := RunFilingStages(ctx, testCIK, []string{StageSummaryChecked, StageSummaryDownloaded}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if ranLater {
+		t.Error("the stage after the canceled one ran")
+	}
+	if want := []FilingStageCounts{{Stage: StageSummaryChecked, Succeeded: 1}}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("counts = %+v, want %+v", counts, want)
+	}
+	states := mustGetStates(t)
+	if state := states["0001837014-24-000010"]; state.Stage != StageSummaryChecked {
+		t.Errorf("the filing that ran is at %q, want %q", state.Stage, StageSummaryChecked)
+	}
+	if state := states["0001837014-24-000020"]; state.Stage != StageDiscovered || state.Attempts != 0 || state.FailedStage != "" {
+		t.Errorf("the filing that wasn't run = %+v, want left at discovered without an attempt", state)
+	}
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
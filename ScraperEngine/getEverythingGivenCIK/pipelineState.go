@@ -0,0 +1,84 @@
+package geteverythinggivencik
+
+import (
+	"fmt"
+	"time"
+)
+
+// FilingPipelineState is how far one filing got through the FilingStages, saved to PipelineStates.
+// Stage is the last stage that succeeded, a filing that failed the stage after it has FailedStage, Error and Attempts set
+// and is retried on the next run until it has failed MaxAttempts times.
+// Skipped is set for filings that can't go further, eg) 10-Qs filed before XBRL have no FilingSummary.xml.
+// A stage that fails for the whole CIK is saved once, on a state without an AccessionNumber
+type FilingPipelineState struct {
+	CIK             string    `bson:"cik"`
+	AccessionNumber string    `bson:"accessionNumber"`
+	Stage           string    `bson:"stage"`
+	FailedStage     string    `bson:"failedStage,omitempty"`
+	Error           string    `bson:"error,omitempty"`
+	Attempts        int       `bson:"attempts"`
+	Skipped         string    `bson:"skipped,omitempty"`
+	UpdatedAt       time.Time `bson:"updatedAt"`
+}
+
+// PipelineStateStore keeps the FilingPipelineState of every filing, the pipelineState collection in Mongo,
+// the pipeline_state table with DATABASE_BACKEND=sqlite, or the in-memory one in tests
+type PipelineStateStore interface {
+	// ListFilingStates returns the states of the filings of the CIK, not the failure of the whole CIK
+	ListFilingStates(CIK string) ([]FilingPipelineState, error)
+	// AddDiscoveredFilings starts the filings that aren't tracked yet at discovered, the state of the others is kept
+	AddDiscoveredFilings(CIK string, accessionNumbers []string) error
+	// SaveStageSucceeded moves a tracked filing to the stage and clears the failure of the stage
+	SaveStageSucceeded(CIK string, accessionNumber string, stage string, skipped string) error
+	// SaveStageFailed keeps a tracked filing at its last successful stage and counts the failed attempt
+	SaveStageFailed(CIK string, accessionNumber string, stage string, errorMessage string) error
+	// GetCIKState returns the stage that last failed for the whole CIK, nil when there is none
+	GetCIKState(CIK string) (*FilingPipelineState, error)
+	// SaveCIKStageFailed saves a failure of the whole CIK once and counts the attempt
+	SaveCIKStageFailed(CIK string, stage string, errorMessage string) error
+	// ClearCIKStageFailed removes the failure of the whole CIK when it was at the stage
+	ClearCIKStageFailed(CIK string, stage string) error
+	// ResetStages sends the filings at one of stages back to previousStage and clears their failures of stages,
+	// an empty accessionNumber resets every filing of the CIK but not the failure of the whole CIK. It returns the states that changed
+	ResetStages(CIK string, accessionNumber string, stages []string, previousStage string) (int64, error)
+}
+
+// PipelineStates is the store RunFilingStages uses, main sets it to the one DATABASE_BACKEND picks
+var PipelineStates PipelineStateStore
+
+// GetFilingPipelineStatesGivenCIK returns the state of every filing of the CIK by accession number
+func GetFilingPipelineStatesGivenCIK(CIK string) (map[string]FilingPipelineState, error) {
+	states, err := PipelineStates.ListFilingStates(CIK)
+	if err != nil {
+		return nil, err
+	}
+	statesByAccessionNumber := make(map[string]FilingPipelineState)
+	for _, state := range states {
+		statesByAccessionNumber[state.AccessionNumber] = state
+	}
+	return statesByAccessionNumber, nil
+}
+
+// GetCIKPipelineStateGivenCIK returns the stage that last failed for the whole CIK, nil when there is none
+func GetCIKPipelineStateGivenCIK(CIK string) (*FilingPipelineState, error) {
+	return PipelineStates.GetCIKState(CIK)
+}
+
+// ResetFilingPipelineStates runs the stage again for the filings of the CIK that got past it, they go back to the stage before it.
+// Failures at the stage or after it are cleared so they are retried whatever their attempts.
+// An empty accessionNumber resets every filing of the CIK
+func ResetFilingPipelineStates(CIK string, accessionNumber string, stage string) (int64, error) {
+	index := filingStageIndex(stage)
+	if index < 0 {
+		return 0, fmt.Errorf("unknown stage %q", stage)
+	}
+	previous := StageDiscovered
+	if index > 0 {
+		previous = FilingStages[index-1].Name
+	}
+	var stagesToRunAgain []string
+	for _, filingStage := range FilingStages[index:] {
+		stagesToRunAgain = append(stagesToRunAgain, filingStage.Name)
+	}
+	return PipelineStates.ResetStages(CIK, accessionNumber, stagesToRunAgain, previous)
+}
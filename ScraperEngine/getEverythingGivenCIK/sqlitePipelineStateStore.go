@@ -0,0 +1,154 @@
+package geteverythinggivencik
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// SQLitePipelineStateStore keeps the states in the pipeline_state table of sqlitedatabase, next to the filings they are about
+type SQLitePipelineStateStore struct {
+	db *sql.DB
+}
+
+func NewSQLitePipelineStateStore(db *sql.DB) *SQLitePipelineStateStore {
+	return &SQLitePipelineStateStore{db: db}
+}
+
+const pipelineStateColumns = `cik, accession_number, stage, failed_stage, error, attempts, skipped, updated_at`
+
+func (store *SQLitePipelineStateStore) ListFilingStates(CIK string) ([]FilingPipelineState, error) {
+	rows, err := store.db.Query(`SELECT `+pipelineStateColumns+` FROM pipeline_state WHERE cik = ? AND accession_number != ''`, CIK)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var states []FilingPipelineState
+	for rows.Next() {
+		state, err := scanPipelineState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states = append(states, state)
+	}
+	return states, rows.Err()
+}
+
+func (store *SQLitePipelineStateStore) AddDiscoveredFilings(CIK string, accessionNumbers []string) error {
+	if len(accessionNumbers) == 0 {
+		return nil
+	}
+	tx, err := store.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	now := formatPipelineStateTime(time.Now())
+	for _, accessionNumber := range accessionNumbers {
+		_, err := tx.Exec(`INSERT INTO pipeline_state (cik, accession_number, stage, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (cik, accession_number) DO NOTHING`, CIK, accessionNumber, StageDiscovered, now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (store *SQLitePipelineStateStore) SaveStageSucceeded(CIK string, accessionNumber string, stage string, skipped string) error {
+	_, err := store.db.Exec(`UPDATE pipeline_state SET stage = ?, attempts = 0, failed_stage = '', error = '', skipped = ?, updated_at = ?
+		WHERE cik = ? AND accession_number = ?`, stage, skipped, formatPipelineStateTime(time.Now()), CIK, accessionNumber)
+	return err
+}
+
+func (store *SQLitePipelineStateStore) SaveStageFailed(CIK string, accessionNumber string, stage string, errorMessage string) error {
+	_, err := store.db.Exec(`UPDATE pipeline_state SET failed_stage = ?, error = ?, attempts = attempts + 1, updated_at = ?
+		WHERE cik = ? AND accession_number = ?`, stage, errorMessage, formatPipelineStateTime(time.Now()), CIK, accessionNumber)
+	return err
+}
+
+func (store *SQLitePipelineStateStore) GetCIKState(CIK string) (*FilingPipelineState, error) {
+	state, err := scanPipelineState(store.db.QueryRow(`SELECT `+pipelineStateColumns+` FROM pipeline_state WHERE cik = ? AND accession_number = ''`, CIK))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+func (store *SQLitePipelineStateStore) SaveCIKStageFailed(CIK string, stage string, errorMessage string) error {
+	_, err := store.db.Exec(`INSERT INTO pipeline_state (cik, accession_number, failed_stage, error, attempts, updated_at) VALUES (?, '', ?, ?, 1, ?)
+		ON CONFLICT (cik, accession_number) DO UPDATE SET
+			failed_stage = excluded.failed_stage, error = excluded.error, attempts = attempts + 1, updated_at = excluded.updated_at`,
+		CIK, stage, errorMessage, formatPipelineStateTime(time.Now()))
+	return err
+}
+
+func (store *SQLitePipelineStateStore) ClearCIKStageFailed(CIK string, stage string) error {
+	_, err := store.db.Exec(`DELETE FROM pipeline_state WHERE cik = ? AND accession_number = '' AND failed_stage = ?`, CIK, stage)
+	return err
+}
+
+func (store *SQLitePipelineStateStore) ResetStages(CIK string, accessionNumber string, stages []string, previousStage string) (int64, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stagesPlaceholders := strings.TrimSuffix(strings.Repeat("?, ", len(stages)), ", ")
+	// an empty accessionNumber matches every filing, the failure of the whole CIK isn't a filing and is cleared by the next run of the stage
+	accessionNumberCondition := `accession_number != ''`
+	if accessionNumber != "" {
+		accessionNumberCondition = `accession_number = ?`
+	}
+	arguments := func(first ...any) []any {
+		arguments := append(first, CIK)
+		if accessionNumber != "" {
+			arguments = append(arguments, accessionNumber)
+		}
+		for _, stage := range stages {
+			arguments = append(arguments, stage)
+		}
+		return arguments
+	}
+	now := formatPipelineStateTime(time.Now())
+
+	result, err := tx.Exec(`UPDATE pipeline_state SET stage = ?, attempts = 0, failed_stage = '', error = '', skipped = '', updated_at = ?
+		WHERE cik = ? AND `+accessionNumberCondition+` AND stage IN (`+stagesPlaceholders+`)`, arguments(previousStage, now)...)
+	if err != nil {
+		return 0, err
+	}
+	reset, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	result, err = tx.Exec(`UPDATE pipeline_state SET attempts = 0, failed_stage = '', error = '', updated_at = ?
+		WHERE cik = ? AND `+accessionNumberCondition+` AND failed_stage IN (`+stagesPlaceholders+`)`, arguments(now)...)
+	if err != nil {
+		return 0, err
+	}
+	cleared, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return reset + cleared, tx.Commit()
+}
+
+// scanPipelineState reads a row of pipelineStateColumns
+func scanPipelineState(row interface{ Scan(...any) error }) (FilingPipelineState, error) {
+	var state FilingPipelineState
+	var updatedAt string
+	err := row.Scan(&state.CIK, &state.AccessionNumber, &state.Stage, &state.FailedStage, &state.Error, &state.Attempts, &state.Skipped, &updatedAt)
+	if err != nil {
+		return FilingPipelineState{}, err
+	}
+	state.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt)
+	return state, err
+}
+
+func formatPipelineStateTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
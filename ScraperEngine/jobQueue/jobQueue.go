@@ -0,0 +1,302 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
+	geteverythinggivencik "github.com/Programmerdin/FinancialDataSite_Go/getEverythingGivenCIK"
+	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Scrape jobs are queued in the scrapeJobs collection of the published database so the Backend and schedulers can add them.
+// A worker claims a job by taking its lease and keeps the lease by heartbeating while the stages run,
+// a job whose lease ran out (the worker died) is claimed again by the next worker.
+// A failed job goes back to queued with a backoff until it has been attempted MaxAttempts times.
+// A queued or running job has openCompany set to its CIK, the unique index on it keeps a company to one open job
+
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ErrLeaseLost is returned when the worker doesn't hold the lease of the job anymore, another worker may be running it
+var ErrLeaseLost = errors.New("lease of the job was lost")
+
+// JobProgress is where a running job is, Stage is the stage that is running
+type JobProgress struct {
+	Stage           string `bson:"stage,omitempty" json:"stage,omitempty"`
+	CompletedStages int    `bson:"completedStages" json:"completedStages"`
+	TotalStages     int    `bson:"totalStages" json:"totalStages"`
+	Message         string `bson:"message,omitempty" json:"message,omitempty"`
+}
+
+// JobStageResult is how one stage of the last attempt went, Status is "ok", "failed" or "skipped"
+type JobStageResult struct {
+	Stage      string `bson:"stage" json:"stage"`
+	Status     string `bson:"status" json:"status"`
+	DurationMs int64  `bson:"durationMs" json:"durationMs"`
+	Error      string `bson:"error,omitempty" json:"error,omitempty"`
+}
+
+// Job runs the pipeline stages for one company, no Stages runs all of them. Enqueue looks the CIK up from the Ticker,
+// the worker only does for jobs added without one
+type Job struct {
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	CIK            string             `bson:"cik" json:"cik"`
+	Ticker         string             `bson:"ticker,omitempty" json:"ticker,omitempty"`
+	Stages         []string           `bson:"stages,omitempty" json:"stages,omitempty"`
+	Status         string             `bson:"status" json:"status"`
+	Attempts       int                `bson:"attempts" json:"attempts"`
+	MaxAttempts    int                `bson:"maxAttempts" json:"maxAttempts"`
+	RunAfter       time.Time          `bson:"runAfter" json:"runAfter"`
+	LeaseOwner     string             `bson:"leaseOwner,omitempty" json:"leaseOwner,omitempty"`
+	LeaseExpiresAt time.Time          `bson:"leaseExpiresAt,omitempty" json:"leaseExpiresAt,omitempty"`
+	HeartbeatAt    time.Time          `bson:"heartbeatAt,omitempty" json:"heartbeatAt,omitempty"`
+	Progress       JobProgress        `bson:"progress" json:"progress"`
+	StageResults   []JobStageResult   `bson:"stageResults,omitempty" json:"stageResults,omitempty"`
+	Error          string             `bson:"error,omitempty" json:"error,omitempty"`
+	RequestedBy    string             `bson:"requestedBy,omitempty" json:"requestedBy,omitempty"`
+	OpenCompany    string             `bson:"openCompany,omitempty" json:"-"`
+	CreatedAt      time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt      time.Time          `bson:"updatedAt" json:"updatedAt"`
+	StartedAt      time.Time          `bson:"startedAt,omitempty" json:"startedAt,omitempty"`
+	FinishedAt     time.Time          `bson:"finishedAt,omitempty" json:"finishedAt,omitempty"`
+}
+
+// DefaultMaxAttempts is used for jobs enqueued without one
+const DefaultMaxAttempts = 3
+
+func GetJobCollection(client *mongo.Client) *mongo.Collection {
+	return utilityfunctions.GetPublishedMongoDBCollectionByName(client, "scrapeJobCollection", "scrapeJobs")
+}
+
+// OpenJobIndex is unique on openCompany, which only queued and running jobs have. The Backend creates the same index
+var OpenJobIndex = mongo.IndexModel{
+	Keys: bson.D{{Key: "openCompany", Value: 1}},
+	Options: options.Index().SetName("openCompany_unique").SetUnique(true).
+		SetPartialFilterExpression(bson.M{"openCompany": bson.M{"$exists": true}}),
+}
+
+// Enqueue adds a job for the company, a company that already has a queued or running job gets that job back instead of a second one,
+// the bool is false then. A ticker is looked up here so the company's jobs are found by CIK whether they were added by CIK or ticker,
+// and the stages are checked here so a typo fails when the job is added and not when it runs
+func Enqueue(CIK string, ticker string, stages []string, maxAttempts int, requestedBy string, client *mongo.Client) (Job, bool, error) {
+	if CIK == "" && ticker == "" {
+		return Job{}, false, fmt.Errorf("a job needs a CIK or a ticker")
+	}
+	if CIK == "" {
+		var err error
+		CIK, err = fetchdata.FindCIKGivenTicker(ticker)
+		if err != nil {
+			return Job{}, false, err
+		}
+	}
+	if _, err := geteverythinggivencik.SelectStages(stages); err != nil {
+		return Job{}, false, err
+	}
+	if maxAttempts < 1 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	collection := GetJobCollection(client)
+	if _, err := collection.Indexes().CreateOne(context.Background(), OpenJobIndex); err != nil {
+		return Job{}, false, err
+	}
+
+	totalStages := len(stages)
+	if totalStages == 0 {
+		totalStages = len(geteverythinggivencik.Stages)
+	}
+	now := time.Now()
+	job := Job{
+		ID:          primitive.NewObjectID(),
+		CIK:         CIK,
+		Ticker:      ticker,
+		Stages:      stages,
+		Status:      StatusQueued,
+		MaxAttempts: maxAttempts,
+		RunAfter:    now,
+		Progress:    JobProgress{TotalStages: totalStages},
+		RequestedBy: requestedBy,
+		OpenCompany: CIK,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	// the job is only inserted when the company has no open job, two enqueues racing each other can't both insert because of the index
+	filter := bson.M{"openCompany": job.OpenCompany}
+	upsertOptions := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	var saved Job
+	err := collection.FindOneAndUpdate(context.Background(), filter, bson.M{"$setOnInsert": job}, upsertOptions).Decode(&saved)
+	if mongo.IsDuplicateKeyError(err) {
+		err = collection.FindOne(context.Background(), filter).Decode(&saved)
+	}
+	if err != nil {
+		return Job{}, false, err
+	}
+	return saved, saved.ID == job.ID, nil
+}
+
+// Claim takes the lease of the queued job that has waited longest, or of a running job whose lease ran out.
+// It returns nil when there is nothing to run
+func Claim(workerID string, lease time.Duration, client *mongo.Client) (*Job, error) {
+	now := time.Now()
+	hasAttemptsLeft := bson.M{"$expr": bson.M{"$lt": bson.A{"$attempts", "$maxAttempts"}}}
+
+	//a job that keeps taking its worker down would be claimed forever, it fails once its last attempt's lease runs out
+	_, err := GetJobCollection(client).UpdateMany(context.Background(),
+		bson.M{"status": StatusRunning, "leaseExpiresAt": bson.M{"$lt": now}, "$nor": bson.A{hasAttemptsLeft}},
+		bson.M{
+			"$set":   bson.M{"status": StatusFailed, "error": "the lease ran out during the last attempt", "finishedAt": now, "updatedAt": now},
+			"$unset": bson.M{"leaseOwner": "", "leaseExpiresAt": "", "openCompany": ""},
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"$or": bson.A{
+		bson.M{"status": StatusQueued, "runAfter": bson.M{"$lte": now}},
+		bson.M{"status": StatusRunning, "leaseExpiresAt": bson.M{"$lt": now}, "$expr": hasAttemptsLeft["$expr"]},
+	}}
+	update := bson.M{
+		"$set": bson.M{
+			"status":         StatusRunning,
+			"leaseOwner":     workerID,
+			"leaseExpiresAt": now.Add(lease),
+			"heartbeatAt":    now,
+			"startedAt":      now,
+			"updatedAt":      now,
+			"progress":       JobProgress{Message: "claimed by " + workerID},
+		},
+		"$unset": bson.M{"stageResults": "", "finishedAt": ""},
+		"$inc":   bson.M{"attempts": 1},
+	}
+	findOptions := options.FindOneAndUpdate().SetSort(bson.M{"runAfter": 1}).SetReturnDocument(options.After)
+
+	var job Job
+	err = GetJobCollection(client).FindOneAndUpdate(context.Background(), filter, update, findOptions).Decode(&job)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// updateLeasedJob updates the job only while the worker holds its lease
+func updateLeasedJob(job *Job, workerID string, update bson.M, client *mongo.Client) error {
+	filter := bson.M{"_id": job.ID, "status": StatusRunning, "leaseOwner": workerID}
+	result, err := GetJobCollection(client).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// Heartbeat extends the lease of the job
+func Heartbeat(job *Job, workerID string, lease time.Duration, client *mongo.Client) error {
+	now := time.Now()
+	return updateLeasedJob(job, workerID, bson.M{"$set": bson.M{"leaseExpiresAt": now.Add(lease), "heartbeatAt": now, "updatedAt": now}}, client)
+}
+
+// UpdateProgress saves where the job is and the results of the stages that have run
+func UpdateProgress(job *Job, workerID string, progress JobProgress, stageResults []JobStageResult, client *mongo.Client) error {
+	set := bson.M{"progress": progress, "updatedAt": time.Now()}
+	if stageResults != nil {
+		set["stageResults"] = stageResults
+	}
+	return updateLeasedJob(job, workerID, bson.M{"$set": set}, client)
+}
+
+// Complete marks the job succeeded and releases its lease
+func Complete(job *Job, workerID string, stageResults []JobStageResult, client *mongo.Client) error {
+	now := time.Now()
+	return updateLeasedJob(job, workerID, bson.M{
+		"$set": bson.M{
+			"status":       StatusSucceeded,
+			"stageResults": stageResults,
+			"progress":     JobProgress{CompletedStages: len(stageResults), TotalStages: len(stageResults), Message: "done"},
+			"finishedAt":   now,
+			"updatedAt":    now,
+		},
+		"$unset": bson.M{"leaseOwner": "", "leaseExpiresAt": "", "error": "", "openCompany": ""},
+	}, client)
+}
+
+// Fail records the error and releases the lease, the job is queued again after Backoff unless it has no attempts left
+func Fail(job *Job, workerID string, jobErr error, stageResults []JobStageResult, client *mongo.Client) error {
+	now := time.Now()
+	set := bson.M{"error": jobErr.Error(), "stageResults": stageResults, "updatedAt": now}
+	unset := bson.M{"leaseOwner": "", "leaseExpiresAt": ""}
+	if job.Attempts < job.MaxAttempts {
+		set["status"] = StatusQueued
+		set["runAfter"] = now.Add(Backoff(job.Attempts))
+		set["progress.message"] = fmt.Sprintf("attempt %d of %d failed, retrying at %s", job.Attempts, job.MaxAttempts, now.Add(Backoff(job.Attempts)).Format(time.RFC3339))
+	} else {
+		set["status"] = StatusFailed
+		set["finishedAt"] = now
+		set["progress.message"] = fmt.Sprintf("failed after %d attempts", job.Attempts)
+		unset["openCompany"] = ""
+	}
+	return updateLeasedJob(job, workerID, bson.M{"$set": set, "$unset": unset}, client)
+}
+
+// Backoff is how long a job waits after its attempt-th failed attempt, 1 minute doubling up to 1 hour
+func Backoff(attempt int) time.Duration {
+	backoff := time.Minute
+	for i := 1; i < attempt && backoff < time.Hour; i++ {
+		backoff *= 2
+	}
+	if backoff > time.Hour {
+		backoff = time.Hour
+	}
+	return backoff
+}
+
+// ListJobs returns the newest jobs first, filtered by CIK and status when they are not empty
+func ListJobs(CIK string, status string, limit int64, client *mongo.Client) ([]Job, error) {
+	filter := bson.M{}
+	if CIK != "" {
+		filter["cik"] = CIK
+	}
+	if status != "" {
+		filter["status"] = status
+	}
+	findOptions := options.Find().SetSort(bson.M{"createdAt": -1})
+	if limit > 0 {
+		findOptions.SetLimit(limit)
+	}
+	cursor, err := GetJobCollection(client).Find(context.Background(), filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []Job
+	if err := cursor.All(context.Background(), &jobs); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// GetJob returns the job with the hex object id
+func GetJob(id string, client *mongo.Client) (Job, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return Job{}, fmt.Errorf("invalid job id %q: %w", id, err)
+	}
+	var job Job
+	if err := GetJobCollection(client).FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
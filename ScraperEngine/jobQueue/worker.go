@@ -0,0 +1,174 @@
+package jobqueue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
+	geteverythinggivencik "github.com/Programmerdin/FinancialDataSite_Go/getEverythingGivenCIK"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WorkerOptions configure a worker, Lease is how long a job stays claimed without a heartbeat
+// and the worker heartbeats every third of it
+type WorkerOptions struct {
+	WorkerID     string
+	Lease        time.Duration
+	PollInterval time.Duration
+	KeepGoing    bool
+}
+
+// DefaultWorkerID is the host name and process id, unique enough for workers on the same database
+func DefaultWorkerID() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "worker"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// RunWorker claims and runs jobs until ctx is canceled, the job that is running when it is canceled runs to the end first
+func RunWorker(ctx context.Context, workerOptions WorkerOptions, client *mongo.Client) error {
+	if workerOptions.WorkerID == "" {
+		workerOptions.WorkerID = DefaultWorkerID()
+	}
+	if workerOptions.Lease <= 0 {
+		workerOptions.Lease = 5 * time.Minute
+	}
+	if workerOptions.PollInterval <= 0 {
+		workerOptions.PollInterval = 10 * time.Second
+	}
+	fmt.Printf("Worker %s waiting for jobs\n", workerOptions.WorkerID)
+
+	for {
+		if ctx.Err() != nil {
+			fmt.Printf("Worker %s stopped\n", workerOptions.WorkerID)
+			return nil
+		}
+		job, err := Claim(workerOptions.WorkerID, workerOptions.Lease, client)
+		if err != nil {
+			fmt.Println("Error claiming job:", err)
+		}
+		if job == nil {
+			select {
+			case <-ctx.Done():
+			case <-time.After(workerOptions.PollInterval):
+			}
+			continue
+		}
+
+		fmt.Printf("Worker %s claimed job %s for %s %s, attempt %d of %d\n",
+			workerOptions.WorkerID, job.ID.Hex(), job.CIK, job.Ticker, job.Attempts, job.MaxAttempts)
+		if err := RunJob(job, workerOptions, client); err != nil {
+			fmt.Printf("Job %s failed: %v\n", job.ID.Hex(), err)
+		} else {
+			fmt.Printf("Job %s succeeded\n", job.ID.Hex())
+		}
+	}
+}
+
+// RunJob runs the stages of the claimed job while heartbeating, saves the progress after every stage
+// and completes or fails the job at the end. When the lease is lost the running stage is canceled,
+// another worker may have claimed the job
+func RunJob(job *Job, workerOptions WorkerOptions, client *mongo.Client) (jobErr error) {
+	var stageResults []JobStageResult
+
+	leaseCtx, cancelLease := context.WithCancelCause(context.Background())
+	defer cancelLease(nil)
+	stopHeartbeat := make(chan struct{})
+	var heartbeatWg sync.WaitGroup
+	heartbeatWg.Add(1)
+	go func() {
+		defer heartbeatWg.Done()
+		ticker := time.NewTicker(workerOptions.Lease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-ticker.C:
+				if err := Heartbeat(job, workerOptions.WorkerID, workerOptions.Lease, client); err != nil {
+					fmt.Printf("Error heartbeating job %s: %v\n", job.ID.Hex(), err)
+					if errors.Is(err, ErrLeaseLost) {
+						cancelLease(ErrLeaseLost)
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			jobErr = fmt.Errorf("panic: %v", recovered)
+		}
+		close(stopHeartbeat)
+		heartbeatWg.Wait()
+		if errors.Is(jobErr, ErrLeaseLost) {
+			// the job isn't this worker's to complete or fail anymore
+			return
+		}
+
+		var err error
+		if jobErr == nil {
+			err = Complete(job, workerOptions.WorkerID, stageResults, client)
+		} else {
+			err = Fail(job, workerOptions.WorkerID, jobErr, stageResults, client)
+		}
+		if err != nil {
+			fmt.Printf("Error saving the outcome of job %s: %v\n", job.ID.Hex(), err)
+		}
+	}()
+
+	if job.CIK == "" {
+		CIK, err := fetchdata.FindCIKGivenTicker(job.Ticker)
+		if err != nil {
+			return err
+		}
+		job.CIK = CIK
+	}
+	stages, err := geteverythinggivencik.SelectStages(job.Stages)
+	if err != nil {
+		return err
+	}
+
+	var failedStages []string
+	for i, stage := range stages {
+		if leaseCtx.Err() != nil {
+			return context.Cause(leaseCtx)
+		}
+		if len(failedStages) > 0 && !workerOptions.KeepGoing {
+			stageResults = append(stageResults, JobStageResult{Stage: stage.Name, Status: "skipped"})
+			continue
+		}
+
+		progress := JobProgress{Stage: stage.Name, CompletedStages: i, TotalStages: len(stages), Message: stage.Description}
+		if err := UpdateProgress(job, workerOptions.WorkerID, progress, stageResults, client); err != nil {
+			fmt.Printf("Error saving the progress of job %s: %v\n", job.ID.Hex(), err)
+			if errors.Is(err, ErrLeaseLost) {
+				return err
+			}
+		}
+
+		result := geteverythinggivencik.RunStagesContext(leaseCtx, job.CIK, []geteverythinggivencik.Stage{stage}, false, client)[0]
+		if leaseCtx.Err() != nil {
+			return context.Cause(leaseCtx)
+		}
+		stageResult := JobStageResult{Stage: result.Stage, Status: result.Status, DurationMs: result.Duration.Milliseconds()}
+		if result.Err != nil {
+			stageResult.Error = result.Err.Error()
+			failedStages = append(failedStages, stage.Name)
+		}
+		stageResults = append(stageResults, stageResult)
+	}
+
+	if len(failedStages) > 0 {
+		return fmt.Errorf("stages failed: %s", strings.Join(failedStages, ", "))
+	}
+	return nil
+}
@@ -5,66 +5,169 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
+	combinecsvfiles "github.com/Programmerdin/FinancialDataSite_Go/combineCSVfiles"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	geteverythinggivencik "github.com/Programmerdin/FinancialDataSite_Go/getEverythingGivenCIK"
+	sqlitedatabase "github.com/Programmerdin/FinancialDataSite_Go/sqliteDatabase"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 
-	combinecsvfiles "github.com/Programmerdin/FinancialDataSite_Go/combineCSVfiles"
 	"github.com/joho/godotenv"
 )
 
+// usage lists the commands, every command prints its own flags with -h
+const usage = `usage: scraper <command> [flags]
+
+pipeline, every command takes --cik or --ticker, --data-dir, --concurrency, --max-attempts, --keep-going and --dry-run:
+  fetch        store the filing metadata and download the FilingSummary files
+  categorize   find the R files of the financial statements
+  parse        download the R files and parse them into CSVs
+  combine      combine the CSVs into Level 1 statements and publish them [--statement BS]
+  all          run the stages in order [--stages fetch,categorize,parse,combine]
+  batch        run many companies on a pool of workers [--file ciks.txt] [--tickers AAPL,KO] [--index sp500] [--workers 4]
+  worker       claim and run scrape jobs from the job queue [--id worker-1] [--lease 5m]
+  jobs         add a scrape job (enqueue --cik/--ticker) or look at the queue (list, show --id)
+  pipeline     where every filing is in the pipeline (status) or run a stage again (reset --stage parsed)
+
+other commands, the ones that run for one company take --cik or --ticker:
+  reclassify, details, segments, publish, ttm, standardize, validate, reconcile, prompts, review
+  postgres     apply the migrations of POSTGRES_URL (migrate) or load a company into it (load --cik/--ticker)
+`
+
 func main() {
+	os.Exit(run())
+}
+
+// run returns the exit code, main exits after the deferred Close and Disconnect have run
+func run() int {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
 	// Load .env file
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		log.Printf("Error loading .env file: %v", err)
+		return 1
+	}
+
+	// SEC-files is a local directory unless SEC_FILES_STORE says otherwise
+	if err := storage.ConfigureFromEnv(); err != nil {
+		log.Printf("Error configuring the SEC-files store: %v", err)
+		return 1
+	}
+
+	// the filing metadata, the pipeline state and the published combined statements are in Mongo unless DATABASE_BACKEND=sqlite
+	var client *mongo.Client
+	switch strings.ToLower(os.Getenv("DATABASE_BACKEND")) {
+	case "", "mongo":
+		client, err = connectToMongoDB(mongoURIFromEnv())
+		if err != nil {
+			log.Printf("Error connecting to MongoDB: %v", err)
+			return 1
+		}
+		filingrepository.Filings = filingrepository.NewMongoFilingRepository(client)
+		combinecsvfiles.CombinedStatements = combinecsvfiles.MongoCombinedStatementStore{Client: client}
+		geteverythinggivencik.PipelineStates = geteverythinggivencik.NewMongoPipelineStateStore(client)
+	case "sqlite":
+		db, err := sqlitedatabase.Open(sqlitedatabase.PathFromEnv())
+		if err != nil {
+			log.Printf("Error opening the SQLite database: %v", err)
+			return 1
+		}
+		defer db.Close()
+		fmt.Println("Using the SQLite database", sqlitedatabase.PathFromEnv())
+		filingrepository.Filings = filingrepository.NewSQLiteFilingRepository(db)
+		combinecsvfiles.CombinedStatements = combinecsvfiles.SQLiteCombinedStatementStore{DB: db}
+		geteverythinggivencik.PipelineStates = geteverythinggivencik.NewSQLitePipelineStateStore(db)
+
+		// the job queue and the review queue are only kept in Mongo, connect when it is configured
+		if os.Getenv("MONGODB_URI") != "" || os.Getenv("mongodb_id") != "" {
+			client, err = connectToMongoDB(mongoURIFromEnv())
+			if err != nil {
+				log.Printf("Error connecting to MongoDB: %v", err)
+				return 1
+			}
+		} else {
+			fmt.Println("No MongoDB configured, jobs and reviews are not kept")
+		}
+	default:
+		log.Printf("Unknown DATABASE_BACKEND %q, expected mongo or sqlite", os.Getenv("DATABASE_BACKEND"))
+		return 2
+	}
+	if client != nil {
+		defer func() {
+			if err := client.Disconnect(context.TODO()); err != nil {
+				log.Printf("Error disconnecting from MongoDB: %v", err)
+			}
+		}()
+	}
+
+	// go run . fetch --ticker SMRT [--concurrency 5]
+	// go run . categorize --cik 0001837014
+	// go run . parse --cik 0001837014
+	// go run . all --cik 0001837014 [--stages fetch,categorize] [--data-dir /data/scraper] [--keep-going] [--dry-run]
+	// go run . batch --index sp500 [--workers 8] [--stages fetch,categorize] [--summary-file batchSummary.csv]
+	// go run . batch --file ciks.txt --tickers AAPL,KO
+	// go run . worker [--id worker-1] [--lease 5m] [--poll 10s]
+	// go run . jobs enqueue --ticker SMRT [--stages fetch,categorize] [--attempts 3]
+	// go run . jobs list [--status queued] [--cik 0001837014]
+	// go run . jobs show --id 65f1c2...
+	// go run . pipeline status --cik 0001837014
+	// go run . pipeline reset --cik 0001837014 --stage parsed [--accession 0001837014-24-000010]
+	// go run . reclassify --cik 0001837014 [--apply]
+	// go run . details --cik 0001837014 --pattern "Debt.*Maturit" --pattern "Segment"
+	// go run . segments --cik 0001837014 [--concept us-gaap:Revenues]
+	// go run . combine --cik 0001837014 [--statement IS]
+	// go run . publish --cik 0001837014
+	// go run . postgres migrate
+	// go run . postgres load --cik 0001837014
+	// go run . ttm --cik 0001837014
+	// go run . standardize --cik 0001837014
+	// go run . validate --cik 0001837014
+	// go run . reconcile --cik 0001837014
+	// go run . prompts list [--accession 0001837014-24-000010] [--limit 20]
+	// go run . prompts show --id 65f1c2...
+	// go run . review list [--cik 0001837014] [--status pending]
+	// go run . review show --cik 0001837014 --accession 0001837014-24-000010
+	// go run . review submit --cik 0001837014 --accession 0001837014-24-000010 --current-assets 9-15 --assets 9-20 --current-liabilities 22-27 --liabilities 22-31 --equity 33-40 [--other-equity 32-32]
+	if err := runCommand(os.Args[1], os.Args[2:], client); err != nil {
+		log.Print(err)
+		return 1
 	}
+	return 0
+}
 
-	// Connect to MongoDB
+// mongoURIFromEnv is MONGODB_URI, eg) mongodb://localhost:27017, or the Atlas cluster with mongodb_id and mongodb_password
+func mongoURIFromEnv() string {
+	if mongoURI := os.Getenv("MONGODB_URI"); mongoURI != "" {
+		return mongoURI
+	}
 	mongoID := os.Getenv("mongodb_id")
 	mongoPassword := os.Getenv("mongodb_password")
+	return fmt.Sprintf("mongodb+srv://%s:%s@financialdatasitecluste.scp0c5v.mongodb.net/?retryWrites=true&w=majority", mongoID, mongoPassword)
+}
+
+// connectToMongoDB connects and pings the deployment
+func connectToMongoDB(mongoURI string) (*mongo.Client, error) {
 	// Use the SetServerAPIOptions() method to set the Stable API version to 1
 	serverAPI := options.ServerAPI(options.ServerAPIVersion1)
-	// Construct the MongoDB URI using the provided credentials
-	mongoURI := fmt.Sprintf("mongodb+srv://%s:%s@financialdatasitecluste.scp0c5v.mongodb.net/?retryWrites=true&w=majority", mongoID, mongoPassword)
 	opts := options.Client().ApplyURI(mongoURI).SetServerAPIOptions(serverAPI)
 	// Create a new client and connect to the server
 	client, err := mongo.Connect(context.TODO(), opts)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	defer func() {
-		if err = client.Disconnect(context.TODO()); err != nil {
-			panic(err)
-		}
-	}()
 	// Send a ping to confirm a successful connection
-	if err := client.Database("admin").RunCommand(context.TODO(), bson.D{{"ping", 1}}).Err(); err != nil {
-		panic(err)
+	if err := client.Database("admin").RunCommand(context.TODO(), bson.D{{Key: "ping", Value: 1}}).Err(); err != nil {
+		client.Disconnect(context.TODO())
+		return nil, err
 	}
 	fmt.Println("Pinged your deployment. You successfully connected to MongoDB!")
-
-	// var KO_CIK string = "0000021344"
-	// var META_CIK string = "0001326801"
-	// var AAPL_CIK string = "0000320193"
-	var SMRT_CIK string = "0001837014"
-	// var SMRT_accessionNumber1 string = "0001104659-21-068286"
-
-	// var KO_accessionNumber1 string = "0001104659-21-068286"
-
-	// var Meta_BS_filepath string = "SEC-files\\filingSummaryAndRfiles\\0001326801\\0001326801-13-000003\\R2.csv"
-	// var Meta_IS_filepath string = "SEC-files\\filingSummaryAndRfiles\\0001326801\\0001326801-13-000003\\R4.csv"
-
-	// combinecsvfiles.GetFinancialStatementsCsvRfilePathsGivenCIK(SMRT_CIK, client)
-	// geteverythinggivencik.GetEverythingGivenCIK(SMRT_CIK, client)
-	// combinecsvfiles.CommonFieldFinderForFinancialStatementRfile(Meta_IS_filepath)
-	// combinecsvfiles.GenerateLevel1CombinedBalanceSheetsAndSaveAsCsvFileGivenCIK(SMRT_CIK, client)
-	// combinecsvfiles.GenerateLevel1CombinedBalanceSheetsAndSaveAsCsvFileGivenCIK(SMRT_CIK, client)
-	combinecsvfiles.TesterFunctionForLevel2BalanceSheets(SMRT_CIK)
-
-	// // Test OpenAI Connection
-	// if err := combinecsvfiles.TestOpenAIConnection(); err != nil {
-	// 	log.Fatal("Failed to connect to OpenAI:", err)
-	// }
+	return client, nil
 }
@@ -0,0 +1,76 @@
+package parserfiles
+
+import (
+	"fmt"
+
+	categorizefinancialstatements "github.com/Programmerdin/FinancialDataSite_Go/categorizeRfiles"
+	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// DownloadAndParseDetailRfilesGivenCIK finds the R files matching the patterns in every downloaded FilingSummary.xml of the CIK,
+// records them under detailRfiles in Mongo, downloads the missing ones and parses them into CSVs next to the financial statements
+// patterns are report name regular expressions or XBRL role URIs, see FindDetailRfilesFromFilingSummaryXML
+func DownloadAndParseDetailRfilesGivenCIK(CIK string, patterns []string, client *mongo.Client) error {
+	if len(patterns) == 0 {
+		return fmt.Errorf("no report name patterns or role URIs given")
+	}
+
+	accessionNumbers, err := categorizefinancialstatements.RetrieveAccessionNumbersThatHaveFilingSummaries(CIK)
+	if err != nil {
+		fmt.Println("Error RetrieveAccessionNumbersThatHaveFilingSummaries function:", err)
+		return err
+	}
+
+	var accessionNumbersOfDetailRfiles []string
+	var detailRfileNames []string
+	for _, accessionNumber := range accessionNumbers {
+		filingSummaryKey := storage.FilingKey(CIK, accessionNumber, "FilingSummary.xml")
+		if exists, err := storage.SECFiles.Exists(filingSummaryKey); err != nil || !exists {
+			fmt.Println("FilingSummary.xml not downloaded yet:", filingSummaryKey)
+			continue
+		}
+
+		detailRfiles, err := categorizefinancialstatements.FindDetailRfilesFromFilingSummaryXML(filingSummaryKey, patterns)
+		if err != nil {
+			fmt.Println("Error FindDetailRfilesFromFilingSummaryXML function:", err)
+			continue
+		}
+		if err := categorizefinancialstatements.SaveDetailRfileObjects(CIK, accessionNumber, detailRfiles); err != nil {
+			fmt.Println("Error SaveDetailRfileObjects function:", err)
+			return err
+		}
+
+		for _, detailRfile := range detailRfiles {
+			accessionNumbersOfDetailRfiles = append(accessionNumbersOfDetailRfiles, accessionNumber)
+			detailRfileNames = append(detailRfileNames, detailRfile.FileName)
+		}
+	}
+
+	downloadLinks, keys, err := GenerateDownloadLinksAndKeysForRfiles(CIK, accessionNumbersOfDetailRfiles, detailRfileNames)
+	if err != nil {
+		fmt.Println("Error GenerateDownloadLinksAndKeysForRfiles function:", err)
+		return err
+	}
+	if err := fetchdata.DownloadManySECFiles(downloadLinks, keys); err != nil {
+		fmt.Println("Error DownloadManySECFiles function:", err)
+		return err
+	}
+
+	var failedRfiles []string
+	for i := range detailRfileNames {
+		if exists, err := storage.SECFiles.Exists(storage.FilingKey(CIK, accessionNumbersOfDetailRfiles[i], detailRfileNames[i])); err != nil || !exists {
+			failedRfiles = append(failedRfiles, accessionNumbersOfDetailRfiles[i]+"/"+detailRfileNames[i])
+			continue
+		}
+		if err := ParseRfileAndSaveAsCSV(CIK, accessionNumbersOfDetailRfiles[i], detailRfileNames[i], client); err != nil {
+			failedRfiles = append(failedRfiles, accessionNumbersOfDetailRfiles[i]+"/"+detailRfileNames[i])
+		}
+	}
+	fmt.Printf("Parsed %d of %d detail R files\n", len(detailRfileNames)-len(failedRfiles), len(detailRfileNames))
+	if len(failedRfiles) > 0 {
+		return fmt.Errorf("failed to parse %d detail R files: %v", len(failedRfiles), failedRfiles)
+	}
+	return nil
+}
@@ -1,17 +1,13 @@
 package parserfiles
 
 import (
-	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 
 	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
-	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
-	"go.mongodb.org/mongo-driver/bson"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func DownloadRfiles(CIK string, client *mongo.Client) error {
@@ -20,12 +16,12 @@ func DownloadRfiles(CIK string, client *mongo.Client) error {
 		fmt.Println("Error RetrieveRfileNamesAndAccessionNumbersFromMongoDB function:", err)
 		return err
 	}
-	downloadLinks, filePaths, err := GenerateDownloadLinksAndFilePathsForRfiles(CIK, accessionNumbers, RfileNames)
+	downloadLinks, keys, err := GenerateDownloadLinksAndKeysForRfiles(CIK, accessionNumbers, RfileNames)
 	if err != nil {
-		fmt.Println("Error GenerateDownloadLinksAndFilePathsForRfiles function:", err)
+		fmt.Println("Error GenerateDownloadLinksAndKeysForRfiles function:", err)
 		return err
 	}
-	err = fetchdata.DownloadManySECFiles(downloadLinks, filePaths)
+	err = fetchdata.DownloadManySECFiles(downloadLinks, keys)
 	if err != nil {
 		fmt.Println("Error DownloadManySECFiles function:", err)
 		return err
@@ -34,81 +30,53 @@ func DownloadRfiles(CIK string, client *mongo.Client) error {
 	return nil
 }
 
-func GenerateDownloadLinksAndFilePathsForRfiles(CIK string, accessionNumbers []string, RfileNames []string) ([]string, []string, error) {
+// GenerateDownloadLinksAndKeysForRfiles returns the download links and storage.SECFiles keys of the R files that aren't in the store yet
+func GenerateDownloadLinksAndKeysForRfiles(CIK string, accessionNumbers []string, RfileNames []string) ([]string, []string, error) {
 	var downloadLinks []string
-	var filePaths []string
+	var keys []string
 
 	for i := 0; i < len(accessionNumbers); i++ {
-		filePath := filepath.Join("SEC-files", "filingSummaryAndRfiles", CIK, accessionNumbers[i], RfileNames[i])
+		key := storage.FilingKey(CIK, accessionNumbers[i], RfileNames[i])
 
 		// Check if the file exists already
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		exists, err := storage.SECFiles.Exists(key)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !exists {
 			downloadLink := "https://www.sec.gov/Archives/edgar/data/" + CIK + "/" + strings.Replace(accessionNumbers[i], "-", "", -1) + "/" + RfileNames[i]
 			downloadLinks = append(downloadLinks, downloadLink)
-			filePaths = append(filePaths, filePath)
-		} else if err != nil {
-			// If there's an error other than the file not existing, return the error
-			return nil, nil, err
+			keys = append(keys, key)
 		}
 		// No else needed; if the file exists, we simply don't add it to the slices
 	}
 
-	return downloadLinks, filePaths, nil
+	return downloadLinks, keys, nil
 }
 
+// RetrieveRfileNamesAndAccessionNumbersFromMongoDB returns the R files of the financial statements of every filing that has a balance sheet R file,
+// one accession number per R file
 func RetrieveRfileNamesAndAccessionNumbersFromMongoDB(CIK string, client *mongo.Client) ([]string, []string, error) {
-	collection := utilityfunctions.GetMongoDBCollection(client)
-	ctx := context.Background()
-	filter := bson.M{
-		"cik":               CIK,
-		"hasFilingSummary":  true,
-		"Rfile_BS_fileName": bson.M{"$exists": true},
-	}
-	projection := bson.M{
-		"accessionnumber":    1,
-		"Rfile_BS_fileName":  1,
-		"Rfile_IS_fileName":  1,
-		"Rfile_CIS_fileName": 1,
-		"Rfile_CF_fileName":  1,
-		"_id":                0,
-	}
-
-	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(projection))
+	filings, err := filingrepository.Filings.ListFilingsByCIK(CIK)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer cursor.Close(ctx)
 
 	var accessionNumbers []string
 	var RfileNames []string
-
-	for cursor.Next(ctx) {
-		var doc bson.M
-		if err := cursor.Decode(&doc); err != nil {
-			return nil, nil, err
-		}
-		// Collect file names and accessionNumbers if they exist in the document
-		if fileName, ok := doc["Rfile_BS_fileName"].(string); ok {
-			RfileNames = append(RfileNames, fileName)
-			accessionNumbers = append(accessionNumbers, doc["accessionnumber"].(string))
+	for _, filing := range filings {
+		if filing.HasFilingSummary == nil || !*filing.HasFilingSummary {
+			continue
 		}
-		if fileName, ok := doc["Rfile_IS_fileName"].(string); ok {
-			RfileNames = append(RfileNames, fileName)
-			accessionNumbers = append(accessionNumbers, doc["accessionnumber"].(string))
+		if _, ok := filing.Rfiles["BS"]; !ok {
+			continue
 		}
-		if fileName, ok := doc["Rfile_CIS_fileName"].(string); ok {
-			RfileNames = append(RfileNames, fileName)
-			accessionNumbers = append(accessionNumbers, doc["accessionnumber"].(string))
-		}
-		if fileName, ok := doc["Rfile_CF_fileName"].(string); ok {
-			RfileNames = append(RfileNames, fileName)
-			accessionNumbers = append(accessionNumbers, doc["accessionnumber"].(string))
+		for _, financialStatementType := range filingrepository.FinancialStatementTypes {
+			if Rfile, ok := filing.Rfiles[financialStatementType]; ok {
+				RfileNames = append(RfileNames, Rfile.FileName)
+				accessionNumbers = append(accessionNumbers, filing.AccessionNumber)
+			}
 		}
 	}
-
-	if err := cursor.Err(); err != nil {
-		return nil, nil, err
-	}
-
 	return accessionNumbers, RfileNames, nil
 }
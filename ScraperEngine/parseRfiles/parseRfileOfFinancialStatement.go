@@ -2,32 +2,37 @@ package parserfiles
 
 import (
 	"bytes"
-	"context"
 	"fmt"
 	"log"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
 	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
 	"github.com/PuerkitoBio/goquery"
 	"github.com/antchfx/xmlquery"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type StatementData struct {
-	Headers [][]string
-	Data    [][]string
+	Headers  [][]string
+	Data     [][]string
+	Concepts []string // XBRL concept of every Data row, eg) us-gaap:AccountsReceivableNetCurrent, "" when the R file doesn't link one
 }
 
-func ParseManyRfilesAndSaveAsCSVs(CIK string, client *mongo.Client) {
+// the line item cell of an htm R file links its concept: onclick="top.Show.showAR( this, 'defref_us-gaap_AccountsReceivableNetCurrent', window );"
+var defrefRegex = regexp.MustCompile(`defref_([^_']+)_([^']+)`)
+
+// ParseManyRfilesAndSaveAsCSVs parses the R files of the CIK that don't have a CSV yet,
+// it keeps going when one fails and returns the ones that failed in one error
+func ParseManyRfilesAndSaveAsCSVs(CIK string, client *mongo.Client) error {
 	accesionNumbers, Rfilenames, err := RetrieveRfileNamesAndAccessionNumbersFromMongoDB(CIK, client)
 	if err != nil {
 		fmt.Println("Error RetrieveRfileNamesAndAccessionNumbersFromMongoDB function:", err)
-		return
+		return err
 	}
 
 	var accessionNumbers_to_parse []string
@@ -38,17 +43,27 @@ func ParseManyRfilesAndSaveAsCSVs(CIK string, client *mongo.Client) {
 		if ext == ".htm" || ext == ".html" || ext == ".xml" {
 			RfileName_CSV = strings.TrimSuffix(Rfilenames[i], ext) + ".csv"
 		}
-		filePath := filepath.Join("SEC-files", "filingSummaryAndRfiles", CIK, accesionNumbers[i], RfileName_CSV)
-
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		exists, err := storage.SECFiles.Exists(storage.FilingKey(CIK, accesionNumbers[i], RfileName_CSV))
+		if err != nil {
+			fmt.Println("Error checking file existence:", err)
+			return err
+		}
+		if !exists {
 			accessionNumbers_to_parse = append(accessionNumbers_to_parse, accesionNumbers[i])
 			Rfilenames_to_parse = append(Rfilenames_to_parse, Rfilenames[i])
 		}
 	}
 
+	var failedRfiles []string
 	for i := 0; i < len(accessionNumbers_to_parse); i++ {
-		ParseRfileAndSaveAsCSV(CIK, accessionNumbers_to_parse[i], Rfilenames_to_parse[i], client)
+		if err := ParseRfileAndSaveAsCSV(CIK, accessionNumbers_to_parse[i], Rfilenames_to_parse[i], client); err != nil {
+			failedRfiles = append(failedRfiles, accessionNumbers_to_parse[i]+"/"+Rfilenames_to_parse[i])
+		}
+	}
+	if len(failedRfiles) > 0 {
+		return fmt.Errorf("failed to parse %d of %d R files: %v", len(failedRfiles), len(accessionNumbers_to_parse), failedRfiles)
 	}
+	return nil
 }
 
 func ParseRfileAndSaveAsCSV(CIK, accessionNumber, RfileName string, client *mongo.Client) error {
@@ -79,7 +94,7 @@ func ParseRfileAndSaveAsCSV(CIK, accessionNumber, RfileName string, client *mong
 
 	err = saveParsedRfileAsCSV(&cleanParsedRfile, CIK, accessionNumber, RfileName)
 	if err != nil {
-		log.Fatalf("Failed to save CSV: %v", err)
+		fmt.Printf("Failed to save CSV: %v\n", err)
 		return err
 	}
 
@@ -87,16 +102,15 @@ func ParseRfileAndSaveAsCSV(CIK, accessionNumber, RfileName string, client *mong
 }
 
 func ParseHtmRfile(CIK, accessionNumber, RfileName string) (StatementData, error) {
-	RfilePath := filepath.Join("SEC-files", "filingSummaryAndRfiles", CIK, accessionNumber, RfileName)
-	file, err := os.Open(RfilePath)
+	RfileKey := storage.FilingKey(CIK, accessionNumber, RfileName)
+	htmBytes, err := storage.SECFiles.Get(RfileKey)
 	if err != nil {
-		log.Fatalf("could not open file %s: %v", RfilePath, err)
+		return StatementData{}, fmt.Errorf("could not open file %s: %v", RfileKey, err)
 	}
-	defer file.Close()
 
-	doc, err := goquery.NewDocumentFromReader(file)
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(htmBytes))
 	if err != nil {
-		log.Fatalf("could not create goquery document: %v", err)
+		return StatementData{}, fmt.Errorf("could not create goquery document: %v", err)
 	}
 
 	statementData := StatementData{
@@ -135,6 +149,11 @@ func ParseHtmRfile(CIK, accessionNumber, RfileName string) (StatementData, error
 			})
 			statementData.Headers = append(statementData.Headers, rowData)
 		} else {
+			concept := ""
+			if matches := defrefRegex.FindStringSubmatch(cols.First().Find("a[onclick]").AttrOr("onclick", "")); len(matches) == 3 {
+				concept = matches[1] + ":" + matches[2]
+			}
+			statementData.Concepts = append(statementData.Concepts, concept)
 			cols.Each(func(i int, el *goquery.Selection) {
 				text := el.Text()
 				text = strings.TrimSpace(text)
@@ -173,24 +192,32 @@ func ParseHtmRfile(CIK, accessionNumber, RfileName string) (StatementData, error
 	}
 
 	// Remove rows that only have empty string
-	filterRows := func(rows [][]string) [][]string {
-		filtered := [][]string{}
-		for _, row := range rows {
-			notEmpty := false
-			for _, cell := range row {
-				if strings.TrimSpace(cell) != "" {
-					notEmpty = true
-					break
-				}
-			}
-			if notEmpty {
-				filtered = append(filtered, row)
+	isRowEmpty := func(row []string) bool {
+		for _, cell := range row {
+			if strings.TrimSpace(cell) != "" {
+				return false
 			}
 		}
-		return filtered
+		return true
+	}
+	filteredHeaders := [][]string{}
+	for _, row := range statementData.Headers {
+		if !isRowEmpty(row) {
+			filteredHeaders = append(filteredHeaders, row)
+		}
 	}
-	statementData.Headers = filterRows(statementData.Headers)
-	statementData.Data = filterRows(statementData.Data)
+	statementData.Headers = filteredHeaders
+	// keep the concepts in line with the data rows
+	filteredData := [][]string{}
+	filteredConcepts := []string{}
+	for i, row := range statementData.Data {
+		if !isRowEmpty(row) {
+			filteredData = append(filteredData, row)
+			filteredConcepts = append(filteredConcepts, statementData.Concepts[i])
+		}
+	}
+	statementData.Data = filteredData
+	statementData.Concepts = filteredConcepts
 
 	// Check if every row is the same as total_column_count
 	checkRowLengths := func(rows [][]string) bool {
@@ -211,8 +238,8 @@ func ParseHtmRfile(CIK, accessionNumber, RfileName string) (StatementData, error
 
 	isEveryRowLengthSame := headersAllSameLength && dataAllSameLength
 	if !isEveryRowLengthSame {
-		fmt.Printf("CIK: %s, AccessionNumber: %s, RfileName: %s\n", CIK, accessionNumber, RfileName)
-		log.Fatal("Error: Not all rows have the same length, problem during parsing HTM")
+		// detail R files have irregular tables more often than financial statements, skip the file instead of stopping the whole run
+		return statementData, fmt.Errorf("CIK: %s, AccessionNumber: %s, RfileName: %s - not all rows have the same length, problem during parsing HTM", CIK, accessionNumber, RfileName)
 	}
 
 	return statementData, nil
@@ -224,8 +251,7 @@ func ParseXmlRfile(CIK, accessionNumber, RfileName string) (StatementData, error
 		Headers: [][]string{},
 		Data:    [][]string{},
 	}
-	filePath := filepath.Join("SEC-files/filingSummaryAndRfiles", CIK, accessionNumber, RfileName)
-	xmlBytes, err := os.ReadFile(filePath)
+	xmlBytes, err := storage.SECFiles.Get(storage.FilingKey(CIK, accessionNumber, RfileName))
 	if err != nil {
 		// handle error
 		return statementData, err
@@ -281,6 +307,14 @@ func ParseXmlRfile(CIK, accessionNumber, RfileName string) (StatementData, error
 	for i := 0; i < len(RowLabelNodes); i++ {
 		statementData.Data[i] = append(statementData.Data[i], RowLabelNodes[i].InnerText())
 	}
+	//Add the concept of each line item, ElementName looks like us-gaap_AccountsReceivableNetCurrent
+	for _, RowNode := range RowNodes {
+		concept := ""
+		if ElementNameNode := xmlquery.FindOne(RowNode, "./ElementName"); ElementNameNode != nil {
+			concept = strings.Replace(strings.TrimSpace(ElementNameNode.InnerText()), "_", ":", 1)
+		}
+		statementData.Concepts = append(statementData.Concepts, concept)
+	}
 
 	//How many cells per row excluding name of the line item (aka Label)
 	CellNodes := xmlquery.Find(doc, "//Rows/Row[2]/Cells/Cell")
@@ -303,6 +337,7 @@ func ParseXmlRfile(CIK, accessionNumber, RfileName string) (StatementData, error
 	if check {
 		//remove first row of statementData.Data
 		statementData.Data = statementData.Data[1:]
+		statementData.Concepts = statementData.Concepts[1:]
 	}
 
 	//Deal with CURRENT ASSET and CURRENT LIABILITY rows
@@ -335,6 +370,7 @@ func ParseXmlRfile(CIK, accessionNumber, RfileName string) (StatementData, error
 		isLineItem0OrEmpty := statementData.Data[i][1] == "0" || statementData.Data[i][1] == ""
 		if isLineItemAbstract && isLineItem0OrEmpty {
 			statementData.Data = append(statementData.Data[:i], statementData.Data[i+1:]...)
+			statementData.Concepts = append(statementData.Concepts[:i], statementData.Concepts[i+1:]...)
 		}
 	}
 
@@ -415,6 +451,7 @@ func CleanParsedRfile(statementData *StatementData, accessionNumber string, clie
 
 	copy(statementDataClean.Headers, statementDataArray[:len(statementData.Headers)])
 	copy(statementDataClean.Data, statementDataArray[len(statementData.Headers):])
+	statementDataClean.Concepts = statementData.Concepts
 
 	// Create and process denomination row
 	denominationRow := make([]string, len(statementDataArray[0]))
@@ -551,37 +588,25 @@ func CleanParsedRfile(statementData *StatementData, accessionNumber string, clie
 	return statementDataClean
 }
 
-// FindReportDateAndFormGivenAccessionNumber finds the report date and form type for a given accession number from MongoDB
+// FindReportDateAndFormGivenAccessionNumber finds the report date and form type for a given accession number from the filing repository
 func FindReportDateAndFormGivenAccessionNumber(accessionNumber string, client *mongo.Client) (ReportDate string, Form string, err error) {
-	collection := utilityfunctions.GetMongoDBCollection(client)
-
-	filter := bson.M{"accessionnumber": accessionNumber}
-	var result bson.M
-	err = collection.FindOne(context.Background(), filter).Decode(&result)
+	filing, err := filingrepository.Filings.GetFiling(accessionNumber)
 	if err != nil {
 		return "", "", err
 	}
-	reportDate, _ := result["reportdate"].(string)
-	form, _ := result["form"].(string)
-
+	reportDate := filing.ReportDate
 	if reportDate != "" {
 		reportDate = utilityfunctions.ConvertDateStringToYYYYMMDD(reportDate)
 	}
 
-	return reportDate, form, nil
+	return reportDate, filing.Form, nil
 }
 
 // saveParsedRfileAsCSV saves the parsed R file as a CSV
 func saveParsedRfileAsCSV(statementData *StatementData, CIK string, accessionNumber string, RfileName string) error {
 	re := regexp.MustCompile(`\.(html|htm|xml|xbrl)$`)
 	csvFileName := re.ReplaceAllString(RfileName, ".csv")
-	outputDirPath := filepath.Join("SEC-files", "filingSummaryAndRfiles", CIK, accessionNumber)
-	outputFilePath := filepath.Join(outputDirPath, csvFileName)
-
-	// Ensure that the directory exists
-	if err := os.MkdirAll(outputDirPath, 0755); err != nil {
-		return fmt.Errorf("error creating directories: %w", err)
-	}
+	outputKey := storage.FilingKey(CIK, accessionNumber, csvFileName)
 
 	csvLines := []string{}
 
@@ -611,12 +636,42 @@ func saveParsedRfileAsCSV(statementData *StatementData, CIK string, accessionNum
 	content := append(bom, []byte(csvContent)...)
 
 	// Write CSV string to a file with UTF-8 BOM
-	err := os.WriteFile(outputFilePath, content, 0644)
+	err := storage.SECFiles.Put(outputKey, content)
 	if err != nil {
 		return fmt.Errorf("error writing CSV file: %w", err)
 	}
 
-	fmt.Printf("CSV file has been saved to %s\n", outputFilePath)
+	fmt.Printf("CSV file has been saved to %s\n", outputKey)
+
+	return saveLineItemConceptsAsCSV(statementData, strings.TrimSuffix(outputKey, ".csv")+"_concepts.csv")
+}
+
+// saveLineItemConceptsAsCSV saves the concept of every line item next to the CSV of the R file, eg) R2_concepts.csv,
+// one lineItem,concept row per data row in the same order so line items with the same name can still be told apart
+func saveLineItemConceptsAsCSV(statementData *StatementData, outputKey string) error {
+	hasConcept := false
+	for _, concept := range statementData.Concepts {
+		if concept != "" {
+			hasConcept = true
+			break
+		}
+	}
+	if !hasConcept {
+		return nil
+	}
+	if len(statementData.Concepts) != len(statementData.Data) {
+		// the concepts would be saved next to the wrong line items
+		return fmt.Errorf("%s: %d concepts for %d line items", outputKey, len(statementData.Concepts), len(statementData.Data))
+	}
+
+	csvLines := []string{"lineItem,concept"}
+	for i, dataRow := range statementData.Data {
+		// same escaping as the line item cell of the R file CSV so the names match
+		csvLines = append(csvLines, escapeCsvCell(dataRow[0], true, true)+","+escapeCsvCell(statementData.Concepts[i], true, true))
+	}
+	if err := storage.SECFiles.Put(outputKey, []byte(strings.Join(csvLines, "\n"))); err != nil {
+		return fmt.Errorf("error writing concepts CSV file: %w", err)
+	}
 	return nil
 }
 
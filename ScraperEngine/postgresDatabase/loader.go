@@ -0,0 +1,134 @@
+package postgresdatabase
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	combinecsvfiles "github.com/Programmerdin/FinancialDataSite_Go/combineCSVfiles"
+	filingrepository "github.com/Programmerdin/FinancialDataSite_Go/filingRepository"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// LoadCIK loads the filings of the CIK from filingrepository.Filings and its published combined statements into Postgres.
+// Everything is done in one transaction, a CIK that is loaded again has its statements replaced
+func LoadCIK(ctx context.Context, pool *pgxpool.Pool, CIK string) error {
+	filings, err := filingrepository.Filings.ListFilingsByCIK(CIK)
+	if err != nil {
+		fmt.Println("Error ListFilingsByCIK function:", err)
+		return err
+	}
+	docs, err := combinecsvfiles.ReadCombinedStatementDocsGivenCIK(CIK)
+	if err != nil {
+		return err
+	}
+
+	return pgx.BeginFunc(ctx, pool, func(tx pgx.Tx) error {
+		for _, filing := range filings {
+			if err := upsertFiling(ctx, tx, filing); err != nil {
+				return fmt.Errorf("filing %s: %w", filing.AccessionNumber, err)
+			}
+		}
+		for _, doc := range docs {
+			values, err := loadStatement(ctx, tx, doc)
+			if err != nil {
+				return fmt.Errorf("%s of %s: %w", doc.FinancialStatementType, CIK, err)
+			}
+			fmt.Printf("Loaded %s Level %d of %s into Postgres with %d columns and %d values\n", doc.FinancialStatementType, doc.Level, CIK, len(doc.Columns), values)
+		}
+		fmt.Printf("Loaded %d filings of %s into Postgres\n", len(filings), CIK)
+		return nil
+	})
+}
+
+func upsertFiling(ctx context.Context, tx pgx.Tx, filing filingrepository.Filing) error {
+	var size *int64
+	if parsed, err := strconv.ParseInt(filing.Size, 10, 64); err == nil {
+		size = &parsed
+	}
+	var acceptanceDateTime *time.Time
+	if parsed, err := time.Parse(time.RFC3339, filing.AcceptanceDateTime); err == nil {
+		acceptanceDateTime = &parsed
+	}
+	_, err := tx.Exec(ctx, `INSERT INTO filings (accession_number, cik, form, filing_date, report_date, acceptance_date_time, act, file_number, film_number, items, size, has_filing_summary)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (accession_number) DO UPDATE SET
+			cik = excluded.cik, form = excluded.form, filing_date = excluded.filing_date, report_date = excluded.report_date,
+			acceptance_date_time = excluded.acceptance_date_time, act = excluded.act, file_number = excluded.file_number,
+			film_number = excluded.film_number, items = excluded.items, size = excluded.size, has_filing_summary = excluded.has_filing_summary`,
+		filing.AccessionNumber, filing.CIK, filing.Form, parseDate(filing.FilingDate), parseDate(filing.ReportDate), acceptanceDateTime,
+		filing.Act, filing.FileNumber, filing.FilmNumber, filing.Items, size, filing.HasFilingSummary)
+	return err
+}
+
+// loadStatement replaces the statement of the CIK and type with doc and returns the number of values loaded
+func loadStatement(ctx context.Context, tx pgx.Tx, doc combinecsvfiles.CombinedStatementDoc) (int, error) {
+	_, err := tx.Exec(ctx, `DELETE FROM statements WHERE cik = $1 AND financial_statement_type = $2`, doc.CIK, doc.FinancialStatementType)
+	if err != nil {
+		return 0, err
+	}
+	var statementID int64
+	err = tx.QueryRow(ctx, `INSERT INTO statements (cik, financial_statement_type, level, source_file) VALUES ($1, $2, $3, $4) RETURNING statement_id`,
+		doc.CIK, doc.FinancialStatementType, doc.Level, doc.Provenance.SourceFile).Scan(&statementID)
+	if err != nil {
+		return 0, err
+	}
+
+	columnRows := make([][]any, 0, len(doc.Columns))
+	for i, column := range doc.Columns {
+		var durationMonths *int
+		if parsed, err := strconv.Atoi(column.ReportDurationInMonths); err == nil {
+			durationMonths = &parsed
+		}
+		valueSource := column.ValueSource
+		if valueSource == "" {
+			valueSource = "reported"
+		}
+		columnRows = append(columnRows, []any{statementID, i, column.AccessionNumber, column.Form, parseDate(column.ReportDate), parseDate(column.ReportPeriod), durationMonths, valueSource})
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"statement_columns"},
+		[]string{"statement_id", "column_index", "accession_number", "form", "report_date", "report_period", "duration_months", "value_source"},
+		pgx.CopyFromRows(columnRows))
+	if err != nil {
+		return 0, err
+	}
+
+	lineItems := combinecsvfiles.GetCombinedStatementLineItems(doc.Data)
+	lineItemRows := make([][]any, 0, len(lineItems))
+	var valueRows [][]any
+	for _, lineItem := range lineItems {
+		lineItemRows = append(lineItemRows, []any{statementID, lineItem.RowIndex, lineItem.Name, lineItem.Heading})
+		for columnIndex, cell := range lineItem.Values {
+			if columnIndex >= len(doc.Columns) {
+				continue
+			}
+			var value pgtype.Numeric
+			if err := value.Scan(cell); err != nil {
+				continue
+			}
+			valueRows = append(valueRows, []any{statementID, lineItem.RowIndex, columnIndex, value})
+		}
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"line_items"}, []string{"statement_id", "row_index", "name", "heading"}, pgx.CopyFromRows(lineItemRows))
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"line_item_values"}, []string{"statement_id", "row_index", "column_index", "value"}, pgx.CopyFromRows(valueRows))
+	if err != nil {
+		return 0, err
+	}
+	return len(valueRows), nil
+}
+
+// parseDate reads the dates of the submissions file (2024-09-28) and of the CSVs (20240928), nil when the date is empty or can't be read
+func parseDate(date string) *time.Time {
+	for _, layout := range []string{"2006-01-02", "20060102"} {
+		if parsed, err := time.Parse(layout, date); err == nil {
+			return &parsed
+		}
+	}
+	return nil
+}
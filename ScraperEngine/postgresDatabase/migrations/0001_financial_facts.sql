@@ -0,0 +1,74 @@
+-- the filings of every CIK, as in the filing repository
+CREATE TABLE filings (
+	accession_number TEXT PRIMARY KEY,
+	cik TEXT NOT NULL,
+	form TEXT NOT NULL,
+	filing_date DATE,
+	report_date DATE,
+	acceptance_date_time TIMESTAMPTZ,
+	act TEXT NOT NULL DEFAULT '',
+	file_number TEXT NOT NULL DEFAULT '',
+	film_number TEXT NOT NULL DEFAULT '',
+	items TEXT NOT NULL DEFAULT '',
+	size BIGINT,
+	has_filing_summary BOOLEAN
+);
+CREATE INDEX filings_cik_report_date ON filings (cik, report_date);
+
+-- one row per published combined statement (BS, IS, CF) of a CIK, loading a CIK again replaces its statements
+CREATE TABLE statements (
+	statement_id BIGSERIAL PRIMARY KEY,
+	cik TEXT NOT NULL,
+	financial_statement_type TEXT NOT NULL,
+	level INTEGER NOT NULL,
+	source_file TEXT NOT NULL,
+	loaded_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (cik, financial_statement_type)
+);
+
+-- the columns of a statement, each is one report period of one filing
+CREATE TABLE statement_columns (
+	statement_id BIGINT NOT NULL REFERENCES statements (statement_id) ON DELETE CASCADE,
+	column_index INTEGER NOT NULL,
+	accession_number TEXT NOT NULL,
+	form TEXT NOT NULL,
+	report_date DATE,
+	report_period DATE,
+	duration_months INTEGER,
+	value_source TEXT NOT NULL,
+	PRIMARY KEY (statement_id, column_index)
+);
+CREATE INDEX statement_columns_accession_number ON statement_columns (accession_number);
+
+-- the line items of a statement in the order of the CSV, heading is the heading row above it (eg "Current assets:")
+CREATE TABLE line_items (
+	statement_id BIGINT NOT NULL REFERENCES statements (statement_id) ON DELETE CASCADE,
+	row_index INTEGER NOT NULL,
+	name TEXT NOT NULL,
+	heading TEXT NOT NULL,
+	PRIMARY KEY (statement_id, row_index)
+);
+
+-- the value of a line item in a column, cells that aren't a number have no row
+CREATE TABLE line_item_values (
+	statement_id BIGINT NOT NULL,
+	row_index INTEGER NOT NULL,
+	column_index INTEGER NOT NULL,
+	value NUMERIC NOT NULL,
+	PRIMARY KEY (statement_id, row_index, column_index),
+	FOREIGN KEY (statement_id, row_index) REFERENCES line_items (statement_id, row_index) ON DELETE CASCADE,
+	FOREIGN KEY (statement_id, column_index) REFERENCES statement_columns (statement_id, column_index) ON DELETE CASCADE
+);
+
+-- one row per value with everything about it, for ad-hoc queries and joins with pricing tables on cik and report_period
+CREATE VIEW financial_facts AS
+SELECT s.cik, s.financial_statement_type, s.level,
+	li.row_index, li.heading, li.name AS line_item,
+	c.column_index, c.accession_number, c.form, c.report_date, c.report_period, c.duration_months, c.value_source,
+	f.filing_date,
+	v.value
+FROM line_item_values v
+JOIN line_items li ON li.statement_id = v.statement_id AND li.row_index = v.row_index
+JOIN statement_columns c ON c.statement_id = v.statement_id AND c.column_index = v.column_index
+JOIN statements s ON s.statement_id = v.statement_id
+LEFT JOIN filings f ON f.accession_number = c.accession_number;
@@ -0,0 +1,110 @@
+// Dimensional (axis/member) facts such as revenue by product or by geography.
+// R files flatten these into label rows, so they are read from the XBRL instance document of each filing instead
+package segmentdata
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	fetchdata "github.com/Programmerdin/FinancialDataSite_Go/fetchDataFolder"
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	"github.com/tidwall/gjson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// files of the filing directory that end in .xml but are not the instance document
+var nonInstanceXmlFilePattern = regexp.MustCompile(`(?i)(^FilingSummary\.xml$|^R\d+\.xml$|_(cal|def|lab|pre)\.xml$)`)
+
+// DownloadXbrlInstanceFilesGivenCIK downloads index.json and the XBRL instance document of every filing that has a FilingSummary
+// and returns accessionNumber -> key of the instance document
+func DownloadXbrlInstanceFilesGivenCIK(CIK string, client *mongo.Client) (map[string]string, error) {
+	accessionNumbers, err := fetchdata.RetrieveAccessionNumbersThatHaveFilingSummary(CIK, client)
+	if err != nil {
+		fmt.Println("Error RetrieveAccessionNumbersThatHaveFilingSummary function:", err)
+		return nil, err
+	}
+
+	// index.json lists every file of the filing, it is the only reliable way to find the instance document name
+	var indexJsonLinks []string
+	var indexJsonKeys []string
+	for _, accessionNumber := range accessionNumbers {
+		indexJsonKey := storage.FilingKey(CIK, accessionNumber, "index.json")
+		exists, err := storage.SECFiles.Exists(indexJsonKey)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			indexJsonLinks = append(indexJsonLinks, filingDirectoryUrl(CIK, accessionNumber)+"index.json")
+			indexJsonKeys = append(indexJsonKeys, indexJsonKey)
+		}
+	}
+	if err := fetchdata.DownloadManySECFiles(indexJsonLinks, indexJsonKeys); err != nil {
+		fmt.Println("Error DownloadManySECFiles function:", err)
+		return nil, err
+	}
+
+	instanceFileKeys := make(map[string]string)
+	var instanceLinks []string
+	var instanceKeys []string
+	for _, accessionNumber := range accessionNumbers {
+		indexJsonKey := storage.FilingKey(CIK, accessionNumber, "index.json")
+		instanceFileName, err := FindXbrlInstanceFileNameInIndexJson(indexJsonKey)
+		if err != nil {
+			fmt.Printf("accession number %s: %v\n", accessionNumber, err)
+			continue
+		}
+
+		instanceKey := storage.FilingKey(CIK, accessionNumber, instanceFileName)
+		instanceFileKeys[accessionNumber] = instanceKey
+		exists, err := storage.SECFiles.Exists(instanceKey)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			instanceLinks = append(instanceLinks, filingDirectoryUrl(CIK, accessionNumber)+instanceFileName)
+			instanceKeys = append(instanceKeys, instanceKey)
+		}
+	}
+	if err := fetchdata.DownloadManySECFiles(instanceLinks, instanceKeys); err != nil {
+		fmt.Println("Error DownloadManySECFiles function:", err)
+		return nil, err
+	}
+
+	return instanceFileKeys, nil
+}
+
+// FindXbrlInstanceFileNameInIndexJson picks the instance document out of the file list of a filing
+// inline XBRL filings have an extracted instance named like aapl-20230930_htm.xml, older filings have aapl-20120929.xml
+func FindXbrlInstanceFileNameInIndexJson(indexJsonKey string) (string, error) {
+	jsonString, err := fetchdata.ReadJsonFile(indexJsonKey)
+	if err != nil {
+		return "", err
+	}
+	if !gjson.Valid(jsonString) {
+		return "", fmt.Errorf("invalid json %v", indexJsonKey)
+	}
+
+	var candidates []string
+	gjson.Get(jsonString, "directory.item").ForEach(func(key, value gjson.Result) bool {
+		name := value.Get("name").String()
+		if strings.HasSuffix(strings.ToLower(name), ".xml") && !nonInstanceXmlFilePattern.MatchString(name) {
+			candidates = append(candidates, name)
+		}
+		return true
+	})
+
+	for _, name := range candidates {
+		if strings.HasSuffix(strings.ToLower(name), "_htm.xml") {
+			return name, nil
+		}
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no XBRL instance document found in %s", indexJsonKey)
+	}
+	return candidates[0], nil
+}
+
+func filingDirectoryUrl(CIK string, accessionNumber string) string {
+	return "https://www.sec.gov/Archives/edgar/data/" + CIK + "/" + strings.Replace(accessionNumber, "-", "", -1) + "/"
+}
@@ -0,0 +1,167 @@
+package segmentdata
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	"github.com/antchfx/xmlquery"
+)
+
+// AxisMember is one dimension of a fact, eg) srt:ProductOrServiceAxis = us-gaap:ProductMember
+type AxisMember struct {
+	Axis   string `bson:"axis"`
+	Member string `bson:"member"`
+}
+
+// DimensionalFact is a numeric fact of the instance document whose context has at least one axis/member pair
+type DimensionalFact struct {
+	CIK              string       `bson:"cik"`
+	AccessionNumber  string       `bson:"accessionNumber"`
+	FilingPeriodEnd  string       `bson:"filingPeriodEnd"` // dei:DocumentPeriodEndDate of the filing, used to prefer restated values
+	Concept          string       `bson:"concept"`
+	Dimensions       []AxisMember `bson:"dimensions"`
+	DimensionsKey    string       `bson:"dimensionsKey"`
+	PeriodStart      string       `bson:"periodStart"` // empty for instant facts
+	PeriodEnd        string       `bson:"periodEnd"`
+	DurationInMonths int          `bson:"durationInMonths"`
+	Value            string       `bson:"value"`
+	Unit             string       `bson:"unit"`
+	Decimals         string       `bson:"decimals"`
+}
+
+type xbrlContext struct {
+	dimensions  []AxisMember
+	periodStart string
+	periodEnd   string
+}
+
+// ParseDimensionalFactsFromXbrlInstanceFile returns every numeric fact of the instance document that carries axis/member dimensions
+func ParseDimensionalFactsFromXbrlInstanceFile(instanceKey string, CIK string, accessionNumber string) ([]DimensionalFact, error) {
+	data, err := storage.SECFiles.Get(instanceKey)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", instanceKey, err)
+	}
+
+	doc, err := xmlquery.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing XBRL instance %s: %w", instanceKey, err)
+	}
+
+	contexts := make(map[string]xbrlContext)
+	for _, contextNode := range xmlquery.Find(doc, "//*[local-name()='context']") {
+		var context xbrlContext
+		for _, memberNode := range xmlquery.Find(contextNode, ".//*[local-name()='explicitMember' or local-name()='typedMember']") {
+			context.dimensions = append(context.dimensions, AxisMember{
+				Axis:   memberNode.SelectAttr("dimension"),
+				Member: strings.TrimSpace(memberNode.InnerText()),
+			})
+		}
+		if len(context.dimensions) == 0 {
+			continue // only dimensional facts are captured here, the R files already have the rest
+		}
+		sort.Slice(context.dimensions, func(i, j int) bool {
+			return context.dimensions[i].Axis < context.dimensions[j].Axis
+		})
+
+		if instant := xmlquery.FindOne(contextNode, ".//*[local-name()='instant']"); instant != nil {
+			context.periodEnd = xbrlDateToYYYYMMDD(instant.InnerText())
+		} else {
+			if startDate := xmlquery.FindOne(contextNode, ".//*[local-name()='startDate']"); startDate != nil {
+				context.periodStart = xbrlDateToYYYYMMDD(startDate.InnerText())
+			}
+			if endDate := xmlquery.FindOne(contextNode, ".//*[local-name()='endDate']"); endDate != nil {
+				context.periodEnd = xbrlDateToYYYYMMDD(endDate.InnerText())
+			}
+		}
+		contexts[contextNode.SelectAttr("id")] = context
+	}
+
+	units := make(map[string]string)
+	for _, unitNode := range xmlquery.Find(doc, "//*[local-name()='unit']") {
+		var measures []string
+		for _, measureNode := range xmlquery.Find(unitNode, ".//*[local-name()='measure']") {
+			measure := strings.TrimSpace(measureNode.InnerText())
+			// iso4217:USD -> USD
+			if index := strings.Index(measure, ":"); index != -1 {
+				measure = measure[index+1:]
+			}
+			measures = append(measures, measure)
+		}
+		units[unitNode.SelectAttr("id")] = strings.Join(measures, "/")
+	}
+
+	var filingPeriodEnd string
+	if documentPeriodEndDate := xmlquery.FindOne(doc, "//*[local-name()='DocumentPeriodEndDate']"); documentPeriodEndDate != nil {
+		filingPeriodEnd = xbrlDateToYYYYMMDD(documentPeriodEndDate.InnerText())
+	}
+
+	var facts []DimensionalFact
+	for _, factNode := range xmlquery.Find(doc, "//*[@contextRef and @unitRef]") {
+		context, ok := contexts[factNode.SelectAttr("contextRef")]
+		if !ok {
+			continue
+		}
+		value := strings.TrimSpace(factNode.InnerText())
+		if value == "" || factNode.SelectAttr("xsi:nil") == "true" {
+			continue
+		}
+
+		concept := factNode.Data
+		if factNode.Prefix != "" {
+			concept = factNode.Prefix + ":" + factNode.Data
+		}
+		facts = append(facts, DimensionalFact{
+			CIK:              CIK,
+			AccessionNumber:  accessionNumber,
+			FilingPeriodEnd:  filingPeriodEnd,
+			Concept:          concept,
+			Dimensions:       context.dimensions,
+			DimensionsKey:    DimensionsKey(context.dimensions),
+			PeriodStart:      context.periodStart,
+			PeriodEnd:        context.periodEnd,
+			DurationInMonths: durationInMonths(context.periodStart, context.periodEnd),
+			Value:            value,
+			Unit:             units[factNode.SelectAttr("unitRef")],
+			Decimals:         factNode.SelectAttr("decimals"),
+		})
+	}
+
+	return facts, nil
+}
+
+// DimensionsKey turns the axis/member pairs into one string so facts with the same dimensions can be grouped
+func DimensionsKey(dimensions []AxisMember) string {
+	pairs := make([]string, len(dimensions))
+	for i, dimension := range dimensions {
+		pairs[i] = dimension.Axis + "=" + dimension.Member
+	}
+	return strings.Join(pairs, ";")
+}
+
+// 2023-09-30 -> 20230930
+func xbrlDateToYYYYMMDD(date string) string {
+	return strings.ReplaceAll(strings.TrimSpace(date), "-", "")
+}
+
+// durationInMonths rounds the number of days between the two dates to months, instant facts return 0
+func durationInMonths(periodStart string, periodEnd string) int {
+	if periodStart == "" || periodEnd == "" {
+		return 0
+	}
+	start, err := time.Parse("20060102", periodStart)
+	if err != nil {
+		return 0
+	}
+	end, err := time.Parse("20060102", periodEnd)
+	if err != nil {
+		return 0
+	}
+	// XBRL end dates are inclusive, add a day so a Jan 1 - Mar 31 context is exactly 3 months
+	days := end.AddDate(0, 0, 1).Sub(start).Hours() / 24
+	return int(math.Round(days / (365.25 / 12)))
+}
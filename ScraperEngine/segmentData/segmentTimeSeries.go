@@ -0,0 +1,220 @@
+package segmentdata
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Programmerdin/FinancialDataSite_Go/storage"
+	utilityfunctions "github.com/Programmerdin/FinancialDataSite_Go/utilityFunctions"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SegmentTimeSeries is one concept broken down by one set of axis/member pairs across every filing of a CIK
+type SegmentTimeSeries struct {
+	Concept    string
+	Dimensions []AxisMember
+	Unit       string
+	Values     map[SegmentPeriod]string
+}
+
+// SegmentPeriod is one column of the time series, instant facts have DurationInMonths 0
+type SegmentPeriod struct {
+	PeriodEnd        string
+	DurationInMonths int
+}
+
+func getSegmentFactsCollection(client *mongo.Client) *mongo.Collection {
+	return utilityfunctions.GetMongoDBCollectionByName(client, "SegmentFactsCollection", "segmentFacts")
+}
+
+// CaptureDimensionalFactsGivenCIK downloads the instance document of every filing of the CIK and saves its dimensional facts to Mongo
+func CaptureDimensionalFactsGivenCIK(CIK string, client *mongo.Client) error {
+	instanceFileKeys, err := DownloadXbrlInstanceFilesGivenCIK(CIK, client)
+	if err != nil {
+		return err
+	}
+
+	var failedAccessionNumbers []string
+	for accessionNumber, instanceFileKey := range instanceFileKeys {
+		facts, err := ParseDimensionalFactsFromXbrlInstanceFile(instanceFileKey, CIK, accessionNumber)
+		if err != nil {
+			fmt.Println(err)
+			failedAccessionNumbers = append(failedAccessionNumbers, accessionNumber)
+			continue
+		}
+		if err := SaveDimensionalFactsToMongoDB(facts, client); err != nil {
+			return err
+		}
+		fmt.Printf("accession number %s: saved %d dimensional facts\n", accessionNumber, len(facts))
+	}
+
+	if len(failedAccessionNumbers) > 0 {
+		return fmt.Errorf("failed to parse the XBRL instance of %d filings: %v", len(failedAccessionNumbers), failedAccessionNumbers)
+	}
+	return nil
+}
+
+// SaveDimensionalFactsToMongoDB upserts the facts, running it twice on the same filing doesn't create duplicates
+func SaveDimensionalFactsToMongoDB(facts []DimensionalFact, client *mongo.Client) error {
+	if len(facts) == 0 {
+		return nil
+	}
+	collection := getSegmentFactsCollection(client)
+
+	models := make([]mongo.WriteModel, 0, len(facts))
+	for _, fact := range facts {
+		filter := bson.M{
+			"cik":             fact.CIK,
+			"accessionNumber": fact.AccessionNumber,
+			"concept":         fact.Concept,
+			"dimensionsKey":   fact.DimensionsKey,
+			"periodStart":     fact.PeriodStart,
+			"periodEnd":       fact.PeriodEnd,
+			"unit":            fact.Unit,
+		}
+		models = append(models, mongo.NewReplaceOneModel().SetFilter(filter).SetReplacement(fact).SetUpsert(true))
+	}
+
+	_, err := collection.BulkWrite(context.Background(), models, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return fmt.Errorf("failed to store dimensional facts: %v", err)
+	}
+	return nil
+}
+
+// RetrieveDimensionalFactsFromMongoDB returns every dimensional fact of the CIK, optionally only the given concept
+func RetrieveDimensionalFactsFromMongoDB(CIK string, concept string, client *mongo.Client) ([]DimensionalFact, error) {
+	collection := getSegmentFactsCollection(client)
+	filter := bson.M{"cik": CIK}
+	if concept != "" {
+		filter["concept"] = concept
+	}
+
+	ctx := context.Background()
+	cursor, err := collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var facts []DimensionalFact
+	if err := cursor.All(ctx, &facts); err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+// BuildSegmentTimeSeries groups facts by concept and dimensions, when several filings report the same period
+// the value of the most recent filing wins so restated numbers replace the originals
+func BuildSegmentTimeSeries(facts []DimensionalFact) []SegmentTimeSeries {
+	type seriesKey struct {
+		concept       string
+		dimensionsKey string
+		unit          string
+	}
+	seriesByKey := make(map[seriesKey]*SegmentTimeSeries)
+	filingPeriodEndOfValue := make(map[seriesKey]map[SegmentPeriod]string)
+
+	for _, fact := range facts {
+		key := seriesKey{fact.Concept, fact.DimensionsKey, fact.Unit}
+		series, ok := seriesByKey[key]
+		if !ok {
+			series = &SegmentTimeSeries{
+				Concept:    fact.Concept,
+				Dimensions: fact.Dimensions,
+				Unit:       fact.Unit,
+				Values:     make(map[SegmentPeriod]string),
+			}
+			seriesByKey[key] = series
+			filingPeriodEndOfValue[key] = make(map[SegmentPeriod]string)
+		}
+
+		period := SegmentPeriod{PeriodEnd: fact.PeriodEnd, DurationInMonths: fact.DurationInMonths}
+		if _, exists := series.Values[period]; exists && fact.FilingPeriodEnd < filingPeriodEndOfValue[key][period] {
+			continue
+		}
+		series.Values[period] = fact.Value
+		filingPeriodEndOfValue[key][period] = fact.FilingPeriodEnd
+	}
+
+	allSeries := make([]SegmentTimeSeries, 0, len(seriesByKey))
+	for _, series := range seriesByKey {
+		allSeries = append(allSeries, *series)
+	}
+	sort.Slice(allSeries, func(i, j int) bool {
+		if allSeries[i].Concept != allSeries[j].Concept {
+			return allSeries[i].Concept < allSeries[j].Concept
+		}
+		return DimensionsKey(allSeries[i].Dimensions) < DimensionsKey(allSeries[j].Dimensions)
+	})
+	return allSeries
+}
+
+// SegmentTimeSeriesTo2Darray lays the series out like the combined statements: reportPeriod and reportDurationInMonths rows on top,
+// then one row per series with its concept, axes, members and unit in the first four columns
+func SegmentTimeSeriesTo2Darray(allSeries []SegmentTimeSeries) [][]string {
+	periodSet := make(map[SegmentPeriod]bool)
+	for _, series := range allSeries {
+		for period := range series.Values {
+			periodSet[period] = true
+		}
+	}
+	periods := make([]SegmentPeriod, 0, len(periodSet))
+	for period := range periodSet {
+		periods = append(periods, period)
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		if periods[i].DurationInMonths != periods[j].DurationInMonths {
+			return periods[i].DurationInMonths < periods[j].DurationInMonths
+		}
+		return periods[i].PeriodEnd < periods[j].PeriodEnd
+	})
+
+	reportPeriodRow := []string{"reportPeriod", "", "", ""}
+	reportDurationRow := []string{"reportDurationInMonths", "", "", ""}
+	for _, period := range periods {
+		reportPeriodRow = append(reportPeriodRow, period.PeriodEnd)
+		reportDurationRow = append(reportDurationRow, strconv.Itoa(period.DurationInMonths))
+	}
+	array := [][]string{
+		reportPeriodRow,
+		reportDurationRow,
+		append([]string{"concept", "axis", "member", "unit"}, make([]string, len(periods))...),
+	}
+
+	for _, series := range allSeries {
+		axes := make([]string, len(series.Dimensions))
+		members := make([]string, len(series.Dimensions))
+		for i, dimension := range series.Dimensions {
+			axes[i] = dimension.Axis
+			members[i] = dimension.Member
+		}
+		row := []string{series.Concept, strings.Join(axes, ";"), strings.Join(members, ";"), series.Unit}
+		for _, period := range periods {
+			row = append(row, series.Values[period])
+		}
+		array = append(array, row)
+	}
+	return array
+}
+
+// GenerateSegmentTimeSeriesAndSaveAsCsvFileGivenCIK saves every segment series of the CIK to SEC-files/combinedFinancialStatements
+func GenerateSegmentTimeSeriesAndSaveAsCsvFileGivenCIK(CIK string, concept string, client *mongo.Client) ([]SegmentTimeSeries, error) {
+	facts, err := RetrieveDimensionalFactsFromMongoDB(CIK, concept, client)
+	if err != nil {
+		return nil, err
+	}
+	allSeries := BuildSegmentTimeSeries(facts)
+
+	key := storage.CombinedStatementKey(CIK + "_segmentTimeSeries.csv")
+	if err := storage.PutCsv(storage.SECFiles, key, SegmentTimeSeriesTo2Darray(allSeries)); err != nil {
+		return allSeries, err
+	}
+	fmt.Printf("Successfully saved %d segment series to %s\n", len(allSeries), key)
+	return allSeries, nil
+}
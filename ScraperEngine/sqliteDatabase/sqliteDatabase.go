@@ -0,0 +1,107 @@
+// SQLite database for single machine deployments, DATABASE_BACKEND=sqlite keeps the filing metadata, the pipeline state,
+// the combined statements and their TTM in one file instead of Mongo so the scraper and the Backend run without Atlas
+package sqlitedatabase
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	_ "modernc.org/sqlite"
+)
+
+// schema is created on Open, every statement can run again on an existing database
+var schema = []string{
+	// one row per 10-K/10-Q, has_filing_summary is NULL until index.json of the filing was checked
+	`CREATE TABLE IF NOT EXISTS filings (
+		accession_number TEXT PRIMARY KEY,
+		cik TEXT NOT NULL,
+		filing_date TEXT NOT NULL DEFAULT '',
+		report_date TEXT NOT NULL DEFAULT '',
+		acceptance_date_time TEXT NOT NULL DEFAULT '',
+		act TEXT NOT NULL DEFAULT '',
+		form TEXT NOT NULL DEFAULT '',
+		file_number TEXT NOT NULL DEFAULT '',
+		film_number TEXT NOT NULL DEFAULT '',
+		items TEXT NOT NULL DEFAULT '',
+		size TEXT NOT NULL DEFAULT '',
+		has_filing_summary INTEGER,
+		classification_rules_version TEXT NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS filings_cik_report_date ON filings (cik, report_date)`,
+	// the R file of each financial statement (BS, IS, CIS, CF) of a filing
+	`CREATE TABLE IF NOT EXISTS filing_rfiles (
+		accession_number TEXT NOT NULL REFERENCES filings (accession_number) ON DELETE CASCADE,
+		financial_statement_type TEXT NOT NULL,
+		file_name TEXT NOT NULL,
+		long_name TEXT NOT NULL DEFAULT '',
+		short_name TEXT NOT NULL DEFAULT '',
+		menu_category TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (accession_number, financial_statement_type)
+	)`,
+	// what the stages found out about a filing (balanceSheetValidation, reconciliation, detailRfiles), extended JSON by name
+	`CREATE TABLE IF NOT EXISTS filing_reports (
+		accession_number TEXT NOT NULL REFERENCES filings (accession_number) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		report TEXT NOT NULL,
+		PRIMARY KEY (accession_number, name)
+	)`,
+	// how far every filing got through the stages of the orchestrator, the row with an empty accession_number is a failure of the whole CIK
+	`CREATE TABLE IF NOT EXISTS pipeline_state (
+		cik TEXT NOT NULL,
+		accession_number TEXT NOT NULL,
+		stage TEXT NOT NULL DEFAULT '',
+		failed_stage TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		skipped TEXT NOT NULL DEFAULT '',
+		updated_at TEXT NOT NULL,
+		PRIMARY KEY (cik, accession_number)
+	)`,
+	// the published combined statements the Backend serves, columns, data and provenance are JSON
+	`CREATE TABLE IF NOT EXISTS combined_financial_statements (
+		cik TEXT NOT NULL,
+		financial_statement_type TEXT NOT NULL,
+		level INTEGER NOT NULL,
+		columns TEXT NOT NULL,
+		data TEXT NOT NULL,
+		provenance TEXT NOT NULL,
+		generated_at TEXT NOT NULL,
+		PRIMARY KEY (cik, financial_statement_type)
+	)`,
+	// the TTM income statement and cash flow statement the Backend serves, data and gaps are JSON
+	`CREATE TABLE IF NOT EXISTS trailing_twelve_months (
+		cik TEXT NOT NULL,
+		financial_statement_type TEXT NOT NULL,
+		data TEXT NOT NULL,
+		gaps TEXT NOT NULL,
+		updated_at TEXT NOT NULL,
+		PRIMARY KEY (cik, financial_statement_type)
+	)`,
+}
+
+// PathFromEnv is SQLITE_PATH or financialData.db in the working directory
+func PathFromEnv() string {
+	if path := os.Getenv("SQLITE_PATH"); path != "" {
+		return path
+	}
+	return "financialData.db"
+}
+
+// Open opens the database file, creating it and its tables when they don't exist yet.
+// The stages write from many goroutines, one connection makes them take turns instead of failing with SQLITE_BUSY
+func Open(path string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+
+	for _, statement := range schema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("error creating the schema of %s: %w", path, err)
+		}
+	}
+	return db, nil
+}
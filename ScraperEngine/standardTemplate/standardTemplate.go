@@ -0,0 +1,135 @@
+// The standardized chart of accounts every company is mapped to for the Level 3 statements.
+// Each template line lists the XBRL concepts and the words looked for in the line item names that belong to it,
+// line items that match no line go to the "other" line of their section.
+// The default template is embedded in the binary, set STANDARD_TEMPLATE_FILE to load it from a JSON file instead
+package standardtemplate
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+//go:embed defaultStandardTemplate.json
+var defaultStandardTemplateJson []byte
+
+// TemplateLine is one row of a Level 3 statement
+// Total lines and stock items (per share amounts, share counts, cash balances) take the first matching line item instead of the sum
+type TemplateLine struct {
+	ID             string     `json:"id"`
+	Label          string     `json:"label"`
+	Section        string     `json:"section"`
+	Concepts       []string   `json:"concepts"`       // eg) us-gaap:AccountsReceivableNetCurrent
+	Terms          []string   `json:"terms"`          // case and space insensitive, any of them
+	WordsInOrder   [][]string `json:"wordsInOrder"`   // any of the lists, the words of a list in that order
+	ExclusionTerms []string   `json:"exclusionTerms"` // a line item name with any of them never matches by name
+	Total          bool       `json:"total"`          // closes its section, the line items after it belong to the next section
+	StockItem      bool       `json:"stockItem"`
+	Other          bool       `json:"other"` // collects the line items of its section that match no other line
+}
+
+// StatementTemplate lists the sections in the order they appear in the statement and the lines of all of them
+type StatementTemplate struct {
+	Sections []string       `json:"sections"`
+	Lines    []TemplateLine `json:"lines"`
+}
+
+type StandardTemplate struct {
+	Version           string            `json:"version"`
+	BalanceSheet      StatementTemplate `json:"balanceSheet"`
+	IncomeStatement   StatementTemplate `json:"incomeStatement"`
+	CashFlowStatement StatementTemplate `json:"cashFlowStatement"`
+}
+
+var (
+	loadedTemplate     StandardTemplate
+	loadedTemplateErr  error
+	loadedTemplateOnce sync.Once
+)
+
+// LoadStandardTemplate reads the template file once and keeps it in memory for the rest of the run
+func LoadStandardTemplate() (StandardTemplate, error) {
+	loadedTemplateOnce.Do(func() {
+		loadedTemplate, loadedTemplateErr = ReadStandardTemplate(os.Getenv("STANDARD_TEMPLATE_FILE"))
+	})
+	return loadedTemplate, loadedTemplateErr
+}
+
+// ReadStandardTemplate parses a template file, an empty filePath returns the embedded default template
+func ReadStandardTemplate(filePath string) (StandardTemplate, error) {
+	data := defaultStandardTemplateJson
+	if filePath != "" {
+		fileData, err := os.ReadFile(filePath)
+		if err != nil {
+			return StandardTemplate{}, fmt.Errorf("error reading standard template file %s: %w", filePath, err)
+		}
+		data = fileData
+	}
+
+	var template StandardTemplate
+	if err := json.Unmarshal(data, &template); err != nil {
+		return StandardTemplate{}, fmt.Errorf("error parsing standard template: %w", err)
+	}
+	if template.Version == "" {
+		return StandardTemplate{}, fmt.Errorf("standard template has no version")
+	}
+	for name, statementTemplate := range map[string]StatementTemplate{
+		"balanceSheet":      template.BalanceSheet,
+		"incomeStatement":   template.IncomeStatement,
+		"cashFlowStatement": template.CashFlowStatement,
+	} {
+		if err := statementTemplate.validate(); err != nil {
+			return StandardTemplate{}, fmt.Errorf("standard template %s: %w", name, err)
+		}
+	}
+	return template, nil
+}
+
+// every section needs exactly one other line so no line item is dropped, ids have to be unique within a statement
+func (statementTemplate StatementTemplate) validate() error {
+	if len(statementTemplate.Sections) == 0 {
+		return fmt.Errorf("no sections")
+	}
+	otherLinesOf := make(map[string]int)
+	ids := make(map[string]bool)
+	for _, line := range statementTemplate.Lines {
+		if ids[line.ID] {
+			return fmt.Errorf("duplicate line id %q", line.ID)
+		}
+		ids[line.ID] = true
+		if statementTemplate.SectionIndex(line.Section) == -1 {
+			return fmt.Errorf("line %q has unknown section %q", line.ID, line.Section)
+		}
+		if line.Other {
+			otherLinesOf[line.Section]++
+		}
+	}
+	for _, section := range statementTemplate.Sections {
+		if otherLinesOf[section] != 1 {
+			return fmt.Errorf("section %q has %d other lines, want 1", section, otherLinesOf[section])
+		}
+	}
+	return nil
+}
+
+// SectionIndex returns the position of the section in Sections, -1 if there is no such section
+func (statementTemplate StatementTemplate) SectionIndex(section string) int {
+	for i, name := range statementTemplate.Sections {
+		if name == section {
+			return i
+		}
+	}
+	return -1
+}
+
+// OtherLineIndex returns the index in Lines of the other line of the section
+func (statementTemplate StatementTemplate) OtherLineIndex(section string) int {
+	for i, line := range statementTemplate.Lines {
+		if line.Other && line.Section == section {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// LocalStore keeps the files in a directory, Root can be relative to the working directory
+type LocalStore struct {
+	Root string
+}
+
+func NewLocalStore(root string) *LocalStore {
+	return &LocalStore{Root: root}
+}
+
+func (store *LocalStore) filePath(key string) string {
+	return filepath.Join(store.Root, filepath.FromSlash(key))
+}
+
+func (store *LocalStore) Get(key string) ([]byte, error) {
+	data, err := os.ReadFile(store.filePath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotExist
+	}
+	return data, err
+}
+
+// Put creates the directories of the file when they don't exist yet
+func (store *LocalStore) Put(key string, data []byte) error {
+	filePath := store.filePath(key)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, data, 0644)
+}
+
+func (store *LocalStore) Exists(key string) (bool, error) {
+	fileInfo, err := os.Stat(store.filePath(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !fileInfo.IsDir(), nil
+}
+
+// List returns no keys when the directory doesn't exist
+func (store *LocalStore) List(prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(store.filePath(prefix), func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relativePath, err := filepath.Rel(store.Root, filePath)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, filepath.ToSlash(relativePath))
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
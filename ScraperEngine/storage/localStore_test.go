@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	store := NewLocalStore(t.TempDir())
+
+	key := CombinedStatementKey("0001837014_combinedBalanceSheetLevel1.csv")
+	array := [][]string{{"accessionNumber", "0001837014-24-000010"}, {"separator"}, {"Cash, and cash equivalents", "1,234"}}
+	if err := PutCsv(store, key, array); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(FilingKey("0001837014", "0001837014-24-000010", "R2.htm"), []byte("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetCsv(store, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, array) {
+		t.Errorf("got %v, want %v", got, array)
+	}
+	if exists, err := store.Exists(key); err != nil || !exists {
+		t.Errorf("Exists = %v, %v, want true", exists, err)
+	}
+	if exists, err := store.Exists("combinedFinancialStatements"); err != nil || exists {
+		t.Errorf("Exists of a directory = %v, %v, want false", exists, err)
+	}
+	if _, err := store.Get("combinedFinancialStatements/missing.csv"); !errors.Is(err, ErrNotExist) {
+		t.Errorf("Get of a missing key = %v, want ErrNotExist", err)
+	}
+
+	keys, err := store.List("filingSummaryAndRfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"filingSummaryAndRfiles/0001837014/0001837014-24-000010/R2.htm"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("List = %v, want %v", keys, want)
+	}
+	if keys, err := store.List("submissions"); err != nil || keys != nil {
+		t.Errorf("List of a missing directory = %v, %v, want nothing", keys, err)
+	}
+}
@@ -0,0 +1,271 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Store keeps the files in a bucket of S3 or any S3 compatible service (MinIO, R2, ...).
+// Requests are signed with Signature Version 4 and sent path style, Endpoint/Bucket/Key, which every one of them takes
+type S3Store struct {
+	Endpoint        string // eg) https://s3.us-east-1.amazonaws.com or http://localhost:9000
+	Bucket          string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Prefix          string // keys are saved under Prefix/ when it is set so a bucket can hold more than the SEC-files tree
+	HTTPClient      *http.Client
+}
+
+// NewS3StoreFromEnv reads the store from SEC_FILES_S3_ENDPOINT, SEC_FILES_S3_BUCKET, SEC_FILES_S3_REGION (us-east-1 by default),
+// SEC_FILES_S3_PREFIX and the credentials from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY
+func NewS3StoreFromEnv() (*S3Store, error) {
+	store := &S3Store{
+		Endpoint:        os.Getenv("SEC_FILES_S3_ENDPOINT"),
+		Bucket:          os.Getenv("SEC_FILES_S3_BUCKET"),
+		Region:          os.Getenv("SEC_FILES_S3_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		Prefix:          os.Getenv("SEC_FILES_S3_PREFIX"),
+	}
+	if store.Region == "" {
+		store.Region = "us-east-1"
+	}
+	if store.Endpoint == "" {
+		store.Endpoint = "https://s3." + store.Region + ".amazonaws.com"
+	}
+	if store.Bucket == "" {
+		return nil, fmt.Errorf("SEC_FILES_S3_BUCKET is required for the s3 store")
+	}
+	if store.AccessKeyID == "" || store.SecretAccessKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for the s3 store")
+	}
+	return store, nil
+}
+
+func (store *S3Store) objectKey(key string) string {
+	if store.Prefix == "" {
+		return key
+	}
+	return strings.TrimSuffix(store.Prefix, "/") + "/" + key
+}
+
+func (store *S3Store) Get(key string) ([]byte, error) {
+	resp, err := store.do(http.MethodGet, store.objectKey(key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotExist
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError("GET", key, resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+func (store *S3Store) Put(key string, data []byte) error {
+	resp, err := store.do(http.MethodPut, store.objectKey(key), nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError("PUT", key, resp)
+	}
+	return nil
+}
+
+func (store *S3Store) Exists(key string) (bool, error) {
+	resp, err := store.do(http.MethodHead, store.objectKey(key), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, responseError("HEAD", key, resp)
+	}
+}
+
+// listBucketResult is the part of the ListObjectsV2 response the store needs
+type listBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List pages through ListObjectsV2, 1000 keys a page
+func (store *S3Store) List(prefix string) ([]string, error) {
+	objectPrefix := store.objectKey(prefix)
+	if objectPrefix != "" && !strings.HasSuffix(objectPrefix, "/") {
+		objectPrefix += "/"
+	}
+
+	var keys []string
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {objectPrefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		resp, err := store.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := responseError("LIST", prefix, resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error decoding the list of %s: %w", prefix, err)
+		}
+
+		for _, content := range result.Contents {
+			key := content.Key
+			if store.Prefix != "" {
+				key = strings.TrimPrefix(key, strings.TrimSuffix(store.Prefix, "/")+"/")
+			}
+			keys = append(keys, key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func responseError(operation string, key string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("s3 %s %s: status %d: %s", operation, key, resp.StatusCode, strings.TrimSpace(string(body)))
+}
+
+// do sends a signed request for the object key, an empty object key is a request on the bucket
+func (store *S3Store) do(method string, objectKey string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(store.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint %q: %w", store.Endpoint, err)
+	}
+	requestPath := "/" + store.Bucket
+	if objectKey != "" {
+		requestPath += "/" + objectKey
+	}
+	requestURL := &url.URL{
+		Scheme:   endpoint.Scheme,
+		Host:     endpoint.Host,
+		Path:     requestPath,
+		RawPath:  uriEncode(requestPath, false),
+		RawQuery: canonicalQueryString(query),
+	}
+
+	req, err := http.NewRequest(method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	store.sign(req, requestURL, body, time.Now().UTC())
+
+	httpClient := store.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return httpClient.Do(req)
+}
+
+// sign adds the Signature Version 4 Authorization header,
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (store *S3Store) sign(req *http.Request, requestURL *url.URL, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		requestURL.RawPath,
+		requestURL.RawQuery,
+		"host:" + requestURL.Host + "\n" + "x-amz-content-sha256:" + payloadHash + "\n" + "x-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + store.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+store.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, store.Region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		store.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQueryString sorts the parameters and encodes them the way Signature Version 4 expects, url.Values.Encode uses + for spaces
+func canonicalQueryString(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parameters []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parameters = append(parameters, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parameters, "&")
+}
+
+// uriEncode percent encodes everything but the unreserved characters, and / unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var builder strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			builder.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			builder.WriteByte(b)
+		default:
+			fmt.Fprintf(&builder, "%%%02X", b)
+		}
+	}
+	return builder.String()
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
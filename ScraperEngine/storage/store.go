@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// Everything the scraper downloads and generates lives in the SEC-files tree:
+//   filingSummaryAndRfiles/<CIK>/<accessionNumber>/  FilingSummary.xml, index.json, R files and their CSVs, XBRL instances
+//   combinedFinancialStatements/                     combined statements, mappings and reports of every CIK
+//   submissions/, indexConstituents/, company_tickers.json
+// The stages read and write it through a Store so it can be a local directory or a bucket shared by many machines.
+// Keys are slash separated paths relative to the root of the tree, eg) combinedFinancialStatements/0001837014_combinedBalanceSheetLevel1.csv
+
+// Store holds the files of the SEC-files tree
+type Store interface {
+	// Get returns the content of the file, ErrNotExist when there is none
+	Get(key string) ([]byte, error)
+	// Put creates or replaces the file
+	Put(key string, data []byte) error
+	Exists(key string) (bool, error)
+	// List returns the keys of every file under the directory prefix, subdirectories included, sorted
+	List(prefix string) ([]string, error)
+}
+
+// ErrNotExist is returned by Get when the file isn't in the store
+var ErrNotExist = errors.New("file does not exist in the store")
+
+// SECFiles is the store every stage uses, the local SEC-files directory until ConfigureFromEnv says otherwise
+var SECFiles Store = NewLocalStore("SEC-files")
+
+// ConfigureFromEnv sets SECFiles from SEC_FILES_STORE, "local" (default) is the directory SEC_FILES_DIR or SEC-files,
+// "s3" is the bucket SEC_FILES_S3_BUCKET of any S3 compatible service, see NewS3StoreFromEnv
+func ConfigureFromEnv() error {
+	switch strings.ToLower(os.Getenv("SEC_FILES_STORE")) {
+	case "", "local":
+		root := os.Getenv("SEC_FILES_DIR")
+		if root == "" {
+			root = "SEC-files"
+		}
+		SECFiles = NewLocalStore(root)
+	case "s3":
+		store, err := NewS3StoreFromEnv()
+		if err != nil {
+			return err
+		}
+		SECFiles = store
+	default:
+		return fmt.Errorf("unknown SEC_FILES_STORE %q, expected local or s3", os.Getenv("SEC_FILES_STORE"))
+	}
+	return nil
+}
+
+// FilingKey is the key of a file of one filing, eg) FilingSummary.xml or R2.htm
+func FilingKey(CIK string, accessionNumber string, fileName string) string {
+	return path.Join(FilingPrefix(CIK, accessionNumber), fileName)
+}
+
+// FilingPrefix is the directory of the files of one filing
+func FilingPrefix(CIK string, accessionNumber string) string {
+	return path.Join("filingSummaryAndRfiles", CIK, accessionNumber)
+}
+
+// CombinedStatementKey is the key of a file of the combinedFinancialStatements directory
+func CombinedStatementKey(fileName string) string {
+	return path.Join("combinedFinancialStatements", fileName)
+}
+
+// GetCsv reads a CSV file of the store, rows can have different numbers of fields
+func GetCsv(store Store, key string) ([][]string, error) {
+	data, err := store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return records, nil
+}
+
+// PutCsv saves the 2D array as a CSV file of the store
+func PutCsv(store Store, key string, array [][]string) error {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	if err := writer.WriteAll(array); err != nil {
+		return fmt.Errorf("error writing %s: %w", key, err)
+	}
+	return store.Put(key, buffer.Bytes())
+}
@@ -12,3 +12,27 @@ func GetMongoDBCollection(client *mongo.Client) *mongo.Collection {
 	collectionName := os.Getenv("10K10QMetaDataCollection")
 	return client.Database(databaseName).Collection(collectionName)
 }
+
+// GetMongoDBCollectionByName returns the collection named by the environment variable, or defaultCollectionName if the variable is not set
+func GetMongoDBCollectionByName(client *mongo.Client, collectionEnvVariable string, defaultCollectionName string) *mongo.Collection {
+	databaseName := os.Getenv("DATABASE_NAME")
+	collectionName := os.Getenv(collectionEnvVariable)
+	if collectionName == "" {
+		collectionName = defaultCollectionName
+	}
+	return client.Database(databaseName).Collection(collectionName)
+}
+
+// GetPublishedMongoDBCollectionByName returns a collection of the database the Backend serves the website from,
+// PUBLISHED_DATABASE_NAME or testDatabase2 which is what the Backend reads
+func GetPublishedMongoDBCollectionByName(client *mongo.Client, collectionEnvVariable string, defaultCollectionName string) *mongo.Collection {
+	databaseName := os.Getenv("PUBLISHED_DATABASE_NAME")
+	if databaseName == "" {
+		databaseName = "testDatabase2"
+	}
+	collectionName := os.Getenv(collectionEnvVariable)
+	if collectionName == "" {
+		collectionName = defaultCollectionName
+	}
+	return client.Database(databaseName).Collection(collectionName)
+}